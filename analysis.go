@@ -0,0 +1,242 @@
+package mexpr
+
+import "strings"
+
+// Truth describes whether an expression's result depends on its input, see
+// `Truthiness`.
+type Truth uint8
+
+// Possible truth values
+const (
+	// TruthDepends means the result depends on the input.
+	TruthDepends Truth = iota
+
+	// TruthAlways means the expression is always truthy, like `1 == 1 or x > 2`.
+	TruthAlways
+
+	// TruthNever means the expression is never truthy, like `x > 5 and x < 3`.
+	// It may still return an error, e.g. if `x` is not a number.
+	TruthNever
+)
+
+func (t Truth) String() string {
+	switch t {
+	case TruthAlways:
+		return "always"
+	case TruthNever:
+		return "never"
+	}
+	return "depends"
+}
+
+// Truthiness analyzes whether an expression is always or never true
+// regardless of its input, which is useful to warn users before saving
+// filters which match everything or nothing. Parts of the expression without
+// any properties are evaluated, while comparisons of the same property joined
+// by `and` are checked for contradictions like `x > 5 and x < 3` or
+// `status == "a" and status == "b"`. Pass the same options used to run the
+// expression. The analysis is conservative, so `TruthDepends` may also be
+// returned for expressions which are constant in ways it can't detect.
+func Truthiness(ast *Node, options ...InterpreterOption) Truth {
+	if ast == nil {
+		return TruthDepends
+	}
+	c := newConfig(options)
+	switch ast.Type {
+	case NodeAnd:
+		conjuncts := flattenAnd(ast, nil)
+		always := true
+		for _, conjunct := range conjuncts {
+			switch Truthiness(conjunct, options...) {
+			case TruthNever:
+				return TruthNever
+			case TruthDepends:
+				always = false
+			}
+		}
+		if always {
+			return TruthAlways
+		}
+		if contradicts(conjuncts, &c) {
+			return TruthNever
+		}
+		return TruthDepends
+	case NodeOr:
+		left, right := Truthiness(ast.Left, options...), Truthiness(ast.Right, options...)
+		if left == TruthAlways || right == TruthAlways {
+			return TruthAlways
+		}
+		if left == TruthNever && right == TruthNever {
+			return TruthNever
+		}
+		return TruthDepends
+	case NodeNot:
+		switch Truthiness(ast.Right, options...) {
+		case TruthAlways:
+			return TruthNever
+		case TruthNever:
+			return TruthAlways
+		}
+		return TruthDepends
+	}
+	if !static(ast) {
+		return TruthDepends
+	}
+	result, err := Run(ast, nil, options...)
+	if err != nil {
+		return TruthDepends
+	}
+	if toBool(result) {
+		return TruthAlways
+	}
+	return TruthNever
+}
+
+// static returns whether a node's result doesn't depend on the input, i.e.
+// it doesn't use any properties.
+func static(ast *Node) bool {
+	if ast == nil {
+		return true
+	}
+	if ast.Type == NodeIdentifier {
+		return false
+	}
+	for _, arg := range ast.Args {
+		if !static(arg) {
+			return false
+		}
+	}
+	return static(ast.Left) && static(ast.Right)
+}
+
+// flattenAnd returns the conditions joined by `and`, e.g. `a`, `b`, and `c`
+// for `a and b and c`.
+func flattenAnd(ast *Node, conjuncts []*Node) []*Node {
+	if ast.Type == NodeAnd {
+		return flattenAnd(ast.Right, flattenAnd(ast.Left, conjuncts))
+	}
+	return append(conjuncts, ast)
+}
+
+// bounds are the values a property may have based on comparisons with
+// literals.
+type bounds struct {
+	lower, upper         float64
+	hasLower, hasUpper   bool
+	lowerOpen, upperOpen bool
+	equal                any
+	hasEqual             bool
+	notEqual             []any
+}
+
+// contradicts returns whether the comparisons of properties with literals in
+// a list of conditions which must all be true can't all be true at once.
+func contradicts(conjuncts []*Node, c *config) bool {
+	properties := map[string]*bounds{}
+	for _, conjunct := range conjuncts {
+		op, path, literal, ok := comparison(conjunct)
+		if !ok {
+			continue
+		}
+		b := properties[path]
+		if b == nil {
+			b = &bounds{}
+			properties[path] = b
+		}
+		value, ok := literalKey(literal, c)
+		if !ok {
+			continue
+		}
+		switch op {
+		case NodeEqual:
+			if b.hasEqual && !deepEqual(b.equal, value) {
+				return true
+			}
+			b.equal, b.hasEqual = value, true
+		case NodeNotEqual:
+			b.notEqual = append(b.notEqual, value)
+		default:
+			n, isNum := value.(float64)
+			if !isNum {
+				continue
+			}
+			switch op {
+			case NodeGreaterThan, NodeGreaterThanEqual:
+				if !b.hasLower || n > b.lower || (n == b.lower && op == NodeGreaterThan) {
+					b.lower, b.hasLower, b.lowerOpen = n, true, op == NodeGreaterThan
+				}
+			case NodeLessThan, NodeLessThanEqual:
+				if !b.hasUpper || n < b.upper || (n == b.upper && op == NodeLessThan) {
+					b.upper, b.hasUpper, b.upperOpen = n, true, op == NodeLessThan
+				}
+			}
+		}
+	}
+	for _, b := range properties {
+		if b.hasLower && b.hasUpper && (b.lower > b.upper || (b.lower == b.upper && (b.lowerOpen || b.upperOpen))) {
+			return true
+		}
+		if !b.hasEqual {
+			continue
+		}
+		for _, v := range b.notEqual {
+			if deepEqual(b.equal, v) {
+				return true
+			}
+		}
+		if n, ok := b.equal.(float64); ok {
+			if b.hasLower && (n < b.lower || (n == b.lower && b.lowerOpen)) {
+				return true
+			}
+			if b.hasUpper && (n > b.upper || (n == b.upper && b.upperOpen)) {
+				return true
+			}
+		} else if b.hasLower || b.hasUpper {
+			// A non-number can't be compared with numbers.
+			return true
+		}
+	}
+	return false
+}
+
+// comparison returns the parts of a comparison between a property and a
+// literal, like `x > 5`. Comparisons with the literal on the left like
+// `5 < x` are flipped.
+func comparison(ast *Node) (NodeType, string, *Node, bool) {
+	flipped := map[NodeType]NodeType{
+		NodeEqual:            NodeEqual,
+		NodeNotEqual:         NodeNotEqual,
+		NodeLessThan:         NodeGreaterThan,
+		NodeLessThanEqual:    NodeGreaterThanEqual,
+		NodeGreaterThan:      NodeLessThan,
+		NodeGreaterThanEqual: NodeLessThanEqual,
+	}
+	op, ok := flipped[ast.Type]
+	if !ok {
+		return 0, "", nil, false
+	}
+	if path := propertyPath(ast.Left); path != nil && ast.Right.Type == NodeLiteral {
+		return ast.Type, strings.Join(path, "."), ast.Right, true
+	}
+	if path := propertyPath(ast.Right); path != nil && ast.Left.Type == NodeLiteral {
+		return op, strings.Join(path, "."), ast.Left, true
+	}
+	return 0, "", nil, false
+}
+
+// literalKey returns a literal's value for comparisons, with numbers as
+// floats and strings folded when using `FoldStrings`.
+func literalKey(literal *Node, c *config) (any, bool) {
+	switch v := literal.Value.(type) {
+	case string:
+		if c.foldStrings {
+			return foldString(v), true
+		}
+		return v, true
+	}
+	if isNumber(literal.Value) {
+		f, _ := toNumber(literal, literal.Value)
+		return f, true
+	}
+	return nil, false
+}
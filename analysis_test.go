@@ -0,0 +1,44 @@
+package mexpr
+
+import "testing"
+
+func TestTruthiness(t *testing.T) {
+	cases := []struct {
+		expr     string
+		opts     []InterpreterOption
+		expected Truth
+	}{
+		{expr: `1 == 1 or x > 2`, expected: TruthAlways},
+		{expr: `x > 5 and x < 3`, expected: TruthNever},
+		{expr: `x > 5 and y < 3`, expected: TruthDepends},
+		{expr: `x >= 5 and x <= 5`, expected: TruthDepends},
+		{expr: `x > 5 and x <= 5`, expected: TruthNever},
+		{expr: `3 > x and x > 5`, expected: TruthNever},
+		{expr: `a.b == "x" and a.b == "y"`, expected: TruthNever},
+		{expr: `a.b == "x" and a.b == "X"`, opts: []InterpreterOption{FoldStrings}, expected: TruthDepends},
+		{expr: `status == "x" and status != "x"`, expected: TruthNever},
+		{expr: `n == 4 and n > 10`, expected: TruthNever},
+		{expr: `n == 4 and n > 1 and n < 10`, expected: TruthDepends},
+		{expr: `n == "a" and n > 1`, expected: TruthNever},
+		{expr: `not (1 > 2) and "a" in ["a", "b"]`, expected: TruthAlways},
+		{expr: `1 > 2 or x == 1`, expected: TruthDepends},
+		{expr: `1 > 2 and x == 1`, expected: TruthNever},
+		{expr: `not (x > 5 and x < 3)`, expected: TruthAlways},
+		{expr: `(x > 5 and x < 3) or (y > 1 and 0 > 1)`, expected: TruthNever},
+		{expr: `"" or 0`, expected: TruthNever},
+		{expr: `x`, expected: TruthDepends},
+		{expr: `now > 1`, expected: TruthDepends},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil, tc.opts...)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			if truth := Truthiness(ast, tc.opts...); truth != tc.expected {
+				t.Fatalf("expected %s but found %s", tc.expected, truth)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package mexpr
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a thread-safe cache of parsed expressions, useful for servers which
+// evaluate many distinct user-provided filters. Every expression in the cache
+// is parsed, type checked, and run with the same types and options, so use a
+// separate cache for each set of options. Once the cache is full the least
+// recently used expression is evicted.
+//
+// Options which record per-run state, like `WithStats` and `WithTrace`,
+// should not be used with a cache shared between goroutines.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	types   any
+	options []InterpreterOption
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// cacheEntry is a parsed expression along with a pool of interpreters for it.
+// Parse errors are cached too so invalid expressions aren't parsed again.
+type cacheEntry struct {
+	expression string
+	ast        *Node
+	err        Error
+	pool       sync.Pool
+}
+
+// NewCache creates a cache which holds up to `size` expressions. If `types`
+// is passed, expressions are type checked against it like with `Parse`.
+func NewCache(size int, types any, options ...InterpreterOption) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:    size,
+		types:   types,
+		options: options,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Len returns the number of expressions in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// entry returns the cache entry for an expression, parsing it if needed.
+func (c *Cache) entry(expression string) *cacheEntry {
+	c.mu.Lock()
+	if el, ok := c.entries[expression]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*cacheEntry)
+	}
+	c.mu.Unlock()
+
+	// Parse without holding the lock so other expressions aren't blocked. If
+	// another goroutine parsed the same expression meanwhile, theirs is used.
+	e := &cacheEntry{expression: expression}
+	e.ast, e.err = Parse(expression, c.types, c.options...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[expression]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*cacheEntry)
+	}
+	c.entries[expression] = c.order.PushFront(e)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).expression)
+	}
+	return e
+}
+
+// Get returns a ready-to-run interpreter for the expression, which is only
+// parsed if it isn't already in the cache. The interpreter belongs to the
+// caller and, like all interpreters, is not safe for concurrent use.
+func (c *Cache) Get(expression string) (Interpreter, Error) {
+	e := c.entry(expression)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return NewInterpreter(e.ast, c.options...), nil
+}
+
+// Eval runs the expression with the given input, which is only parsed if it
+// isn't already in the cache. Interpreters are reused between calls, and it is
+// safe to call concurrently.
+func (c *Cache) Eval(expression string, input any) (any, Error) {
+	e := c.entry(expression)
+	if e.err != nil {
+		return nil, e.err
+	}
+	i, ok := e.pool.Get().(Interpreter)
+	if !ok {
+		i = NewInterpreter(e.ast, c.options...)
+	}
+	defer e.pool.Put(i)
+	return i.Run(input)
+}
@@ -0,0 +1,64 @@
+package mexpr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2, map[string]any{"a": 1.0}, StrictMode)
+
+	result, err := cache.Eval(`a + 1`, map[string]any{"a": 2.0})
+	if err != nil || result != 3.0 {
+		t.Fatalf("expected 3 but found %v (%v)", result, err)
+	}
+
+	i, err := cache.Get(`a + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := i.Run(map[string]any{"a": 5.0}); err != nil || result != 6.0 {
+		t.Fatalf("expected 6 but found %v (%v)", result, err)
+	}
+
+	// Parse and type errors are returned and cached.
+	if _, err := cache.Eval(`a +`, nil); err == nil || err.Kind() != KindSyntax {
+		t.Fatalf("expected syntax error but found %v", err)
+	}
+	if _, err := cache.Get(`b`); err == nil || err.Kind() != KindUnknownProperty {
+		t.Fatalf("expected unknown property error but found %v", err)
+	}
+
+	// The cache size is limited, evicting the least recently used.
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 entries but found %d", cache.Len())
+	}
+	if _, ok := cache.entries[`a + 1`]; ok {
+		t.Fatal("expected least recently used expression to be evicted")
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	cache := NewCache(8, nil)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				expr := fmt.Sprintf("items where @ > %d", n%16)
+				result, err := cache.Eval(expr, map[string]any{"items": []any{5.0, 10.0, 15.0}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(result.([]any)) != 3-n%16/5 {
+					t.Errorf("unexpected result %v for %s", result, expr)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,21 @@
+//go:build !mexpr_lite
+
+package mexpr
+
+import "net/netip"
+
+// inCidr returns whether the IP address is within the network given in CIDR
+// notation, e.g. `10.0.0.0/8`.
+func inCidr(ast *Node, address, network any) (any, Error) {
+	addr, err := netip.ParseAddr(toString(address))
+	if err != nil {
+		return nil, newNodeError(KindTypeMismatch, ast, "unable to convert %v to IP address", address)
+	}
+	prefix, err := netip.ParsePrefix(toString(network))
+	if err != nil {
+		return nil, newNodeError(KindTypeMismatch, ast, "unable to convert %v to CIDR", network)
+	}
+	// Match IPv4-mapped IPv6 addresses like `::ffff:10.0.0.1` against IPv4
+	// ranges.
+	return prefix.Masked().Contains(addr.Unmap()), nil
+}
@@ -0,0 +1,8 @@
+//go:build mexpr_lite
+
+package mexpr
+
+// inCidr is not available in builds with the `mexpr_lite` build tag.
+func inCidr(ast *Node, address, network any) (any, Error) {
+	return nil, newNodeError(KindRuntime, ast, "inCidr is not supported in this build")
+}
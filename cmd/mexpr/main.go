@@ -0,0 +1,144 @@
+// Command mexpr evaluates an expression against a JSON document read from
+// standard input or a file and prints the result, which is useful for testing
+// filters and in shell pipelines.
+//
+//	echo '{"items": [{"id": 1}, {"id": 5}]}' | mexpr 'items where id > 3'
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danielgtaylor/mexpr"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the given arguments and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mexpr", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: mexpr [flags] EXPRESSION")
+		fmt.Fprintln(stderr, "       mexpr -repl [-f file] [flags]")
+		fmt.Fprintln(stderr, "\nEvaluates EXPRESSION against a JSON document from stdin or a file.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	file := flags.String("f", "", "read the input document from `file` instead of stdin")
+	strict := flags.Bool("strict", false, "enable strict mode, e.g. error on missing properties")
+	unquoted := flags.Bool("unquoted", false, "enable unquoted strings")
+	output := flags.String("o", "json", "output `format`: json, pretty, or raw (strings without quotes)")
+	color := flags.Bool("color", false, "use terminal colors for errors")
+	trace := flags.Bool("trace", false, "log each evaluated node and its result to stderr")
+	interactive := flags.Bool("repl", false, "interactively evaluate expressions read from stdin")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (*interactive && flags.NArg() != 0) || (!*interactive && flags.NArg() != 1) {
+		flags.Usage()
+		return 2
+	}
+
+	switch *output {
+	case "json", "pretty", "raw":
+	default:
+		fmt.Fprintf(stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	options := []mexpr.InterpreterOption{}
+	if *strict {
+		options = append(options, mexpr.StrictMode)
+	}
+	if *unquoted {
+		options = append(options, mexpr.UnquotedStrings)
+	}
+	if *trace {
+		options = append(options, mexpr.WithTrace(stderr))
+	}
+
+	// In REPL mode stdin is used for expressions, so the input document can
+	// only come from a file.
+	var data []byte
+	var err error
+	if *file != "" {
+		data, err = os.ReadFile(*file)
+	} else if !*interactive {
+		data, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var input any
+	if len(bytes.TrimSpace(data)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// Keep large integers like IDs exact.
+		decoder.UseNumber()
+		if err := decoder.Decode(&input); err != nil {
+			fmt.Fprintf(stderr, "unable to parse input: %v\n", err)
+			return 1
+		}
+	}
+
+	p := &printer{stdout: stdout, stderr: stderr, format: *output, color: *color}
+	if *interactive {
+		return repl(stdin, p, input, options)
+	}
+	if !p.eval(flags.Arg(0), input, options) {
+		return 1
+	}
+	return 0
+}
+
+// printer writes results and errors in the selected output format.
+type printer struct {
+	stdout io.Writer
+	stderr io.Writer
+	format string
+	color  bool
+}
+
+// eval runs the expression and prints its result or error, returning whether
+// it was successful.
+func (p *printer) eval(expression string, input any, options []mexpr.InterpreterOption) bool {
+	result, err := mexpr.Eval(expression, input, options...)
+	if err != nil {
+		if p.color {
+			fmt.Fprintln(p.stderr, err.PrettyColor(expression))
+		} else {
+			fmt.Fprintln(p.stderr, err.Pretty(expression))
+		}
+		return false
+	}
+	return p.print(result)
+}
+
+// print writes a result to stdout.
+func (p *printer) print(result any) bool {
+	if s, ok := result.(string); ok && p.format == "raw" {
+		fmt.Fprintln(p.stdout, s)
+		return true
+	}
+	var encoded []byte
+	var err error
+	if p.format == "pretty" {
+		encoded, err = json.MarshalIndent(result, "", "  ")
+	} else {
+		encoded, err = json.Marshal(result)
+	}
+	if err != nil {
+		fmt.Fprintf(p.stderr, "unable to encode result: %v\n", err)
+		return false
+	}
+	fmt.Fprintln(p.stdout, string(encoded))
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		args   []string
+		input  string
+		code   int
+		output string
+		err    string
+	}{
+		{args: []string{"a + b"}, input: `{"a": 1, "b": 2}`, output: "3\n"},
+		{args: []string{"items where id > 3"}, input: `{"items": [{"id": 1}, {"id": 5}]}`, output: `[{"id":5}]` + "\n"},
+		{args: []string{"id"}, input: `{"id": 12345678901234567890}`, output: "12345678901234567890\n"},
+		{args: []string{"big == 9007199254740992"}, input: `{"big": 9007199254740993}`, output: "false\n"},
+		{args: []string{"big + 1"}, input: `{"big": 9007199254740993}`, output: "9007199254740994\n"},
+		{args: []string{"items where id == 9007199254740993"}, input: `{"items": [{"id": 9007199254740992}, {"id": 9007199254740993}]}`, output: `[{"id":9007199254740993}]` + "\n"},
+		{args: []string{"-o", "raw", "name"}, input: `{"name": "Alice"}`, output: "Alice\n"},
+		{args: []string{"name"}, input: `{"name": "Alice"}`, output: `"Alice"` + "\n"},
+		{args: []string{"-o", "pretty", "obj"}, input: `{"obj": {"a": 1}}`, output: "{\n  \"a\": 1\n}\n"},
+		{args: []string{"1 + 2"}, output: "3\n"},
+		{args: []string{"missing"}, input: `{}`, output: "null\n"},
+		{args: []string{"-strict", "missing"}, input: `{}`, code: 1, err: "cannot get missing"},
+		{args: []string{"-trace", "a > 1"}, input: `{"a": 2}`, output: "true\n", err: "  a => 2\n  1 => 1\n> => true\n"},
+		{args: []string{"-unquoted", "foo"}, input: `{}`, output: `"foo"` + "\n"},
+		{args: []string{"1 +"}, code: 1, err: "incomplete expression"},
+		{args: []string{"a"}, input: `{oops`, code: 1, err: "unable to parse input"},
+		{args: []string{"-o", "yaml", "a"}, code: 2, err: "unknown output format"},
+		{args: []string{}, code: 2, err: "Usage"},
+		{args: []string{"-repl", "a"}, code: 2, err: "Usage"},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			code := run(tc.args, strings.NewReader(tc.input), stdout, stderr)
+			if code != tc.code {
+				t.Fatalf("expected exit code %d but found %d: %s", tc.code, code, stderr.String())
+			}
+			if stdout.String() != tc.output {
+				t.Fatalf("expected output %q but found %q", tc.output, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tc.err) {
+				t.Fatalf("expected error containing %q but found %q", tc.err, stderr.String())
+			}
+		})
+	}
+}
+
+func TestREPL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "input.json")
+	if err := os.WriteFile(file, []byte(`{"items": [{"id": 1}, {"id": 5}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := strings.NewReader("items.length\n\nitems where id > 3\nitems +\n:input\n:quit\nitems\n")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := run([]string{"-repl", "-f", file}, stdin, stdout, stderr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0 but found %d: %s", code, stderr.String())
+	}
+
+	expected := "> 2\n> > [{\"id\":5}]\n> incomplete expression, EOF found\nitems +\n.......^\n> {\"items\":[{\"id\":1},{\"id\":5}]}\n> "
+	if stdout.String() != expected {
+		t.Fatalf("expected output %q but found %q", expected, stdout.String())
+	}
+}
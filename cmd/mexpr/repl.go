@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/danielgtaylor/mexpr"
+)
+
+const replHelp = `Enter an expression to evaluate it against the input document.
+Commands:
+  :input  print the input document
+  :help   show this help
+  :quit   exit (or press Ctrl+D)`
+
+// repl reads expressions line by line and prints each result, so filters can
+// be developed iteratively against a document which is only loaded once.
+func repl(stdin io.Reader, p *printer, input any, options []mexpr.InterpreterOption) int {
+	scanner := bufio.NewScanner(stdin)
+	// Errors are written alongside results so they show up in order.
+	p.stderr = p.stdout
+	for {
+		fmt.Fprint(p.stdout, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(p.stdout)
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			continue
+		case ":quit", ":q", ":exit":
+			return 0
+		case ":help", ":h":
+			fmt.Fprintln(p.stdout, replHelp)
+			continue
+		case ":input":
+			p.print(input)
+			continue
+		}
+		p.eval(line, input, options)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(p.stdout, err)
+		return 1
+	}
+	return 0
+}
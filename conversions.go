@@ -1,17 +1,38 @@
 package mexpr
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
+	"strconv"
 	"time"
 )
 
+// Undefined is the result of selecting a missing property when using the
+// `UndefinedValues` option. It is falsey and is only equal to itself.
+var Undefined = undefined{}
+
+type undefined struct{}
+
+func (undefined) String() string {
+	return "undefined"
+}
+
+// isNil returns whether the value is `nil` or `Undefined`.
+func isNil(v interface{}) bool {
+	return v == nil || v == Undefined
+}
+
 func isNumber(v interface{}) bool {
 	switch v.(type) {
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		return true
 	case float32, float64:
 		return true
+	case json.Number, *big.Int, *big.Float, *big.Rat:
+		return true
 	}
 	return false
 }
@@ -42,8 +63,110 @@ func toNumber(ast *Node, v interface{}) (float64, Error) {
 		return float64(n), nil
 	case float32:
 		return float64(n), nil
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f, nil
+		}
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, nil
+	case *big.Float:
+		f, _ := n.Float64()
+		return f, nil
+	case *big.Rat:
+		f, _ := n.Float64()
+		return f, nil
+	}
+	return 0, newNodeError(KindTypeMismatch, ast, "unable to convert to number: %v", v)
+}
+
+// isInteger returns whether the value is a Go integer type or a `json.Number`
+// holding an integer which fits in an `int64`, like a large ID.
+func isInteger(v interface{}) bool {
+	switch n := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case json.Number:
+		_, err := n.Int64()
+		return err == nil
+	}
+	return false
+}
+
+// toInteger converts a Go integer type or integral `json.Number` to an
+// `int64`. Returns false if the value is not an integer or is too large to
+// fit.
+func toInteger(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		if uint64(n) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		if n > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// compareIntegers compares two Go integer values without converting them to
+// floats, which lose precision above 2^53. Returns -1, 0, or 1, or false if
+// either value is not an integer.
+func compareIntegers(left, right any) (int, bool) {
+	if !isInteger(left) || !isInteger(right) {
+		return 0, false
 	}
-	return 0, NewError(ast.Offset, ast.Length, "unable to convert to number: %v", v)
+	l, lok := toInteger(left)
+	r, rok := toInteger(right)
+	switch {
+	case !lok && !rok:
+		// Both are unsigned and too large for an int64.
+		lu := reflect.ValueOf(left).Uint()
+		ru := reflect.ValueOf(right).Uint()
+		if lu < ru {
+			return -1, true
+		} else if lu > ru {
+			return 1, true
+		}
+		return 0, true
+	case !lok:
+		return 1, true
+	case !rok:
+		return -1, true
+	case l < r:
+		return -1, true
+	case l > r:
+		return 1, true
+	}
+	return 0, true
+}
+
+func isTime(v interface{}) bool {
+	_, ok := v.(time.Time)
+	return ok
 }
 
 func isString(v interface{}) bool {
@@ -64,26 +187,59 @@ func toString(v interface{}) string {
 		return string(s)
 	case []byte:
 		return string(s)
+	case *big.Rat:
+		return ratString(s)
+	case time.Time:
+		return s.Format(time.RFC3339Nano)
 	}
 	return fmt.Sprintf("%v", v)
 }
 
 // toTime converts a string value into a time.Time if possible, otherwise
-// returns a zero time.
-func toTime(v interface{}) time.Time {
+// the zero time is returned. Extra `layouts` are tried after the defaults.
+// Times without a zone are parsed in `loc`, which defaults to UTC.
+func toTime(v interface{}, layouts []string, loc *time.Location) time.Time {
+	if t, ok := v.(time.Time); ok {
+		return t
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
 	vStr := toString(v)
 	if t, err := time.Parse(time.RFC3339, vStr); err == nil {
 		return t
 	}
-	if t, err := time.Parse("2006-01-02T15:04:05", vStr); err == nil {
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", vStr, loc); err == nil {
 		return t
 	}
-	if t, err := time.Parse("2006-01-02", vStr); err == nil {
+	if t, err := time.ParseInLocation("2006-01-02", vStr, loc); err == nil {
 		return t
 	}
+	for _, layout := range layouts {
+		if layout == LayoutUnix {
+			if f, err := strconv.ParseFloat(vStr, 64); err == nil && (isNumber(v) || isString(v)) {
+				sec, frac := math.Modf(f)
+				return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+			}
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, vStr, loc); err == nil {
+			return t
+		}
+	}
 	return time.Time{}
 }
 
+// isList returns whether the value is a slice or array other than `[]byte`,
+// which is treated as a string.
+func isList(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
 func isSlice(v interface{}) bool {
 	if _, ok := v.([]interface{}); ok {
 		return true
@@ -91,6 +247,16 @@ func isSlice(v interface{}) bool {
 	return false
 }
 
+// isMap returns whether the value is a map which properties can be selected
+// from.
+func isMap(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return true
+	}
+	return false
+}
+
 func toBool(v interface{}) bool {
 	switch n := v.(type) {
 	case bool:
@@ -119,6 +285,9 @@ func toBool(v interface{}) bool {
 		return n > 0
 	case float64:
 		return n > 0
+	case json.Number, *big.Int, *big.Float, *big.Rat:
+		f, _ := toNumber(nil, n)
+		return f > 0
 	case string:
 		return len(n) > 0
 	case []byte:
@@ -160,6 +329,9 @@ func normalize(v interface{}) interface{} {
 		return float64(n)
 	case float32:
 		return float64(n)
+	case json.Number, *big.Int, *big.Float, *big.Rat:
+		f, _ := toNumber(nil, n)
+		return f
 	case []byte:
 		return string(n)
 	}
@@ -169,6 +341,17 @@ func normalize(v interface{}) interface{} {
 
 // deepEqual returns whether two values are deeply equal.
 func deepEqual(left, right any) bool {
+	if cmp, ok := compareIntegers(left, right); ok {
+		return cmp == 0
+	}
+
+	// Compare numbers directly to prevent allocations from normalizing them.
+	if isNumber(left) && isNumber(right) {
+		l, _ := toNumber(nil, left)
+		r, _ := toNumber(nil, right)
+		return l == r
+	}
+
 	l := normalize(left)
 	r := normalize(right)
 
@@ -184,6 +367,42 @@ func deepEqual(left, right any) bool {
 		}
 	}
 
+	// Compare arrays element-wise so that e.g. `int` and `float64` items with
+	// the same value are equal.
+	lv, rv := reflect.ValueOf(l), reflect.ValueOf(r)
+	if isList(lv) && isList(rv) {
+		if lv.Len() != rv.Len() {
+			return false
+		}
+		for idx := 0; idx < lv.Len(); idx++ {
+			if !deepEqual(lv.Index(idx).Interface(), rv.Index(idx).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Compare maps by key and value, with keys converted to strings so that
+	// e.g. `map[string]any` and `map[any]any` can be equal.
+	if lv.Kind() == reflect.Map && rv.Kind() == reflect.Map {
+		if lv.Len() != rv.Len() {
+			return false
+		}
+		values := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			values[toString(iter.Key().Interface())] = iter.Value().Interface()
+		}
+		iter = lv.MapRange()
+		for iter.Next() {
+			v, ok := values[toString(iter.Key().Interface())]
+			if !ok || !deepEqual(iter.Value().Interface(), v) {
+				return false
+			}
+		}
+		return true
+	}
+
 	// Otherwise, just use the built-in deep equality check.
 	return reflect.DeepEqual(left, right)
 }
@@ -0,0 +1,155 @@
+package mexpr
+
+import "math"
+
+// estimatedItems is the number of items assumed for arrays and maps when the
+// type examples don't say otherwise, see `EstimateCost`.
+const estimatedItems = 100
+
+// maxCost caps estimates so deeply nested clauses don't overflow, including
+// on 32-bit platforms.
+const maxCost = math.MaxInt32
+
+// Cost is a heuristic estimate of the work needed to run an expression, see
+// `EstimateCost`. It mirrors `Stats`, which measures the actual work done.
+type Cost struct {
+	// Size is the number of nodes in the expression.
+	Size int
+
+	// Nodes is the estimated number of nodes evaluated per run. Nodes inside
+	// a `where` clause are counted once per item.
+	Nodes int
+
+	// Items is the estimated number of items created by ranges plus array or
+	// map items iterated by `where` clauses, `sumBy`, `minBy`, and `maxBy`,
+	// like the per-run limit.
+	Items int
+
+	// Depth is the deepest nesting of `where` clauses and aggregations, e.g. 2
+	// for `users where (orders where total > 5)`.
+	Depth int
+}
+
+// EstimateCost returns a heuristic estimate of the cost of running an
+// expression without running it, so services can reject or down-prioritize
+// expensive expressions up front. If `types` is passed, it should be a set of
+// example values for the input like for `Parse`. Example arrays and maps with
+// more than one item are assumed to be the size of the real input, while
+// others are assumed to have 100 items. Ranges with literal bounds like
+// `1..1000` use their actual size.
+func EstimateCost(ast *Node, types any) Cost {
+	e := &costEstimator{}
+	e.walk(ast, 1, 0, types)
+	return e.cost
+}
+
+type costEstimator struct {
+	cost Cost
+}
+
+// walk adds the cost of a node which is evaluated `times` times at the given
+// nesting depth, where `value` is the example of the current item.
+func (e *costEstimator) walk(ast *Node, times int, depth int, value any) {
+	if ast == nil {
+		return
+	}
+	e.cost.Size++
+	e.cost.Nodes = saturate(e.cost.Nodes + times)
+	switch ast.Type {
+	case NodeRange:
+		if n, ok := rangeSize(ast); ok {
+			e.cost.Items = saturate(e.cost.Items + multiply(times, n))
+		}
+	case NodeWhere, NodeSumBy, NodeMinBy, NodeMaxBy:
+		e.walk(ast.Left, times, depth, value)
+		items, item := e.items(ast.Left, value)
+		e.cost.Items = saturate(e.cost.Items + multiply(times, items))
+		if depth+1 > e.cost.Depth {
+			e.cost.Depth = depth + 1
+		}
+		e.walk(ast.Right, multiply(times, items), depth+1, item)
+		return
+	}
+	e.walk(ast.Left, times, depth, value)
+	e.walk(ast.Right, times, depth, value)
+	for _, arg := range ast.Args {
+		e.walk(arg, times, depth, value)
+	}
+}
+
+// items returns the estimated number of items iterated by a clause on the
+// given node and an example item, if known.
+func (e *costEstimator) items(ast *Node, value any) (int, any) {
+	if n, ok := rangeSize(ast); ok {
+		return n, nil
+	}
+	var example any
+	if path := pathOf(ast, nil); path != nil {
+		example = value
+		for _, name := range path {
+			if items, ok := example.([]any); ok && len(items) > 0 {
+				// Properties of arrays select from each item.
+				example = items[0]
+			}
+			m, ok := example.(map[string]any)
+			if !ok {
+				example = nil
+				break
+			}
+			example = m[name]
+		}
+	}
+	switch v := example.(type) {
+	case []any:
+		if len(v) > 1 {
+			return len(v), v[0]
+		}
+		if len(v) == 1 {
+			return estimatedItems, v[0]
+		}
+	case map[string]any:
+		if len(v) > 1 {
+			for _, item := range v {
+				return len(v), item
+			}
+		}
+	}
+	return estimatedItems, nil
+}
+
+// rangeSize returns the number of items in a range with literal bounds like
+// `1..1000`.
+func rangeSize(ast *Node) (int, bool) {
+	if ast.Type != NodeRange || ast.Left == nil || ast.Right == nil || ast.Left.Type != NodeLiteral || ast.Right.Type != NodeLiteral {
+		return 0, false
+	}
+	start, err1 := toNumber(ast.Left, ast.Left.Value)
+	end, err2 := toNumber(ast.Right, ast.Right.Value)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	if end < start {
+		return 0, true
+	}
+	if end-start+1 >= maxCost {
+		return maxCost, true
+	}
+	return int(end - start + 1), true
+}
+
+// multiply returns `a * b` limited to `maxCost`, checking before multiplying
+// so large values can't wrap around.
+func multiply(a, b int) int {
+	if b != 0 && a > maxCost/b {
+		return maxCost
+	}
+	return saturate(a * b)
+}
+
+// saturate limits a cost to `maxCost`, including after an overflow.
+func saturate(n int) int {
+	if n < 0 || n > maxCost {
+		return maxCost
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package mexpr
+
+import "testing"
+
+func TestEstimateCost(t *testing.T) {
+	types := map[string]any{
+		"total": 1.0,
+		"users": []any{
+			map[string]any{"name": "a", "orders": []any{map[string]any{"total": 1.0}}},
+			map[string]any{"name": "b", "orders": []any{map[string]any{"total": 2.0}}},
+		},
+		"tags": []any{"a"},
+	}
+
+	cases := []struct {
+		expr string
+		cost Cost
+	}{
+		{expr: "total > 5", cost: Cost{Size: 3, Nodes: 3}},
+		// Two example users are the size of the input, one tag is not.
+		{expr: `users where name == "a"`, cost: Cost{Size: 5, Nodes: 8, Items: 2, Depth: 1}},
+		{expr: `tags where @ == "a"`, cost: Cost{Size: 5, Nodes: 302, Items: 100, Depth: 1}},
+		{expr: `users where (orders where total > 5)`, cost: Cost{Size: 7, Nodes: 606, Items: 202, Depth: 2}},
+		// Range items are counted when created and again when iterated.
+		{expr: `1..10 sumBy @`, cost: Cost{Size: 5, Nodes: 14, Items: 20, Depth: 1}},
+		{expr: `code in 0..9999999`, cost: Cost{Size: 5, Nodes: 5, Items: 10000000}},
+		{expr: `unknown where a`, cost: Cost{Size: 3, Nodes: 102, Items: 100, Depth: 1}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cost := EstimateCost(ast, types); cost != tc.cost {
+				t.Errorf("expected %+v but found %+v", tc.cost, cost)
+			}
+		})
+	}
+}
+
+func TestEstimateCostSaturates(t *testing.T) {
+	expr := "a where (a where (a where (a where (a where (a where (a where b))))))"
+	ast, err := Parse(expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost := EstimateCost(ast, nil)
+	if cost.Items != maxCost || cost.Nodes != maxCost || cost.Depth != 7 {
+		t.Errorf("expected saturated cost but found %+v", cost)
+	}
+}
+
+func TestEstimateCostOverflow(t *testing.T) {
+	expr := "(0..4294967295) where ((0..4294967295) where true).length > 0"
+	ast, err := Parse(expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost := EstimateCost(ast, nil)
+	if cost.Items != maxCost || cost.Nodes != maxCost {
+		t.Errorf("expected saturated cost but found %+v", cost)
+	}
+}
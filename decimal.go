@@ -0,0 +1,174 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// toRat converts a number into an exact rational number for decimal math.
+// Floats are converted using their shortest decimal representation, so the
+// float `0.1` becomes exactly `1/10` rather than the nearest binary fraction.
+func toRat(ast *Node, v any) (*big.Rat, Error) {
+	switch n := v.(type) {
+	case *big.Rat:
+		return n, nil
+	case *big.Int:
+		return new(big.Rat).SetInt(n), nil
+	case *big.Float:
+		if r, _ := n.Rat(nil); r != nil {
+			return r, nil
+		}
+	case json.Number:
+		if r, ok := new(big.Rat).SetString(string(n)); ok {
+			return r, nil
+		}
+	case float32:
+		return floatRat(ast, float64(n), 32)
+	case float64:
+		return floatRat(ast, n, 64)
+	case uint:
+		return new(big.Rat).SetUint64(uint64(n)), nil
+	case uint64:
+		return new(big.Rat).SetUint64(n), nil
+	default:
+		if i, ok := toInteger(v); ok {
+			return new(big.Rat).SetInt64(i), nil
+		}
+	}
+	return nil, newNodeError(KindTypeMismatch, ast, "unable to convert to number: %v", v)
+}
+
+// floatRat converts a float with the given bit size into a rational number.
+func floatRat(ast *Node, f float64, bits int) (*big.Rat, Error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, newNodeError(KindTypeMismatch, ast, "unable to convert to number: %v", f)
+	}
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, bits))
+	return r, nil
+}
+
+// ratString formats a rational number as a decimal string. Values with a
+// finite decimal representation are exact, e.g. `1/8` is `0.125`, while
+// others like `1/3` are rounded to 20 decimal places.
+func ratString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// A fraction has a finite decimal representation if the denominator only
+	// has the prime factors 2 and 5. The number of digits needed is then the
+	// larger of the two powers.
+	d := new(big.Int).Set(r.Denom())
+	twos := 0
+	for d.Bit(0) == 0 {
+		d.Rsh(d, 1)
+		twos++
+	}
+	five := big.NewInt(5)
+	fives := 0
+	m := new(big.Int)
+	for {
+		q, rem := new(big.Int).QuoRem(d, five, m)
+		if rem.Sign() != 0 {
+			break
+		}
+		d = q
+		fives++
+	}
+	if d.Cmp(big.NewInt(1)) == 0 {
+		digits := twos
+		if fives > digits {
+			digits = fives
+		}
+		return r.FloatString(digits)
+	}
+
+	s := r.FloatString(20)
+	for s[len(s)-1] == '0' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// ratRound rounds a rational number half away from zero to the given number
+// of decimal places.
+func ratRound(r *big.Rat, places int) *big.Rat {
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(places))), nil))
+	if places < 0 {
+		scale.Inv(scale)
+	}
+	scaled := new(big.Rat).Mul(r, scale)
+
+	// Add or subtract one half, then truncate towards zero.
+	half := big.NewRat(1, 2)
+	if scaled.Sign() < 0 {
+		half.Neg(half)
+	}
+	scaled.Add(scaled, half)
+	truncated := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	return new(big.Rat).Quo(new(big.Rat).SetInt(truncated), scale)
+}
+
+// abs returns the absolute value of an integer.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// maxDecimalBits limits the size of exact powers like `9 ^ 1024`, since
+// repeated powers would otherwise take practically forever to compute.
+const maxDecimalBits = 1 << 16
+
+// decimalMath runs a math operation on two exact rational numbers.
+func decimalMath(ast *Node, left, right *big.Rat) (any, Error) {
+	switch ast.Type {
+	case NodeAdd:
+		return new(big.Rat).Add(left, right), nil
+	case NodeSubtract:
+		return new(big.Rat).Sub(left, right), nil
+	case NodeMultiply:
+		return new(big.Rat).Mul(left, right), nil
+	case NodeDivide, NodeModulus:
+		if right.Sign() == 0 {
+			return nil, wrapError(newNodeError(KindRuntime, ast, "cannot divide by zero"), ErrDivideByZero)
+		}
+		quo := new(big.Rat).Quo(left, right)
+		if ast.Type == NodeDivide {
+			return quo, nil
+		}
+		// The remainder has the same sign as the left side, matching `math.Mod`.
+		trunc := new(big.Int).Quo(quo.Num(), quo.Denom())
+		return new(big.Rat).Sub(left, new(big.Rat).Mul(right, new(big.Rat).SetInt(trunc))), nil
+	case NodePower:
+		if right.IsInt() && right.Num().IsInt64() && math.Abs(float64(right.Num().Int64())) <= 1024 {
+			exp := right.Num().Int64()
+			if exp < 0 {
+				if left.Sign() == 0 {
+					return nil, wrapError(newNodeError(KindRuntime, ast, "cannot divide by zero"), ErrDivideByZero)
+				}
+				left = new(big.Rat).Inv(left)
+				exp = -exp
+			}
+			bits := left.Num().BitLen()
+			if denomBits := left.Denom().BitLen(); denomBits > bits {
+				bits = denomBits
+			}
+			if int64(bits)*exp > maxDecimalBits {
+				return nil, newNodeError(KindLimitExceeded, ast, "power result is larger than %d bits", maxDecimalBits)
+			}
+			e := big.NewInt(exp)
+			num := new(big.Int).Exp(left.Num(), e, nil)
+			denom := new(big.Int).Exp(left.Denom(), e, nil)
+			return new(big.Rat).SetFrac(num, denom), nil
+		}
+		// Fractional or huge powers can't be exact, so fall back to floats.
+		l, _ := left.Float64()
+		r, _ := right.Float64()
+		return floatRat(ast, math.Pow(l, r), 64)
+	}
+	return nil, newNodeError(KindRuntime, ast, "unknown decimal operation %v", ast)
+}
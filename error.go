@@ -1,6 +1,78 @@
 package mexpr
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrorKind describes the category of an error, which makes it possible to
+// handle errors programmatically without matching on messages.
+type ErrorKind uint8
+
+// Possible error kinds
+const (
+	KindUnknown ErrorKind = iota
+	KindSyntax
+	KindUnknownProperty
+	KindTypeMismatch
+	KindRuntime
+	KindLimitExceeded
+	KindAccessDenied
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindSyntax:
+		return "syntax"
+	case KindUnknownProperty:
+		return "unknown-property"
+	case KindTypeMismatch:
+		return "type-mismatch"
+	case KindRuntime:
+		return "runtime"
+	case KindLimitExceeded:
+		return "limit-exceeded"
+	case KindAccessDenied:
+		return "access-denied"
+	}
+	return "unknown"
+}
+
+// Sentinel errors which can be checked with `errors.Is`, e.g.
+// `errors.Is(err, mexpr.ErrUnknownProperty)`. Each kind of error matches its
+// sentinel, see `ErrorKind`, and errors with a specific cause like a division
+// by zero also match the sentinel for that cause.
+var (
+	ErrSyntax          = errors.New("syntax error")
+	ErrUnknownProperty = errors.New("unknown property")
+	ErrTypeMismatch    = errors.New("type mismatch")
+	ErrRuntime         = errors.New("runtime error")
+	ErrLimitExceeded   = errors.New("limit exceeded")
+	ErrAccessDenied    = errors.New("access denied")
+
+	// ErrDivideByZero is the cause of `KindRuntime` errors from dividing by
+	// zero, e.g. `1 / 0` or `5 % 0`.
+	ErrDivideByZero = errors.New("cannot divide by zero")
+
+	// ErrIndexOutOfRange is the cause of `KindRuntime` errors from indexing
+	// or slicing past the end of an array or string, e.g. `items[5]` when there
+	// are only two items.
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// kindErrors maps each kind to its sentinel error.
+var kindErrors = map[ErrorKind]error{
+	KindSyntax:          ErrSyntax,
+	KindUnknownProperty: ErrUnknownProperty,
+	KindTypeMismatch:    ErrTypeMismatch,
+	KindRuntime:         ErrRuntime,
+	KindLimitExceeded:   ErrLimitExceeded,
+	KindAccessDenied:    ErrAccessDenied,
+}
 
 // Error represents an error at a specific location.
 type Error interface {
@@ -12,15 +84,51 @@ type Error interface {
 	// Length returns the length in bytes after the offset where the error ends.
 	Length() uint8
 
+	// End returns the offset just past the full range of the error, e.g. the
+	// end of the whole operation for `a + b` while `Offset` and `Length` point
+	// at the `+` operator.
+	End() uint16
+
+	// Span returns the start and end offsets of the full range of the error,
+	// which includes the location given by `Offset` and `Length`.
+	Span() (uint16, uint16)
+
+	// Kind returns the category of the error, e.g. a syntax error.
+	Kind() ErrorKind
+
 	// Pretty prints out a message with a pointer to the source location of the
 	// error.
 	Pretty(source string) string
+
+	// PrettyColor works like `Pretty` but uses ANSI terminal colors to
+	// highlight the message and the location of the error.
+	PrettyColor(source string) string
+
+	// PrettyContext works like `Pretty` but only shows up to `context`
+	// characters of the source before and after the error, which is useful for
+	// long expressions. A negative `context` is treated as zero.
+	PrettyContext(source string, context int) string
 }
 
 type exprErr struct {
+	kind    ErrorKind
 	offset  uint16
 	length  uint8
+	start   uint16
+	end     uint16
 	message string
+
+	// cause is the underlying error, if any, e.g. the error returned by an
+	// access hook or `ErrDivideByZero`.
+	cause error
+
+	// suggestions are possible fixes, like `startsWith` for `startswith`.
+	suggestions []string
+
+	// format and args are used to create the message, which can be changed
+	// using a `MessageCatalog`.
+	format string
+	args   []any
 }
 
 func (e *exprErr) Error() string {
@@ -35,22 +143,246 @@ func (e *exprErr) Length() uint8 {
 	return e.length
 }
 
+func (e *exprErr) End() uint16 {
+	return e.end
+}
+
+func (e *exprErr) Span() (uint16, uint16) {
+	return e.start, e.end
+}
+
+func (e *exprErr) Kind() ErrorKind {
+	return e.kind
+}
+
+// errorJSON is the JSON representation of an error, for APIs to return
+// structured errors which frontends can show inline.
+type errorJSON struct {
+	Name        string   `json:"name,omitempty"`
+	Message     string   `json:"message"`
+	Kind        string   `json:"kind"`
+	Offset      uint16   `json:"offset"`
+	Length      uint8    `json:"length"`
+	Start       uint16   `json:"start"`
+	End         uint16   `json:"end"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// MarshalJSON encodes the error's message, kind, location, and any
+// suggested fixes, e.g.:
+//
+//	{"message": "...", "kind": "syntax", "offset": 4, "length": 1, "start": 0, "end": 5}
+func (e *exprErr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.toJSON())
+}
+
+func (e *exprErr) toJSON() errorJSON {
+	return errorJSON{
+		Message:     e.message,
+		Kind:        e.kind.String(),
+		Offset:      e.offset,
+		Length:      e.length,
+		Start:       e.start,
+		End:         e.end,
+		Suggestions: e.suggestions,
+	}
+}
+
+// Is reports whether the error's kind matches a sentinel like `ErrSyntax`.
+func (e *exprErr) Is(target error) bool {
+	return target != nil && kindErrors[e.kind] == target
+}
+
+// Unwrap returns the cause of the error, if any.
+func (e *exprErr) Unwrap() error {
+	return e.cause
+}
+
 func (e *exprErr) Pretty(source string) string {
-	msg := e.Error() + "\n" + source + "\n"
-	for i := uint16(0); i < e.offset; i++ {
-		msg += "."
+	return e.Error() + "\n" + source + "\n" + strings.Repeat(".", int(e.start)) + e.underline()
+}
+
+// underline returns the markers below the range of the error, with `^` at
+// the error's location and `~` for the rest of the range, e.g. `~~^~~` for
+// `a + b`.
+func (e *exprErr) underline() string {
+	before := int(e.offset) - int(e.start)
+	after := int(e.end) - int(e.offset) - int(e.length)
+	if after < 0 {
+		after = 0
 	}
-	for i := uint8(0); i < e.length; i++ {
-		msg += "^"
+	return strings.Repeat("~", before) + strings.Repeat("^", int(e.length)) + strings.Repeat("~", after)
+}
+
+// ANSI terminal escape codes used for colorized output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiDim   = "\x1b[2m"
+)
+
+// span returns the start and end of the error's range within the source. The
+// span is clamped to the source, as errors at the end of the input may point
+// just past it.
+func (e *exprErr) span(source string) (int, int) {
+	start := int(e.start)
+	if start > len(source) {
+		start = len(source)
 	}
-	return msg
+	end := int(e.end)
+	if end > len(source) {
+		end = len(source)
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
+func (e *exprErr) PrettyColor(source string) string {
+	start, end := e.span(source)
+	msg := ansiBold + ansiRed + e.Error() + ansiReset + "\n"
+	msg += source[:start] + ansiBold + ansiRed + source[start:end] + ansiReset + source[end:] + "\n"
+	msg += ansiDim + strings.Repeat(".", int(e.start)) + ansiReset + ansiRed + e.underline()
+	return msg + ansiReset
 }
 
-// NewError creates a new error at a specific location.
+// NewError creates a new error at a specific location. The error's kind is
+// `KindUnknown`.
 func NewError(offset uint16, length uint8, format string, a ...interface{}) Error {
+	return newError(KindUnknown, offset, length, format, a...)
+}
+
+// newError creates a new error of the given kind at a specific location.
+func newError(kind ErrorKind, offset uint16, length uint8, format string, a ...interface{}) Error {
 	return &exprErr{
+		kind:    kind,
 		offset:  offset,
 		length:  length,
+		start:   offset,
+		end:     offset + uint16(length),
 		message: fmt.Sprintf(format, a...),
+		format:  format,
+		args:    a,
+	}
+}
+
+// wrapError sets the underlying cause of an error, see `errors.Unwrap`.
+func wrapError(err Error, cause error) Error {
+	err.(*exprErr).cause = cause
+	return err
+}
+
+// withSuggestions adds a hint with possible fixes to the error message, like
+// "(did you mean `startsWith`?)". The suggestions are included when the error
+// is encoded as JSON.
+func withSuggestions(err Error, suggestions ...string) Error {
+	if len(suggestions) == 0 {
+		return err
+	}
+	e := err.(*exprErr)
+	e.suggestions = suggestions
+	e.message += suggestionHint(suggestionFormat, suggestions)
+	return e
+}
+
+// suggestionFormat is the format of the hint added to messages by
+// `withSuggestions`, where the argument is the quoted suggestions.
+const suggestionFormat = "did you mean %s?"
+
+func suggestionHint(format string, suggestions []string) string {
+	return " (" + fmt.Sprintf(format, "`"+strings.Join(suggestions, "` or `")+"`") + ")"
+}
+
+// MessageCatalog maps the format strings of error messages, like
+// "no property %v in %v", to customized or translated formats which take the
+// same arguments, e.g. "propriété %v introuvable dans %v". Arguments can be
+// reordered or left out using explicit indexes like `%[2]v`. The hint listing
+// suggested fixes uses the format "did you mean %s?". Formats which are not
+// in the catalog are left unchanged.
+type MessageCatalog map[string]string
+
+// Localize returns a copy of the error with its message created using the
+// catalog. The kind, location, and cause of the error are unchanged, so it
+// can still be handled programmatically. Errors which were not created by
+// this package are returned as-is.
+func (c MessageCatalog) Localize(err Error) Error {
+	switch e := err.(type) {
+	case *exprErr:
+		localized := *e
+		format, ok := c[e.format]
+		if !ok {
+			format = e.format
+		}
+		localized.message = fmt.Sprintf(format, e.args...)
+		if len(e.suggestions) > 0 {
+			format, ok := c[suggestionFormat]
+			if !ok {
+				format = suggestionFormat
+			}
+			localized.message += suggestionHint(format, e.suggestions)
+		}
+		return &localized
+	case *ProgramError:
+		return &ProgramError{Name: e.Name, Expression: e.Expression, Err: c.Localize(e.Err)}
+	}
+	return err
+}
+
+// newNodeError creates a new error of the given kind at the node's token,
+// covering the node's whole sub-expression, e.g. all of `a + b`.
+func newNodeError(kind ErrorKind, ast *Node, format string, a ...interface{}) Error {
+	err := newError(kind, ast.Offset, ast.Length, format, a...).(*exprErr)
+	if ast.End != 0 && ast.Start <= ast.Offset && ast.End >= ast.Offset+uint16(ast.Length) {
+		err.start, err.end = ast.Start, ast.End
+	}
+	return err
+}
+
+// newSpanError returns an error for the source from `start` up to `end`. The
+// length is clamped to fit, while the span covers the whole range.
+func newSpanError(kind ErrorKind, start, end uint16, format string, a ...interface{}) Error {
+	length := end - start
+	if length > math.MaxUint8 {
+		length = math.MaxUint8
 	}
+	err := newError(kind, start, uint8(length), format, a...).(*exprErr)
+	err.end = end
+	return err
+}
+
+func (e *exprErr) PrettyContext(source string, context int) string {
+	start, end := e.span(source)
+	if context < 0 {
+		context = 0
+	}
+
+	// Find the window to display, making sure not to cut a multi-byte
+	// character in half.
+	from := start - context
+	prefix := ""
+	if from > 0 {
+		prefix = "..."
+		for from < start && !utf8.RuneStart(source[from]) {
+			from++
+		}
+	} else {
+		from = 0
+	}
+	to := end + context
+	suffix := ""
+	if to < len(source) {
+		suffix = "..."
+		for to > end && !utf8.RuneStart(source[to]) {
+			to--
+		}
+	} else {
+		to = len(source)
+	}
+
+	msg := e.Error() + "\n" + prefix + source[from:to] + suffix + "\n"
+	msg += strings.Repeat(".", len(prefix)+start-from)
+	msg += e.underline()
+	return msg
 }
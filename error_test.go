@@ -0,0 +1,267 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestErrorKind(t *testing.T) {
+	type test struct {
+		expr  string
+		input string
+		kind  ErrorKind
+	}
+	cases := []test{
+		{expr: `1 +`, kind: KindSyntax},
+		{expr: `a = 1`, kind: KindSyntax},
+		{expr: `foo + 1`, input: `{}`, kind: KindUnknownProperty},
+		{expr: `foo > 1`, input: `{"foo": "bar"}`, kind: KindTypeMismatch},
+		{expr: `1 / 0`, kind: KindRuntime},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			var input any
+			if tc.input != "" {
+				if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := Parse(tc.expr, input)
+			if err == nil {
+				t.Fatal("expected error but found none")
+			}
+			if err.Kind() != tc.kind {
+				t.Fatalf("expected %s but found %s: %s", tc.kind, err.Kind(), err)
+			}
+		})
+	}
+}
+
+func TestErrorKindRuntime(t *testing.T) {
+	_, err := Eval(`a[5]`, map[string]any{"a": []any{1}})
+	if err == nil || err.Kind() != KindRuntime {
+		t.Fatalf("expected runtime error but found %v", err)
+	}
+
+	_, err = Eval(`foo.bar`, map[string]any{}, StrictMode)
+	if err == nil || err.Kind() != KindUnknownProperty {
+		t.Fatalf("expected unknown property error but found %v", err)
+	}
+}
+
+func TestErrorPrettyColor(t *testing.T) {
+	expr := `1 + foo`
+	_, err := Parse(expr, map[string]any{})
+	if err == nil {
+		t.Fatal("expected error but found none")
+	}
+
+	expected := "\x1b[1m\x1b[31mno property foo in map with keys []\x1b[0m\n" +
+		"1 + \x1b[1m\x1b[31mfoo\x1b[0m\n" +
+		"\x1b[2m....\x1b[0m\x1b[31m^^^\x1b[0m"
+	if pretty := err.PrettyColor(expr); pretty != expected {
+		t.Fatalf("expected %q but found %q", expected, pretty)
+	}
+
+	// Errors past the end of the input must not panic.
+	_, err = Parse(`1 +`, nil)
+	if err == nil {
+		t.Fatal("expected error but found none")
+	}
+	err.PrettyColor(`1 +`)
+}
+
+func TestErrorPrettyContext(t *testing.T) {
+	expr := `a > 1 and b > 2 and c > 3 and d * 2 and e > 5 and f > 6 and g > 7`
+	_, err := Parse(expr, map[string]any{"a": 1, "b": 2, "c": 3, "d": []any{}, "e": 5, "f": 6, "g": 7})
+	if err == nil {
+		t.Fatal("expected error but found none")
+	}
+
+	expected := "cannot operate on incompatible types array and number\n" +
+		"...3 and d * 2 and e...\n" +
+		".........~~^~~"
+	if pretty := err.PrettyContext(expr, 6); pretty != expected {
+		t.Fatalf("expected %q but found %q", expected, pretty)
+	}
+
+	// Short expressions are shown in full.
+	if pretty, full := err.PrettyContext(expr, 100), err.Pretty(expr); pretty != full {
+		t.Fatalf("expected %q but found %q", full, pretty)
+	}
+
+	// Negative context only shows the error.
+	if pretty, none := err.PrettyContext(expr, -5), err.PrettyContext(expr, 0); pretty != none {
+		t.Fatalf("expected %q but found %q", none, pretty)
+	}
+}
+
+func TestErrorSpan(t *testing.T) {
+	expr := `a > 1 and b.c * (d - 1)`
+	_, err := Parse(expr, map[string]any{"a": 1, "b": map[string]any{"c": "x"}, "d": 1})
+	if err == nil {
+		t.Fatal("expected error but found none")
+	}
+	if start, end := err.Span(); start != 10 || end != 23 || err.End() != end {
+		t.Fatalf("unexpected span %d-%d", start, end)
+	}
+
+	expected := "cannot operate on incompatible types string and number\n" + expr + "\n" +
+		"..........~~~~^~~~~~~~~"
+	if pretty := err.Pretty(expr); pretty != expected {
+		t.Fatalf("expected %q but found %q", expected, pretty)
+	}
+
+	// Errors created by offset and length span just that location.
+	err = NewError(2, 3, "custom")
+	if start, end := err.Span(); start != 2 || end != 5 {
+		t.Fatalf("unexpected span %d-%d", start, end)
+	}
+}
+
+func TestStrictSyntax(t *testing.T) {
+	cases := []struct {
+		expr    string
+		message string
+		offset  uint16
+		length  uint8
+	}{
+		{expr: `name == "abc`, message: "unterminated string", offset: 8, length: 4},
+		{expr: "`a b == 1", message: "unterminated quoted identifier", offset: 0, length: 9},
+		{expr: `x > 1.2.3`, message: "unexpected second decimal point in number", offset: 7, length: 1},
+		{expr: `.5.1 + x`, message: "unexpected second decimal point in number", offset: 2, length: 1},
+		{expr: `1__000`, message: "underscores in numbers must be between digits", offset: 1, length: 1},
+		{expr: `1_ + 2`, message: "underscores in numbers must be between digits", offset: 1, length: 1},
+		{expr: `user.`, message: "expected property name after .", offset: 4, length: 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr, nil, StrictSyntax)
+			if err == nil {
+				t.Fatal("expected error but found none")
+			}
+			if err.Error() != tc.message || err.Offset() != tc.offset || err.Length() != tc.length {
+				t.Fatalf("expected %s at %d-%d but found %s", tc.message, tc.offset, tc.length, err.Pretty(tc.expr))
+			}
+		})
+	}
+
+	// Valid input is still accepted.
+	for _, expr := range []string{`1_000 + 1.5 + .5`, `x in 1..10`, "`a b` == \"c\\\"\"", `items[1:]`} {
+		if _, err := Parse(expr, nil, StrictSyntax); err != nil {
+			t.Fatal(err.Pretty(expr))
+		}
+	}
+
+	// Without strict syntax malformed numbers are reported by the parser.
+	if _, err := Parse(`x > 1.2.3`, nil); err == nil || err.Offset() != 4 || err.Length() != 5 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestErrorsIs(t *testing.T) {
+	_, err := Parse(`a +`, nil)
+	if !errors.Is(err, ErrSyntax) || errors.Is(err, ErrRuntime) {
+		t.Fatalf("expected syntax error but found %v", err)
+	}
+
+	_, err = Parse(`foo > 1`, map[string]any{})
+	if !errors.Is(err, ErrUnknownProperty) {
+		t.Fatalf("expected unknown property error but found %v", err)
+	}
+
+	for _, expr := range []string{`1 / 0`, `a % 0`} {
+		_, err = Eval(expr, map[string]any{"a": 5})
+		if !errors.Is(err, ErrDivideByZero) || !errors.Is(err, ErrRuntime) {
+			t.Fatalf("%s: expected divide by zero but found %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{`a[5]`, `a[0:5]`, `s[3]`} {
+		_, err = Eval(expr, map[string]any{"a": []any{1}, "s": "abc"})
+		if !errors.Is(err, ErrIndexOutOfRange) || !errors.Is(err, ErrRuntime) {
+			t.Fatalf("%s: expected index out of range but found %v", expr, err)
+		}
+	}
+
+	denied := errors.New("nope")
+	_, err = Eval(`secret`, map[string]any{"secret": 1}, WithAccessHook(func(path string) error {
+		return denied
+	}))
+	if !errors.Is(err, denied) || !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("expected wrapped hook error but found %v", err)
+	}
+
+	_, err = Compile(map[string]string{"a": `x +`}, nil)
+	var programErr *ProgramError
+	if !errors.As(err, &programErr) || !errors.Is(err, ErrSyntax) {
+		t.Fatalf("expected program syntax error but found %v", err)
+	}
+	if errors.Unwrap(programErr) != programErr.Err {
+		t.Fatal("expected program error to unwrap to its expression error")
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	_, err := Parse(`name startswith "a"`, nil)
+	encoded, jsonErr := json.Marshal(err)
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	expected := `{"message":"expected eof but found identifier (did you mean ` + "`startsWith`" + `?)","kind":"syntax","offset":5,"length":10,"start":5,"end":15,"suggestions":["startsWith"]}`
+	if string(encoded) != expected {
+		t.Fatalf("expected %s but found %s", expected, encoded)
+	}
+
+	_, err = Parse(`a + b > 1`, map[string]any{"a": 1, "b": "x"}, StrictTypes)
+	encoded, _ = json.Marshal(err)
+	expected = `{"message":"cannot add number and string without converting to a string","kind":"type-mismatch","offset":2,"length":1,"start":0,"end":5}`
+	if string(encoded) != expected {
+		t.Fatalf("expected %s but found %s", expected, encoded)
+	}
+
+	_, err = Compile(map[string]string{"total": `price *`}, nil)
+	encoded, _ = json.Marshal(err)
+	expected = `{"name":"total","message":"incomplete expression, EOF found","kind":"syntax","offset":7,"length":1,"start":7,"end":8}`
+	if string(encoded) != expected {
+		t.Fatalf("expected %s but found %s", expected, encoded)
+	}
+}
+
+func TestMessageCatalog(t *testing.T) {
+	catalog := MessageCatalog{
+		"no property %v in %v":     "propriété %[1]v introuvable",
+		"did you mean %s?":         "vouliez-vous dire %s ?",
+		"expected %s but found %s": "%[2]s trouvé, %[1]s attendu",
+	}
+
+	_, err := Parse(`foo > 1`, map[string]any{"bar": 1})
+	localized := catalog.Localize(err)
+	if localized.Error() != "propriété foo introuvable" {
+		t.Fatalf("unexpected message %s", localized.Error())
+	}
+	if localized.Kind() != KindUnknownProperty || localized.Offset() != err.Offset() || !errors.Is(localized, ErrUnknownProperty) {
+		t.Fatal("expected kind and location to be unchanged")
+	}
+	if err.Error() == localized.Error() {
+		t.Fatal("expected original error to be unchanged")
+	}
+
+	_, err = Parse(`name startswith "a"`, nil)
+	if msg := catalog.Localize(err).Error(); msg != "identifier trouvé, eof attendu (vouliez-vous dire `startsWith` ?)" {
+		t.Fatalf("unexpected message %s", msg)
+	}
+
+	_, err = Parse(`1 +`, nil)
+	if catalog.Localize(err).Error() != err.Error() {
+		t.Fatal("expected messages not in the catalog to be unchanged")
+	}
+
+	_, err = Compile(map[string]string{"a": `foo > 1`}, map[string]any{})
+	if msg := catalog.Localize(err).Error(); msg != "a: propriété foo introuvable" {
+		t.Fatalf("unexpected message %s", msg)
+	}
+}
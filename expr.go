@@ -1,12 +1,14 @@
 // Package mexpr provides a simple expression parser.
 package mexpr
 
+import "strings"
+
 // Parse an expression and return the abstract syntax tree. If `types` is
 // passed, it should be a set of representative example values for the input
 // which will be used to type check the expression against.
 func Parse(expression string, types any, options ...InterpreterOption) (*Node, Error) {
-	l := NewLexer(expression)
-	p := NewParser(l)
+	l := NewLexer(expression, options...)
+	p := NewParser(l, options...)
 	ast, err := p.Parse()
 	if err != nil {
 		return nil, err
@@ -26,19 +28,99 @@ func TypeCheck(ast *Node, types any, options ...InterpreterOption) Error {
 	return i.Run(types)
 }
 
+// TypeCheckAll works like `TypeCheck` but checks the entire AST, returning
+// all type errors found rather than stopping at the first one. If no errors
+// are found then the result is empty.
+func TypeCheckAll(ast *Node, types any, options ...InterpreterOption) []Error {
+	i := newTypeChecker(ast, options...)
+	i.collect = true
+	i.Run(types)
+	return i.errors
+}
+
 // Run executes an AST with the given input and returns the output.
 func Run(ast *Node, input any, options ...InterpreterOption) (any, Error) {
 	i := NewInterpreter(ast, options...)
 	return i.Run(input)
 }
 
+// RunAll executes an AST like `Run` but returns the results of every
+// expression in a sequence like `a; b; c` rather than only the last one.
+// Other expressions return a single result.
+func RunAll(ast *Node, input any, options ...InterpreterOption) ([]any, Error) {
+	if ast == nil || ast.Type != NodeSequence {
+		result, err := Run(ast, input, options...)
+		if err != nil {
+			return nil, err
+		}
+		return []any{result}, nil
+	}
+	// Run the expressions as an array so they share one interpreter, e.g. so
+	// `now` is the same for all of them.
+	results, err := Run(&Node{Type: NodeArray, Offset: ast.Offset, Length: ast.Length, Start: ast.Start, End: ast.End, Args: ast.Args}, input, options...)
+	if err != nil {
+		return nil, err
+	}
+	return results.([]any), nil
+}
+
+// Explanation is a node of the abstract syntax tree along with the value it
+// evaluated to, which makes it possible to show how a result was computed,
+// e.g. `price (12) > threshold (20) → false`.
+type Explanation struct {
+	Node  *Node
+	Value any
+
+	// Error is set if evaluating the node failed.
+	Error Error
+
+	// Children are the explanations of the nodes this node depends on, in the
+	// order they were evaluated. Nodes in a `where` clause are evaluated, and
+	// so explained, once for each item.
+	Children []*Explanation
+}
+
+// String returns an indented tree of the nodes and their values.
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	e.write(&sb, 0)
+	return sb.String()
+}
+
+func (e *Explanation) write(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(e.Node.String())
+	if e.Error != nil {
+		sb.WriteString(" => error: " + e.Error.Error() + "\n")
+	} else {
+		sb.WriteString(" => " + traceValue(e.Value) + "\n")
+	}
+	for _, child := range e.Children {
+		child.write(sb, depth+1)
+	}
+}
+
+// Explain runs an AST with the given input like `Run`, but returns the AST
+// annotated with the value computed at every node. If running fails, the
+// explanation up to the failure is returned along with the error.
+func Explain(ast *Node, input any, options ...InterpreterOption) (*Explanation, Error) {
+	if ast == nil {
+		return nil, nil
+	}
+	i := NewInterpreter(ast, options...).(*interpreter)
+	root := &Explanation{}
+	i.explanations = []*Explanation{root}
+	_, err := i.Run(input)
+	return root.Children[0], err
+}
+
 // Eval is a convenience function which lexes, parses, and executes an
 // expression with the given input. If you plan to execute the expression
-// multiple times consider caching the output of `Parse(...)` instead for a
-// big speed improvement.
+// multiple times consider caching the output of `Parse(...)` or using a
+// `Cache` instead for a big speed improvement.
 func Eval(expression string, input any, options ...InterpreterOption) (any, Error) {
 	// No need to type check because we are about to run with the input.
-	ast, err := Parse(expression, nil)
+	ast, err := Parse(expression, nil, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,3 +129,61 @@ func Eval(expression string, input any, options ...InterpreterOption) (any, Erro
 	}
 	return Run(ast, input, options...)
 }
+
+// EvalBool is like `Eval` but requires the result to be a boolean, e.g. for
+// filters and rules. Any other result, including `nil`, is a
+// `KindTypeMismatch` error.
+func EvalBool(expression string, input any, options ...InterpreterOption) (bool, Error) {
+	ast, result, err := evalResult(expression, input, options)
+	if err != nil {
+		return false, err
+	}
+	if b, ok := result.(bool); ok {
+		return b, nil
+	}
+	return false, newNodeError(KindTypeMismatch, ast, "expected boolean result but found %v", result)
+}
+
+// EvalNumber is like `Eval` but requires the result to be a number, which is
+// converted to a `float64`, including integers and `*big.Rat` values from
+// `DecimalNumbers`. Any other result, including `nil` and numeric strings, is
+// a `KindTypeMismatch` error.
+func EvalNumber(expression string, input any, options ...InterpreterOption) (float64, Error) {
+	ast, result, err := evalResult(expression, input, options)
+	if err != nil {
+		return 0, err
+	}
+	if isNumber(result) {
+		if n, err := toNumber(ast, result); err == nil {
+			return n, nil
+		}
+	}
+	return 0, newNodeError(KindTypeMismatch, ast, "expected number result but found %v", result)
+}
+
+// EvalString is like `Eval` but requires the result to be a string. Any other
+// result, including `nil`, is a `KindTypeMismatch` error.
+func EvalString(expression string, input any, options ...InterpreterOption) (string, Error) {
+	ast, result, err := evalResult(expression, input, options)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := result.(string); ok {
+		return s, nil
+	}
+	return "", newNodeError(KindTypeMismatch, ast, "expected string result but found %v", result)
+}
+
+// evalResult parses and runs an expression for the typed `Eval` functions. It
+// returns the root node, which locates type errors for the whole expression.
+func evalResult(expression string, input any, options []InterpreterOption) (*Node, any, Error) {
+	ast, err := Parse(expression, nil, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ast == nil {
+		return &Node{}, nil, nil
+	}
+	result, err := Run(ast, input, options...)
+	return ast, result, err
+}
@@ -0,0 +1,398 @@
+package mexpr
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter is a single condition for `BuildFilter`, like a form field in a
+// search UI, e.g. `{Field: "price", Op: ">", Value: 10}` for `price > 10`.
+type Filter struct {
+	// Field is a property path like `user.name` or `items.id`.
+	Field string
+
+	// Op is a comparison or string operator: `==`, `!=`, `<`, `<=`, `>`, `>=`,
+	// `in`, `contains`, `startsWith`, `endsWith`, `before`, `after`, or `like`.
+	// An empty operator means `==`.
+	Op string
+
+	// Value is compared with the field. It should be a string, number, boolean,
+	// or `nil`, or a slice of these for `in`.
+	Value any
+}
+
+// filterOps maps operators for `Filter.Op` to node types.
+var filterOps = map[string]NodeType{
+	"":           NodeEqual,
+	"==":         NodeEqual,
+	"!=":         NodeNotEqual,
+	"<":          NodeLessThan,
+	"<=":         NodeLessThanEqual,
+	">":          NodeGreaterThan,
+	">=":         NodeGreaterThanEqual,
+	"in":         NodeIn,
+	"contains":   NodeContains,
+	"startsWith": NodeStartsWith,
+	"endsWith":   NodeEndsWith,
+	"before":     NodeBefore,
+	"after":      NodeAfter,
+	"like":       NodeLike,
+}
+
+// queryOps maps operator names in query parameters like `price[gt]` to
+// operators for `Filter.Op`.
+var queryOps = map[string]string{
+	"eq":         "==",
+	"ne":         "!=",
+	"lt":         "<",
+	"lte":        "<=",
+	"gt":         ">",
+	"gte":        ">=",
+	"in":         "in",
+	"contains":   "contains",
+	"startsWith": "startsWith",
+	"endsWith":   "endsWith",
+	"before":     "before",
+	"after":      "after",
+	"like":       "like",
+}
+
+// BuildFilter assembles an abstract syntax tree from structured filters which
+// are all required to match, i.e. they are joined by `and`, so APIs can offer
+// form-style filtering backed by the same engine as free-text expressions.
+// The resulting AST can be type checked and run like any other. Nodes are
+// located as if the filters were written as an expression like
+// `status == "active" and price > 10`, so errors point at the right filter.
+// Returns `nil` if there are no filters.
+func BuildFilter(filters []Filter) (*Node, Error) {
+	var result *Node
+	offset := uint16(0)
+	for _, f := range filters {
+		andOffset := offset + 1
+		if result != nil {
+			offset += uint16(len(" and "))
+		}
+		condition, err := buildCondition(f, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = condition.End
+		if result == nil {
+			result = condition
+		} else {
+			result = &Node{Type: NodeAnd, Offset: andOffset, Length: 3, Left: result, Right: condition}
+		}
+	}
+	spans(result)
+	return result, nil
+}
+
+// buildCondition builds the node for a single filter written at `offset`.
+func buildCondition(f Filter, offset uint16) (*Node, Error) {
+	op := f.Op
+	if op == "" {
+		op = "=="
+	}
+	opOffset := offset + uint16(len(f.Field)) + 1
+	typ, ok := filterOps[f.Op]
+	if !ok {
+		return nil, newError(KindSyntax, opOffset, uint8(len(f.Op)), "unknown filter operator %s for %s", f.Op, f.Field)
+	}
+	field, err := Parse(f.Field, nil)
+	if err != nil {
+		return nil, err
+	}
+	if field == nil || !isPath(field) {
+		return nil, newError(KindSyntax, offset, uint8(len(f.Field)), "filter field %s must be a property path", f.Field)
+	}
+	move(field, offset)
+
+	valueOffset := opOffset + uint16(len(op)) + 1
+	var items []any
+	switch v := f.Value.(type) {
+	case []any:
+		items = v
+	case []string:
+		items = make([]any, len(v))
+		for idx, item := range v {
+			items[idx] = item
+		}
+	default:
+		return filterCondition(typ, opOffset, op, field, filterLiteral(f.Value, valueOffset)), nil
+	}
+	value := &Node{Type: NodeArray, Offset: valueOffset, Start: valueOffset, Args: make([]*Node, len(items))}
+	end := valueOffset + 1
+	for idx, item := range items {
+		if idx > 0 {
+			end += uint16(len(", "))
+		}
+		value.Args[idx] = filterLiteral(item, end)
+		end = value.Args[idx].End
+	}
+	value.End = end + 1
+	value.Length = uint8(value.End - valueOffset)
+	return filterCondition(typ, opOffset, op, field, value), nil
+}
+
+// filterCondition creates the node comparing a field with a value.
+func filterCondition(typ NodeType, offset uint16, op string, field, value *Node) *Node {
+	n := &Node{Type: typ, Offset: offset, Length: uint8(len(op)), Left: field, Right: value}
+	spans(n)
+	return n
+}
+
+// filterLiteral creates a literal node for a filter value at `offset`, as
+// long as the value would be when written in an expression.
+func filterLiteral(v any, offset uint16) *Node {
+	text := filterText(v)
+	return &Node{Type: NodeLiteral, Value: v, Offset: offset, Length: uint8(len(text)), Start: offset, End: offset + uint16(len(text))}
+}
+
+// filterText returns a filter value written as in an expression.
+func filterText(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	} else if v != nil {
+		return fmt.Sprint(v)
+	}
+	return "null"
+}
+
+// filterSource returns the expression equivalent to a filter, like
+// `price > 10`, which `BuildFilter` locates its nodes in.
+func filterSource(f Filter) string {
+	op := f.Op
+	if op == "" {
+		op = "=="
+	}
+	var items []string
+	switch v := f.Value.(type) {
+	case []any:
+		for _, item := range v {
+			items = append(items, filterText(item))
+		}
+	case []string:
+		for _, item := range v {
+			items = append(items, filterText(item))
+		}
+	default:
+		return f.Field + " " + op + " " + filterText(f.Value)
+	}
+	return f.Field + " " + op + " [" + strings.Join(items, ", ") + "]"
+}
+
+// move shifts the location of a node and its children by `offset`.
+func move(ast *Node, offset uint16) {
+	if ast == nil {
+		return
+	}
+	ast.Offset += offset
+	ast.Start += offset
+	ast.End += offset
+	move(ast.Left, offset)
+	move(ast.Right, offset)
+	for _, arg := range ast.Args {
+		move(arg, offset)
+	}
+}
+
+// isPath returns whether a node is a property path like `a.b[0].c`.
+func isPath(ast *Node) bool {
+	switch ast.Type {
+	case NodeIdentifier:
+		return true
+	case NodeFieldSelect:
+		return isPath(ast.Left) && isPath(ast.Right)
+	case NodeArrayIndex:
+		return isPath(ast.Left) && ast.Right.Type == NodeLiteral
+	}
+	return false
+}
+
+// FilterFromQuery builds a filter from URL query parameters, combining
+// form-style parameters with a free-text expression. Parameters are named in
+// the style of JSON:API and all are required to match:
+//
+//   - `filter=<expression>` is a free-text expression like `price > 10`
+//   - `filter[status]=active` compares a field for equality
+//   - `filter[price][gt]=10` uses an operator, one of `eq`, `ne`, `lt`, `lte`,
+//     `gt`, `gte`, `in`, `contains`, `startsWith`, `endsWith`, `before`,
+//     `after`, or `like`
+//
+// Values for `in` are separated by commas, e.g. `filter[status][in]=a,b`.
+// Other parameters, like those for paging, are ignored. If `types` is passed,
+// values are converted to the type of their field and the result is type
+// checked. Otherwise decimal numbers, booleans, and `null` are converted, but
+// numbers with leading zeros like `filter[zip]=02134` or other forms like
+// `0x10` stay strings. Returns `nil` if there are no filter parameters.
+//
+// Each parameter is located on its own, so errors are a `*ProgramError` named
+// after the parameter, like `filter[price][gt]`, with its expression. For
+// form-style parameters that is the equivalent expression, like `price > 10`.
+func FilterFromQuery(query url.Values, types any, options ...InterpreterOption) (*Node, Error) {
+	var s *schema
+	if types != nil {
+		s = getSchema(types)
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	// Sort for a consistent order, as Go maps are unordered.
+	sort.Strings(keys)
+
+	var result *Node
+	// Each part keeps its parameter and source to describe its errors.
+	var asts []*Node
+	var parts []*ProgramError
+	add := func(key, expression string, ast *Node) {
+		if ast == nil {
+			return
+		}
+		asts = append(asts, ast)
+		parts = append(parts, &ProgramError{Name: key, Expression: expression})
+		if result == nil {
+			result = ast
+		} else {
+			result = &Node{Type: NodeAnd, Left: result, Right: ast}
+		}
+	}
+	for _, key := range keys {
+		if key == "filter" {
+			for _, expression := range query[key] {
+				ast, err := Parse(expression, nil, options...)
+				if err != nil {
+					return nil, &ProgramError{Name: key, Expression: expression, Err: err}
+				}
+				add(key, expression, ast)
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		field, op := key[len("filter["):len(key)-1], ""
+		if idx := strings.Index(field, "]["); idx != -1 {
+			name := field[idx+2:]
+			if op = queryOps[name]; op == "" {
+				return nil, &ProgramError{Name: key, Err: newError(KindSyntax, 0, 0, "unknown filter operator %s", name)}
+			}
+			field = field[:idx]
+		}
+		fieldSchema := querySchema(s, field)
+		for _, raw := range query[key] {
+			var value any
+			if op == "in" {
+				items := []any{}
+				for _, item := range strings.Split(raw, ",") {
+					items = append(items, queryValue(item, fieldSchema))
+				}
+				value = items
+			} else {
+				value = queryValue(raw, fieldSchema)
+			}
+			f := Filter{Field: field, Op: op, Value: value}
+			ast, err := BuildFilter([]Filter{f})
+			if err != nil {
+				return nil, &ProgramError{Name: key, Expression: filterSource(f), Err: err}
+			}
+			add(key, filterSource(f), ast)
+		}
+	}
+
+	if types != nil {
+		for idx, ast := range asts {
+			if err := TypeCheck(ast, types, options...); err != nil {
+				parts[idx].Err = err
+				return result, parts[idx]
+			}
+		}
+	}
+	return result, nil
+}
+
+// querySchema returns the schema of a field path like `user.name`, or `nil`
+// if unknown. Properties of arrays use the schema of the items.
+func querySchema(s *schema, field string) *schema {
+	for _, name := range strings.Split(field, ".") {
+		if a := s.member(typeArray); a != nil && !s.isObject() {
+			s = a.items
+		}
+		next, ok := s.property(name)
+		if !ok {
+			return nil
+		}
+		s = next
+	}
+	if a := s.member(typeArray); a != nil {
+		// Filters on arrays like `tags contains x` compare items.
+		return a.items
+	}
+	return s
+}
+
+// queryValue converts a query parameter value to the type of its field, or
+// guesses the type if the field's type is unknown.
+func queryValue(raw string, s *schema) any {
+	if s != nil && !s.isAny() {
+		if s.isString() {
+			return raw
+		}
+		if s.isNumber() && isDecimal(raw) {
+			if n, err := strconv.ParseFloat(raw, 64); err == nil {
+				return n
+			}
+		}
+		if s.is(typeBool) {
+			if b, err := strconv.ParseBool(raw); err == nil {
+				return b
+			}
+		}
+		return raw
+	}
+	switch raw {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if isDecimal(raw) && !hasLeadingZero(raw) {
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return n
+		}
+	}
+	return raw
+}
+
+// hasLeadingZero returns whether a number has a leading zero like `02134`,
+// which is likely a code such as a zip code rather than a number.
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0' && s[1] != '.'
+}
+
+// isDecimal returns whether a string is a plain decimal number like `-1.5`,
+// unlike e.g. `NaN`, `Inf`, or `0x10` which `strconv.ParseFloat` accepts.
+func isDecimal(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	whole, fraction, found := strings.Cut(s, ".")
+	return isDigits(whole) && (!found || isDigits(fraction))
+}
+
+// isDigits returns whether a string is one or more ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package mexpr
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestBuildFilter(t *testing.T) {
+	ast, err := BuildFilter([]Filter{
+		{Field: "status", Value: "active"},
+		{Field: "price", Op: ">", Value: 10.0},
+		{Field: "user.name", Op: "startsWith", Value: "a"},
+		{Field: "tags", Op: "contains", Value: "sale"},
+		{Field: "region", Op: "in", Value: []string{"eu", "us"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := Parse(`status == "active" and price > 10 and user.name startsWith "a" and tags contains "sale" and region in ["eu", "us"]`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameNode(expected, ast) {
+		t.Fatalf("expected %s but found %s", expected.Dot(""), ast.Dot(""))
+	}
+	if !sameLocation(expected, ast) {
+		t.Fatal("expected nodes to be located like the equivalent expression")
+	}
+
+	input := map[string]any{
+		"status": "active",
+		"price":  15,
+		"user":   map[string]any{"name": "alice"},
+		"tags":   []any{"new", "sale"},
+		"region": "eu",
+	}
+	result, err := Run(ast, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != true {
+		t.Fatalf("expected match but found %v", result)
+	}
+
+	if ast, err := BuildFilter(nil); ast != nil || err != nil {
+		t.Fatalf("expected nil filter but found %v, %v", ast, err)
+	}
+	if _, err := BuildFilter([]Filter{{Field: "a", Op: "~", Value: 1}}); err == nil {
+		t.Fatal("expected unknown operator error")
+	}
+	if _, err := BuildFilter([]Filter{{Field: "a + b", Value: 1}}); err == nil {
+		t.Fatal("expected invalid field error")
+	}
+	if _, err := BuildFilter([]Filter{{Field: "a", Value: 1}, {Field: "b", Op: "~", Value: 1}}); err == nil || err.Offset() != 13 {
+		t.Fatalf("expected unknown operator error at offset 13 but found %v", err)
+	}
+}
+
+// sameLocation returns whether two ASTs have nodes at the same locations.
+func sameLocation(a, b *Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Offset != b.Offset || a.Length != b.Length || a.Start != b.Start || a.End != b.End || len(a.Args) != len(b.Args) {
+		return false
+	}
+	for idx := range a.Args {
+		if !sameLocation(a.Args[idx], b.Args[idx]) {
+			return false
+		}
+	}
+	return sameLocation(a.Left, b.Left) && sameLocation(a.Right, b.Right)
+}
+
+func TestFilterFromQuery(t *testing.T) {
+	types := map[string]any{
+		"status": "active",
+		"price":  1.0,
+		"zip":    "02134",
+		"region": "eu",
+	}
+	input := map[string]any{
+		"status": "active",
+		"price":  15.0,
+		"zip":    "02134",
+		"region": "eu",
+	}
+
+	cases := []struct {
+		query    string
+		types    any
+		expected string
+		matches  bool
+	}{
+		{query: "filter[status]=active", expected: `status == "active"`, matches: true},
+		{query: "filter[price][gt]=10&page=2", expected: `price > 10`, matches: true},
+		{query: "filter[zip]=02134", types: types, expected: `zip == "02134"`, matches: true},
+		{query: "filter[zip]=02134", expected: `zip == "02134"`, matches: true},
+		{query: "filter[price][lt]=0.5&filter[status][ne]=-0", expected: `price < 0.5 and status != 0`, matches: false},
+		{query: "filter[region][in]=us,eu", expected: `region in ["us", "eu"]`, matches: true},
+		{query: "filter=price < 20&filter[status][ne]=active", expected: `price < 20 and status != "active"`, matches: false},
+		{query: "filter[price][gt]=9.5", expected: `price > 9.5`, matches: true},
+		{query: "filter[status]=nan", expected: `status == "nan"`, matches: false},
+		{query: "filter[status][in]=0x10,Infinity", expected: `status in ["0x10", "Infinity"]`, matches: false},
+		{query: "filter[price]=inf", types: types, expected: `price == "inf"`, matches: false},
+		{query: "filter[price]=015", types: types, expected: `price == 15`, matches: true},
+		{query: "page=2", expected: ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			ast, err := FilterFromQuery(query, tc.types)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.expected == "" {
+				if ast != nil {
+					t.Fatalf("expected nil filter but found %s", ast.Dot(""))
+				}
+				return
+			}
+			expected, err := Parse(tc.expected, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameNode(expected, ast) {
+				t.Fatalf("expected %s but found %s", expected.Dot(""), ast.Dot(""))
+			}
+			result, err := Run(ast, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tc.matches) {
+				t.Fatalf("expected %v but found %v", tc.matches, result)
+			}
+		})
+	}
+
+	errors := []struct {
+		query      string
+		name       string
+		expression string
+		offset     uint16
+	}{
+		{query: "filter[a][nope]=1", name: "filter[a][nope]"},
+		{query: "filter=a >", name: "filter", expression: "a >", offset: 3},
+		{query: "filter=price > 1&filter[missing]=1", name: "filter[missing]", expression: `missing == 1`, offset: 0},
+		{query: "filter[status]=a&filter=price > status", name: "filter", expression: "price > status", offset: 6},
+	}
+	for _, tc := range errors {
+		values, _ := url.ParseQuery(tc.query)
+		_, err := FilterFromQuery(values, types)
+		perr, ok := err.(*ProgramError)
+		if !ok {
+			t.Fatalf("expected program error for %s but found %v", tc.query, err)
+		}
+		if perr.Name != tc.name || perr.Expression != tc.expression || perr.Offset() != tc.offset {
+			t.Fatalf("unexpected error for %s: %s %q %d", tc.query, perr.Name, perr.Expression, perr.Offset())
+		}
+	}
+}
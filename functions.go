@@ -0,0 +1,689 @@
+package mexpr
+
+import (
+	"encoding/base64"
+	"math"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// function describes a built-in function which can be called like
+// `default(a, 1)` or as a method on a value like `a.default(1)`, where the
+// value is passed as the first argument.
+type function struct {
+	// minArgs and maxArgs limit the number of arguments that can be passed.
+	minArgs int
+	maxArgs int
+
+	// allowMissing lets the first argument reference missing properties, even
+	// in strict mode, in which case it is treated as `nil`.
+	allowMissing bool
+
+	// call runs the function with the evaluated arguments.
+	call func(i *interpreter, ast *Node, args []any) (any, Error)
+
+	// returns gives the result type for the argument types. If not set, the
+	// result can be anything.
+	returns func(i *typeChecker, ast *Node, args []*schema) (*schema, Error)
+}
+
+// functions is the set of built-in functions available to expressions.
+var functions = map[string]*function{
+	"default": {
+		minArgs:      2,
+		maxArgs:      2,
+		allowMissing: true,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isEmpty(args[0]) {
+				return args[1], nil
+			}
+			return args[0], nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			if args[0].isAny() {
+				return schemaAny, nil
+			}
+			if args[0].typeName == typeNull {
+				return args[1], nil
+			}
+			if args[0].nullable {
+				return newUnion(args[0], args[1]), nil
+			}
+			return args[0], nil
+		},
+	},
+	"has": {
+		minArgs: 2,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			switch m := args[0].(type) {
+			case map[string]any:
+				_, ok := m[toString(args[1])]
+				return ok, nil
+			case map[any]any:
+				_, ok := m[args[1]]
+				return ok, nil
+			}
+			return false, nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaBool, nil
+		},
+	},
+	"number": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			return castNumber(ast, args[0])
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaNumber, nil
+		},
+	},
+	"int": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if n, ok := toInteger(args[0]); ok {
+				return n, nil
+			}
+			if s, ok := args[0].(string); ok {
+				if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+					return n, nil
+				}
+			}
+			f, err := castNumber(ast, args[0])
+			if err != nil || f == nil {
+				return f, err
+			}
+			n := math.Trunc(f.(float64))
+			if math.IsNaN(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+				return nil, newNodeError(KindRuntime, ast, "cannot convert %v to integer", args[0])
+			}
+			return int64(n), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaInt, nil
+		},
+	},
+	"string": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			return toString(args[0]), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	},
+	"bool": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if s, ok := args[0].(string); ok {
+				if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+					return b, nil
+				}
+			}
+			return toBool(args[0]), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaBool, nil
+		},
+	},
+	"take": {
+		minArgs: 2,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			return paginate(ast, true, args[0], args[1])
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return i.checkPaging(ast, args[0], args[1])
+		},
+	},
+	"drop": {
+		minArgs: 2,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			return paginate(ast, false, args[0], args[1])
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return i.checkPaging(ast, args[0], args[1])
+		},
+	},
+	"startOfDay":   startOf(func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()) }),
+	"startOfMonth": startOf(func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()) }),
+	"startOfYear":  startOf(func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location()) }),
+	"match": {
+		minArgs: 2,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			if err := i.checkStrings(ast, args[0], args[1]); err != nil {
+				return nil, err
+			}
+			re, err := i.regexp(ast, toString(args[1]))
+			if err != nil {
+				return nil, err
+			}
+			groups := re.FindStringSubmatch(toString(args[0]))
+			if groups == nil {
+				return nil, nil
+			}
+			names := re.SubexpNames()
+			var named map[string]any
+			for idx, name := range names {
+				if name != "" {
+					if named == nil {
+						named = map[string]any{}
+					}
+					named[name] = groups[idx]
+				}
+			}
+			if named != nil {
+				return named, nil
+			}
+			results := make([]any, len(groups))
+			for idx, group := range groups {
+				results[idx] = group
+			}
+			return results, nil
+		},
+	},
+	"clamp": {
+		minArgs: 3,
+		maxArgs: 3,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			for _, arg := range args {
+				if !isNumber(arg) {
+					return nil, newNodeError(KindTypeMismatch, ast, "clamp expects numbers but found %v", arg)
+				}
+			}
+			cmp, err := i.compareNumbers(ast, args[1], args[2])
+			if err != nil {
+				return nil, err
+			}
+			if cmp > 0 {
+				return nil, newNodeError(KindRuntime, ast, "clamp minimum %v is greater than maximum %v", args[1], args[2])
+			}
+			for idx, bound := range args[1:] {
+				cmp, err := i.compareNumbers(ast, args[0], bound)
+				if err != nil {
+					return nil, err
+				}
+				if (idx == 0 && cmp < 0) || (idx == 1 && cmp > 0) {
+					return bound, nil
+				}
+			}
+			return args[0], nil
+		},
+		returns: returnsNumber(schemaNumber),
+	},
+	"similarity": {
+		minArgs: 2,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if err := i.checkStrings(ast, args[0], args[1]); err != nil {
+				return nil, err
+			}
+			a, b := toString(args[0]), toString(args[1])
+			if utf8.RuneCountInString(a) > maxSimilarityLength || utf8.RuneCountInString(b) > maxSimilarityLength {
+				return nil, newNodeError(KindLimitExceeded, ast, "similarity expects strings of at most %d characters", maxSimilarityLength)
+			}
+			return similarity(a, b), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaFloat, nil
+		},
+	},
+	"padStart": padding(true),
+	"padEnd":   padding(false),
+	"base64": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			return base64.StdEncoding.EncodeToString([]byte(toString(args[0]))), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	},
+	"base64decode": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			s := strings.TrimSpace(toString(args[0]))
+			// Accept both the standard and URL-safe alphabets, with or without
+			// padding.
+			for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+				if decoded, err := encoding.DecodeString(s); err == nil {
+					return string(decoded), nil
+				}
+			}
+			return nil, newNodeError(KindRuntime, ast, "invalid base64 value %q", s)
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	},
+	"urlencode": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			return url.QueryEscape(toString(args[0])), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	},
+	"urldecode": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			decoded, err := url.QueryUnescape(toString(args[0]))
+			if err != nil {
+				return nil, newNodeError(KindRuntime, ast, "invalid URL encoded value %q", toString(args[0]))
+			}
+			return decoded, nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	},
+	"round": {
+		minArgs: 1,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			places, err := decimalPlaces(ast, args)
+			if err != nil {
+				return nil, err
+			}
+			if r, ok := args[0].(*big.Rat); ok {
+				return ratRound(r, places), nil
+			}
+			f, err := toNumber(ast, args[0])
+			if err != nil {
+				return nil, err
+			}
+			return roundFloat(f, places), nil
+		},
+		returns: returnsNumber(schemaNumber),
+	},
+	"fixed": {
+		minArgs: 1,
+		maxArgs: 2,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			places, err := decimalPlaces(ast, args)
+			if err != nil {
+				return nil, err
+			}
+			if places < 0 {
+				places = 0
+			}
+			if r, ok := args[0].(*big.Rat); ok {
+				return r.FloatString(places), nil
+			}
+			f, err := toNumber(ast, args[0])
+			if err != nil {
+				return nil, err
+			}
+			return strconv.FormatFloat(roundFloat(f, places), 'f', places, 64), nil
+		},
+		returns: returnsNumber(schemaString),
+	},
+}
+
+// maxSimilarityLength limits the length of strings compared by `similarity`,
+// which takes time proportional to the product of their lengths.
+const maxSimilarityLength = 1_000
+
+// maxPadLength limits the length of strings created by `padStart` and
+// `padEnd`.
+const maxPadLength = 1_000_000
+
+// padding creates a function which pads a string to a minimum length with
+// an optional pad string, which defaults to a space. The pad string is
+// repeated and truncated as needed, like in JavaScript. The length must be a
+// non-negative integer of at most `maxPadLength`.
+func padding(start bool) *function {
+	return &function{
+		minArgs: 2,
+		maxArgs: 3,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			if i.strictTypes && !isString(args[0]) {
+				return nil, newNodeError(KindTypeMismatch, ast, "%s expects a string but found %v", ast.Value, args[0])
+			}
+			length, err := toNumber(ast, args[1])
+			if err != nil {
+				return nil, err
+			}
+			if length != math.Trunc(length) {
+				return nil, newNodeError(KindTypeMismatch, ast, "%s length must be an integer but found %v", ast.Value, args[1])
+			}
+			if length < 0 {
+				return nil, newNodeError(KindRuntime, ast, "%s length cannot be negative but found %v", ast.Value, args[1])
+			}
+			if length > maxPadLength {
+				return nil, newNodeError(KindLimitExceeded, ast, "%s length is larger than %d", ast.Value, maxPadLength)
+			}
+			pad := " "
+			if len(args) > 2 {
+				pad = toString(args[2])
+			}
+			s := toString(args[0])
+			missing := int(length) - utf8.RuneCountInString(s)
+			if missing <= 0 || pad == "" {
+				return s, nil
+			}
+			fill := []rune(strings.Repeat(pad, missing/utf8.RuneCountInString(pad)+1))[:missing]
+			if start {
+				return string(fill) + s, nil
+			}
+			return s + string(fill), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			if !args[1].isAny() && !args[1].isNumber() {
+				return i.fail(newNodeError(KindTypeMismatch, ast, "%s expects a number length but found %s", ast.Value, args[1]))
+			}
+			return schemaString, nil
+		},
+	}
+}
+
+// startOf creates a function which converts its argument to a date and
+// truncates it, e.g. to the start of the month.
+func startOf(truncate func(t time.Time) time.Time) *function {
+	return &function{
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			t := i.toTime(args[0])
+			if t.IsZero() {
+				return nil, newNodeError(KindTypeMismatch, ast, "unable to convert %v to date or time", args[0])
+			}
+			return truncate(t), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaDate, nil
+		},
+	}
+}
+
+// similarity returns how similar two strings are from `0` to `1` based on
+// the Levenshtein edit distance, where `1` means the strings are equal.
+func similarity(a, b string) float64 {
+	length := utf8.RuneCountInString(a)
+	if n := utf8.RuneCountInString(b); n > length {
+		length = n
+	}
+	if length == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(a, b))/float64(length)
+}
+
+// editDistance returns the Levenshtein distance between two strings, i.e. the
+// number of single character insertions, deletions, and substitutions needed
+// to change one into the other.
+func editDistance(a, b string) int {
+	left, right := []rune(a), []rune(b)
+	prev := make([]int, len(right)+1)
+	curr := make([]int, len(right)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(left); i++ {
+		curr[0] = i
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(right)]
+}
+
+// returnsNumber creates a type check for functions taking a number followed
+// by optional numeric arguments and returning the given type. A `null` first
+// argument is passed through.
+func returnsNumber(result *schema) func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+	return func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+		if args[0].typeName == typeNull {
+			// A `null` value is passed through.
+			return schemaNull, nil
+		}
+		for _, arg := range args {
+			if !arg.isAny() && !arg.isNumber() {
+				return i.fail(newNodeError(KindTypeMismatch, ast, "%s expects numbers but found %s", ast.Value, arg))
+			}
+		}
+		if args[0].nullable {
+			return newUnion(result, schemaNull), nil
+		}
+		return result, nil
+	}
+}
+
+// decimalPlaces returns the optional number of decimal places argument,
+// defaulting to zero.
+func decimalPlaces(ast *Node, args []any) (int, Error) {
+	if len(args) < 2 {
+		return 0, nil
+	}
+	places, err := toNumber(ast, args[1])
+	if err != nil {
+		return 0, err
+	}
+	if places < -15 || places > 15 {
+		return 0, newNodeError(KindRuntime, ast, "decimal places must be between -15 and 15 but found %v", places)
+	}
+	return int(places), nil
+}
+
+// roundFloat rounds a number half away from zero to the given number of
+// decimal places, which may be negative to round to e.g. the nearest 100.
+func roundFloat(f float64, places int) float64 {
+	if places < 0 {
+		p := math.Pow10(-places)
+		return math.Round(f/p) * p
+	}
+	p := math.Pow10(places)
+	return math.Round(f*p) / p
+}
+
+// castNumber converts a value to a `float64`, parsing strings and treating
+// booleans as `1` or `0`. Strings must be finite numbers, so `"NaN"` and
+// `"Inf"` are rejected. Returns `nil` for `nil` values.
+func castNumber(ast *Node, v any) (any, Error) {
+	switch n := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if n {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(n), "_", ""), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, newNodeError(KindTypeMismatch, ast, "cannot convert %q to number", n)
+		}
+		return f, nil
+	}
+	f, err := toNumber(ast, v)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// isEmpty returns whether a value is `nil` or an empty string, array, or map.
+func isEmpty(v any) bool {
+	switch n := v.(type) {
+	case nil, undefined:
+		return true
+	case string:
+		return n == ""
+	case []byte:
+		return len(n) == 0
+	case []any:
+		return len(n) == 0
+	case map[string]any:
+		return len(n) == 0
+	case map[any]any:
+		return len(n) == 0
+	}
+	return false
+}
+
+// hasKey returns whether the value is a map containing the key.
+func hasKey(v any, key string) bool {
+	switch m := v.(type) {
+	case map[string]any:
+		_, ok := m[key]
+		return ok
+	case map[any]any:
+		_, ok := m[key]
+		return ok
+	}
+	return false
+}
+
+// lookupFunction returns the named function, checking that it accepts the
+// given number of arguments.
+func lookupFunction(ast *Node, argCount int) (*function, Error) {
+	name := ast.Value.(string)
+	f := functions[name]
+	if f == nil {
+		return nil, newNodeError(KindSyntax, ast, "unknown function %s", name)
+	}
+	if argCount < f.minArgs || argCount > f.maxArgs {
+		if f.minArgs == f.maxArgs {
+			return nil, newNodeError(KindSyntax, ast, "%s expects %d arguments but found %d", name, f.minArgs, argCount)
+		}
+		return nil, newNodeError(KindSyntax, ast, "%s expects %d to %d arguments but found %d", name, f.minArgs, f.maxArgs, argCount)
+	}
+	return f, nil
+}
+
+// allowsMissing returns whether the node is a call to a function which allows
+// its first argument to reference missing properties.
+func allowsMissing(ast *Node) bool {
+	if ast == nil || ast.Type != NodeCall {
+		return false
+	}
+	f := functions[ast.Value.(string)]
+	return f != nil && f.allowMissing
+}
+
+// call runs a built-in function. For method calls like `a.default(1)` the
+// `receiver` is passed as the first argument. Arguments are always evaluated
+// against `value`.
+func (i *interpreter) call(ast *Node, receiver []any, value any) (any, Error) {
+	f, err := lookupFunction(ast, len(receiver)+len(ast.Args))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]any, 0, len(receiver)+len(ast.Args))
+	args = append(args, receiver...)
+	for _, arg := range ast.Args {
+		result, err := i.run(arg, value)
+		if err != nil {
+			if f.allowMissing && len(args) == 0 && err.Kind() == KindUnknownProperty {
+				args = append(args, nil)
+				continue
+			}
+			return nil, err
+		}
+		args = append(args, result)
+	}
+	return f.call(i, ast, args)
+}
+
+// call type checks a call to a built-in function. See `interpreter.call`.
+func (i *typeChecker) call(ast *Node, receiver []*schema, value any) (*schema, Error) {
+	f, err := lookupFunction(ast, len(receiver)+len(ast.Args))
+	if err != nil {
+		return i.fail(err)
+	}
+	args := make([]*schema, 0, len(receiver)+len(ast.Args))
+	args = append(args, receiver...)
+	for _, arg := range ast.Args {
+		var result *schema
+		if f.allowMissing && len(args) == 0 {
+			result, err = i.runAllowMissing(arg, value)
+		} else {
+			result, err = i.run(arg, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, result)
+	}
+	if f.returns == nil {
+		return schemaAny, nil
+	}
+	return f.returns(i, ast, args)
+}
+
+// runAllowMissing type checks a node which may reference missing properties,
+// in which case the result is `null`.
+func (i *typeChecker) runAllowMissing(ast *Node, value any) (*schema, Error) {
+	// Stop collecting errors so that missing properties can be ignored.
+	collect := i.collect
+	i.collect = false
+	result, err := i.run(ast, value)
+	i.collect = collect
+	if err != nil {
+		if err.Kind() != KindUnknownProperty {
+			return i.fail(err)
+		}
+		return schemaNull, nil
+	}
+	return result, nil
+}
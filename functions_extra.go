@@ -0,0 +1,72 @@
+//go:build !mexpr_lite
+
+package mexpr
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// extraFunctions are left out of builds with the `mexpr_lite` build tag for
+// smaller binaries, which means the `crypto` packages aren't needed.
+var extraFunctions = map[string]*function{
+	"json": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			var value any
+			if err := json.Unmarshal([]byte(toString(args[0])), &value); err != nil {
+				return nil, newNodeError(KindRuntime, ast, "invalid JSON: %v", err)
+			}
+			return value, nil
+		},
+	},
+	"tojson": {
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if args[0] == Undefined {
+				return "null", nil
+			}
+			encoded, err := json.Marshal(args[0])
+			if err != nil {
+				return nil, newNodeError(KindRuntime, ast, "unable to convert to JSON: %v", err)
+			}
+			return string(encoded), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	},
+	"sha256": digest(func(b []byte) []byte { h := sha256.Sum256(b); return h[:] }),
+	"md5":    digest(func(b []byte) []byte { h := md5.Sum(b); return h[:] }),
+}
+
+func init() {
+	for name, f := range extraFunctions {
+		functions[name] = f
+	}
+}
+
+// digest creates a function which hashes its string argument and returns the
+// hex-encoded digest.
+func digest(hash func([]byte) []byte) *function {
+	return &function{
+		minArgs: 1,
+		maxArgs: 1,
+		call: func(i *interpreter, ast *Node, args []any) (any, Error) {
+			if isNil(args[0]) {
+				return nil, nil
+			}
+			return hex.EncodeToString(hash([]byte(toString(args[0])))), nil
+		},
+		returns: func(i *typeChecker, ast *Node, args []*schema) (*schema, Error) {
+			return schemaString, nil
+		},
+	}
+}
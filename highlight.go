@@ -0,0 +1,105 @@
+package mexpr
+
+// HighlightCategory describes how to color a part of an expression.
+type HighlightCategory uint8
+
+// Highlight categories
+const (
+	HighlightIdentifier HighlightCategory = iota
+	HighlightKeyword
+	HighlightOperator
+	HighlightString
+	HighlightNumber
+	HighlightPunctuation
+)
+
+func (c HighlightCategory) String() string {
+	switch c {
+	case HighlightIdentifier:
+		return "identifier"
+	case HighlightKeyword:
+		return "keyword"
+	case HighlightOperator:
+		return "operator"
+	case HighlightString:
+		return "string"
+	case HighlightNumber:
+		return "number"
+	}
+	return "punctuation"
+}
+
+// HighlightSpan is a part of an expression returned by `Highlight`.
+type HighlightSpan struct {
+	// Offset of the first byte of the span in the expression.
+	Offset int
+
+	// Length of the span in bytes.
+	Length int
+
+	Category HighlightCategory
+}
+
+// Highlight splits an expression into categorized spans for syntax
+// highlighting, using the same lexer as the parser. Whitespace is not
+// included. Keywords like `and` are distinguished from identifiers, including
+// properties named like keywords such as `foo.in`. Strings include their
+// quotes. If the expression can't be tokenized, the spans found so far are
+// returned with the error.
+func Highlight(expression string) ([]HighlightSpan, Error) {
+	l := NewLexer(expression).(*lexer)
+	spans := []HighlightSpan{}
+	end := 0
+	for {
+		t, err := l.Next()
+		if err != nil {
+			return spans, err
+		}
+		start := skipSpace(expression, end)
+		if t.Type == TokenEOF {
+			if start < len(expression) && expression[start] == '.' {
+				// The lexer stops at a trailing dot, e.g. while typing `foo.`.
+				spans = append(spans, HighlightSpan{Offset: start, Length: 1, Category: HighlightPunctuation})
+			}
+			return spans, nil
+		}
+		end = int(l.pos)
+		spans = append(spans, HighlightSpan{Offset: start, Length: end - start, Category: categorize(t)})
+	}
+}
+
+// skipSpace returns the offset of the first non-whitespace byte at or after
+// `start`.
+func skipSpace(expression string, start int) int {
+	for start < len(expression) {
+		switch expression[start] {
+		case ' ', '\t', '\r', '\n':
+			start++
+			continue
+		}
+		break
+	}
+	return start
+}
+
+// categorize returns the highlight category of a token.
+func categorize(t *Token) HighlightCategory {
+	switch t.Type {
+	case TokenIdentifier:
+		return HighlightIdentifier
+	case TokenString:
+		return HighlightString
+	case TokenNumber:
+		return HighlightNumber
+	case TokenAnd, TokenOr, TokenNot:
+		if isWord(t.Value) {
+			return HighlightKeyword
+		}
+		return HighlightOperator
+	case TokenStringCompare, TokenWhere, TokenExists, TokenTransform, TokenPaging, TokenAggregate:
+		return HighlightKeyword
+	case TokenLeftParen, TokenRightParen, TokenLeftBracket, TokenRightBracket, TokenComma, TokenDot, TokenSlice, TokenSemicolon:
+		return HighlightPunctuation
+	}
+	return HighlightOperator
+}
@@ -0,0 +1,98 @@
+package mexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	cases := []struct {
+		expr     string
+		expected []string
+	}{
+		{expr: `a.b > 1.5`, expected: []string{"identifier a", "punctuation .", "identifier b", "operator >", "number 1.5"}},
+		{expr: `name startsWith "a \"b\"" and not x`, expected: []string{"identifier name", "keyword startsWith", `string "a \"b\""`, "keyword and", "keyword not", "identifier x"}},
+		{expr: `!a && b || c`, expected: []string{"operator !", "identifier a", "operator &&", "identifier b", "operator ||", "identifier c"}},
+		{expr: `foo.in where items[0:2]`, expected: []string{"identifier foo", "punctuation .", "identifier in", "keyword where", "identifier items", "punctuation [", "number 0", "punctuation :", "number 2", "punctuation ]"}},
+		{expr: `default(a, 1)`, expected: []string{"identifier default", "punctuation (", "identifier a", "punctuation ,", "number 1", "punctuation )"}},
+		{expr: "`a b`.\"c\" > 1", expected: []string{"identifier `a b`", "punctuation .", `string "c"`, "operator >", "number 1"}},
+		{expr: ` user. `, expected: []string{"identifier user", "punctuation ."}},
+		{expr: `"日本" + x`, expected: []string{`string "日本"`, "operator +", "identifier x"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			spans, err := Highlight(tc.expr)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			var found []string
+			for _, s := range spans {
+				found = append(found, s.Category.String()+" "+tc.expr[s.Offset:s.Offset+s.Length])
+			}
+			if !reflect.DeepEqual(tc.expected, found) {
+				t.Fatalf("expected %v but found %v", tc.expected, found)
+			}
+		})
+	}
+}
+
+func TestHighlightError(t *testing.T) {
+	spans, err := Highlight(`a & b`)
+	if err == nil || len(spans) != 1 {
+		t.Fatalf("expected error after one span but found %v %v", spans, err)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(`a.b >= "x y"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Token{
+		{Type: TokenIdentifier, Offset: 0, Length: 1, Value: "a"},
+		{Type: TokenDot, Offset: 1, Length: 1, Value: "."},
+		{Type: TokenIdentifier, Offset: 2, Length: 1, Value: "b"},
+		{Type: TokenComparison, Offset: 4, Length: 2, Value: ">="},
+		{Type: TokenString, Offset: 7, Length: 5, Value: "x y"},
+	}
+	if !reflect.DeepEqual(expected, tokens) {
+		t.Fatalf("expected %v but found %v", expected, tokens)
+	}
+
+	tokens, err = Tokenize(`a + "b`, StrictSyntax)
+	if err == nil || len(tokens) != 2 {
+		t.Fatalf("expected partial tokens with an error, found %v %v", tokens, err)
+	}
+}
+
+func TestPreserveTrivia(t *testing.T) {
+	expr := "  a.b >=\n\t\"x\\\"y\" and  (c) "
+	l := NewLexer(expr, PreserveTrivia)
+	trivia := []string{}
+	reproduced := ""
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		trivia = append(trivia, tok.Trivia)
+		reproduced += tok.Trivia
+		if tok.Type == TokenEOF {
+			break
+		}
+		reproduced += expr[tok.Offset : int(tok.Offset)+int(tok.Length)]
+	}
+	if reproduced != expr {
+		t.Fatalf("expected %q but reproduced %q", expr, reproduced)
+	}
+	expected := []string{"  ", "", "", " ", "\n\t", " ", "  ", "", "", " "}
+	if !reflect.DeepEqual(expected, trivia) {
+		t.Fatalf("expected trivia %q but found %q", expected, trivia)
+	}
+
+	tokens, _ := Tokenize(" a")
+	if tokens[0].Trivia != "" {
+		t.Fatal("trivia should only be recorded with PreserveTrivia")
+	}
+}
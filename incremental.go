@@ -0,0 +1,156 @@
+package mexpr
+
+import "strings"
+
+// Incremental runs an expression against input which changes slowly over
+// time, like the state behind a dashboard. Results of parts of the expression
+// are cached, and only the parts which depend on changed properties are run
+// again. It is not safe for concurrent use.
+type Incremental struct {
+	i *interpreter
+}
+
+// memo is the cached result of a node.
+type memo struct {
+	value any
+	err   Error
+}
+
+// NewIncremental creates an incremental evaluator for the given AST.
+func NewIncremental(ast *Node, options ...InterpreterOption) *Incremental {
+	i := NewInterpreter(ast, options...).(*interpreter)
+	// Cached results may be reused by later runs, so can't share buffers.
+	i.buffers = nil
+	i.deps = map[*Node][]string{}
+	dependencies(ast, false, i.deps)
+	i.memos = map[*Node]memo{}
+	return &Incremental{i: i}
+}
+
+// Run evaluates the expression against the input. Parts of the expression
+// which only depend on unchanged properties return their cached result from
+// the previous run. Changed properties are paths like `user.name`, and
+// changing a property also changes everything inside it, e.g. `user` covers
+// `user.name`. Arrays change as a whole, so use `items` rather than an index.
+// The first run evaluates the entire expression.
+func (e *Incremental) Run(input any, changed ...string) (any, Error) {
+	for ast, deps := range e.i.deps {
+		if _, ok := e.i.memos[ast]; !ok {
+			continue
+		}
+		for _, dep := range deps {
+			if overlaps(dep, changed) {
+				delete(e.i.memos, ast)
+				break
+			}
+		}
+	}
+	return e.i.Run(input)
+}
+
+// Reset clears all cached results, so the next run evaluates the entire
+// expression.
+func (e *Incremental) Reset() {
+	e.i.memos = map[*Node]memo{}
+}
+
+// overlaps returns whether a dependency is affected by any of the changed
+// paths. The empty path depends on the entire input.
+func overlaps(dep string, changed []string) bool {
+	for _, c := range changed {
+		if dep == "" || c == "" || dep == c || strings.HasPrefix(dep, c+".") || strings.HasPrefix(c, dep+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencies finds the input properties each node depends on and adds them
+// to `deps`, returning the properties for `ast`. Nodes whose results can't be
+// cached, like those using `now`, are left out of `deps` along with their
+// parents. Nodes run once for each item, like `where` conditions, use
+// `inItem` and are never cached.
+func dependencies(ast *Node, inItem bool, deps map[*Node][]string) ([]string, bool) {
+	if ast == nil {
+		return nil, true
+	}
+	var result []string
+	cacheable := true
+	add := func(node *Node, inItem bool) {
+		d, ok := dependencies(node, inItem, deps)
+		result = append(result, d...)
+		cacheable = cacheable && ok
+	}
+	switch ast.Type {
+	case NodeIdentifier:
+		switch name := ast.Value.(string); name {
+		case "now":
+			cacheable = false
+		case "@", "$root", "$parent":
+			if !inItem || name != "@" {
+				// These may depend on the entire input.
+				result = []string{""}
+			}
+		case "$key", "$value":
+		default:
+			if !inItem {
+				result = []string{name}
+			}
+		}
+	case NodeFieldSelect:
+		if path := propertyPath(ast); path != nil && !inItem {
+			result = []string{strings.Join(path, ".")}
+			break
+		}
+		if path, ok := rootPath(ast); ok {
+			result = []string{strings.Join(path, ".")}
+			break
+		}
+		add(ast.Left, inItem)
+		if ast.Right != nil && ast.Right.Type == NodeCall {
+			// Method call arguments are run in the same scope as the left side.
+			for _, arg := range ast.Right.Args {
+				add(arg, inItem)
+			}
+		} else {
+			// Properties on the right are selected from the left side's value,
+			// which is already a dependency.
+			add(ast.Right, true)
+		}
+	case NodeWhere, NodeSumBy, NodeMinBy, NodeMaxBy:
+		add(ast.Left, inItem)
+		add(ast.Right, true)
+	case NodeSlice:
+		// Slice bounds are reused between evaluations, so only the parent's
+		// result can be cached.
+		add(ast.Left, inItem)
+		add(ast.Right, inItem)
+		return result, cacheable
+	default:
+		add(ast.Left, inItem)
+		add(ast.Right, inItem)
+		for _, arg := range ast.Args {
+			add(arg, inItem)
+		}
+	}
+	if cacheable && !inItem {
+		deps[ast] = result
+	}
+	return result, cacheable
+}
+
+// rootPath returns the property names of a chain starting at `$root`, like
+// `min` for `$root.min`.
+func rootPath(ast *Node) ([]string, bool) {
+	switch ast.Type {
+	case NodeIdentifier:
+		return nil, ast.Value == "$root"
+	case NodeFieldSelect:
+		if ast.Right != nil && ast.Right.Type == NodeIdentifier && ast.Right.Value != "@" {
+			if path, ok := rootPath(ast.Left); ok {
+				return append(path, ast.Right.Value.(string)), true
+			}
+		}
+	}
+	return nil, false
+}
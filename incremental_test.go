@@ -0,0 +1,84 @@
+package mexpr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIncremental(t *testing.T) {
+	expr := `(orders where total > $root.min).length + user.score * 2 + items[0:1].length`
+	ast, err := Parse(expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &Stats{}
+	inc := NewIncremental(ast, WithStats(stats))
+
+	input := map[string]any{
+		"orders": []any{map[string]any{"total": 5.0}, map[string]any{"total": 20.0}},
+		"min":    10.0,
+		"user":   map[string]any{"score": 3.0},
+		"items":  []any{1.0, 2.0, 3.0},
+	}
+
+	run := func(changed ...string) int {
+		t.Helper()
+		result, err := inc.Run(input, changed...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := Eval(expr, input)
+		if result != expected {
+			t.Fatalf("expected %v but found %v after changing %v", expected, result, changed)
+		}
+		return stats.Nodes
+	}
+
+	all := run()
+	if nodes := run(); nodes != 0 {
+		t.Fatalf("expected cached result but evaluated %d nodes", nodes)
+	}
+
+	input["user"].(map[string]any)["score"] = 4.0
+	score := run("user.score")
+	if score >= all || score == 0 {
+		t.Fatalf("expected only the score to be evaluated but evaluated %d of %d nodes", score, all)
+	}
+
+	// Changing a parent property affects everything inside it.
+	input["user"] = map[string]any{"score": 10.0}
+	if nodes := run("user"); nodes != score {
+		t.Fatalf("expected %d nodes but evaluated %d", score, nodes)
+	}
+
+	// `$root` in a `where` depends on the entire input.
+	input["min"] = 1.0
+	if nodes := run("min"); nodes <= score {
+		t.Fatalf("expected the where clause to be evaluated but evaluated %d nodes", nodes)
+	}
+
+	input["items"] = []any{1.0, 2.0}
+	run("items")
+
+	inc.Reset()
+	if nodes := run(); nodes != all {
+		t.Fatalf("expected %d nodes after reset but evaluated %d", all, nodes)
+	}
+}
+
+func TestIncrementalNow(t *testing.T) {
+	clock := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ast, err := Parse(`created before now`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc := NewIncremental(ast, WithClock(func() time.Time { return clock }))
+	input := map[string]any{"created": "2022-06-01T00:00:00Z"}
+	if result, _ := inc.Run(input); result != false {
+		t.Fatalf("expected false but found %v", result)
+	}
+	clock = clock.AddDate(1, 0, 0)
+	if result, _ := inc.Run(input); result != true {
+		t.Fatalf("expected `now` to be evaluated again but found %v", result)
+	}
+}
@@ -1,107 +1,1227 @@
 package mexpr
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"math/big"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-// InterpreterOption passes configuration settings when creating a new
-// interpreter instance.
-type InterpreterOption int
+// checkBounds returns an error if the index is out of bounds.
+func checkBounds(ast *Node, input any, idx int) Error {
+	if v, ok := input.([]any); ok {
+		if idx < 0 || idx >= len(v) {
+			return wrapError(newNodeError(KindRuntime, ast, "invalid index %d for slice of length %d", int(idx), len(v)), ErrIndexOutOfRange)
+		}
+	}
+	if v, ok := input.(string); ok {
+		if length := utf8.RuneCountInString(v); idx < 0 || idx >= length {
+			return wrapError(newNodeError(KindRuntime, ast, "invalid index %d for string of length %d", int(idx), length), ErrIndexOutOfRange)
+		}
+	}
+	return nil
+}
+
+// runeOffset returns the byte offset of the rune at `idx` in the string, or
+// the string's length if `idx` is past the end. String indexes count runes so
+// that multi-byte characters aren't split.
+func runeOffset(s string, idx int) int {
+	for offset := range s {
+		if idx == 0 {
+			return offset
+		}
+		idx--
+	}
+	return len(s)
+}
+
+// integerMath runs an operation on two integers, returning an integer result.
+// Negative powers and results which overflow are the exception and return a
+// float.
+func integerMath(ast *Node, left, right int64) (any, Error) {
+	switch ast.Type {
+	case NodeAdd, NodeSubtract, NodeMultiply, NodePower:
+		if result, ok := checkedIntegerMath(ast.Type, left, right); ok {
+			return result, nil
+		}
+		l, r := float64(left), float64(right)
+		switch ast.Type {
+		case NodeAdd:
+			return l + r, nil
+		case NodeSubtract:
+			return l - r, nil
+		case NodeMultiply:
+			return l * r, nil
+		}
+		return math.Pow(l, r), nil
+	case NodeDivide, NodeModulus:
+		if right == 0 {
+			return nil, wrapError(newNodeError(KindRuntime, ast, "cannot divide by zero"), ErrDivideByZero)
+		}
+		if ast.Type == NodeDivide {
+			if left == math.MinInt64 && right == -1 {
+				return -float64(left), nil
+			}
+			return left / right, nil
+		}
+		return left % right, nil
+	}
+	return nil, newNodeError(KindRuntime, ast, "unknown integer operation %v", ast)
+}
+
+// floatMath runs an operation on two floats. Modulus of two whole numbers
+// returns an integer.
+func floatMath(ast *Node, left, right float64) (any, Error) {
+	switch ast.Type {
+	case NodeAdd:
+		return left + right, nil
+	case NodeSubtract:
+		return left - right, nil
+	case NodeMultiply:
+		return left * right, nil
+	case NodeDivide:
+		if right == 0.0 {
+			return nil, wrapError(newNodeError(KindRuntime, ast, "cannot divide by zero"), ErrDivideByZero)
+		}
+		return left / right, nil
+	case NodeModulus:
+		if right == 0 {
+			return nil, wrapError(newNodeError(KindRuntime, ast, "cannot divide by zero"), ErrDivideByZero)
+		}
+		if left != math.Trunc(left) || right != math.Trunc(right) {
+			return math.Mod(left, right), nil
+		}
+		return int(left) % int(right), nil
+	}
+	return math.Pow(left, right), nil
+}
+
+// checkedIntegerMath runs a math operation on two integers, returning false
+// if there is no exact integer result (e.g. on overflow or division) so that
+// the caller can fall back to floats.
+func checkedIntegerMath(nodeType NodeType, left, right int64) (int64, bool) {
+	switch nodeType {
+	case NodeAdd:
+		if r := left + right; (r > left) == (right > 0) {
+			return r, true
+		}
+	case NodeSubtract:
+		if r := left - right; (r < left) == (right > 0) {
+			return r, true
+		}
+	case NodeMultiply:
+		if left == 0 || right == 0 {
+			return 0, true
+		}
+		if (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+			return 0, false
+		}
+		if r := left * right; r/right == left {
+			return r, true
+		}
+	case NodeModulus:
+		if right != 0 {
+			return left % right, true
+		}
+	case NodePower:
+		if right >= 0 && left >= -1 && left <= 1 {
+			// Powers of -1, 0, and 1 never overflow, however large the exponent.
+			switch {
+			case right == 0:
+				return 1, true
+			case left == -1 && right%2 == 0:
+				return 1, true
+			}
+			return left, true
+		}
+		if right < 0 || right > 64 {
+			return 0, false
+		}
+		result := int64(1)
+		for n := int64(0); n < right; n++ {
+			var ok bool
+			if result, ok = checkedIntegerMath(NodeMultiply, result, left); !ok {
+				return 0, false
+			}
+		}
+		return result, true
+	}
+	return 0, false
+}
+
+// Interpreter executes expression AST programs.
+type Interpreter interface {
+	Run(value any) (any, Error)
+}
+
+// NewInterpreter returns an interpreter for the given AST. The AST is not
+// modified while running, so it can be shared by interpreters in different
+// goroutines, but each interpreter must only be used by one goroutine at a
+// time.
+func NewInterpreter(ast *Node, options ...InterpreterOption) Interpreter {
+	i := &interpreter{
+		ast:     ast,
+		config:  newConfig(options),
+		buffers: buffered(ast, nil),
+	}
+	if i.trace == nil && i.stats == nil && i.access == nil {
+		// These options need to see every node, so can't skip any with a path.
+		i.paths = compilePaths(ast, nil)
+	}
+	return i
+}
+
+// propertyPath returns the property names of a chain like `foo.bar.baz`, or
+// `nil` if the node is anything else, e.g. `foo[0].bar` or `$root.foo`.
+func propertyPath(ast *Node) []string {
+	switch ast.Type {
+	case NodeIdentifier:
+		switch name := ast.Value.(string); name {
+		case "@", "$root", "$parent", "$key", "$value":
+			return nil
+		default:
+			return []string{name}
+		}
+	case NodeFieldSelect:
+		if ast.Left == nil || ast.Right == nil || ast.Right.Type != NodeIdentifier || ast.Right.Value == "@" {
+			return nil
+		}
+		if path := propertyPath(ast.Left); path != nil {
+			return append(path, ast.Right.Value.(string))
+		}
+	}
+	return nil
+}
+
+// compilePaths finds the chains of properties like `foo.bar.baz` so they can
+// be looked up in one step rather than evaluating each node.
+func compilePaths(ast *Node, paths map[*Node][]string) map[*Node][]string {
+	if ast == nil {
+		return paths
+	}
+	if ast.Type == NodeFieldSelect {
+		if path := propertyPath(ast); path != nil {
+			if paths == nil {
+				paths = map[*Node][]string{}
+			}
+			paths[ast] = path
+		}
+	}
+	paths = compilePaths(ast.Left, paths)
+	paths = compilePaths(ast.Right, paths)
+	for _, arg := range ast.Args {
+		paths = compilePaths(arg, paths)
+	}
+	return paths
+}
+
+// lookup gets a property path from nested maps. If any part is missing or not
+// a map it returns false, and the nodes are evaluated as usual to handle
+// arrays, pseudo-properties like `length`, globals, and errors.
+func lookup(path []string, value any) (any, bool) {
+	for _, name := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// buffered finds the `where` clauses whose results are only used while
+// running, like `(items where id > 3).length == 1`, and adds an empty buffer
+// for each. These results are collected into the reused buffer rather than a
+// new slice on every run.
+func buffered(ast *Node, buffers map[*Node][]any) map[*Node][]any {
+	if ast == nil {
+		return buffers
+	}
+	consumes := false
+	switch ast.Type {
+	case NodeEqual, NodeNotEqual, NodeLessThan, NodeLessThanEqual, NodeGreaterThan, NodeGreaterThanEqual, NodeAnd, NodeOr, NodeNot, NodeIn, NodeContains:
+		consumes = true
+	case NodeFieldSelect:
+		if ast.Right != nil && ast.Right.Type == NodeIdentifier {
+			name := ast.Right.Value.(string)
+			consumes = name == "length" || name == "isEmpty"
+		}
+	}
+	for _, child := range [2]*Node{ast.Left, ast.Right} {
+		if consumes && child != nil && child.Type == NodeWhere {
+			if buffers == nil {
+				buffers = map[*Node][]any{}
+			}
+			buffers[child] = []any{}
+		}
+		buffers = buffered(child, buffers)
+	}
+	for _, arg := range ast.Args {
+		buffers = buffered(arg, buffers)
+	}
+	return buffers
+}
+
+// scope describes the current item of a `where` clause. The `parent` is the
+// value the clause was run in, while `key` is the item's index or map key.
+type scope struct {
+	parent any
+	key    any
+	value  any
+}
+
+type interpreter struct {
+	config
+	ast             *Node
+	prevFieldSelect bool
+
+	// prevProperty is set when the identifier is the property name on the
+	// right side of a `.`, which means it can't be a global.
+	prevProperty bool
+
+	// root is the input value, while scopes holds the state of nested `where`
+	// clauses for `$root`, `$parent`, `$key`, and `$value`.
+	root   any
+	scopes []scope
+
+	// now is the current time for the `now` identifier, set on first use so
+	// that it is consistent for the entire run.
+	now time.Time
+
+	// regexps caches compiled patterns across runs.
+	regexps map[string]*regexp.Regexp
+
+	// depth is the nesting level of the current node when tracing.
+	depth int
+
+	// explanations is the stack of nodes being evaluated for `Explain`.
+	explanations []*Explanation
+
+	// path is the path of property names to the current value, used for the
+	// `WithAccessHook` option.
+	path []string
+
+	// buffers holds reusable result slices for `where` clauses, see
+	// `buffered`.
+	buffers map[*Node][]any
+
+	// slices holds the start and end of each slice like `items[1:3]`, which
+	// are reused to prevent allocations. Each slice node has its own bounds, so
+	// nested slices can't overwrite each other. They must not be stored in the
+	// AST, which may be shared by interpreters in other goroutines. Each
+	// `[]any` is stored already boxed, so returning it doesn't allocate.
+	slices map[*Node]any
+
+	// deps holds the input properties each node depends on and memos holds
+	// cached node results, used by `Incremental`.
+	deps  map[*Node][]string
+	memos map[*Node]memo
+
+	// paths holds the property names of chains like `foo.bar.baz`, see
+	// `compilePaths`.
+	paths map[*Node][]string
+
+	// observing is set when the run needs to see every node, see `run`.
+	observing bool
+
+	// items counts the range items created and the items iterated over by
+	// `where` clauses and aggregations during the current run, see `spend`.
+	items int
+
+	// hash identifies the expression in log events, see `hashAST`.
+	hash string
+}
+
+// pathOf returns the path of property names to the result of the node
+// relative to the current path, e.g. `["items", "id"]` for `items.id`. Array
+// indexes are skipped. Returns nil if the node is not a property path, like
+// a function call.
+func pathOf(ast *Node, base []string) []string {
+	switch ast.Type {
+	case NodeIdentifier:
+		switch name := ast.Value.(string); name {
+		case "@":
+			return base
+		case "$root", "$parent", "$key", "$value":
+			return nil
+		default:
+			return append(base[:len(base):len(base)], name)
+		}
+	case NodeFieldSelect:
+		return pathOf(ast.Right, pathOf(ast.Left, base))
+	case NodeArrayIndex, NodeWhere, NodeLimit, NodeOffset:
+		return pathOf(ast.Left, base)
+	}
+	return nil
+}
+
+// enter sets the current path to the path of the node, e.g. before running
+// an expression against its items. The returned function restores the
+// previous path.
+func (i *interpreter) enter(ast *Node) func() {
+	path := i.path
+	i.path = pathOf(ast, path)
+	return func() {
+		i.path = path
+	}
+}
+
+// checkAccess calls the `WithAccessHook` function for the property, returning
+// an error if access is denied.
+func (i *interpreter) checkAccess(ast *Node) Error {
+	path := strings.Join(append(i.path[:len(i.path):len(i.path)], ast.Value.(string)), ".")
+	if err := i.access(path); err != nil {
+		return wrapError(newNodeError(KindAccessDenied, ast, "access to %s denied: %s", path, err.Error()), err)
+	}
+	return nil
+}
+
+// regexp returns the compiled pattern, caching it for future runs.
+func (i *interpreter) regexp(ast *Node, pattern string) (*regexp.Regexp, Error) {
+	if re, ok := i.regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, newNodeError(KindRuntime, ast, "invalid pattern %q: %s", pattern, err.Error())
+	}
+	if i.regexps == nil {
+		i.regexps = map[string]*regexp.Regexp{}
+	}
+	i.regexps[pattern] = re
+	return re, nil
+}
+
+// maxRunItems limits how many range items a single run can create plus how
+// many items it can iterate over, so nested ranges like
+// `1..3000 where (1..3000 where @ > 0)` can't run for practically forever.
+const maxRunItems = 10_000_000
+
+// maxRangeItems limits the size of a single range, since each one is created
+// as an array in memory, e.g. `0..9999999` would need hundreds of megabytes.
+// Checks like `code in 200..299` compare the bounds and have no limit.
+const maxRangeItems = 100_000
+
+// spend counts `n` range items or iterations against the run's limit. Once
+// the limit is reached every later call fails too, so nested clauses which
+// ignore errors still stop.
+func (i *interpreter) spend(ast *Node, n int) Error {
+	if i.items > maxRunItems || n > maxRunItems-i.items {
+		i.items = maxRunItems + 1
+		return newNodeError(KindLimitExceeded, ast, "expression uses more than %d range items and iterations", maxRunItems)
+	}
+	i.items += n
+	return nil
+}
+
+// bounds returns the integer start and end of a range like `1..10`.
+func (i *interpreter) bounds(ast *Node, value any) (float64, float64, Error) {
+	resultLeft, err := i.run(ast.Left, value)
+	if err != nil {
+		return 0, 0, err
+	}
+	resultRight, err := i.run(ast.Right, value)
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := toNumber(ast.Left, resultLeft)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := toNumber(ast.Right, resultRight)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start != math.Trunc(start) || end != math.Trunc(end) {
+		return 0, 0, newNodeError(KindTypeMismatch, ast, "range requires integers but found %v and %v", resultLeft, resultRight)
+	}
+	return start, end, nil
+}
+
+// paginate returns the first `count` items of an array when `limit` is set,
+// otherwise it skips the first `count` items.
+func paginate(ast *Node, limit bool, value, count any) (any, Error) {
+	if isNil(value) {
+		return nil, nil
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return nil, newNodeError(KindTypeMismatch, ast, "%s requires an array but found %v", ast, value)
+	}
+	n, err := toNumber(ast, count)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n != math.Trunc(n) {
+		return nil, newNodeError(KindRuntime, ast, "%s requires a non-negative integer but found %v", ast, count)
+	}
+	if int(n) > len(items) {
+		n = float64(len(items))
+	}
+	if limit {
+		return items[:int(n)], nil
+	}
+	return items[int(n):], nil
+}
+
+// projects returns whether a field select on an array should be applied to
+// each item, like `items.id`, rather than to the array itself, like
+// `items.length`.
+func projects(ast *Node) bool {
+	if ast.Type == NodeIdentifier {
+		switch ast.Value.(string) {
+		case "length", "isEmpty", "@":
+			return false
+		}
+	}
+	return true
+}
+
+// filter runs a `where` clause condition for a single item and returns
+// whether it matched. The key is the item's index or map key.
+func (i *interpreter) filter(ast *Node, value, key, item any) (bool, Error) {
+	result, err := i.each(ast, value, key, item)
+	if err != nil {
+		return false, err
+	}
+	return toBool(result), nil
+}
+
+// each runs the expression against a single item of an array or map, e.g.
+// for `where` or `sumBy`. Errors are ignored unless in strict mode, in which
+// case the result is `nil`.
+func (i *interpreter) each(ast *Node, value, key, item any) (any, Error) {
+	if i.stats != nil {
+		i.stats.Items++
+	}
+	if err := i.spend(ast, 1); err != nil {
+		return nil, err
+	}
+	i.scopes = append(i.scopes, scope{parent: value, key: key, value: item})
+	// In an unquoted string scenario it makes no sense for the first/only
+	// token after a `where` clause to be treated as a string. Instead we
+	// treat a `where` the same as a field select `.` in this scenario.
+	i.prevFieldSelect = true
+	result, err := i.run(ast, item)
+	i.scopes = i.scopes[:len(i.scopes)-1]
+	if err != nil {
+		if i.strict || i.items > maxRunItems {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return result, nil
+}
+
+// where filters the items of an array or map, e.g. `items where id > 3`.
+func (i *interpreter) where(ast *Node, value any) (any, Error) {
+	resultLeft, err := i.run(ast.Left, value)
+	if err != nil {
+		return nil, err
+	}
+	if isNil(resultLeft) {
+		return nil, nil
+	}
+	if i.access != nil {
+		defer i.enter(ast.Left)()
+	}
+	results := []any{}
+	// Explanations keep every result, so they can't share a buffer.
+	buffer, reuse := i.buffers[ast]
+	if reuse = reuse && i.explanations == nil; reuse {
+		results = buffer[:0]
+	}
+	switch left := resultLeft.(type) {
+	case []any:
+		if i.parallel(left) {
+			matched, err := i.filterParallel(ast.Right, value, left)
+			if err != nil {
+				return nil, err
+			}
+			for idx, item := range left {
+				if matched[idx] {
+					results = append(results, item)
+					if full, err := i.full(ast, len(results)); full || err != nil {
+						if err != nil {
+							return nil, err
+						}
+						break
+					}
+				}
+			}
+			break
+		}
+		for idx, item := range left {
+			ok, err := i.filter(ast.Right, value, idx, item)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				results = append(results, item)
+				if full, err := i.full(ast, len(results)); full || err != nil {
+					if err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+		}
+	case map[string]any:
+		var filtered map[string]any
+		if i.keepMapKeys {
+			filtered = map[string]any{}
+		}
+		for k, item := range left {
+			ok, err := i.filter(ast.Right, value, k, item)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if filtered != nil {
+					filtered[k] = item
+				} else {
+					results = append(results, item)
+				}
+				if full, err := i.full(ast, len(filtered)+len(results)); full || err != nil {
+					if err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+		}
+		if filtered != nil {
+			return filtered, nil
+		}
+	case map[any]any:
+		var filtered map[any]any
+		if i.keepMapKeys {
+			filtered = map[any]any{}
+		}
+		for k, item := range left {
+			ok, err := i.filter(ast.Right, value, k, item)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				if filtered != nil {
+					filtered[k] = item
+				} else {
+					results = append(results, item)
+				}
+				if full, err := i.full(ast, len(filtered)+len(results)); full || err != nil {
+					if err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+		}
+		if filtered != nil {
+			return filtered, nil
+		}
+	}
+	if reuse {
+		i.buffers[ast] = results
+	}
+	return results, nil
+}
+
+// full returns whether a `where` clause with `count` results should stop
+// because it reached the limit set by `WithMaxWhereResults`, or an error if
+// the results exceed the limit and aren't truncated.
+func (i *interpreter) full(ast *Node, count int) (bool, Error) {
+	if i.maxWhereResults <= 0 || count < i.maxWhereResults {
+		return false, nil
+	}
+	if i.truncateWhere {
+		return true, nil
+	}
+	if count > i.maxWhereResults {
+		return false, newNodeError(KindLimitExceeded, ast, "where clause has more than %d results", i.maxWhereResults)
+	}
+	return false, nil
+}
+
+// selectField selects the right side of a `.` from the left value, which is
+// done for each item if the left value is an array, e.g. `items.id`.
+func (i *interpreter) selectField(ast *Node, leftValue, value any) (any, Error) {
+	if ast.Right.Type == NodeCall {
+		// Method call like `a.default(1)`, which is `default(a, 1)`.
+		return i.call(ast.Right, []any{leftValue}, value)
+	}
+	if i.access != nil {
+		defer i.enter(ast.Left)()
+	}
+	if items, ok := leftValue.([]any); ok && projects(ast.Right) {
+		// Select the field from each item, e.g. `items.id`, skipping any
+		// items without the field.
+		results := make([]any, 0, len(items))
+		for _, item := range items {
+			if i.stats != nil {
+				i.stats.Items++
+			}
+			i.prevFieldSelect = true
+			i.prevProperty = true
+			result, err := i.run(ast.Right, item)
+			if err != nil {
+				return nil, err
+			}
+			if !isNil(result) {
+				results = append(results, result)
+			}
+		}
+		return results, nil
+	}
+	i.prevFieldSelect = true
+	i.prevProperty = true
+	return i.run(ast.Right, leftValue)
+}
+
+// aggregate runs `sumBy`, `minBy`, or `maxBy`, which evaluate the right side
+// for each item. The sum is returned for `sumBy`, while `minBy` and `maxBy`
+// return the item with the smallest or largest value. Items where the value
+// is `nil` are skipped.
+func (i *interpreter) aggregate(ast *Node, value any) (any, Error) {
+	resultLeft, err := i.run(ast.Left, value)
+	if err != nil {
+		return nil, err
+	}
+	if isNil(resultLeft) {
+		return nil, nil
+	}
+	items, ok := resultLeft.([]any)
+	if !ok {
+		return nil, newNodeError(KindTypeMismatch, ast, "%s requires an array but found %v", ast, resultLeft)
+	}
+	if i.access != nil {
+		defer i.enter(ast.Left)()
+	}
+	var total, best, bestValue any
+	for idx, item := range items {
+		result, err := i.each(ast.Right, value, idx, item)
+		if err != nil {
+			return nil, err
+		}
+		if isNil(result) {
+			continue
+		}
+		if !isNumber(result) {
+			return nil, newNodeError(KindTypeMismatch, ast.Right, "%s requires numbers but found %v", ast, result)
+		}
+		if ast.Type == NodeSumBy {
+			if total, err = i.sum(ast, total, result); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if bestValue != nil {
+			cmp, err := i.compareNumbers(ast, result, bestValue)
+			if err != nil {
+				return nil, err
+			}
+			if (ast.Type == NodeMinBy && cmp >= 0) || (ast.Type == NodeMaxBy && cmp <= 0) {
+				continue
+			}
+		}
+		best, bestValue = item, result
+	}
+	if ast.Type != NodeSumBy {
+		return best, nil
+	}
+	if total == nil {
+		if i.decimal {
+			return new(big.Rat), nil
+		}
+		return 0.0, nil
+	}
+	return total, nil
+}
+
+// sum adds a number to a running total, which starts as `nil`. Integers are
+// kept exact until a float is added or the total would overflow.
+func (i *interpreter) sum(ast *Node, total, v any) (any, Error) {
+	if i.decimal {
+		r, err := toRat(ast, v)
+		if err != nil {
+			return nil, err
+		}
+		if total == nil {
+			return r, nil
+		}
+		return new(big.Rat).Add(total.(*big.Rat), r), nil
+	}
+	if n, ok := toInteger(v); ok {
+		if total == nil {
+			return n, nil
+		}
+		if t, ok := total.(int64); ok {
+			if result, ok := checkedIntegerMath(NodeAdd, t, n); ok {
+				return result, nil
+			}
+		}
+	}
+	f, err := toNumber(ast, v)
+	if err != nil {
+		return nil, err
+	}
+	if total == nil {
+		return f, nil
+	}
+	t, err := toNumber(ast, total)
+	if err != nil {
+		return nil, err
+	}
+	return t + f, nil
+}
+
+// compareNumbers returns -1, 0, or 1 depending on whether the left number is
+// less than, equal to, or greater than the right.
+func (i *interpreter) compareNumbers(ast *Node, left, right any) (int, Error) {
+	if i.decimal {
+		l, err := toRat(ast, left)
+		if err != nil {
+			return 0, err
+		}
+		r, err := toRat(ast, right)
+		if err != nil {
+			return 0, err
+		}
+		return l.Cmp(r), nil
+	}
+	if cmp, ok := compareIntegers(left, right); ok {
+		return cmp, nil
+	}
+	l, err := toNumber(ast, left)
+	if err != nil {
+		return 0, err
+	}
+	r, err := toNumber(ast, right)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case l < r:
+		return -1, nil
+	case l > r:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// clamp limits slice indexes to the given length for lenient indexing.
+// Returns false if there is nothing to select.
+func clamp(start, end float64, length int) (float64, float64, bool) {
+	if start < 0 {
+		start = 0
+	}
+	if end > float64(length-1) {
+		end = float64(length - 1)
+	}
+	return start, end, start <= end
+}
+
+// checkStrings returns an error if a string operation would need to convert
+// non-string values when using strict typing.
+func (i *interpreter) checkStrings(ast *Node, left, right any) Error {
+	if i.strictTypes && !(isString(left) && isString(right)) {
+		return newNodeError(KindTypeMismatch, ast, "expected strings but found %v and %v", left, right)
+	}
+	return nil
+}
+
+// boolean converts a value to a boolean, returning an error for non-booleans
+// when using strict typing. It is kept small enough to be inlined, since most
+// values are already booleans.
+func (i *interpreter) boolean(ast *Node, v any) (bool, Error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return i.convertBoolean(ast, v)
+}
+
+// convertBoolean converts a non-boolean value for `boolean`.
+func (i *interpreter) convertBoolean(ast *Node, v any) (bool, Error) {
+	if i.strictTypes {
+		return false, newNodeError(KindTypeMismatch, ast, "expected boolean but found %v", v)
+	}
+	return toBool(v), nil
+}
+
+// compared returns the result of a comparison operator given whether the
+// left side is less than (-1), equal to (0), or greater than (1) the right.
+func compared(nodeType NodeType, cmp int) bool {
+	switch nodeType {
+	case NodeEqual:
+		return cmp == 0
+	case NodeNotEqual:
+		return cmp != 0
+	case NodeGreaterThan:
+		return cmp > 0
+	case NodeGreaterThanEqual:
+		return cmp >= 0
+	case NodeLessThan:
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// compareFloats returns the result of a comparison operator for two floats.
+func compareFloats(nodeType NodeType, left, right float64) bool {
+	switch nodeType {
+	case NodeEqual:
+		return left == right
+	case NodeNotEqual:
+		return left != right
+	case NodeGreaterThan:
+		return left > right
+	case NodeGreaterThanEqual:
+		return left >= right
+	case NodeLessThan:
+		return left < right
+	}
+	return left <= right
+}
+
+// isSliceIndex returns whether an array index selects a slice, like
+// `items[1:3]` or `items[bounds]` where `bounds` is a start and end. Array
+// literals like `items[[0, 1]]` are not slice bounds.
+func isSliceIndex(index *Node, v any) bool {
+	if index.Type == NodeArray {
+		return false
+	}
+	return isSlice(v) && len(v.([]any)) == 2
+}
+
+// fold converts a value to a string for comparisons, normalizing it when
+// using `FoldStrings`.
+func (i *interpreter) fold(v any) string {
+	s, ok := v.(string)
+	if !ok {
+		s = toString(v)
+	}
+	if i.foldStrings {
+		return foldString(s)
+	}
+	return s
+}
+
+// equal returns whether two values are equal, normalizing strings when using
+// `FoldStrings`.
+func (i *interpreter) equal(left, right any) bool {
+	if i.foldStrings && isString(left) && isString(right) {
+		return foldString(toString(left)) == foldString(toString(right))
+	}
+	return deepEqual(left, right)
+}
+
+// like returns whether the string matches a wildcard pattern, where `*` or
+// `%` match any number of characters and `?` or `_` match a single
+// character. Use a backslash to match a wildcard character literally.
+func like(s, pattern string) bool {
+	str := []rune(s)
+	pat := []rune(pattern)
+	si, pi := 0, 0
+	star, match := -1, 0
+	for si < len(str) {
+		if pi < len(pat) {
+			switch p := pat[pi]; {
+			case p == '*' || p == '%':
+				// Remember the wildcard position to backtrack to if needed.
+				star, match = pi, si
+				pi++
+				continue
+			case p == '?' || p == '_':
+				si++
+				pi++
+				continue
+			case p == '\\' && pi+1 < len(pat):
+				if pat[pi+1] == str[si] {
+					si++
+					pi += 2
+					continue
+				}
+			case p == str[si]:
+				si++
+				pi++
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// Let the last wildcard match one more character and try again.
+		match++
+		si, pi = match, star+1
+	}
+	for pi < len(pat) && (pat[pi] == '*' || pat[pi] == '%') {
+		pi++
+	}
+	return pi == len(pat)
+}
 
-const (
-	// StrictMode does extra checks like making sure identifiers exist.
-	StrictMode InterpreterOption = iota
+// unknownLogic applies three-valued logic for `and` and `or` when at least
+// one side is `nil`, meaning unknown. A known `false` for `and` or `true` for
+// `or` decides the result, otherwise the result is unknown.
+func (i *interpreter) unknownLogic(ast *Node, left, right any) (any, Error) {
+	for _, side := range []*Node{ast.Left, ast.Right} {
+		v := left
+		if side == ast.Right {
+			v = right
+		}
+		if isNil(v) {
+			continue
+		}
+		b, err := i.boolean(side, v)
+		if err != nil {
+			return nil, err
+		}
+		if b == (ast.Type == NodeOr) {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
 
-	// UnqoutedStrings enables the use of unquoted string values rather than
-	// returning nil or a missing identifier error. Identifiers get priority
-	// over unquoted strings.
-	UnquotedStrings
-)
+// integer returns the value as an integer if it is a Go integer type or an
+// integral number literal like `5`. Used for strict number typing.
+func (i *interpreter) integer(ast *Node, v any) (int64, bool) {
+	if n, ok := toInteger(v); ok {
+		return n, true
+	}
+	if f, ok := v.(float64); ok && ast.Type == NodeLiteral && f == math.Trunc(f) {
+		return int64(f), true
+	}
+	return 0, false
+}
 
-// mapValues returns the values of the map m.
-// The values will be in an indeterminate order.
-func mapValues[M ~map[K]V, K comparable, V any](m M) []V {
-	r := make([]V, 0, len(m))
-	for _, v := range m {
-		r = append(r, v)
+// mixesNumbers returns whether one value is an integer while the other is a
+// float. Integral literals like `5` can be used as either.
+func (i *interpreter) mixesNumbers(left *Node, leftValue any, right *Node, rightValue any) bool {
+	isLiteral := func(ast *Node, v any) bool {
+		f, ok := v.(float64)
+		return ok && ast.Type == NodeLiteral && f == math.Trunc(f)
 	}
-	return r
+	if isLiteral(left, leftValue) || isLiteral(right, rightValue) {
+		return false
+	}
+	return isInteger(leftValue) != isInteger(rightValue)
 }
 
-// checkBounds returns an error if the index is out of bounds.
-func checkBounds(ast *Node, input any, idx int) Error {
-	if v, ok := input.([]any); ok {
-		if idx < 0 || idx >= len(v) {
-			return NewError(ast.Offset, ast.Length, "invalid index %d for slice of length %d", int(idx), len(v))
-		}
+func (i *interpreter) Run(value any) (any, Error) {
+	if i.logger == nil {
+		return i.runRoot(value)
 	}
-	if v, ok := input.(string); ok {
-		if idx < 0 || idx >= len(v) {
-			return NewError(ast.Offset, ast.Length, "invalid index %d for string of length %d", int(idx), len(v))
-		}
+	start := time.Now()
+	result, err := i.runRoot(value)
+	if i.hash == "" {
+		i.hash = hashAST(i.ast)
 	}
-	return nil
+	if err != nil {
+		logEvent(i.logger, LogRun, start, err, "hash", i.hash)
+	} else {
+		logEvent(i.logger, LogRun, start, nil, "hash", i.hash, "result", result)
+	}
+	return result, err
 }
 
-// Interpreter executes expression AST programs.
-type Interpreter interface {
-	Run(value any) (any, Error)
+// runRoot evaluates the whole AST against the input.
+func (i *interpreter) runRoot(value any) (any, Error) {
+	i.reset(value)
+	if i.buffers != nil {
+		defer i.release()
+	}
+	if i.stats != nil {
+		return i.measure(func() (any, Error) {
+			return i.run(i.ast, value)
+		})
+	}
+	return i.run(i.ast, value)
 }
 
-// NewInterpreter returns an interpreter for the given AST.
-func NewInterpreter(ast *Node, options ...InterpreterOption) Interpreter {
-	strict := false
-	unquoted := false
+// reset clears the state from any previous run.
+func (i *interpreter) reset(value any) {
+	i.now = time.Time{}
+	i.root = value
+	i.scopes = i.scopes[:0]
+	i.path = nil
+	i.items = 0
+	i.observing = i.memos != nil || i.stats != nil || i.trace != nil || i.explanations != nil
+}
 
-	for _, opt := range options {
-		switch opt {
-		case StrictMode:
-			strict = true
-		case UnquotedStrings:
-			unquoted = true
+// release clears the buffers after a run so they don't keep the input alive.
+func (i *interpreter) release() {
+	for ast, buffer := range i.buffers {
+		for idx := range buffer {
+			buffer[idx] = nil
 		}
+		i.buffers[ast] = buffer[:0]
 	}
+}
 
-	return &interpreter{
-		ast:      ast,
-		strict:   strict,
-		unquoted: unquoted,
+// run evaluates the node. Whether the run needs `recall` and `observe` is
+// decided once per run, so the common case calls `eval` directly.
+func (i *interpreter) run(ast *Node, value any) (any, Error) {
+	if i.observing {
+		return i.recall(ast, value)
 	}
+	return i.eval(ast, value)
 }
 
-type interpreter struct {
-	ast             *Node
-	prevFieldSelect bool
-	strict          bool
-	unquoted        bool
+// recall evaluates the node, returning the cached result when running with
+// `Incremental`.
+func (i *interpreter) recall(ast *Node, value any) (any, Error) {
+	if i.memos != nil && ast != nil {
+		if _, ok := i.deps[ast]; ok {
+			if m, ok := i.memos[ast]; ok {
+				return m.value, m.err
+			}
+			result, err := i.observe(ast, value)
+			i.memos[ast] = memo{value: result, err: err}
+			return result, err
+		}
+	}
+	return i.observe(ast, value)
 }
 
-func (i *interpreter) Run(value any) (any, Error) {
-	return i.run(i.ast, value)
+// observe evaluates the node, counting it for `WithStats`, logging it along
+// with its result when using `WithTrace`, and recording it for `Explain`.
+// Nodes are logged after their children, which are indented.
+func (i *interpreter) observe(ast *Node, value any) (any, Error) {
+	if i.stats != nil && ast != nil {
+		i.stats.Nodes++
+	}
+	if (i.trace == nil && i.explanations == nil) || ast == nil {
+		return i.eval(ast, value)
+	}
+	var explanation *Explanation
+	if i.explanations != nil {
+		explanation = &Explanation{Node: ast}
+		parent := i.explanations[len(i.explanations)-1]
+		parent.Children = append(parent.Children, explanation)
+		i.explanations = append(i.explanations, explanation)
+	}
+	i.depth++
+	result, err := i.eval(ast, value)
+	i.depth--
+	if explanation != nil {
+		explanation.Value, explanation.Error = result, err
+		i.explanations = i.explanations[:len(i.explanations)-1]
+	}
+	if i.trace != nil {
+		indent := strings.Repeat("  ", i.depth)
+		if err != nil {
+			fmt.Fprintf(i.trace, "%s%s => error: %s\n", indent, ast, err.Error())
+		} else {
+			fmt.Fprintf(i.trace, "%s%s => %s\n", indent, ast, traceValue(result))
+		}
+	}
+	return result, err
 }
 
-func (i *interpreter) run(ast *Node, value any) (any, Error) {
+// traceValue formats a value for the trace log, quoting strings so they can be
+// told apart from other values.
+func traceValue(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(s)
+	}
+	return toString(v)
+}
+
+func (i *interpreter) eval(ast *Node, value any) (any, Error) {
 	if ast == nil {
 		return nil, nil
 	}
 
 	fromSelect := i.prevFieldSelect
 	i.prevFieldSelect = false
+	fromProperty := i.prevProperty
+	i.prevProperty = false
 
 	switch ast.Type {
+	case NodeError:
+		return nil, ast.Value.(Error)
 	case NodeIdentifier:
 		switch ast.Value.(string) {
 		case "@":
 			return value, nil
+		case "$root":
+			if !fromProperty {
+				return i.root, nil
+			}
+		case "$parent":
+			if !fromProperty {
+				if len(i.scopes) == 0 {
+					return nil, nil
+				}
+				return i.scopes[len(i.scopes)-1].parent, nil
+			}
+		case "$key", "$value":
+			if !fromProperty {
+				if len(i.scopes) == 0 {
+					return nil, nil
+				}
+				if ast.Value.(string) == "$key" {
+					return i.scopes[len(i.scopes)-1].key, nil
+				}
+				return i.scopes[len(i.scopes)-1].value, nil
+			}
 		case "length":
 			// Special pseudo-property to get the value's length.
 			if s, ok := value.(string); ok {
-				return len(s), nil
+				return utf8.RuneCountInString(s), nil
 			}
 			if a, ok := value.([]any); ok {
 				return len(a), nil
 			}
+		case "isEmpty":
+			// Special pseudo-property which is also true for `nil` values. Maps
+			// with an `isEmpty` key return that value instead.
+			if !hasKey(value, "isEmpty") {
+				return isEmpty(value), nil
+			}
+		case "isBlank":
+			// Special pseudo-property for empty or whitespace-only strings.
+			if isNil(value) {
+				return true, nil
+			}
+			if s, ok := value.(string); ok {
+				return strings.TrimSpace(s) == "", nil
+			}
+		case "lines":
+			// Special pseudo-property to split on newlines, ignoring a trailing
+			// newline and carriage returns.
+			if s, ok := value.(string); ok {
+				if s == "" {
+					return []any{}, nil
+				}
+				lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+				results := make([]any, len(lines))
+				for idx, line := range lines {
+					results[idx] = strings.TrimSuffix(line, "\r")
+				}
+				return results, nil
+			}
+		case "words":
+			// Special pseudo-property to split on whitespace.
+			if s, ok := value.(string); ok {
+				words := strings.Fields(s)
+				results := make([]any, len(words))
+				for idx, word := range words {
+					results[idx] = word
+				}
+				return results, nil
+			}
 		case "lower":
 			if s, ok := value.(string); ok {
 				return strings.ToLower(s), nil
@@ -110,6 +1230,16 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 			if s, ok := value.(string); ok {
 				return strings.ToUpper(s), nil
 			}
+		case "camel", "snake", "kebab", "title":
+			// Special pseudo-properties to convert identifier case styles.
+			if s, ok := value.(string); ok {
+				return toCase(ast.Value.(string), s), nil
+			}
+		}
+		if i.access != nil && isMap(value) {
+			if err := i.checkAccess(ast); err != nil {
+				return nil, err
+			}
 		}
 		if m, ok := value.(map[string]any); ok {
 			if v, ok := m[ast.Value.(string)]; ok {
@@ -121,41 +1251,148 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 				return v, nil
 			}
 		}
-		if i.unquoted && !fromSelect {
+		if !fromProperty && i.globals != nil {
+			if v, ok := i.globals[ast.Value.(string)]; ok {
+				return v, nil
+			}
+		}
+		if !fromProperty && ast.Value.(string) == "now" {
+			// Built-in current time, used if there is no `now` in the input.
+			if i.now.IsZero() {
+				clock := i.clock
+				if clock == nil {
+					clock = time.Now
+				}
+				i.now = clock()
+			}
+			return i.now, nil
+		}
+		if !fromProperty && i.undefined && ast.Value.(string) == "undefined" {
+			return Undefined, nil
+		}
+		if !fromSelect && i.unquotedString(ast.Value.(string)) {
 			// Identifiers not found in the map are treated as strings, but only if
 			// the previous item was not a `.` like `obj.field`.
 			return ast.Value.(string), nil
 		}
 		if !i.strict {
+			if i.undefined {
+				return Undefined, nil
+			}
 			return nil, nil
 		}
-		return nil, NewError(ast.Offset, ast.Length, "cannot get %v from %v", ast.Value, value)
+		err := newNodeError(KindUnknownProperty, ast, "cannot get %v from %v", ast.Value, value)
+		if !fromSelect {
+			err = withSuggestions(err, i.closestEnums(ast.Value.(string))...)
+		}
+		return nil, err
 	case NodeFieldSelect:
+		if path, ok := i.paths[ast]; ok && i.explanations == nil {
+			if result, ok := lookup(path, value); ok {
+				return result, nil
+			}
+		}
 		i.prevFieldSelect = true
 		leftValue, err := i.run(ast.Left, value)
+		if err != nil {
+			if !allowsMissing(ast.Right) || err.Kind() != KindUnknownProperty {
+				return nil, err
+			}
+			leftValue = nil
+		}
+		return i.selectField(ast, leftValue, value)
+	case NodeCall:
+		return i.call(ast, nil, value)
+	case NodeRange:
+		start, end, err := i.bounds(ast, value)
 		if err != nil {
 			return nil, err
 		}
-		i.prevFieldSelect = true
-		return i.run(ast.Right, leftValue)
+		if math.Abs(start) >= 1<<53 || math.Abs(end) >= 1<<53 {
+			// Floats can't count one at a time past 2^53, so `n++` would stop
+			// changing `n` and never reach the end.
+			return nil, newNodeError(KindLimitExceeded, ast, "range bounds must be smaller than 2^53 but found %v and %v", start, end)
+		}
+		size := 0
+		if end >= start {
+			if end-start+1 > maxRangeItems {
+				return nil, newNodeError(KindLimitExceeded, ast, "range has more than %d items", maxRangeItems)
+			}
+			size = int(end - start + 1)
+			if err := i.spend(ast, size); err != nil {
+				return nil, err
+			}
+		}
+		results := make([]any, 0, size)
+		for n := start; n <= end; n++ {
+			results = append(results, n)
+		}
+		return results, nil
+	case NodeArray:
+		results := make([]any, len(ast.Args))
+		for idx, item := range ast.Args {
+			result, err := i.run(item, value)
+			if err != nil {
+				return nil, err
+			}
+			results[idx] = result
+		}
+		return results, nil
+	case NodeSequence:
+		var result any
+		for _, expr := range ast.Args {
+			var err Error
+			if result, err = i.run(expr, value); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case NodeCoalesce:
+		left, err := i.run(ast.Left, value)
+		if err != nil && err.Kind() != KindUnknownProperty {
+			return nil, err
+		}
+		if err == nil && left != nil && left != Undefined {
+			return left, nil
+		}
+		return i.run(ast.Right, value)
+	case NodeExists:
+		// Check for presence by temporarily treating missing properties as
+		// errors, even if the value itself is `null`. Out-of-range indexes are
+		// absent values too.
+		strict, unquoted := i.strict, i.unquoted
+		i.strict, i.unquoted = true, false
+		_, err := i.run(ast.Right, value)
+		i.strict, i.unquoted = strict, unquoted
+		if err != nil {
+			if err.Kind() == KindUnknownProperty || errors.Is(err, ErrIndexOutOfRange) {
+				return false, nil
+			}
+			return nil, err
+		}
+		return true, nil
 	case NodeArrayIndex:
 		resultLeft, err := i.run(ast.Left, value)
 		if err != nil {
 			return nil, err
 		}
+		if isNil(resultLeft) && i.lenient {
+			return nil, nil
+		}
 		if !isSlice(resultLeft) && !isString(resultLeft) {
-			return nil, NewError(ast.Offset, ast.Length, "can only index strings or arrays but got %v", resultLeft)
+			return nil, newNodeError(KindTypeMismatch, ast, "can only index strings or arrays but got %v", resultLeft)
 		}
 		resultRight, err := i.run(ast.Right, value)
 		if err != nil {
 			return nil, err
 		}
-		if isSlice(resultRight) && len(resultRight.([]any)) == 2 {
-			start, err := toNumber(ast, resultRight.([]any)[0])
+		if isSliceIndex(ast.Right, resultRight) {
+			bounds := resultRight.([]any)
+			start, err := toNumber(ast, bounds[0])
 			if err != nil {
 				return nil, err
 			}
-			end, err := toNumber(ast, resultRight.([]any)[1])
+			end, err := toNumber(ast, bounds[1])
 			if err != nil {
 				return nil, err
 			}
@@ -166,6 +1403,12 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 				if end < 0 {
 					end += float64(len(left))
 				}
+				if i.lenient {
+					var ok bool
+					if start, end, ok = clamp(start, end, len(left)); !ok {
+						return []any{}, nil
+					}
+				}
 				if err := checkBounds(ast, left, int(start)); err != nil {
 					return nil, err
 				}
@@ -173,52 +1416,71 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 					return nil, err
 				}
 				if int(start) > int(end) {
-					return nil, NewError(ast.Offset, ast.Length, "slice start cannot be greater than end")
+					return nil, newNodeError(KindRuntime, ast, "slice start cannot be greater than end")
 				}
 				return left[int(start) : int(end)+1], nil
 			}
 			left := toString(resultLeft)
+			length := utf8.RuneCountInString(left)
 			if start < 0 {
-				start += float64(len(left))
+				start += float64(length)
 			}
 			if end < 0 {
-				end += float64(len(left))
+				end += float64(length)
+			}
+			if i.lenient {
+				var ok bool
+				if start, end, ok = clamp(start, end, length); !ok {
+					return "", nil
+				}
 			}
 			if err := checkBounds(ast, left, int(start)); err != nil {
 				return nil, err
 			}
 			if int(start) > int(end) {
-				return nil, NewError(ast.Offset, ast.Length, "string slice start cannot be greater than end")
+				return nil, newNodeError(KindRuntime, ast, "string slice start cannot be greater than end")
 			}
 			if err := checkBounds(ast, left, int(end)); err != nil {
 				return nil, err
 			}
-			return left[int(start) : int(end)+1], nil
+			return left[runeOffset(left, int(start)):runeOffset(left, int(end)+1)], nil
 		}
 		if isNumber(resultRight) {
 			idx, err := toNumber(ast, resultRight)
 			if err != nil {
 				return nil, err
 			}
+			if i.strictNumbers && idx != math.Trunc(idx) {
+				return nil, newNodeError(KindTypeMismatch, ast, "array index must be an integer but found %v", resultRight)
+			}
 			if left, ok := resultLeft.([]any); ok {
 				if idx < 0 {
 					idx += float64(len(left))
 				}
+				if i.lenient && (idx < 0 || int(idx) >= len(left)) {
+					return nil, nil
+				}
 				if err := checkBounds(ast, left, int(idx)); err != nil {
 					return nil, err
 				}
 				return left[int(idx)], nil
 			}
 			left := toString(resultLeft)
+			length := utf8.RuneCountInString(left)
 			if idx < 0 {
-				idx += float64(len(left))
+				idx += float64(length)
+			}
+			if i.lenient && (idx < 0 || int(idx) >= length) {
+				return nil, nil
 			}
 			if err := checkBounds(ast, left, int(idx)); err != nil {
 				return nil, err
 			}
-			return string(left[int(idx)]), nil
+			offset := runeOffset(left, int(idx))
+			_, width := utf8.DecodeRuneInString(left[offset:])
+			return left[offset : offset+width], nil
 		}
-		return nil, NewError(ast.Offset, ast.Length, "array index must be number or slice %v", resultRight)
+		return nil, newNodeError(KindTypeMismatch, ast, "array index must be number or slice %v", resultRight)
 	case NodeSlice:
 		resultLeft, err := i.run(ast.Left, value)
 		if err != nil {
@@ -228,9 +1490,21 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		if err != nil {
 			return nil, err
 		}
-		ast.Value.([]any)[0] = resultLeft
-		ast.Value.([]any)[1] = resultRight
-		return ast.Value, nil
+		if i.explanations != nil {
+			// Explanations keep every result, so they can't share the bounds.
+			return []any{resultLeft, resultRight}, nil
+		}
+		boxed, ok := i.slices[ast]
+		if !ok {
+			if i.slices == nil {
+				i.slices = map[*Node]any{}
+			}
+			boxed = make([]any, 2)
+			i.slices[ast] = boxed
+		}
+		bounds := boxed.([]any)
+		bounds[0], bounds[1] = resultLeft, resultRight
+		return boxed, nil
 	case NodeLiteral:
 		return ast.Value, nil
 	case NodeSign:
@@ -238,6 +1512,22 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		if err != nil {
 			return nil, err
 		}
+		if i.decimal && isNumber(resultRight) {
+			right, err := toRat(ast, resultRight)
+			if err != nil {
+				return nil, err
+			}
+			if ast.Value.(string) == "-" {
+				right = new(big.Rat).Neg(right)
+			}
+			return right, nil
+		}
+		if n, ok := toInteger(resultRight); ok && n != math.MinInt64 {
+			if ast.Value.(string) == "-" {
+				n = -n
+			}
+			return n, nil
+		}
 		right, err := toNumber(ast, resultRight)
 		if err != nil {
 			return nil, err
@@ -255,8 +1545,18 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		if err != nil {
 			return nil, err
 		}
+		if left, ok := resultLeft.(float64); ok && !i.decimal && !i.strictNumbers {
+			// Most math is on JSON numbers, which don't need any of the
+			// conversions below.
+			if right, ok := resultRight.(float64); ok {
+				return floatMath(ast, left, right)
+			}
+		}
 		if ast.Type == NodeAdd {
 			if isString(resultLeft) || isString(resultRight) {
+				if i.strictTypes && !(isString(resultLeft) && isString(resultRight)) {
+					return nil, newNodeError(KindTypeMismatch, ast, "cannot add %v and %v without converting to a string", resultLeft, resultRight)
+				}
 				return toString(resultLeft) + toString(resultRight), nil
 			}
 			if isSlice(resultLeft) && isSlice(resultRight) {
@@ -264,37 +1564,49 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 				return append(tmp, resultRight.([]any)...), nil
 			}
 		}
-		if isNumber(resultLeft) && isNumber(resultRight) {
-			left, err := toNumber(ast.Left, resultLeft)
+		if i.decimal && isNumber(resultLeft) && isNumber(resultRight) {
+			left, err := toRat(ast.Left, resultLeft)
 			if err != nil {
 				return nil, err
 			}
-			right, err := toNumber(ast.Right, resultRight)
+			right, err := toRat(ast.Right, resultRight)
 			if err != nil {
 				return nil, err
 			}
-			switch ast.Type {
-			case NodeAdd:
-				return left + right, nil
-			case NodeSubtract:
-				return left - right, nil
-			case NodeMultiply:
-				return left * right, nil
-			case NodeDivide:
-				if right == 0.0 {
-					return nil, NewError(ast.Offset, ast.Length, "cannot divide by zero")
+			return decimalMath(ast, left, right)
+		}
+		if i.strictNumbers && isNumber(resultLeft) && isNumber(resultRight) {
+			if left, ok := i.integer(ast.Left, resultLeft); ok {
+				if right, ok := i.integer(ast.Right, resultRight); ok {
+					return integerMath(ast, left, right)
 				}
-				return left / right, nil
-			case NodeModulus:
-				if int(right) == 0 {
-					return nil, NewError(ast.Offset, ast.Length, "cannot divide by zero")
+			}
+			if ast.Type == NodeModulus {
+				return nil, newNodeError(KindTypeMismatch, ast, "modulus requires integers but found %v and %v", resultLeft, resultRight)
+			}
+		}
+		if isInteger(resultLeft) || isInteger(resultRight) {
+			left, lok := i.integer(ast.Left, resultLeft)
+			right, rok := i.integer(ast.Right, resultRight)
+			if lok && rok {
+				// Keep integers exact, only falling back to floats if needed.
+				if result, ok := checkedIntegerMath(ast.Type, left, right); ok {
+					return result, nil
 				}
-				return int(left) % int(right), nil
-			case NodePower:
-				return math.Pow(left, right), nil
 			}
 		}
-		return nil, NewError(ast.Offset, ast.Length, "cannot add incompatible types %v and %v", resultLeft, resultRight)
+		if isNumber(resultLeft) && isNumber(resultRight) {
+			left, err := toNumber(ast.Left, resultLeft)
+			if err != nil {
+				return nil, err
+			}
+			right, err := toNumber(ast.Right, resultRight)
+			if err != nil {
+				return nil, err
+			}
+			return floatMath(ast, left, right)
+		}
+		return nil, newNodeError(KindTypeMismatch, ast, "cannot add incompatible types %v and %v", resultLeft, resultRight)
 	case NodeEqual, NodeNotEqual, NodeLessThan, NodeLessThanEqual, NodeGreaterThan, NodeGreaterThanEqual:
 		resultLeft, err := i.run(ast.Left, value)
 		if err != nil {
@@ -304,6 +1616,64 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		if err != nil {
 			return nil, err
 		}
+		// Most comparisons are between JSON numbers or exact strings, which
+		// don't need any of the conversions below.
+		switch left := resultLeft.(type) {
+		case float64:
+			if right, ok := resultRight.(float64); ok && !i.decimal {
+				return compareFloats(ast.Type, left, right), nil
+			}
+		case string:
+			if right, ok := resultRight.(string); ok && !i.foldStrings {
+				switch ast.Type {
+				case NodeEqual:
+					return left == right, nil
+				case NodeNotEqual:
+					return left != right, nil
+				}
+			}
+		}
+		if i.threeValued && (isNil(resultLeft) || isNil(resultRight)) {
+			return nil, nil
+		}
+		if i.foldStrings && (ast.Type == NodeEqual || ast.Type == NodeNotEqual) && isString(resultLeft) && isString(resultRight) {
+			return i.equal(resultLeft, resultRight) == (ast.Type == NodeEqual), nil
+		}
+		if i.strictNumbers && (ast.Type == NodeEqual || ast.Type == NodeNotEqual) && isNumber(resultLeft) && isNumber(resultRight) {
+			if i.mixesNumbers(ast.Left, resultLeft, ast.Right, resultRight) {
+				return nil, newNodeError(KindTypeMismatch, ast, "cannot compare integer and float values %v and %v", resultLeft, resultRight)
+			}
+		}
+		if i.decimal && isNumber(resultLeft) && isNumber(resultRight) {
+			left, err := toRat(ast.Left, resultLeft)
+			if err != nil {
+				return nil, err
+			}
+			right, err := toRat(ast.Right, resultRight)
+			if err != nil {
+				return nil, err
+			}
+			cmp := left.Cmp(right)
+			return compared(ast.Type, cmp), nil
+		}
+		if cmp, ok := compareIntegers(resultLeft, resultRight); ok {
+			return compared(ast.Type, cmp), nil
+		}
+		ordering := ast.Type != NodeEqual && ast.Type != NodeNotEqual
+		if isTime(resultLeft) || isTime(resultRight) || (ordering && isString(resultLeft) && isString(resultRight)) {
+			// Compare dates, e.g. `created >= startOfMonth(now)`. Strings are only
+			// compared as dates for ordering so equality stays exact.
+			leftTime, rightTime := i.toTime(resultLeft), i.toTime(resultRight)
+			if !leftTime.IsZero() && !rightTime.IsZero() {
+				cmp := 0
+				if leftTime.Before(rightTime) {
+					cmp = -1
+				} else if leftTime.After(rightTime) {
+					cmp = 1
+				}
+				return compared(ast.Type, cmp), nil
+			}
+		}
 		if ast.Type == NodeEqual {
 			return deepEqual(resultLeft, resultRight), nil
 		}
@@ -319,17 +1689,7 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		if err != nil {
 			return nil, err
 		}
-
-		switch ast.Type {
-		case NodeGreaterThan:
-			return left > right, nil
-		case NodeGreaterThanEqual:
-			return left >= right, nil
-		case NodeLessThan:
-			return left < right, nil
-		case NodeLessThanEqual:
-			return left <= right, nil
-		}
+		return compareFloats(ast.Type, left, right), nil
 	case NodeAnd, NodeOr:
 		resultLeft, err := i.run(ast.Left, value)
 		if err != nil {
@@ -339,41 +1699,109 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		if err != nil {
 			return nil, err
 		}
-		left := toBool(resultLeft)
-		right := toBool(resultRight)
+		if i.threeValued && (isNil(resultLeft) || isNil(resultRight)) {
+			return i.unknownLogic(ast, resultLeft, resultRight)
+		}
+		left, err := i.boolean(ast.Left, resultLeft)
+		if err != nil {
+			return nil, err
+		}
+		right, err := i.boolean(ast.Right, resultRight)
+		if err != nil {
+			return nil, err
+		}
 		switch ast.Type {
 		case NodeAnd:
 			return left && right, nil
 		case NodeOr:
 			return left || right, nil
 		}
-	case NodeBefore, NodeAfter:
+	case NodeBefore, NodeAfter, NodeSameDay:
 		resultLeft, err := i.run(ast.Left, value)
 		if err != nil {
 			return nil, err
 		}
-		leftTime := toTime(resultLeft)
+		leftTime := i.toTime(resultLeft)
 		if leftTime.IsZero() {
-			return nil, NewError(ast.Offset, ast.Length, "unable to convert %v to date or time", resultLeft)
+			return nil, newNodeError(KindTypeMismatch, ast, "unable to convert %v to date or time", resultLeft)
 		}
 		resultRight, err := i.run(ast.Right, value)
 		if err != nil {
 			return nil, err
 		}
-		rightTime := toTime(resultRight)
+		rightTime := i.toTime(resultRight)
 		if rightTime.IsZero() {
-			return nil, NewError(ast.Offset, ast.Length, "unable to convert %v to date or time", resultRight)
+			return nil, newNodeError(KindTypeMismatch, ast, "unable to convert %v to date or time", resultRight)
 		}
-		if ast.Type == NodeBefore {
+		switch ast.Type {
+		case NodeBefore:
 			return leftTime.Before(rightTime), nil
-		} else {
+		case NodeAfter:
 			return leftTime.After(rightTime), nil
 		}
-	case NodeIn, NodeContains, NodeStartsWith, NodeEndsWith:
+		// Compare calendar days in the left side's time zone.
+		rightTime = rightTime.In(leftTime.Location())
+		return leftTime.Year() == rightTime.Year() && leftTime.YearDay() == rightTime.YearDay(), nil
+	case NodeInCidr:
+		resultLeft, err := i.run(ast.Left, value)
+		if err != nil {
+			return nil, err
+		}
+		resultRight, err := i.run(ast.Right, value)
+		if err != nil {
+			return nil, err
+		}
+		return inCidr(ast, resultLeft, resultRight)
+	case NodeSumBy, NodeMinBy, NodeMaxBy:
+		return i.aggregate(ast, value)
+	case NodeLimit, NodeOffset:
+		resultLeft, err := i.run(ast.Left, value)
+		if err != nil {
+			return nil, err
+		}
+		resultRight, err := i.run(ast.Right, value)
+		if err != nil {
+			return nil, err
+		}
+		return paginate(ast, ast.Type == NodeLimit, resultLeft, resultRight)
+	case NodeFormat:
+		resultLeft, err := i.run(ast.Left, value)
+		if err != nil {
+			return nil, err
+		}
+		leftTime := i.toTime(resultLeft)
+		if leftTime.IsZero() {
+			return nil, newNodeError(KindTypeMismatch, ast, "unable to convert %v to date or time", resultLeft)
+		}
+		resultRight, err := i.run(ast.Right, value)
+		if err != nil {
+			return nil, err
+		}
+		layout, ok := resultRight.(string)
+		if !ok {
+			return nil, newNodeError(KindTypeMismatch, ast, "format layout must be a string but found %v", resultRight)
+		}
+		return leftTime.Format(layout), nil
+	case NodeIn, NodeContains, NodeStartsWith, NodeEndsWith, NodeLike:
 		resultLeft, err := i.run(ast.Left, value)
 		if err != nil {
 			return nil, err
 		}
+		if ast.Type == NodeIn && ast.Right.Type == NodeRange {
+			// Check the bounds directly rather than creating every item.
+			start, end, err := i.bounds(ast.Right, value)
+			if err != nil {
+				return nil, err
+			}
+			if !isNumber(resultLeft) {
+				return false, nil
+			}
+			n, err := toNumber(ast.Left, resultLeft)
+			if err != nil {
+				return nil, err
+			}
+			return n == math.Trunc(n) && n >= start && n <= end, nil
+		}
 		resultRight, err := i.run(ast.Right, value)
 		if err != nil {
 			return nil, err
@@ -382,7 +1810,7 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 		case NodeIn:
 			if a, ok := resultRight.([]any); ok {
 				for _, item := range a {
-					if deepEqual(item, resultLeft) {
+					if i.equal(item, resultLeft) {
 						return true, nil
 					}
 				}
@@ -400,11 +1828,14 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 				}
 				return false, nil
 			}
-			return strings.Contains(toString(resultRight), toString(resultLeft)), nil
+			if err := i.checkStrings(ast, resultLeft, resultRight); err != nil {
+				return nil, err
+			}
+			return strings.Contains(i.fold(resultRight), i.fold(resultLeft)), nil
 		case NodeContains:
 			if a, ok := resultLeft.([]any); ok {
 				for _, item := range a {
-					if deepEqual(item, resultRight) {
+					if i.equal(item, resultRight) {
 						return true, nil
 					}
 				}
@@ -422,54 +1853,41 @@ func (i *interpreter) run(ast *Node, value any) (any, Error) {
 				}
 				return false, nil
 			}
-			return strings.Contains(toString(resultLeft), toString(resultRight)), nil
+			if err := i.checkStrings(ast, resultLeft, resultRight); err != nil {
+				return nil, err
+			}
+			return strings.Contains(i.fold(resultLeft), i.fold(resultRight)), nil
 		case NodeStartsWith:
-			return strings.HasPrefix(toString(resultLeft), toString(resultRight)), nil
+			if err := i.checkStrings(ast, resultLeft, resultRight); err != nil {
+				return nil, err
+			}
+			return strings.HasPrefix(i.fold(resultLeft), i.fold(resultRight)), nil
 		case NodeEndsWith:
-			return strings.HasSuffix(toString(resultLeft), toString(resultRight)), nil
+			if err := i.checkStrings(ast, resultLeft, resultRight); err != nil {
+				return nil, err
+			}
+			return strings.HasSuffix(i.fold(resultLeft), i.fold(resultRight)), nil
+		case NodeLike:
+			if err := i.checkStrings(ast, resultLeft, resultRight); err != nil {
+				return nil, err
+			}
+			return like(toString(resultLeft), toString(resultRight)), nil
 		}
 	case NodeNot:
 		resultRight, err := i.run(ast.Right, value)
 		if err != nil {
 			return nil, err
 		}
-		right := toBool(resultRight)
-		return !right, nil
-	case NodeWhere:
-		resultLeft, err := i.run(ast.Left, value)
-		if err != nil {
-			return nil, err
-		}
-		results := []any{}
-		if resultLeft == nil {
+		if i.threeValued && isNil(resultRight) {
 			return nil, nil
 		}
-		if m, ok := resultLeft.(map[string]any); ok {
-			resultLeft = mapValues(m)
-		}
-		if m, ok := resultLeft.(map[any]any); ok {
-			values := make([]any, 0, len(m))
-			for _, v := range m {
-				values = append(values, v)
-			}
-			resultLeft = values
-		}
-		if leftSlice, ok := resultLeft.([]any); ok {
-			for _, item := range leftSlice {
-				// In an unquoted string scenario it makes no sense for the first/only
-				// token after a `where` clause to be treated as a string. Instead we
-				// treat a `where` the same as a field select `.` in this scenario.
-				i.prevFieldSelect = true
-				resultRight, err := i.run(ast.Right, item)
-				if i.strict && err != nil {
-					return nil, err
-				}
-				if toBool(resultRight) {
-					results = append(results, item)
-				}
-			}
+		right, err := i.boolean(ast.Right, resultRight)
+		if err != nil {
+			return nil, err
 		}
-		return results, nil
+		return !right, nil
+	case NodeWhere:
+		return i.where(ast, value)
 	}
 	return nil, nil
 }
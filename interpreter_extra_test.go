@@ -0,0 +1,37 @@
+//go:build !mexpr_lite
+
+package mexpr
+
+import "testing"
+
+// TestInterpreterExtra covers features which are left out of builds with the
+// `mexpr_lite` build tag.
+func TestInterpreterExtra(t *testing.T) {
+	cases := []interpreterTest{
+		// JSON
+		{expr: `json(payload).user.name`, input: `{"payload": "{\"user\": {\"name\": \"Alice\"}}"}`, output: "Alice"},
+		{expr: `(payload.json().tags)[1] == "b"`, input: `{"payload": "{\"tags\": [\"a\", \"b\"]}"}`, output: true},
+		{expr: `json(payload).count + 1`, input: `{"payload": "{\"count\": 2}"}`, output: 3.0},
+		{expr: `json(payload)`, input: `{"payload": null}`, output: nil},
+		{expr: `json(payload)`, input: `{"payload": "{oops"}`, err: "invalid JSON"},
+		{expr: `tojson(obj)`, input: `{"obj": {"b": [1, true, null], "a": "x"}}`, output: `{"a":"x","b":[1,true,null]}`},
+		{expr: `tojson(name)`, input: `{"name": "Alice"}`, output: `"Alice"`},
+		{expr: `json(tojson(obj)) == obj`, input: `{"obj": {"a": [1, 2]}}`, output: true},
+		// Hashing
+		{expr: `sha256(body)`, input: `{"body": "hello"}`, output: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{expr: `body.md5() == hash`, input: `{"body": "hello", "hash": "5d41402abc4b2a76b9719d911017c592"}`, output: true},
+		{expr: `md5(body)`, input: `{"body": null}`, output: nil},
+		// IP addresses
+		{expr: `ip inCidr "10.0.0.0/8"`, input: `{"ip": "10.1.2.3"}`, output: true},
+		{expr: `ip inCidr "10.0.0.0/8"`, input: `{"ip": "192.168.1.1"}`, output: false},
+		{expr: `ip inCidr "192.168.1.7/24"`, input: `{"ip": "192.168.1.200"}`, output: true},
+		{expr: `ip inCidr "2001:db8::/32"`, input: `{"ip": "2001:db8::1"}`, output: true},
+		{expr: `ip inCidr "2001:db8::/32"`, input: `{"ip": "10.1.2.3"}`, output: false},
+		{expr: `ip inCidr "10.0.0.0/8"`, input: `{"ip": "::ffff:10.0.0.1"}`, output: true},
+		{expr: `not (ip inCidr "10.0.0.0/8")`, input: `{"ip": "8.8.8.8"}`, output: true},
+		{expr: `ip inCidr "10.0.0.0/8"`, input: `{"ip": "bad"}`, err: "unable to convert bad to IP address"},
+		{expr: `ip inCidr "10.0.0.0"`, input: `{"ip": "10.1.2.3"}`, err: "unable to convert 10.0.0.0 to CIDR"},
+	}
+
+	runInterpreterTests(t, cases)
+}
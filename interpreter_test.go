@@ -1,23 +1,23 @@
 package mexpr
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"math"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestInterpreter(t *testing.T) {
-	type test struct {
-		expr        string
-		input       string
-		inputParsed any
-		skipTC      bool
-		opts        []InterpreterOption
-		err         string
-		output      interface{}
-	}
-	cases := []test{
+	clock := func() time.Time {
+		return time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	}
+
+	cases := []interpreterTest{
 		// Add/sub
 		{expr: "1 + 2 - 3", output: 0.0},
 		{expr: "-1 + +3", output: 2.0},
@@ -47,6 +47,12 @@ func TestInterpreter(t *testing.T) {
 		{expr: "1 != 2", output: true},
 		{expr: "x.length == 3", input: `{"x": "abc"}`, output: true},
 		{expr: `19 % 5 == 4`, output: true},
+		{expr: `5.5 % 2`, output: 1.5},
+		{expr: `a % b`, input: `{"a": 5.5, "b": 2}`, output: 1.5},
+		{expr: `a % b`, input: `{"a": -5.5, "b": 2}`, output: -1.5},
+		{expr: `a % b`, input: `{"a": 5, "b": 0.5}`, output: 0.0},
+		{expr: `a % b`, input: `{"a": 5, "b": 0}`, err: "cannot divide by zero"},
+		{expr: `5 % 0.5`, output: 0.0},
 		{expr: `foo == 1`, input: `{"foo": []}`, output: false},
 		{expr: `foo == 1`, input: `{"foo": {}}`, output: false},
 		// Boolean comparisons
@@ -146,6 +152,518 @@ func TestInterpreter(t *testing.T) {
 		{expr: `foo where method == "GET"`, inputParsed: map[any]any{"foo": map[any]any{"op1": map[any]any{"method": "GET", "path": "/op1"}, "op2": map[any]any{"method": "PUT", "path": "/op2"}, "op3": map[any]any{"method": "DELETE", "path": "/op3"}}}, output: []any{map[any]any{"method": "GET", "path": "/op1"}}},
 		{expr: `items where id > 3`, input: `{"items": []}`, err: "where clause requires a non-empty array or object"},
 		{expr: `items where id > 3`, input: `{"items": 1}`, skipTC: true, output: []any{}},
+		// Integer precision
+		{expr: `a + 1`, inputParsed: map[string]any{"a": int64(9007199254740993)}, output: int64(9007199254740994)},
+		{expr: `a * b`, inputParsed: map[string]any{"a": 3, "b": 4}, output: int64(12)},
+		{expr: `a % b`, inputParsed: map[string]any{"a": 7, "b": 4}, output: int64(3)},
+		{expr: `a / b`, inputParsed: map[string]any{"a": 8, "b": 2}, output: 4.0},
+		{expr: `a + 1`, inputParsed: map[string]any{"a": int64(math.MaxInt64)}, output: float64(math.MaxInt64) + 1},
+		{expr: `a == b`, inputParsed: map[string]any{"a": int64(9007199254740993), "b": int64(9007199254740992)}, output: false},
+		{expr: `a == 9007199254740993`, inputParsed: map[string]any{"a": int64(9007199254740993)}, output: true},
+		{expr: `a == 9_007_199_254_740_992`, inputParsed: map[string]any{"a": int64(9007199254740993)}, output: false},
+		{expr: `a > b`, inputParsed: map[string]any{"a": uint64(math.MaxUint64), "b": uint64(math.MaxUint64 - 1)}, output: true},
+		{expr: `a < b`, inputParsed: map[string]any{"a": int64(-1), "b": uint64(math.MaxUint64)}, output: true},
+		{expr: `a in b`, inputParsed: map[string]any{"a": int64(9007199254740993), "b": []any{int64(9007199254740992)}}, output: false},
+		{expr: `a == 9007199254740992`, inputParsed: map[string]any{"a": json.Number("9007199254740993")}, output: false},
+		{expr: `a == b`, inputParsed: map[string]any{"a": json.Number("9007199254740993"), "b": int64(9007199254740993)}, output: true},
+		{expr: `a + 1`, inputParsed: map[string]any{"a": json.Number("9007199254740993")}, output: int64(9007199254740994)},
+		{expr: `a > b`, inputParsed: map[string]any{"a": json.Number("9007199254740993"), "b": json.Number("9007199254740992")}, output: true},
+		{expr: `a + 1`, inputParsed: map[string]any{"a": json.Number("1.5")}, output: 2.5},
+		// Strict numbers
+		{expr: `a / b`, inputParsed: map[string]any{"a": 7, "b": 2}, output: 3.5},
+		{expr: `a / b`, inputParsed: map[string]any{"a": 7, "b": 2}, opts: []InterpreterOption{StrictNumbers}, output: int64(3)},
+		{expr: `x.length / 2 * 2`, input: `{"x": "abcde"}`, opts: []InterpreterOption{StrictNumbers}, output: int64(4)},
+		{expr: `a + b`, inputParsed: map[string]any{"a": 1, "b": 0.5}, opts: []InterpreterOption{StrictNumbers}, output: 1.5},
+		{expr: `-a`, inputParsed: map[string]any{"a": 3}, opts: []InterpreterOption{StrictNumbers}, output: int64(-3)},
+		{expr: `a == 1`, inputParsed: map[string]any{"a": 1}, opts: []InterpreterOption{StrictNumbers}, output: true},
+		{expr: `a == b`, inputParsed: map[string]any{"a": 1, "b": 1.0}, output: true},
+		{expr: `a == b`, inputParsed: map[string]any{"a": 1, "b": 1.0}, opts: []InterpreterOption{StrictNumbers}, err: "cannot compare integer and float"},
+		{expr: `a == b`, inputParsed: map[string]any{"a": 1, "b": 1.0}, skipTC: true, opts: []InterpreterOption{StrictNumbers}, err: "cannot compare integer and float"},
+		{expr: `a % b`, inputParsed: map[string]any{"a": 5.5, "b": 2}, opts: []InterpreterOption{StrictNumbers}, err: "modulus requires integers"},
+		{expr: `a % b`, inputParsed: map[string]any{"a": 5.5, "b": 2}, skipTC: true, opts: []InterpreterOption{StrictNumbers}, err: "modulus requires integers"},
+		{expr: `a[b]`, inputParsed: map[string]any{"a": []any{1, 2}, "b": 0.5}, opts: []InterpreterOption{StrictNumbers}, err: "array index must be an integer"},
+		{expr: `5 / 2`, opts: []InterpreterOption{StrictNumbers}, output: int64(2)},
+		{expr: `5 % 2`, opts: []InterpreterOption{StrictNumbers}, output: int64(1)},
+		{expr: `1 + 0.5`, opts: []InterpreterOption{StrictNumbers}, output: 1.5},
+		{expr: `5 / 2`, output: 2.5},
+		{expr: `n ^ 3`, inputParsed: map[string]any{"n": 2}, opts: []InterpreterOption{StrictNumbers}, output: int64(8)},
+		{expr: `n ^ 1000000000000`, inputParsed: map[string]any{"n": 1}, opts: []InterpreterOption{StrictNumbers}, output: int64(1)},
+		{expr: `n ^ 1000000000001`, inputParsed: map[string]any{"n": -1}, opts: []InterpreterOption{StrictNumbers}, output: int64(-1)},
+		{expr: `n ^ 1000000000000`, inputParsed: map[string]any{"n": 2}, opts: []InterpreterOption{StrictNumbers}, output: math.Inf(1)},
+		{expr: `n ^ 70`, inputParsed: map[string]any{"n": 2}, opts: []InterpreterOption{StrictNumbers}, output: math.Pow(2, 70)},
+		{expr: `a + 1`, inputParsed: map[string]any{"a": int64(math.MaxInt64)}, opts: []InterpreterOption{StrictNumbers}, output: float64(math.MaxInt64) + 1},
+		{expr: `a - 1`, inputParsed: map[string]any{"a": int64(math.MinInt64)}, opts: []InterpreterOption{StrictNumbers}, output: float64(math.MinInt64) - 1},
+		{expr: `a * b`, inputParsed: map[string]any{"a": int64(math.MinInt64), "b": -1}, opts: []InterpreterOption{StrictNumbers}, output: -float64(math.MinInt64)},
+		{expr: `a / b`, inputParsed: map[string]any{"a": int64(math.MinInt64), "b": -1}, opts: []InterpreterOption{StrictNumbers}, output: -float64(math.MinInt64)},
+		{expr: `a % b`, inputParsed: map[string]any{"a": int64(math.MinInt64), "b": -1}, opts: []InterpreterOption{StrictNumbers}, output: int64(0)},
+		{expr: `a + b`, inputParsed: map[string]any{"a": int64(math.MaxInt64), "b": int64(math.MinInt64)}, opts: []InterpreterOption{StrictNumbers}, output: int64(-1)},
+		{expr: `a[b]`, inputParsed: map[string]any{"a": []any{1, 2}, "b": 0.5}, skipTC: true, opts: []InterpreterOption{StrictNumbers}, err: "array index must be an integer"},
+		// Decimal numbers
+		{expr: `0.1 + 0.2 == 0.3`, output: false},
+		{expr: `0.1 + 0.2 == 0.3`, opts: []InterpreterOption{DecimalNumbers}, output: true},
+		{expr: `a + b == 0.3`, inputParsed: map[string]any{"a": 0.1, "b": 0.2}, opts: []InterpreterOption{DecimalNumbers}, output: true},
+		{expr: `"" + (1.1 * 3)`, opts: []InterpreterOption{DecimalNumbers}, output: "3.3"},
+		{expr: `"" + (1 / 8)`, opts: []InterpreterOption{DecimalNumbers}, output: "0.125"},
+		{expr: `"" + (-7.5 % 2)`, opts: []InterpreterOption{DecimalNumbers}, output: "-1.5"},
+		{expr: `"" + (0.5 ^ -2)`, opts: []InterpreterOption{DecimalNumbers}, output: "4"},
+		{expr: `1 / 3 * 3 == 1`, opts: []InterpreterOption{DecimalNumbers}, output: true},
+		{expr: `(((9 ^ 1024) ^ 1024) ^ 64) > 0`, opts: []InterpreterOption{DecimalNumbers}, err: "power result is larger than"},
+		{expr: `a > 0.2 and a <= 0.25`, input: `{"a": 0.25}`, opts: []InterpreterOption{DecimalNumbers}, output: true},
+		{expr: `1 / (a - 0.1)`, input: `{"a": 0.1}`, opts: []InterpreterOption{DecimalNumbers}, err: "cannot divide by zero"},
+		// Strict types
+		{expr: `"foo" + 1`, output: "foo1"},
+		{expr: `"foo" + 1`, opts: []InterpreterOption{StrictTypes}, err: "without converting to a string"},
+		{expr: `a + b`, inputParsed: map[string]any{"a": "foo", "b": 1}, skipTC: true, opts: []InterpreterOption{StrictTypes}, err: "without converting to a string"},
+		{expr: `"foo" + "bar"`, opts: []InterpreterOption{StrictTypes}, output: "foobar"},
+		{expr: `"id1" endsWith 1`, opts: []InterpreterOption{StrictTypes}, err: "expected strings"},
+		{expr: `a endsWith b`, inputParsed: map[string]any{"a": "id1", "b": 1}, skipTC: true, opts: []InterpreterOption{StrictTypes}, err: "expected strings"},
+		{expr: `a in b`, inputParsed: map[string]any{"a": 1, "b": []any{1, 2}}, opts: []InterpreterOption{StrictTypes}, output: true},
+		{expr: `1 and "a"`, opts: []InterpreterOption{StrictTypes}, err: "expected boolean"},
+		{expr: `a or b`, inputParsed: map[string]any{"a": false, "b": 1}, skipTC: true, opts: []InterpreterOption{StrictTypes}, err: "expected boolean"},
+		{expr: `not a`, input: `{"a": "foo"}`, opts: []InterpreterOption{StrictTypes}, err: "expected boolean"},
+		{expr: `a > 1 and not b`, input: `{"a": 2, "b": false}`, opts: []InterpreterOption{StrictTypes}, output: true},
+		// Lenient indexes
+		{expr: `a[5]`, input: `{"a": [1, 2]}`, err: "invalid index"},
+		{expr: `a[5]`, input: `{"a": [1, 2]}`, opts: []InterpreterOption{LenientIndexes}, output: nil},
+		{expr: `a[-3]`, input: `{"a": "hi"}`, opts: []InterpreterOption{LenientIndexes}, output: nil},
+		{expr: `a[1:5]`, input: `{"a": [1, 2, 3]}`, opts: []InterpreterOption{LenientIndexes}, output: []any{2.0, 3.0}},
+		{expr: `a[4:5]`, input: `{"a": "abc"}`, opts: []InterpreterOption{LenientIndexes}, output: ""},
+		{expr: `items where tags[1] == "b"`, input: `{"items": [{"tags": ["a", "b"]}, {"tags": ["a"]}, {"id": 1}]}`, skipTC: true, opts: []InterpreterOption{LenientIndexes}, output: []any{map[string]any{"tags": []any{"a", "b"}}}},
+		// Functions
+		{expr: `default(a, 5) + 1`, input: `{"a": null}`, output: 6.0},
+		{expr: `default(a, 5) + 1`, input: `{"a": 2}`, output: 3.0},
+		{expr: `default(a, "none")`, input: `{"a": ""}`, output: "none"},
+		{expr: `default(a, "none")`, input: `{}`, skipTC: true, output: "none"},
+		{expr: `default(foo.bar, 1)`, input: `{"foo": {}}`, opts: []InterpreterOption{StrictMode}, output: 1.0},
+		{expr: `foo.bar.default(1) > 0`, input: `{"foo": {}}`, opts: []InterpreterOption{StrictMode}, output: true},
+		{expr: `items where default(tags, "").length == 0`, input: `{"items": [{"id": 1, "tags": ["a"]}, {"id": 2, "tags": []}]}`, skipTC: true, output: []any{map[string]any{"id": 2.0, "tags": []any{}}}},
+		{expr: `default(a)`, err: "default expects 2 arguments but found 1"},
+		{expr: `a.default(1, 2)`, input: `{"a": 1}`, err: "default expects 2 arguments but found 3"},
+		{expr: `unknown(a)`, err: "unknown function unknown"},
+		{expr: `default(a, 1`, err: "expected right-paren"},
+		{expr: `default(a, , 1)`, err: "unexpected comma"},
+		{expr: `1(2)`, err: "unexpected left-paren"},
+		// Exists
+		{expr: `exists foo.bar`, input: `{"foo": {"bar": null}}`, output: true},
+		{expr: `exists foo.bar`, input: `{"foo": {}}`, output: false},
+		{expr: `exists foo.bar`, input: `{"foo": {}}`, opts: []InterpreterOption{StrictMode}, output: false},
+		{expr: `exists foo.bar.baz`, input: `{"foo": {}}`, output: false},
+		{expr: `exists foo[3]`, input: `{"foo": [1]}`, opts: []InterpreterOption{StrictMode}, output: false},
+		{expr: `exists foo[0]`, input: `{"foo": [1]}`, opts: []InterpreterOption{StrictMode}, output: true},
+		{expr: `exists foo[-2]`, input: `{"foo": [1]}`, opts: []InterpreterOption{StrictMode}, output: false},
+		{expr: `exists foo[3]`, input: `{"foo": "abc"}`, opts: []InterpreterOption{StrictMode}, output: false},
+		{expr: `exists foo[3]`, input: `{"foo": [1]}`, output: false},
+		{expr: `exists foo and foo > 1`, input: `{"foo": 2}`, output: true},
+		{expr: `not exists foo`, input: `{}`, skipTC: true, opts: []InterpreterOption{UnquotedStrings}, output: true},
+		{expr: `exists`, input: `{"exists": true}`, output: true},
+		{expr: `exists == 1`, input: `{"exists": 1}`, output: true},
+		{expr: `exists.foo and exists foo`, input: `{"exists": {"foo": 1}, "foo": 2}`, output: true},
+		{expr: `exists ,`, err: "expected eof but found comma"},
+		{expr: `has(foo, "bar")`, input: `{"foo": {"bar": false}}`, output: true},
+		{expr: `foo.has("baz")`, input: `{"foo": {"bar": false}}`, output: false},
+		{expr: `has(foo, "bar")`, input: `{"foo": "bar"}`, output: false},
+		// Type casting
+		{expr: `number(a) + 1`, input: `{"a": "1.5"}`, output: 2.5},
+		{expr: `number(a)`, input: `{"a": true}`, output: 1.0},
+		{expr: `number(a)`, input: `{"a": "abc"}`, err: "cannot convert \"abc\" to number"},
+		{expr: `int(a)`, input: `{"a": "9007199254740993"}`, output: int64(9007199254740993)},
+		{expr: `int(a)`, input: `{"a": "99999999999999999999"}`, err: "cannot convert 99999999999999999999 to integer"},
+		{expr: `int(a)`, input: `{"a": 1e300}`, err: "cannot convert 1e+300 to integer"},
+		{expr: `int(a ^ 2000)`, input: `{"a": 2}`, err: "cannot convert +Inf to integer"},
+		{expr: `number(a)`, input: `{"a": "NaN"}`, err: "cannot convert \"NaN\" to number"},
+		{expr: `number(a)`, input: `{"a": "Infinity"}`, err: "cannot convert \"Infinity\" to number"},
+		{expr: `number(a)`, input: `{"a": "1e400"}`, err: "cannot convert \"1e400\" to number"},
+		{expr: `a.int() == 3`, input: `{"a": 3.7}`, output: true},
+		{expr: `int(a)`, input: `{"a": " 2.5 "}`, output: int64(2)},
+		{expr: `string(a) + "!"`, input: `{"a": 1.5}`, output: "1.5!"},
+		{expr: `bool(a)`, input: `{"a": "false"}`, output: false},
+		{expr: `bool(a) and bool(b)`, input: `{"a": "TRUE", "b": 1}`, output: true},
+		{expr: `items where number(price) > 5`, input: `{"items": [{"price": "10"}, {"price": "2"}]}`, output: []any{map[string]any{"price": "10"}}},
+		// Rounding
+		{expr: `round(total / count, 2) == 3.33`, input: `{"total": 10, "count": 3}`, output: true},
+		{expr: `round(a)`, input: `{"a": 2.5}`, output: 3.0},
+		{expr: `round(a, -2)`, input: `{"a": 1250}`, output: 1300.0},
+		{expr: `a.round(1)`, input: `{"a": -1.25}`, output: -1.3},
+		{expr: `round(a, 2)`, input: `{"a": "foo"}`, err: "round expects numbers but found string"},
+		{expr: `round(a, 2)`, input: `{"a": "foo"}`, skipTC: true, err: "unable to convert to number"},
+		{expr: `round(a, 20)`, input: `{"a": 1}`, err: "decimal places must be between"},
+		{expr: `round(a)`, input: `{"a": null}`, output: nil},
+		{expr: `round(a, 2)`, input: `{"a": null}`, output: nil},
+		{expr: `fixed(a, 2)`, input: `{"a": null}`, output: nil},
+		{expr: `"" + round(1 / 3, 3)`, opts: []InterpreterOption{DecimalNumbers}, output: "0.333"},
+		{expr: `fixed(a, 2)`, input: `{"a": 3}`, output: "3.00"},
+		{expr: `fixed(a, 1)`, input: `{"a": 0.25}`, output: "0.3"},
+		{expr: `fixed(a)`, input: `{"a": 2.5}`, output: "3"},
+		{expr: `fixed(2 / 3, 4)`, opts: []InterpreterOption{DecimalNumbers}, output: "0.6667"},
+		// Date formatting
+		{expr: `created format "2006-01"`, input: `{"created": "2020-05-06T12:34:56Z"}`, output: "2020-05"},
+		{expr: `created format "2006-01" == "2020-05"`, input: `{"created": "2020-05-06"}`, output: true},
+		{expr: `(items where created format "2006" == "2021").length`, input: `{"items": [{"created": "2020-01-01"}, {"created": "2021-01-01"}]}`, output: 1},
+		{expr: `created format "Jan 2"`, inputParsed: map[string]any{"created": time.Date(2020, 5, 6, 0, 0, 0, 0, time.UTC)}, output: "May 6"},
+		{expr: `format == "json"`, input: `{"format": "json"}`, output: true},
+		{expr: `foo.format`, input: `{"foo": {"format": "json"}}`, output: "json"},
+		{expr: `created format "2006"`, input: `{"created": "bad"}`, err: "unable to convert bad to date or time"},
+		{expr: `created format 1`, input: `{"created": "2020-01-01"}`, err: "format layout must be a string"},
+		// Date layouts
+		{expr: `a before "2020-01-01"`, input: `{"a": "Tue, 10 Dec 2019 12:00:00 UTC"}`, err: "unable to convert"},
+		{expr: `a before "2020-01-01"`, input: `{"a": "Tue, 10 Dec 2019 12:00:00 UTC"}`, opts: []InterpreterOption{WithDateLayouts(time.RFC1123)}, output: true},
+		{expr: `a after "2020-01-01"`, input: `{"a": 1600000000}`, opts: []InterpreterOption{WithDateLayouts(LayoutUnix)}, output: true},
+		{expr: `a format "2006-01-02"`, input: `{"a": "1600000000.5"}`, opts: []InterpreterOption{WithDateLayouts(LayoutUnix)}, output: "2020-09-13"},
+		{expr: `a after "2020-01-01"`, input: `{"a": "01/02/2021"}`, opts: []InterpreterOption{StrictMode, WithDateLayouts("01/02/2006")}, output: true},
+		// Date locations
+		{expr: `a before "2022-01-01T12:00:00Z"`, input: `{"a": "2022-01-01T12:30:00"}`, output: false},
+		{expr: `a before "2022-01-01T12:00:00Z"`, input: `{"a": "2022-01-01T12:30:00"}`, opts: []InterpreterOption{WithLocation(time.FixedZone("EST", -5*60*60))}, output: false},
+		{expr: `a before "2022-01-01T12:00:00Z"`, input: `{"a": "2022-01-01T12:30:00"}`, opts: []InterpreterOption{WithLocation(time.FixedZone("CET", 60*60))}, output: true},
+		{expr: `a format "15:04 MST"`, input: `{"a": "2022-01-01T12:30:00"}`, opts: []InterpreterOption{WithLocation(time.FixedZone("CET", 60*60))}, output: "12:30 CET"},
+		{expr: `a after "2022-01-01T00:00:00+01:00"`, input: `{"a": "2022-01-01"}`, opts: []InterpreterOption{WithLocation(time.FixedZone("CET", 60*60))}, output: false},
+		// Current time
+		{expr: `expires before now`, input: `{"expires": "2020-01-01"}`, opts: []InterpreterOption{WithClock(clock)}, output: true},
+		{expr: `expires after now`, input: `{"expires": "2020-01-01"}`, opts: []InterpreterOption{WithClock(clock)}, output: false},
+		{expr: `now format "2006-01-02"`, opts: []InterpreterOption{WithClock(clock)}, output: "2021-02-03"},
+		{expr: `"" + now`, opts: []InterpreterOption{WithClock(clock)}, output: "2021-02-03T04:05:06Z"},
+		{expr: `now`, input: `{"now": 5}`, opts: []InterpreterOption{WithClock(clock)}, output: 5.0},
+		{expr: `foo.now`, input: `{"foo": {}}`, skipTC: true, opts: []InterpreterOption{WithClock(clock)}, output: nil},
+		{expr: `now after "2020-01-01"`, output: true},
+		// Globals
+		{expr: `user.role == "admin"`, input: `{}`, opts: []InterpreterOption{WithGlobals(map[string]any{"user": map[string]any{"role": "admin"}})}, output: true},
+		{expr: `items where owner == user`, input: `{"items": [{"owner": "a"}, {"owner": "b"}]}`, opts: []InterpreterOption{WithGlobals(map[string]any{"user": "b"})}, output: []any{map[string]any{"owner": "b"}}},
+		{expr: `limit`, input: `{"limit": 1}`, opts: []InterpreterOption{WithGlobals(map[string]any{"limit": 2})}, output: 1.0},
+		{expr: `foo.limit`, input: `{"foo": {}}`, skipTC: true, opts: []InterpreterOption{WithGlobals(map[string]any{"limit": 2})}, output: nil},
+		{expr: `flags.beta + 1`, input: `{}`, opts: []InterpreterOption{WithGlobals(map[string]any{"flags": map[string]any{"beta": true}})}, err: "cannot operate on incompatible types"},
+		// Outer scopes
+		{expr: `items where price > $root.threshold`, input: `{"threshold": 5, "items": [{"price": 3}, {"price": 7}]}`, output: []any{map[string]any{"price": 7.0}}},
+		{expr: `items where price > $parent.threshold`, input: `{"threshold": 5, "items": [{"price": 3}, {"price": 7}]}`, output: []any{map[string]any{"price": 7.0}}},
+		{expr: `groups where (items where id == $parent.want)`, input: `{"groups": [{"want": 1, "items": [{"id": 1}]}, {"want": 3, "items": [{"id": 2}]}]}`, output: []any{map[string]any{"want": 1.0, "items": []any{map[string]any{"id": 1.0}}}}},
+		{expr: `$root.a`, input: `{"a": 1}`, output: 1.0},
+		{expr: `$parent`, input: `{"a": 1}`, output: nil},
+		{expr: `foo.$root`, input: `{"foo": {"$root": 2}}`, output: 2.0},
+		{expr: `items where price > $root.missing`, input: `{"items": [{"price": 3}]}`, err: "no property missing"},
+		// Map filtering
+		{expr: `config where ($key startsWith "db_" and $value != "")`, input: `{"config": {"db_host": "x", "db_port": "", "name": "y"}}`, output: []any{"x"}},
+		{expr: `config where $key startsWith "db_"`, input: `{"config": {"db_host": "x", "name": "y"}}`, opts: []InterpreterOption{KeepMapKeys}, output: map[string]any{"db_host": "x"}},
+		{expr: `items where $key > 0`, input: `{"items": ["a", "b", "c"]}`, opts: []InterpreterOption{KeepMapKeys}, output: []any{"b", "c"}},
+		{expr: `items where $value == "b"`, input: `{"items": ["a", "b"]}`, output: []any{"b"}},
+		{expr: `m where $key == 1`, inputParsed: map[string]any{"m": map[any]any{1: "a", 2: "b"}}, skipTC: true, opts: []InterpreterOption{KeepMapKeys}, output: map[any]any{1: "a"}},
+		{expr: `$key`, input: `{}`, output: nil},
+		// Projection
+		{expr: `items.id`, input: `{"items": [{"id": 1}, {"id": 2}, {"name": "x"}]}`, skipTC: true, output: []any{1.0, 2.0}},
+		{expr: `items.id contains 42`, input: `{"items": [{"id": 1}, {"id": 42}]}`, output: true},
+		{expr: `items.length`, input: `{"items": [{"length": 5}]}`, output: 1},
+		{expr: `items.tags[0]`, input: `{"items": [{"tags": ["a", "b"]}, {"tags": ["c"]}]}`, output: []any{"a", "c"}},
+		{expr: `items.user.name.upper`, input: `{"items": [{"user": {"name": "a"}}, {"user": {"name": "b"}}]}`, output: []any{"A", "B"}},
+		{expr: `items.id`, input: `{"items": [{"id": 1}, {"name": "x"}]}`, skipTC: true, opts: []InterpreterOption{StrictMode}, err: "cannot get id"},
+		{expr: `items.foo + 1`, input: `{"items": [{"id": 1}]}`, err: "no property foo"},
+		// Paging
+		{expr: `items where id > 1 limit 2`, input: `{"items": [{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}]}`, output: []any{map[string]any{"id": 2.0}, map[string]any{"id": 3.0}}},
+		{expr: `items limit 2 offset 1`, input: `{"items": [1, 2, 3, 4]}`, output: []any{2.0, 3.0}},
+		{expr: `items offset 1 limit 2`, input: `{"items": [1, 2, 3, 4]}`, output: []any{2.0, 3.0}},
+		{expr: `(items limit 3) offset 1`, input: `{"items": [1, 2, 3, 4]}`, output: []any{2.0, 3.0}},
+		{expr: `(items limit 2) offset 1 limit 2`, input: `{"items": [1, 2, 3, 4]}`, output: []any{2.0}},
+		{expr: `items offset 10`, input: `{"items": [1, 2]}`, output: []any{}},
+		{expr: `items limit 10`, input: `{"items": [1, 2]}`, output: []any{1.0, 2.0}},
+		{expr: `(items limit 1).length == 1`, input: `{"items": [1, 2]}`, output: true},
+		{expr: `items.take(1)`, input: `{"items": [1, 2]}`, output: []any{1.0}},
+		{expr: `drop(items, 1)`, input: `{"items": [1, 2]}`, output: []any{2.0}},
+		{expr: `limit + offset`, input: `{"limit": 1, "offset": 2}`, output: 3.0},
+		{expr: `items limit -1`, input: `{"items": [1, 2]}`, err: "limit requires a non-negative integer"},
+		{expr: `items limit 1`, input: `{"items": "abc"}`, err: "limit requires an array but found string"},
+		{expr: `items limit 1`, input: `{"items": "abc"}`, skipTC: true, err: "limit requires an array but found abc"},
+		// Aggregations
+		{expr: `items sumBy price`, input: `{"items": [{"price": 1.5}, {"price": 2}]}`, output: 3.5},
+		{expr: `items sumBy (price * qty) > 10`, input: `{"items": [{"price": 2, "qty": 3}, {"price": 1, "qty": 5}]}`, output: true},
+		{expr: `items sumBy price * qty`, input: `{"items": [{"price": 2, "qty": 3}, {"price": 1, "qty": 5}]}`, output: 11.0},
+		{expr: `items where active sumBy price`, input: `{"items": [{"price": 1, "active": true}, {"price": 2}]}`, output: 1.0},
+		{expr: `items sumBy price`, input: `{"items": []}`, output: 0.0},
+		{expr: `items sumBy id`, inputParsed: map[string]any{"items": []any{map[string]any{"id": int64(1)}, map[string]any{"id": int64(2)}}}, output: int64(3)},
+		{expr: `items sumBy price == 0.3`, input: `{"items": [{"price": 0.1}, {"price": 0.2}]}`, opts: []InterpreterOption{DecimalNumbers}, output: true},
+		{expr: `items sumBy price`, input: `{"items": [{"price": 1}, {}]}`, skipTC: true, output: 1.0},
+		{expr: `items maxBy price`, input: `{"items": [{"id": 1, "price": 2}, {"id": 2, "price": 3}, {"id": 3, "price": 1}]}`, output: map[string]any{"id": 2.0, "price": 3.0}},
+		{expr: `(items minBy price).id`, input: `{"items": [{"id": 1, "price": 2}, {"id": 2, "price": 3}, {"id": 3, "price": 1}]}`, output: 3.0},
+		{expr: `(items minBy price).id`, input: `{"items": [{"id": 1, "price": 1}, {"id": 2, "price": 1}]}`, output: 1.0},
+		{expr: `items maxBy price`, input: `{"items": []}`, output: nil},
+		{expr: `items maxBy $key`, input: `{"items": ["a", "b"]}`, output: "b"},
+		{expr: `sumBy + maxBy`, input: `{"sumBy": 1, "maxBy": 2}`, output: 3.0},
+		{expr: `items sumBy name`, input: `{"items": [{"name": "a"}]}`, err: "sumBy requires numbers but found string"},
+		{expr: `items sumBy name`, input: `{"items": [{"name": "a"}]}`, skipTC: true, err: "sumBy requires numbers but found a"},
+		{expr: `items sumBy price`, input: `{"items": 1}`, err: "sumBy requires an array but found number"},
+		{expr: `items sumBy price`, input: `{"items": 1}`, skipTC: true, err: "sumBy requires an array but found 1"},
+		// Arrays
+		{expr: `[1, 2]`, output: []any{1.0, 2.0}},
+		{expr: `[]`, output: []any{}},
+		{expr: `[a, "b", 1 + 2,]`, input: `{"a": true}`, output: []any{true, "b", 3.0}},
+		{expr: `foo == [1, 2]`, input: `{"foo": [1, 2]}`, output: true},
+		{expr: `foo != [1, 2]`, input: `{"foo": [1, 2]}`, output: false},
+		{expr: `foo == [1, 2]`, input: `{"foo": [1, 2, 3]}`, output: false},
+		{expr: `foo == [2, 1]`, input: `{"foo": [1, 2]}`, output: false},
+		{expr: `foo == [1, 2]`, inputParsed: map[string]any{"foo": []int{1, 2}}, output: true},
+		{expr: `foo == [[1], ["a"]]`, inputParsed: map[string]any{"foo": []any{[]int64{1}, []string{"a"}}}, output: true},
+		{expr: `foo == bar`, inputParsed: map[string]any{"foo": []any{1.0}, "bar": []float32{1.0}}, output: true},
+		{expr: `foo == "a"`, inputParsed: map[string]any{"foo": []byte("a")}, output: true},
+		{expr: `[1, 2][1]`, output: 2.0},
+		{expr: `[1, , 2]`, err: "unexpected comma"},
+		{expr: `[1, 2`, err: "expected right-bracket"},
+		// Object equality
+		{expr: `a == b`, input: `{"a": {"x": 1, "y": [1, {"z": true}]}, "b": {"y": [1, {"z": true}], "x": 1}}`, output: true},
+		{expr: `a != b`, input: `{"a": {"x": 1}, "b": {"x": 1}}`, output: false},
+		{expr: `a == b`, input: `{"a": {"x": 1}, "b": {"x": 2}}`, output: false},
+		{expr: `a == b`, input: `{"a": {"x": 1}, "b": {"y": 1}}`, output: false},
+		{expr: `a == b`, input: `{"a": {"x": 1}, "b": {"x": 1, "y": 2}}`, output: false},
+		{expr: `a == b`, input: `{"a": {}, "b": {}}`, output: true},
+		{expr: `a == b`, inputParsed: map[string]any{"a": map[string]any{"x": 1, "1": "y"}, "b": map[any]any{"x": 1.0, 1: "y"}}, output: true},
+		{expr: `a == b`, inputParsed: map[string]any{"a": map[string]int{"x": 1}, "b": map[string]any{"x": int64(1)}}, output: true},
+		{expr: `a == b`, input: `{"a": {"x": 1}, "b": [1]}`, output: false},
+		// Ranges
+		{expr: `1..3`, output: []any{1.0, 2.0, 3.0}},
+		{expr: `3..1`, output: []any{}},
+		{expr: `-1..1`, output: []any{-1.0, 0.0, 1.0}},
+		{expr: `1..n + 1`, input: `{"n": 2}`, output: []any{1.0, 2.0, 3.0}},
+		{expr: `code in 200..299`, input: `{"code": 204}`, output: true},
+		{expr: `code in 200..299`, input: `{"code": 299}`, output: true},
+		{expr: `code in 200..299`, input: `{"code": 300}`, output: false},
+		{expr: `code in 200..299`, input: `{"code": 200.5}`, output: false},
+		{expr: `code in 200..299`, input: `{"code": "204"}`, skipTC: true, output: false},
+		{expr: `(0..10)[2:3]`, output: []any{2.0, 3.0}},
+		{expr: `0..4 where $value % 2 == 0`, output: []any{0.0, 2.0, 4.0}},
+		{expr: `1..4 sumBy $value`, output: 10.0},
+		{expr: `1.5..3`, err: "range requires integers"},
+		{expr: `a..3`, input: `{"a": "x"}`, err: "range requires numbers but found string"},
+		{expr: `(0..99_999).length`, output: 100_000},
+		{expr: `0..100_000`, err: "range has more than 100000 items"},
+		{expr: `code in 0..9_999_999`, input: `{"code": 5000000}`, output: true},
+		{expr: `(0..99_999 where (0..99_999 where @ > 0).length > 0).length`, err: "expression uses more than 10000000 range items and iterations"},
+		{expr: `(1..3000 where (1..3000 where @ > 0).length > 0).length`, err: "expression uses more than 10000000 range items and iterations"},
+		{expr: `(1..3000 where (1..3000 where @ > 0).length > 0).length`, opts: []InterpreterOption{WithParallel(100, 4)}, err: "expression uses more than 10000000 range items and iterations"},
+		{expr: `(100000000000000000..100000000000000016).length`, err: "range bounds must be smaller than 2^53"},
+		{expr: `-9007199254740992..-9007199254740990`, err: "range bounds must be smaller than 2^53"},
+		// Empty values
+		{expr: `name.isEmpty`, input: `{"name": ""}`, output: true},
+		{expr: `name.isEmpty`, input: `{"name": "a"}`, output: false},
+		{expr: `name.isEmpty`, input: `{"name": null}`, output: true},
+		{expr: `name.isEmpty`, input: `{"name": null}`, opts: []InterpreterOption{StrictMode}, output: true},
+		{expr: `tags.isEmpty`, input: `{"tags": []}`, output: true},
+		{expr: `tags.isEmpty`, input: `{"tags": [{"id": 1}]}`, output: false},
+		{expr: `meta.isEmpty`, input: `{"meta": {}}`, output: true},
+		{expr: `meta.isEmpty`, input: `{"meta": {"a": 1}}`, output: false},
+		{expr: `meta.isEmpty`, input: `{"meta": {"isEmpty": "yes"}}`, output: "yes"},
+		{expr: `count.isEmpty`, input: `{"count": 0}`, output: false},
+		{expr: `items where not tags.isEmpty`, input: `{"items": [{"tags": []}, {"tags": ["a"]}]}`, output: []any{map[string]any{"tags": []any{"a"}}}},
+		// Blank values
+		{expr: `name.isBlank`, input: `{"name": " \t\n"}`, output: true},
+		{expr: `name.isBlank`, input: `{"name": ""}`, output: true},
+		{expr: `name.isBlank`, input: `{"name": " a "}`, output: false},
+		{expr: `name.isBlank`, input: `{"name": null}`, output: true},
+		{expr: `items where not name.isBlank`, input: `{"items": [{"name": " "}, {"name": "a"}]}`, output: []any{map[string]any{"name": "a"}}},
+		{expr: `names.isBlank`, input: `{"names": ["", "a"]}`, output: []any{true, false}},
+		// Undefined values
+		{expr: `foo`, opts: []InterpreterOption{UndefinedValues}, output: Undefined},
+		{expr: `foo.bar`, opts: []InterpreterOption{UndefinedValues}, output: Undefined},
+		{expr: `foo`, input: `{"foo": null}`, opts: []InterpreterOption{UndefinedValues}, output: nil},
+		{expr: `foo == undefined`, input: `{"bar": 1}`, skipTC: true, opts: []InterpreterOption{UndefinedValues}, output: true},
+		{expr: `foo == undefined`, input: `{"foo": null}`, opts: []InterpreterOption{UndefinedValues}, output: false},
+		{expr: `foo == bar`, input: `{"foo": null}`, skipTC: true, opts: []InterpreterOption{UndefinedValues}, output: false},
+		{expr: `not foo`, opts: []InterpreterOption{UndefinedValues}, output: true},
+		{expr: `foo.isEmpty`, opts: []InterpreterOption{UndefinedValues}, output: true},
+		{expr: `foo.default(1)`, opts: []InterpreterOption{UndefinedValues}, output: 1.0},
+		{expr: `items.id`, input: `{"items": [{"id": 1}, {}]}`, skipTC: true, opts: []InterpreterOption{UndefinedValues}, output: []any{1.0}},
+		{expr: `items where id == undefined`, input: `{"items": [{"id": 1}, {}]}`, skipTC: true, opts: []InterpreterOption{UndefinedValues}, output: []any{map[string]any{}}},
+		{expr: `undefined`, input: `{"undefined": 1}`, opts: []InterpreterOption{UndefinedValues}, output: 1.0},
+		{expr: `undefined`, output: nil},
+		{expr: `foo`, opts: []InterpreterOption{UndefinedValues, StrictMode}, err: "cannot get foo"},
+		// Three-valued logic
+		{expr: `a == 1`, input: `{"a": null}`, opts: []InterpreterOption{ThreeValuedLogic}, output: nil},
+		{expr: `a != 1`, input: `{"a": null}`, opts: []InterpreterOption{ThreeValuedLogic}, output: nil},
+		{expr: `a < b`, input: `{"a": 1, "b": null}`, opts: []InterpreterOption{ThreeValuedLogic}, output: nil},
+		{expr: `a == 1`, input: `{"a": 1}`, opts: []InterpreterOption{ThreeValuedLogic}, output: true},
+		{expr: `a == 1 and b == 2`, input: `{"a": null, "b": 2}`, opts: []InterpreterOption{ThreeValuedLogic}, output: nil},
+		{expr: `a == 1 and b == 2`, input: `{"a": null, "b": 3}`, opts: []InterpreterOption{ThreeValuedLogic}, output: false},
+		{expr: `a == 1 or b == 2`, input: `{"a": null, "b": 2}`, opts: []InterpreterOption{ThreeValuedLogic}, output: true},
+		{expr: `a == 1 or b == 2`, input: `{"a": null, "b": 3}`, opts: []InterpreterOption{ThreeValuedLogic}, output: nil},
+		{expr: `not (a == 1)`, input: `{"a": null}`, opts: []InterpreterOption{ThreeValuedLogic}, output: nil},
+		{expr: `not (a == 1)`, input: `{"a": 2}`, opts: []InterpreterOption{ThreeValuedLogic}, output: true},
+		{expr: `items where not (id == 1)`, input: `{"items": [{"id": 1}, {"id": 2}, {"id": null}]}`, opts: []InterpreterOption{ThreeValuedLogic}, output: []any{map[string]any{"id": 2.0}}},
+		{expr: `items where not (id == 1)`, input: `{"items": [{"id": 1}, {"id": 2}, {"id": null}]}`, output: []any{map[string]any{"id": 2.0}, map[string]any{"id": nil}}},
+		// Date truncation
+		{expr: `created sameDay updated`, input: `{"created": "2022-01-01T01:00:00Z", "updated": "2022-01-01T23:00:00Z"}`, output: true},
+		{expr: `created sameDay updated`, input: `{"created": "2022-01-01T23:00:00Z", "updated": "2022-01-02T01:00:00Z"}`, output: false},
+		{expr: `created sameDay updated`, input: `{"created": "2022-01-01T23:00:00-05:00", "updated": "2022-01-02T01:00:00Z"}`, output: true},
+		{expr: `created sameDay now`, input: `{"created": "2021-02-03"}`, opts: []InterpreterOption{WithClock(clock)}, output: true},
+		{expr: `startOfMonth(created)`, input: `{"created": "2022-03-15T12:30:00Z"}`, output: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: `created.startOfDay() format "2006-01-02T15:04"`, input: `{"created": "2022-03-15T12:30:00Z"}`, output: "2022-03-15T00:00"},
+		{expr: `startOfYear(created) format "2006-01-02"`, input: `{"created": "2022-03-15T12:30:00Z"}`, output: "2022-01-01"},
+		{expr: `created >= startOfMonth(now)`, input: `{"created": "2021-02-01T00:00:00Z"}`, opts: []InterpreterOption{WithClock(clock)}, output: true},
+		{expr: `created >= startOfMonth(now)`, input: `{"created": "2021-01-31T23:59:59Z"}`, opts: []InterpreterOption{WithClock(clock)}, output: false},
+		{expr: `startOfDay(now) == "2021-02-03T00:00:00Z"`, opts: []InterpreterOption{WithClock(clock)}, output: true},
+		// Ordering strings is a type error unless one side is a date, but date
+		// strings are still ordered when running.
+		{expr: `a < b`, input: `{"a": "2021-01-01", "b": "2021-01-02T00:00:00Z"}`, err: "cannot compare string with string"},
+		{expr: `a < b`, input: `{"a": "2021-01-01", "b": "2021-01-02T00:00:00Z"}`, skipTC: true, output: true},
+		{expr: `a < startOfDay(b)`, input: `{"a": "2021-01-01", "b": "2021-01-02T12:00:00Z"}`, output: true},
+		{expr: `startOfDay(now) < 5`, input: `{}`, opts: []InterpreterOption{WithClock(clock)}, err: "cannot compare date with number"},
+		{expr: `a == b`, input: `{"a": "2021-01-01", "b": "2021-01-01T00:00:00Z"}`, output: false},
+		{expr: `startOfDay(created)`, input: `{"created": null}`, output: nil},
+		{expr: `startOfDay(created)`, input: `{"created": "bad"}`, err: "unable to convert bad to date or time"},
+		{expr: `a < b`, input: `{"a": "x", "b": "y"}`, skipTC: true, err: "unable to convert"},
+		// Regular expressions
+		{expr: `name.match("^projects/(\w+)/items/(\d+)$")`, input: `{"name": "projects/foo/items/12"}`, output: []any{"projects/foo/items/12", "foo", "12"}},
+		{expr: `(name.match("items/(\d+)"))[1] == "12"`, input: `{"name": "projects/foo/items/12"}`, output: true},
+		{expr: `match(name, "^projects/(?P<project>\w+)/items/(?P<item>\d+)$")`, input: `{"name": "projects/foo/items/12"}`, output: map[string]any{"project": "foo", "item": "12"}},
+		{expr: `name.match("^projects/(?P<project>\w+)/").project == "foo"`, input: `{"name": "projects/foo/items/12"}`, output: true},
+		{expr: `name.match("^users/")`, input: `{"name": "projects/foo"}`, output: nil},
+		{expr: `items where name.match("^a")`, input: `{"items": [{"name": "ab"}, {"name": "ba"}]}`, output: []any{map[string]any{"name": "ab"}}},
+		{expr: `name.match("^a")`, input: `{"name": null}`, output: nil},
+		{expr: `name.match("(")`, input: `{"name": "a"}`, err: "invalid pattern"},
+		// Lines and words
+		{expr: `log.lines`, input: `{"log": "a\nb c\r\nd\n"}`, output: []any{"a", "b c", "d"}},
+		{expr: `log.lines.length > 2`, input: `{"log": "a\nb\nc"}`, output: true},
+		{expr: `log.lines`, input: `{"log": ""}`, output: []any{}},
+		{expr: `description.words`, input: `{"description": "  this is\turgent\n"}`, output: []any{"this", "is", "urgent"}},
+		{expr: `description.words contains "urgent"`, input: `{"description": "this is urgent"}`, output: true},
+		{expr: `description.words contains "urge"`, input: `{"description": "this is urgent"}`, output: false},
+		{expr: `obj.lines`, input: `{"obj": {"lines": 5}}`, output: 5.0},
+		// Case styles
+		{expr: `a.camel`, input: `{"a": "foo_bar-baz"}`, output: "fooBarBaz"},
+		{expr: `a.snake`, input: `{"a": "fooBarBaz"}`, output: "foo_bar_baz"},
+		{expr: `a.kebab`, input: `{"a": "HTTPServerID2"}`, output: "http-server-id2"},
+		{expr: `a.title`, input: `{"a": "  hello_WORLD again "}`, output: "Hello World Again"},
+		{expr: `a.snake`, input: `{"a": "userID"}`, output: "user_id"},
+		{expr: `a.snake == b.snake`, input: `{"a": "createdAt", "b": "created-at"}`, output: true},
+		{expr: `a.camel`, input: `{"a": ""}`, output: ""},
+		{expr: `a.title`, input: `{"a": {"title": "t"}}`, output: "t"},
+		// Clamping
+		{expr: `clamp(score, 0, 100)`, input: `{"score": 120}`, output: 100.0},
+		{expr: `clamp(score, 0, 100)`, input: `{"score": -5}`, output: 0.0},
+		{expr: `score.clamp(0, 100)`, input: `{"score": 42.5}`, output: 42.5},
+		{expr: `clamp(score, 0, 100) >= 100`, input: `{"score": 150}`, output: true},
+		{expr: `clamp(score, 1, 10)`, inputParsed: map[string]any{"score": int64(5)}, output: int64(5)},
+		{expr: `clamp(score, 0, 1)`, input: `{"score": null}`, output: nil},
+		{expr: `clamp(score, 10, 1)`, input: `{"score": 5}`, err: "clamp minimum 10 is greater than maximum 1"},
+		{expr: `clamp(score, 0, 1)`, input: `{"score": "a"}`, err: "clamp expects numbers but found string"},
+		{expr: `clamp(score, 0, 1)`, input: `{"score": "a"}`, skipTC: true, err: "clamp expects numbers but found a"},
+		{expr: `clamp(score, 0)`, input: `{"score": 1}`, err: "clamp expects 3 arguments but found 2"},
+		// Wildcards
+		{expr: `name like "foo*"`, input: `{"name": "foobar"}`, output: true},
+		{expr: `name like "foo%"`, input: `{"name": "foobar"}`, output: true},
+		{expr: `name like "*bar"`, input: `{"name": "foobar"}`, output: true},
+		{expr: `name like "f?o*r"`, input: `{"name": "foobar"}`, output: true},
+		{expr: `name like "f_o%a_"`, input: `{"name": "foobar"}`, output: true},
+		{expr: `name like "foo"`, input: `{"name": "foobar"}`, output: false},
+		{expr: `name like "*baz"`, input: `{"name": "foobar"}`, output: false},
+		{expr: `name like "*a*a*"`, input: `{"name": "banana"}`, output: true},
+		{expr: `name like "??"`, input: `{"name": "é!"}`, output: true},
+		{expr: `name like "100\%"`, input: `{"name": "100%"}`, output: true},
+		{expr: `name like "100\%"`, input: `{"name": "1000"}`, output: false},
+		{expr: `name like "*"`, input: `{"name": ""}`, output: true},
+		{expr: `items where name like "a*"`, input: `{"items": [{"name": "ab"}, {"name": "ba"}]}`, output: []any{map[string]any{"name": "ab"}}},
+		{expr: `obj.like == 1`, input: `{"obj": {"like": 1}}`, output: true},
+		{expr: `like == 1`, input: `{"like": 1}`, output: true},
+		{expr: `sameDay == 1`, input: `{"sameDay": 1}`, output: true},
+		{expr: `inCidr == 1`, input: `{"inCidr": 1}`, output: true},
+		{expr: `items where in > 1`, input: `{"items": [{"in": 1}, {"in": 2}]}`, output: []any{map[string]any{"in": 2.0}}},
+		// Fuzzy matching
+		{expr: `similarity(name, "john smith")`, input: `{"name": "john smith"}`, output: 1.0},
+		{expr: `similarity(name, "jonh smith")`, input: `{"name": "john smith"}`, output: 0.8},
+		{expr: `name.similarity("jonh smith") >= 0.8`, input: `{"name": "john smith"}`, output: true},
+		{expr: `name.lower.similarity("jane doe") > 0.8`, input: `{"name": "John Smith"}`, output: false},
+		{expr: `similarity(name, "")`, input: `{"name": "abc"}`, output: 0.0},
+		{expr: `similarity(name, "")`, input: `{"name": ""}`, output: 1.0},
+		{expr: `similarity(name, "cafe")`, input: `{"name": "café"}`, output: 0.75},
+		{expr: `similarity(name, "é".padStart(1000, "x"))`, input: `{"name": "abc"}`, output: 0.0},
+		{expr: `similarity("a".padStart(30000, "x"), "b".padStart(30000, "y"))`, err: "similarity expects strings of at most 1000 characters"},
+		{expr: `items where name.similarity("widget") > 0.6`, input: `{"items": [{"name": "widgte"}, {"name": "gizmo"}]}`, output: []any{map[string]any{"name": "widgte"}}},
+		// Padding
+		{expr: `id.padStart(8, "0")`, input: `{"id": "42"}`, output: "00000042"},
+		{expr: `id.padStart(8, "0") == code`, input: `{"id": 42, "code": "00000042"}`, output: true},
+		{expr: `padEnd(id, 5)`, input: `{"id": "ab"}`, output: "ab   "},
+		{expr: `id.padStart(7, "ab")`, input: `{"id": "x"}`, output: "abababx"},
+		{expr: `id.padEnd(4, "é")`, input: `{"id": "ü"}`, output: "üééé"},
+		{expr: `id.padStart(2, "0")`, input: `{"id": "123"}`, output: "123"},
+		{expr: `id.padStart(5, "")`, input: `{"id": "1"}`, output: "1"},
+		{expr: `id.padStart(5)`, input: `{"id": null}`, output: nil},
+		{expr: `id.padStart(8, "0")`, input: `{"id": 42}`, opts: []InterpreterOption{StrictTypes}, skipTC: true, err: "padStart expects a string but found 42"},
+		{expr: `id.padStart("a")`, input: `{"id": "1"}`, err: "padStart expects a number length but found string"},
+		{expr: `id.padStart(1_000_000_000_000)`, input: `{"id": "1"}`, err: "padStart length is larger than 1000000"},
+		{expr: `id.padEnd(-5)`, input: `{"id": "1"}`, err: "padEnd length cannot be negative"},
+		{expr: `id.padStart(2.5)`, input: `{"id": "1"}`, err: "padStart length must be an integer"},
+		// Unicode strings
+		{expr: `s.length`, input: `{"s": "héllo"}`, output: 5},
+		{expr: `s[1]`, input: `{"s": "héllo"}`, output: "é"},
+		{expr: `s[-1]`, input: `{"s": "日本語"}`, output: "語"},
+		{expr: `s[1:2]`, input: `{"s": "日本語"}`, output: "本語"},
+		{expr: `s[:0]`, input: `{"s": "😀ab"}`, output: "😀"},
+		{expr: `s[3]`, input: `{"s": "日本語"}`, err: "invalid index 3 for string of length 3"},
+		{expr: `s[1:5]`, input: `{"s": "日本語"}`, opts: []InterpreterOption{LenientIndexes}, output: "本語"},
+		// Unicode folding
+		{expr: `a == b`, input: `{"a": "café", "b": "CAFE\u0301"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a == b`, input: `{"a": "café", "b": "CAFE\u0301"}`, output: false},
+		{expr: `a != b`, input: `{"a": "Straße", "b": "STRASSE"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a == b`, input: `{"a": "việt", "b": "vie\u0323\u0302t"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a == b`, input: `{"a": "việt", "b": "vie\u0302\u0323t"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a == b`, input: `{"a": "A\u0327\u0301", "b": "a\u0301\u0327"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a contains "CAFÉ"`, input: `{"a": "the cafe\u0301 is open"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `"É" in a`, input: `{"a": "cafe\u0301"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a startsWith "ÉCOLE"`, input: `{"a": "école primaire"}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `tags contains "Café"`, input: `{"tags": ["cafe\u0301"]}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		{expr: `a == b`, input: `{"a": 1, "b": 1}`, opts: []InterpreterOption{FoldStrings}, output: true},
+		// Base64
+		{expr: `base64(a)`, input: `{"a": "hello?"}`, output: "aGVsbG8/"},
+		{expr: `a.base64decode()`, input: `{"a": "aGVsbG8/"}`, output: "hello?"},
+		{expr: `a.base64decode()`, input: `{"a": "aGVsbG8_"}`, output: "hello?"},
+		{expr: `a.base64decode()`, input: `{"a": "aGk"}`, output: "hi"},
+		{expr: `a.base64decode() startsWith "{"`, input: `{"a": "eyJpZCI6IDF9"}`, output: true},
+		{expr: `a.base64().base64decode() == a`, input: `{"a": "héllo"}`, output: true},
+		{expr: `base64(a)`, input: `{"a": null}`, output: nil},
+		{expr: `a.base64decode()`, input: `{"a": "!!"}`, err: "invalid base64 value"},
+		// URL encoding
+		{expr: `urlencode(q)`, input: `{"q": "a b&c=d/é"}`, output: "a+b%26c%3Dd%2F%C3%A9"},
+		{expr: `q.urldecode()`, input: `{"q": "a+b%26c%3Dd%2F%C3%A9"}`, output: "a b&c=d/é"},
+		{expr: `q.urldecode() == "hello world"`, input: `{"q": "hello%20world"}`, output: true},
+		{expr: `q.urlencode().urldecode() == q`, input: `{"q": "x=1&y=2"}`, output: true},
+		{expr: `urldecode(q)`, input: `{"q": null}`, output: nil},
+		{expr: `urldecode(q)`, input: `{"q": "%zz"}`, err: "invalid URL encoded value"},
+		// C-style operators
+		{expr: `a > 1 && b < 5`, input: `{"a": 2, "b": 3}`, output: true},
+		{expr: `a > 1 || b > 5`, input: `{"a": 0, "b": 3}`, output: false},
+		{expr: `!a`, input: `{"a": false}`, output: true},
+		{expr: `!(a == 1) && !b`, input: `{"a": 2, "b": ""}`, output: true},
+		{expr: `a&b == 1 && c|d`, input: `{"a&b": 1, "c|d": true}`, output: true},
+		{expr: `a != 1`, input: `{"a": 2}`, output: true},
+		{expr: `a&&b||c`, input: `{"a": true, "b": false, "c": true}`, output: true},
+		{expr: `a & b`, input: `{"a": true, "b": true}`, err: "& should be &&"},
+		{expr: `a | b`, input: `{"a": true, "b": true}`, err: "| should be ||"},
+		// Lenient equals
+		{expr: `status = "active"`, input: `{"status": "active"}`, opts: []InterpreterOption{LenientEquals}, output: true},
+		{expr: `a = 1 and b = 2`, input: `{"a": 1, "b": 3}`, opts: []InterpreterOption{LenientEquals}, output: false},
+		{expr: `a == 1`, input: `{"a": 1}`, opts: []InterpreterOption{LenientEquals}, output: true},
+		{expr: `a = 1`, input: `{"a": 1}`, err: "= should be =="},
+		{expr: `= 1`, opts: []InterpreterOption{LenientEquals}, err: "= should be =="},
+		// Property paths
+		{expr: `foo.bar.length`, input: `{"foo": {"bar": {"length": 5}}}`, output: 5.0},
+		{expr: `foo.bar.length`, input: `{"foo": {"bar": "abc"}}`, output: 3},
+		{expr: `foo.bar.baz`, input: `{"foo": {"bar": [{"baz": 1}, {"baz": 2}]}}`, output: []any{1.0, 2.0}},
+		{expr: `foo.bar.baz`, inputParsed: map[string]any{"foo": map[any]any{"bar": map[string]any{"baz": 1}}}, output: 1},
+		{expr: `foo.bar.missing`, input: `{"foo": {"bar": {}}}`, skipTC: true, opts: []InterpreterOption{UnquotedStrings}, output: nil},
+		{expr: `foo.bar.missing`, input: `{"foo": {"bar": {}}}`, skipTC: true, opts: []InterpreterOption{StrictMode}, err: "cannot get missing"},
+		// Quoted identifiers
+		{expr: "`weird.key` + 1", input: `{"weird.key": 1}`, output: 2.0},
+		{expr: "`a b`.`where` == 2", input: `{"a b": {"where": 2}}`, output: true},
+		{expr: `foo."a b" + foo."x.y"`, input: `{"foo": {"a b": 1, "x.y": 2}}`, output: 3.0},
+		{expr: "items where `in` > 1", input: `{"items": [{"in": 1}, {"in": 2}]}`, output: []any{map[string]any{"in": 2.0}}},
+		{expr: "`where` == 1", input: `{}`, err: "no property where"},
+		// Sequences
+		{expr: `a + 1; a * 3`, input: `{"a": 2}`, output: 6.0},
+		{expr: `a > 1; "done";`, input: `{"a": 2}`, output: "done"},
+		{expr: `a; b.c`, input: `{"a": 1, "b": {}}`, skipTC: true, opts: []InterpreterOption{StrictMode}, err: "cannot get c"},
+		{expr: `(a; b)`, err: "expected right-paren but found semicolon"},
+		{expr: `a; ,`, err: "incomplete expression, comma found"},
+		// Coalesce
+		{expr: `nickname ?? name`, input: `{"name": "a"}`, skipTC: true, output: "a"},
+		{expr: `nickname ?? name`, input: `{"nickname": "b", "name": "a"}`, output: "b"},
+		{expr: `nickname ?? name`, input: `{"nickname": null, "name": "a"}`, output: "a"},
+		{expr: `nickname ?? name`, input: `{"nickname": "", "name": "a"}`, output: ""},
+		{expr: `user.age ?? 0 > 17`, input: `{"user": {}}`, skipTC: true, opts: []InterpreterOption{StrictMode}, output: false},
+		{expr: `a ?? b ?? 1 + 2`, input: `{}`, skipTC: true, output: 3.0},
+		{expr: `missing?? 1`, input: `{}`, skipTC: true, opts: []InterpreterOption{UndefinedValues}, output: 1.0},
+		{expr: `(1 / 0) ?? 1`, err: "cannot divide by zero"},
 		// Order of operations
 		{expr: "1 + 2 + 3", output: 6.0},
 		{expr: "1 + 2 * 3", output: 7.0},
@@ -161,9 +679,14 @@ func TestInterpreter(t *testing.T) {
 		{expr: `not (1- <= 5)`, err: "missing right operand"},
 		{expr: `(1 >=)`, err: "unexpected right-paren"},
 		{expr: `foo[foo[0] != bar]`, input: `{"foo": [1, 2, 3], "bar": true}`, err: "array index must be number or slice"},
+		{expr: `foo[[0, 1]]`, input: `{"foo": [1, 2, 3]}`, err: "array index must be number or slice"},
+		{expr: `foo[[0, 1]]`, input: `{"foo": [1, 2, 3]}`, skipTC: true, err: "array index must be number or slice"},
 		{expr: `1 < "foo"`, err: "unable to convert to number"},
 		{expr: `1 <`, err: "incomplete expression"},
 		{expr: `1 +`, err: "incomplete expression"},
+		{expr: `:,`, err: "missing right operand"},
+		{expr: `-,`, err: "missing right operand"},
+		{expr: `not ,`, err: "missing right operand"},
 		{expr: `1 ]`, err: "expected eof but found right-bracket"},
 		{expr: `0.5 + 1"`, err: "expected eof but found string"},
 		{expr: `0.5 > "some kind of string"`, err: "unable to convert to number"},
@@ -177,6 +700,22 @@ func TestInterpreter(t *testing.T) {
 		{expr: `a[0]`, input: `{"a": []}`, skipTC: true, err: "invalid index"},
 	}
 
+	runInterpreterTests(t, cases)
+}
+
+// interpreterTest is a single expression run by runInterpreterTests.
+type interpreterTest struct {
+	expr        string
+	input       string
+	inputParsed any
+	skipTC      bool
+	opts        []InterpreterOption
+	err         string
+	output      interface{}
+}
+
+// runInterpreterTests parses, type checks, and runs each test case.
+func runInterpreterTests(t *testing.T, cases []interpreterTest) {
 	for _, tc := range cases {
 		t.Run(tc.expr, func(t *testing.T) {
 			var input any
@@ -261,6 +800,8 @@ func Benchmark(b *testing.B) {
 		{"math", `foo.bar + 1`, `foo.bar + 1`, 1000000001.0},
 		{"string", `baz startsWith "va"`, `baz startsWith "va"`, true},
 		{"index", `arr[1]`, `arr[1]`, 2},
+		{"path", `deep.a.b.c == "x"`, `deep.a.b.c == "x"`, true},
+		{"filter", `(arr where @ > 1).length == 2`, `len(filter(arr, # > 1)) == 2`, true},
 		{
 			name:   "complex",
 			mexpr:  `foo.bar / (1 * 1024 * 1024) >= 1.0 and "v" in baz and baz.length > 3 and arr[2:].length == 1`,
@@ -276,6 +817,13 @@ func Benchmark(b *testing.B) {
 		},
 		"baz": "value",
 		"arr": []interface{}{1, 2, 3},
+		"deep": map[string]interface{}{
+			"a": map[string]interface{}{
+				"b": map[string]interface{}{
+					"c": "x",
+				},
+			},
+		},
 	}
 
 	for _, bm := range benchmarks {
@@ -327,4 +875,547 @@ func Benchmark(b *testing.B) {
 		// 	assert.Equal(b, bm.result, r)
 		// })
 	}
+
+	cache := NewCache(len(benchmarks), input)
+	for _, bm := range benchmarks {
+		b.Run("mexpr-"+bm.name+"-cache", func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				r, _ = cache.Eval(bm.mexpr, input)
+			}
+			if !reflect.DeepEqual(bm.result, r) {
+				b.Fatalf("expected %v but found %v", bm.result, r)
+			}
+		})
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var input any
+	if err := json.Unmarshal([]byte(`{"price": 12, "items": [{"id": 1}, {"id": 5}]}`), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Eval(`price > 20 or (items where id > 3).length == 1`, input, WithTrace(&buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `    price => 12
+    20 => 20
+  > => false
+        items => [map[id:1] map[id:5]]
+          id => 1
+          3 => 3
+        > => false
+          id => 5
+          3 => 3
+        > => true
+      where => [map[id:5]]
+      length => 1
+    . => 1
+    1 => 1
+  == => true
+or => true
+`
+	if buf.String() != expected {
+		t.Fatalf("expected trace:\n%s\nbut found:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if _, err := Eval(`name + 1 > 2`, map[string]any{"name": "a"}, WithTrace(&buf)); err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(buf.String(), `> => error: unable to convert to number: a1`) {
+		t.Fatalf("expected error in trace but found:\n%s", buf.String())
+	}
+}
+
+func TestExplain(t *testing.T) {
+	ast, err := Parse(`price > threshold and "a" in tags`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation, err := Explain(ast, map[string]any{"price": 12, "threshold": 20, "tags": []any{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Value != false {
+		t.Fatalf("expected false but found %v", explanation.Value)
+	}
+	comparison := explanation.Children[0]
+	if comparison.Node.Type != NodeGreaterThan || comparison.Value != false {
+		t.Fatalf("unexpected comparison %v", comparison)
+	}
+	if comparison.Children[0].Value != 12 || comparison.Children[1].Value != 20 {
+		t.Fatalf("unexpected operands %v", comparison)
+	}
+
+	expected := `and => false
+  > => false
+    price => 12
+    threshold => 20
+  in => true
+    a => "a"
+    tags => [a]
+`
+	if explanation.String() != expected {
+		t.Fatalf("expected:\n%s\nbut found:\n%s", expected, explanation.String())
+	}
+
+	ast, err = Parse(`a + 1 > 2`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation, err = Explain(ast, map[string]any{"a": []any{}})
+	if err == nil || explanation.Error == nil || explanation.Children[0].Error == nil {
+		t.Fatalf("expected error but found %v", explanation)
+	}
+}
+
+func TestAccessHook(t *testing.T) {
+	var input any
+	if err := json.Unmarshal([]byte(`{"user": {"name": "Alice", "email": "a@example.com"}, "items": [{"id": 1, "tags": ["a"]}, {"id": 5, "tags": ["b"]}]}`), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	var accessed []string
+	hook := WithAccessHook(func(path string) error {
+		accessed = append(accessed, path)
+		if path == "user.email" {
+			return errors.New("not allowed")
+		}
+		return nil
+	})
+
+	cases := []struct {
+		expr     string
+		accessed []string
+		err      string
+	}{
+		{expr: `user.name == "Alice"`, accessed: []string{"user", "user.name"}},
+		{expr: `items[0].id + items.length`, accessed: []string{"items", "items.id", "items"}},
+		{expr: `items.id`, accessed: []string{"items", "items.id", "items.id"}},
+		{expr: `(items where id > 3).tags`, accessed: []string{"items", "items.id", "items.id", "items.tags"}},
+		{expr: `items where $root.user.name == "Alice"`, accessed: []string{"items", "user", "user.name", "user", "user.name"}},
+		{expr: `items sumBy id`, accessed: []string{"items", "items.id", "items.id"}},
+		{expr: `user.missing`, accessed: []string{"user", "user.missing"}},
+		{expr: `user.email endsWith "example.com"`, accessed: []string{"user", "user.email"}, err: "access to user.email denied: not allowed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			accessed = nil
+			_, err := Eval(tc.expr, input, hook)
+			if tc.err != "" {
+				if err == nil || err.Kind() != KindAccessDenied || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected access denied error but found %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			if !reflect.DeepEqual(accessed, tc.accessed) {
+				t.Fatalf("expected %v but found %v", tc.accessed, accessed)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	var input any
+	if err := json.Unmarshal([]byte(`{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}`), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr      string
+		nodes     int
+		items     int
+		allocates bool
+	}{
+		{expr: `1 + 2`, nodes: 1},
+		{expr: `items[0].id > 1`, nodes: 7},
+		{expr: `items.id`, nodes: 5, items: 3, allocates: true},
+		{expr: `items where id > 1`, nodes: 11, items: 3, allocates: true},
+		{expr: `items sumBy id`, nodes: 5, items: 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			stats := &Stats{}
+			i := NewInterpreter(ast, WithStats(stats))
+			// Run twice to ensure the stats are reset between runs.
+			for run := 0; run < 2; run++ {
+				if _, err := i.Run(input); err != nil {
+					t.Fatal(err.Pretty(tc.expr))
+				}
+				if stats.Nodes != tc.nodes || stats.Items != tc.items {
+					t.Fatalf("expected %d nodes and %d items but found %+v", tc.nodes, tc.items, stats)
+				}
+				if stats.Duration <= 0 || (tc.allocates && stats.Allocations == 0) {
+					t.Fatalf("expected a duration and allocations but found %+v", stats)
+				}
+			}
+		})
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	ast, err := Parse(`(items where @ > 1).length == 2 and (items where @ < 3) == [1, 2] and (groups where (@ where @ > 2).length > 0).length == 1`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := NewInterpreter(ast)
+	for _, tc := range []struct {
+		items    []any
+		expected bool
+	}{
+		{items: []any{1.0, 2.0, 3.0}, expected: true},
+		{items: []any{1.0, 2.0, 3.0, 4.0}, expected: false},
+		{items: []any{1.0, 2.0, 3.0}, expected: true},
+	} {
+		result, err := i.Run(map[string]any{"items": tc.items, "groups": []any{tc.items, []any{1.0}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != tc.expected {
+			t.Fatalf("expected %v but found %v for %v", tc.expected, result, tc.items)
+		}
+	}
+
+	// Results which are returned must not be reused by the next run.
+	ast, err = Parse(`items where @ > 1`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i = NewInterpreter(ast)
+	first, _ := i.Run(map[string]any{"items": []any{1.0, 2.0}})
+	i.Run(map[string]any{"items": []any{5.0, 6.0}})
+	if !reflect.DeepEqual(first, []any{2.0}) {
+		t.Fatalf("expected first result to be unchanged but found %v", first)
+	}
+
+	ast, err = Parse(`(items where @ > 1).length == 1`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i = NewInterpreter(ast)
+	input := map[string]any{"items": []any{1.0, 2.0}}
+	// Only the filtered slice is boxed into an interface.
+	if allocs := testing.AllocsPerRun(100, func() { i.Run(input) }); allocs > 1 {
+		t.Fatalf("expected few allocations but found %v", allocs)
+	}
+}
+
+func TestConcurrentRun(t *testing.T) {
+	ast, err := Parse(`[items[start:end].length] + items[start:]`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			input := map[string]any{"items": []any{0.0, 1.0, 2.0, 3.0}, "start": g, "end": 3}
+			expected := append([]any{4 - g}, input["items"].([]any)[g:]...)
+			for n := 0; n < 1000; n++ {
+				result, err := Run(ast, input)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(result, expected) {
+					t.Errorf("expected %v but found %v", expected, result)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestParallel(t *testing.T) {
+	items := make([]any, 1000)
+	for idx := range items {
+		items[idx] = map[string]any{"id": float64(idx), "tags": []any{float64(idx % 7)}}
+	}
+	items[500] = map[string]any{"id": "bad"}
+	items[900] = map[string]any{"id": "worse"}
+	input := map[string]any{"items": items, "min": 10.0}
+
+	for _, expr := range []string{
+		`items where (id % 3 == 0 and id > $root.min)`,
+		`items where (tags where @ > 3).length > 0`,
+		`(items where $key > 990).id`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			expected, err := Eval(expr, input)
+			if err != nil {
+				t.Fatal(err.Pretty(expr))
+			}
+			for _, workers := range []int{0, 1, 3, 16} {
+				result, err := Eval(expr, input, WithParallel(100, workers))
+				if err != nil {
+					t.Fatal(err.Pretty(expr))
+				}
+				if !reflect.DeepEqual(expected, result) {
+					t.Fatalf("expected %v but found %v with %d workers", expected, result, workers)
+				}
+			}
+		})
+	}
+
+	// The error for the first failing item is returned.
+	_, err := Eval(`items where id % 3 == 0`, input, StrictMode, WithParallel(100, 4))
+	if err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("expected error for first bad item but found %v", err)
+	}
+}
+
+func TestMaxWhereResults(t *testing.T) {
+	items := make([]any, 1000)
+	for idx := range items {
+		items[idx] = float64(idx)
+	}
+	input := map[string]any{"items": items, "m": map[string]any{"a": 1.0, "b": 2.0, "c": 3.0}}
+
+	result, err := Eval(`items where @ < 3`, input, WithMaxWhereResults(3, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, []any{0.0, 1.0, 2.0}) {
+		t.Fatalf("unexpected result %v", result)
+	}
+
+	for _, expr := range []string{`items where @ > 10`, `m where @ > 0`} {
+		_, err = Eval(expr, input, WithMaxWhereResults(2, false))
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Fatalf("expected limit error for %s but found %v", expr, err)
+		}
+	}
+
+	result, err = Eval(`items where @ > 10`, input, WithMaxWhereResults(3, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, []any{11.0, 12.0, 13.0}) {
+		t.Fatalf("unexpected result %v", result)
+	}
+
+	result, err = Eval(`items where @ > 10`, input, WithMaxWhereResults(3, true), WithParallel(100, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, []any{11.0, 12.0, 13.0}) {
+		t.Fatalf("unexpected parallel result %v", result)
+	}
+
+	result, err = Eval(`m where @ > 0`, input, WithMaxWhereResults(2, true), KeepMapKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := result.(map[string]any); !ok || len(m) != 2 {
+		t.Fatalf("expected 2 map results but found %v", result)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	expr := `(a + b) * c.d and not name == "a\"b" or default(x, [1, 2])[0]`
+	ast, err := Parse(expr, nil)
+	if err != nil {
+		t.Fatal(err.Pretty(expr))
+	}
+	expected := map[string]string{
+		"or":        expr,
+		"and":       `(a + b) * c.d and not name == "a\"b"`,
+		"*":         `(a + b) * c.d`,
+		"+":         `(a + b)`,
+		".":         `c.d`,
+		"==":        `not name == "a\"b"`,
+		"not":       `not name`,
+		`a"b`:       `"a\"b"`,
+		"[]":        `default(x, [1, 2])[0]`,
+		"default()": `default(x, [1, 2])`,
+		"[...]":     `[1, 2]`,
+	}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n == nil {
+			return
+		}
+		if span, ok := expected[n.String()]; ok && expr[n.Start:n.End] != span {
+			t.Errorf("expected %s to span %s but found %s", n.String(), span, expr[n.Start:n.End])
+		}
+		walk(n.Left)
+		walk(n.Right)
+		for _, arg := range n.Args {
+			walk(arg)
+		}
+	}
+	walk(ast)
+}
+
+func TestParsePartial(t *testing.T) {
+	cases := []struct {
+		expr   string
+		ast    string
+		errors []string
+	}{
+		{expr: `a + 1`, ast: `+`},
+		{expr: ``, ast: `error`, errors: []string{"incomplete expression, EOF found"}},
+		{expr: `a > 1 and b ==`, ast: `and`, errors: []string{"incomplete expression, EOF found"}},
+		{expr: `(a + ) * 2`, ast: `*`, errors: []string{"unexpected right-paren"}},
+		{expr: `a = 1 and foo(b)`, ast: `and`, errors: []string{"= should be ==", "unknown function foo"}},
+		{expr: `[1, 2`, ast: `[...]`, errors: []string{"expected right-bracket but found eof"}},
+		{expr: `a b`, ast: `a`, errors: []string{"expected eof but found identifier"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, errs := ParsePartial(tc.expr)
+			if ast == nil || ast.String() != tc.ast {
+				t.Fatalf("expected %s but found %v", tc.ast, ast)
+			}
+			var found []string
+			for _, err := range errs {
+				found = append(found, err.Error())
+			}
+			if !reflect.DeepEqual(tc.errors, found) {
+				t.Fatalf("expected %v but found %v", tc.errors, found)
+			}
+		})
+	}
+
+	// Valid parts of a partial AST can still be checked, while error nodes fail.
+	ast, _ := ParsePartial(`missing > 1 and b ==`)
+	errs := TypeCheckAll(ast, map[string]any{"b": 1})
+	if len(errs) != 2 || errs[0].Kind() != KindUnknownProperty || errs[1].Kind() != KindSyntax {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if _, err := Run(ast, map[string]any{"missing": 2, "b": 1}); err == nil || err.Kind() != KindSyntax {
+		t.Fatalf("expected syntax error but found %v", err)
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	ast, err := Parse(`a + 1; a * 3; now == now`, map[string]any{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := RunAll(ast, map[string]any{"a": 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, []any{3.0, 6.0, true}) {
+		t.Fatalf("unexpected results %v", results)
+	}
+
+	ast, _ = Parse(`a + 1`, nil)
+	if results, err := RunAll(ast, map[string]any{"a": 2.0}); err != nil || !reflect.DeepEqual(results, []any{3.0}) {
+		t.Fatalf("unexpected results %v %v", results, err)
+	}
+}
+
+func TestEnumStrings(t *testing.T) {
+	enums := WithEnumStrings("active", "closed", "archived")
+	types := map[string]any{"status": "", "user": map[string]any{"name": ""}}
+	input := map[string]any{"status": "active"}
+
+	ast, err := Parse(`status == active or status in [closed, archived]`, types, enums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := Run(ast, input, enums); err != nil || result != true {
+		t.Fatalf("expected true but found %v %v", result, err)
+	}
+
+	expr := `status == actve`
+	_, err = Parse(expr, types, enums)
+	if err == nil || err.Kind() != KindUnknownProperty || err.Offset() != 10 {
+		t.Fatalf("expected unknown property error but found %v", err)
+	}
+	if !strings.Contains(err.Error(), "(did you mean `active`?)") {
+		t.Fatalf("expected suggestion but found %s", err.Pretty(expr))
+	}
+
+	// Without type checking typos are missing properties unless strict.
+	ast, _ = Parse(expr, nil, enums)
+	if result, err := Run(ast, input, enums); err != nil || result != false {
+		t.Fatalf("expected false but found %v %v", result, err)
+	}
+	if _, err := Run(ast, input, enums, StrictMode); err == nil || !strings.Contains(err.Error(), "did you mean `active`") {
+		t.Fatalf("expected suggestion but found %v", err)
+	}
+
+	// Unrelated names and properties after a dot get no suggestions.
+	if _, err := Parse(`status == nonsense`, types, enums); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := Parse(`user.active`, types, enums); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEvalTyped(t *testing.T) {
+	input := map[string]any{"age": 30, "name": "alice", "price": "12"}
+
+	b, err := EvalBool(`age > 21`, input)
+	if err != nil || !b {
+		t.Fatalf("expected true but found %v, %v", b, err)
+	}
+
+	n, err := EvalNumber(`age + 1`, input)
+	if err != nil || n != 31 {
+		t.Fatalf("expected 31 but found %v, %v", n, err)
+	}
+
+	n, err = EvalNumber(`0.1 + 0.2`, input, DecimalNumbers)
+	if err != nil || n != 0.3 {
+		t.Fatalf("expected 0.3 but found %v, %v", n, err)
+	}
+
+	s, err := EvalString(`name.upper`, input)
+	if err != nil || s != "ALICE" {
+		t.Fatalf("expected ALICE but found %v, %v", s, err)
+	}
+
+	for expr, eval := range map[string]func(string) Error{
+		`name`:    func(e string) Error { _, err := EvalBool(e, input); return err },
+		`missing`: func(e string) Error { _, err := EvalBool(e, input); return err },
+		`price`:   func(e string) Error { _, err := EvalNumber(e, input); return err },
+		`age`:     func(e string) Error { _, err := EvalString(e, input); return err },
+	} {
+		err := eval(expr)
+		if err == nil || err.Kind() != KindTypeMismatch {
+			t.Fatalf("expected type mismatch for %q but found %v", expr, err)
+		}
+	}
+
+	// Errors from parsing are returned as-is.
+	if _, err := EvalNumber(`age + `, input); err == nil || err.Kind() != KindSyntax {
+		t.Fatalf("expected syntax error but found %v", err)
+	}
+}
+
+func TestNestedSlices(t *testing.T) {
+	// Each slice has its own bounds, so nested slices don't reference
+	// themselves, which would overflow the stack when formatting the error.
+	_, err := Eval(`-::1`, nil)
+	if err == nil || err.Kind() != KindTypeMismatch {
+		t.Fatalf("expected type mismatch but found %v", err)
+	}
+
+	result, err := Eval(`items[1:3][0:1]`, map[string]any{"items": []any{1.0, 2.0, 3.0, 4.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, []any{2.0, 3.0}) {
+		t.Fatalf("unexpected result %v", result)
+	}
 }
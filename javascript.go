@@ -0,0 +1,592 @@
+package mexpr
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsRuntime contains the helpers used by generated JavaScript to match the
+// behavior of the interpreter, e.g. for truthiness, equality, and projection.
+const jsRuntime = `{
+    fail(msg, missing) {
+      // Only these errors are ignored for single items, like in the interpreter.
+      const e = new Error(msg);
+      e.mexpr = true;
+      e.missing = missing;
+      throw e;
+    },
+    isNum(v) { return typeof v === "number"; },
+    isObj(v) { return v !== null && typeof v === "object" && !Array.isArray(v); },
+    str(v) {
+      if (v === null || v === undefined) return "<nil>";
+      if (Array.isArray(v)) return "[" + v.map((x) => this.str(x)).join(" ") + "]";
+      if (this.isObj(v)) {
+        return "map[" + Object.keys(v).sort().map((k) => k + ":" + this.str(v[k])).join(" ") + "]";
+      }
+      if (this.isNum(v)) return this.numStr(v);
+      return String(v);
+    },
+    numStr(n) {
+      // Format like Go's %v for floats, which uses an exponent outside 1e-4 to 1e6.
+      if (isNaN(n)) return "NaN";
+      if (!isFinite(n)) return n > 0 ? "+Inf" : "-Inf";
+      if (Object.is(n, -0)) return "-0";
+      const [mantissa, e] = n.toExponential().split("e");
+      const exp = Number(e);
+      if (exp >= -4 && exp < 6) return String(n);
+      return mantissa + "e" + (exp < 0 ? "-" : "+") + String(Math.abs(exp)).padStart(2, "0");
+    },
+    date(v) {
+      // Only the date and time formats the interpreter understands are dates.
+      const m = /^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?)?$/.exec(v);
+      if (!m) return NaN;
+      return Date.parse(m[1] && !m[3] ? v + "Z" : v);
+    },
+    num(v) {
+      if (!this.isNum(v)) this.fail("unable to convert to number: " + this.str(v));
+      return v;
+    },
+    truthy(v) {
+      if (typeof v === "boolean") return v;
+      if (this.isNum(v)) return v > 0;
+      if (typeof v === "string" || Array.isArray(v)) return v.length > 0;
+      if (this.isObj(v)) return Object.keys(v).length > 0;
+      return false;
+    },
+    eq(a, b) {
+      if (Array.isArray(a) && Array.isArray(b)) {
+        return a.length === b.length && a.every((x, i) => this.eq(x, b[i]));
+      }
+      if (this.isObj(a) && this.isObj(b)) {
+        const keys = Object.keys(a);
+        return keys.length === Object.keys(b).length &&
+          keys.every((k) => Object.prototype.hasOwnProperty.call(b, k) && this.eq(a[k], b[k]));
+      }
+      return (a === undefined ? null : a) === (b === undefined ? null : b);
+    },
+    cmp(a, b) {
+      if (typeof a === "string" && typeof b === "string") {
+        const l = this.date(a), r = this.date(b);
+        if (!isNaN(l) && !isNaN(r)) return l < r ? -1 : l > r ? 1 : 0;
+      }
+      const l = this.num(a), r = this.num(b);
+      return l < r ? -1 : l > r ? 1 : 0;
+    },
+    math(op, a, b) {
+      if (op === "+") {
+        if (typeof a === "string" || typeof b === "string") return this.str(a) + this.str(b);
+        if (Array.isArray(a) && Array.isArray(b)) return a.concat(b);
+      }
+      if (!this.isNum(a) || !this.isNum(b)) {
+        this.fail("cannot add incompatible types " + this.str(a) + " and " + this.str(b));
+      }
+      switch (op) {
+        case "+": return a + b;
+        case "-": return a - b;
+        case "*": return a * b;
+        case "^": return Math.pow(a, b);
+      }
+      if (b === 0) this.fail("cannot divide by zero");
+      return op === "/" ? a / b : a % b;
+    },
+    get(v, name) {
+      if (typeof v === "string" || Array.isArray(v)) {
+        if (name === "length") return typeof v === "string" ? Array.from(v).length : v.length;
+        if (name === "isEmpty") return v.length === 0;
+      }
+      if (name === "isEmpty" && !(this.isObj(v) && Object.prototype.hasOwnProperty.call(v, name))) {
+        return v === null || v === undefined || (this.isObj(v) && Object.keys(v).length === 0);
+      }
+      if (name === "isBlank" && (v === null || v === undefined)) return true;
+      if (typeof v === "string") {
+        switch (name) {
+          case "isBlank": return v.trim() === "";
+          case "lower": return v.toLowerCase();
+          case "upper": return v.toUpperCase();
+          case "words": return v.split(/\s+/).filter((w) => w !== "");
+          case "lines":
+            if (v === "") return [];
+            return v.replace(/\n$/, "").split("\n").map((l) => l.replace(/\r$/, ""));
+          case "camel": case "snake": case "kebab": case "title":
+            return this.toCase(name, v);
+        }
+      }
+      if (this.isObj(v) && Object.prototype.hasOwnProperty.call(v, name)) {
+        return v[name] === undefined ? null : v[name];
+      }
+      return null;
+    },
+    must(v, name) {
+      // Like get, but missing properties are errors, for exists.
+      const result = this.get(v, name);
+      if (result === null && !(this.isObj(v) && Object.prototype.hasOwnProperty.call(v, name))) {
+        this.fail("no property " + name, true);
+      }
+      return result;
+    },
+    exists(fn) {
+      try {
+        fn();
+        return true;
+      } catch (e) {
+        if (e.missing) return false;
+        throw e;
+      }
+    },
+    words(s) {
+      // Split identifiers like fooBar, foo_bar, or HTTPServer into words.
+      const runes = Array.from(s), words = [];
+      let start = -1;
+      runes.forEach((r, idx) => {
+        if (!/[\p{L}\p{Nd}]/u.test(r)) {
+          if (start >= 0) words.push(runes.slice(start, idx).join(""));
+          start = -1;
+          return;
+        }
+        if (start >= 0 && /\p{Lu}/u.test(r)) {
+          const prev = runes[idx - 1];
+          const nextLower = idx + 1 < runes.length && /\p{Ll}/u.test(runes[idx + 1]);
+          if (/[\p{Ll}\p{Nd}]/u.test(prev) || (/\p{Lu}/u.test(prev) && nextLower)) {
+            words.push(runes.slice(start, idx).join(""));
+            start = idx;
+          }
+        }
+        if (start < 0) start = idx;
+      });
+      if (start >= 0) words.push(runes.slice(start).join(""));
+      return words;
+    },
+    toCase(style, v) {
+      const capitalize = (w) => {
+        const runes = Array.from(w.toLowerCase());
+        if (runes.length > 0) runes[0] = runes[0].toUpperCase();
+        return runes.join("");
+      };
+      return this.words(v).map((w, idx) => {
+        if (style === "title" || (style === "camel" && idx > 0)) return capitalize(w);
+        return w.toLowerCase();
+      }).join({camel: "", snake: "_", kebab: "-", title: " "}[style]);
+    },
+    select(v, project, fn) {
+      if (project && Array.isArray(v)) {
+        return v.map((item) => fn(item)).filter((x) => x !== null && x !== undefined);
+      }
+      return fn(v);
+    },
+    index(v, idx, slice) {
+      if (typeof v !== "string" && !Array.isArray(v)) {
+        this.fail("can only index strings or arrays but got " + this.str(v));
+      }
+      const items = typeof v === "string" ? Array.from(v) : v;
+      const bound = (i) => {
+        if (i < 0 || i >= items.length) {
+          // Out-of-range indexes are absent values for exists.
+          this.fail("invalid index " + Math.trunc(i) + " for slice of length " + items.length, true);
+        }
+      };
+      if (slice && Array.isArray(idx) && idx.length === 2) {
+        let start = this.num(idx[0]), end = this.num(idx[1]);
+        if (start < 0) start += items.length;
+        if (end < 0) end += items.length;
+        bound(start);
+        bound(end);
+        if (Math.trunc(start) > Math.trunc(end)) this.fail("slice start cannot be greater than end");
+        const result = items.slice(Math.trunc(start), Math.trunc(end) + 1);
+        return typeof v === "string" ? result.join("") : result;
+      }
+      if (!this.isNum(idx)) this.fail("array index must be number or slice " + this.str(idx));
+      if (idx < 0) idx += items.length;
+      bound(idx);
+      return items[Math.trunc(idx)];
+    },
+    has(container, item) {
+      if (Array.isArray(container)) return container.some((x) => this.eq(x, item));
+      if (this.isObj(container)) {
+        const v = container[this.str(item)];
+        return Object.prototype.hasOwnProperty.call(container, this.str(item)) && v !== null && v !== undefined;
+      }
+      return this.str(container).includes(this.str(item));
+    },
+    each(fn, strict) {
+      // Errors for single items are ignored unless checking exists, like in
+      // the interpreter, but bugs and other JavaScript errors are thrown.
+      try {
+        return fn();
+      } catch (e) {
+        if (strict || !e.mexpr) throw e;
+        return null;
+      }
+    },
+    where(v, fn, strict) {
+      if (v === null || v === undefined) return null;
+      const entries = Array.isArray(v) ? v.map((x, i) => [i, x]) : this.isObj(v) ? Object.entries(v) : [];
+      return entries.filter(([k, x]) => this.truthy(this.each(() => fn(x, k), strict))).map(([k, x]) => x);
+    },
+    aggregate(op, v, fn, strict) {
+      if (v === null || v === undefined) return null;
+      if (!Array.isArray(v)) this.fail(op + " requires an array but found " + this.str(v));
+      let total = 0, best = null, bestValue = null;
+      v.forEach((item, idx) => {
+        const result = this.each(() => fn(item, idx), strict);
+        if (result === null || result === undefined) return;
+        if (!this.isNum(result)) this.fail(op + " requires numbers but found " + this.str(result));
+        if (op === "sumBy") {
+          total += result;
+          return;
+        }
+        if (bestValue !== null && (op === "minBy" ? result >= bestValue : result <= bestValue)) return;
+        best = item;
+        bestValue = result;
+      });
+      return op === "sumBy" ? total : best;
+    },
+    bounds(start, end) {
+      start = this.num(start);
+      end = this.num(end);
+      if (start !== Math.trunc(start) || end !== Math.trunc(end)) {
+        this.fail("range requires integers but found " + start + " and " + end);
+      }
+      return [start, end];
+    },
+    range(start, end) {
+      [start, end] = this.bounds(start, end);
+      if (end - start + 1 > 1000000) this.fail("range is larger than 1000000 items");
+      const results = [];
+      for (let n = start; n <= end; n++) results.push(n);
+      return results;
+    },
+    inRange(v, start, end) {
+      [start, end] = this.bounds(start, end);
+      return this.isNum(v) && v === Math.trunc(v) && v >= start && v <= end;
+    },
+    page(name, v, n) {
+      if (v === null || v === undefined) return null;
+      if (!Array.isArray(v)) this.fail(name + " requires an array but found " + this.str(v));
+      if (this.num(n) < 0 || n !== Math.trunc(n)) {
+        this.fail(name + " requires a non-negative integer but found " + this.str(n));
+      }
+      return name === "limit" ? v.slice(0, n) : v.slice(n);
+    },
+  }`
+
+// jsScope tracks the JavaScript variables for the current `where` item.
+type jsScope struct {
+	parent string
+	key    string
+	value  string
+}
+
+// jsGenerator converts an AST into JavaScript source code.
+type jsGenerator struct {
+	scopes []jsScope
+	vars   int
+
+	// strict is set within `exists`, where missing properties are errors.
+	strict bool
+}
+
+// ToJavaScript converts an AST into the source code of an equivalent
+// JavaScript function which takes the input and returns the result, so that
+// e.g. web frontends can preview filters client-side:
+//
+//	const filter = eval(source);
+//	filter({"price": 12});
+//
+// Errors are thrown as JavaScript exceptions. Interpreter options are not
+// supported, and an error is returned for features without a JavaScript
+// equivalent: function calls, `format`, `like`, `inCidr`, and the date
+// operators `before`, `after`, and `sameDay`. Strings are only ordered as dates
+// when both are RFC 3339 dates or times, like in the interpreter. JavaScript
+// has a single number type, so numbers are converted to strings like Go
+// floats, e.g. `"a" + 1e20` is `"a1e+20"`, even for integers like `.length`.
+func ToJavaScript(ast *Node) (string, Error) {
+	g := &jsGenerator{}
+	expr, err := g.gen(ast, "input", false)
+	if err != nil {
+		return "", err
+	}
+	return "(function () {\n  const $ = " + jsRuntime + ";\n  return function (input) {\n    if (input === undefined) input = null;\n    return " + expr + ";\n  };\n})()", nil
+}
+
+// newVar returns a new unique JavaScript variable name.
+func (g *jsGenerator) newVar() string {
+	g.vars++
+	return "$" + strconv.Itoa(g.vars)
+}
+
+// jsUnsupported returns an error for nodes which can't be converted.
+func jsUnsupported(ast *Node) Error {
+	return newNodeError(KindRuntime, ast, "%s is not supported in JavaScript", ast)
+}
+
+// gen generates JavaScript for the node, where `value` is the JavaScript
+// expression for the current value that identifiers are looked up in.
+func (g *jsGenerator) gen(ast *Node, value string, property bool) (string, Error) {
+	if ast == nil {
+		return "null", nil
+	}
+
+	switch ast.Type {
+	case NodeIdentifier:
+		name := ast.Value.(string)
+		if name == "@" {
+			return value, nil
+		}
+		if !property {
+			switch name {
+			case "$root":
+				return "input", nil
+			case "$parent", "$key", "$value":
+				if len(g.scopes) == 0 {
+					return "null", nil
+				}
+				scope := g.scopes[len(g.scopes)-1]
+				switch name {
+				case "$parent":
+					return scope.parent, nil
+				case "$key":
+					return scope.key, nil
+				}
+				return scope.value, nil
+			}
+		}
+		if g.strict {
+			return "$.must(" + value + ", " + jsString(name) + ")", nil
+		}
+		return "$.get(" + value + ", " + jsString(name) + ")", nil
+	case NodeLiteral:
+		switch v := ast.Value.(type) {
+		case nil:
+			return "null", nil
+		case string:
+			return jsString(v), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		if isNumber(ast.Value) {
+			n, err := toNumber(ast, ast.Value)
+			if err != nil {
+				return "", err
+			}
+			return jsNumber(n), nil
+		}
+		return "", jsUnsupported(ast)
+	case NodeFieldSelect:
+		if ast.Right.Type == NodeCall {
+			return "", jsUnsupported(ast.Right)
+		}
+		left, err := g.gen(ast.Left, value, false)
+		if err != nil {
+			return "", err
+		}
+		v := g.newVar()
+		right, err := g.gen(ast.Right, v, true)
+		if err != nil {
+			return "", err
+		}
+		return "$.select(" + left + ", " + strconv.FormatBool(projects(ast.Right)) + ", (" + v + ") => " + right + ")", nil
+	case NodeArrayIndex:
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.index(" + left + ", " + right + ", " + strconv.FormatBool(ast.Right.Type != NodeArray) + ")", nil
+	case NodeSlice:
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "[" + left + ", " + right + "]", nil
+	case NodeArray:
+		items := make([]string, len(ast.Args))
+		for idx, arg := range ast.Args {
+			item, err := g.gen(arg, value, false)
+			if err != nil {
+				return "", err
+			}
+			items[idx] = item
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case NodeRange:
+		return g.call(ast, value, "$.range")
+	case NodeSign:
+		right, err := g.gen(ast.Right, value, false)
+		if err != nil {
+			return "", err
+		}
+		return "(" + ast.Value.(string) + "$.num(" + right + "))", nil
+	case NodeAdd, NodeSubtract, NodeMultiply, NodeDivide, NodeModulus, NodePower:
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.math(" + jsString(ast.String()) + ", " + left + ", " + right + ")", nil
+	case NodeEqual:
+		return g.call(ast, value, "$.eq")
+	case NodeNotEqual:
+		result, err := g.call(ast, value, "$.eq")
+		return "!" + result, err
+	case NodeLessThan, NodeLessThanEqual, NodeGreaterThan, NodeGreaterThanEqual:
+		result, err := g.call(ast, value, "$.cmp")
+		return "(" + result + " " + ast.String() + " 0)", err
+	case NodeAnd, NodeOr:
+		// Both sides are always evaluated, like in the interpreter.
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		op := "&&"
+		if ast.Type == NodeOr {
+			op = "||"
+		}
+		return "[$.truthy(" + left + "), $.truthy(" + right + ")].reduce((a, b) => a " + op + " b)", nil
+	case NodeCoalesce:
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " ?? " + right + ")", nil
+	case NodeNot:
+		right, err := g.gen(ast.Right, value, false)
+		if err != nil {
+			return "", err
+		}
+		return "!$.truthy(" + right + ")", nil
+	case NodeIn:
+		if ast.Right.Type == NodeRange {
+			left, err := g.gen(ast.Left, value, false)
+			if err != nil {
+				return "", err
+			}
+			start, end, err := g.both(ast.Right, value)
+			if err != nil {
+				return "", err
+			}
+			return "$.inRange(" + left + ", " + start + ", " + end + ")", nil
+		}
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.has(" + right + ", " + left + ")", nil
+	case NodeContains:
+		return g.call(ast, value, "$.has")
+	case NodeStartsWith, NodeEndsWith:
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.str(" + left + ")." + ast.String() + "($.str(" + right + "))", nil
+	case NodeLimit, NodeOffset:
+		left, right, err := g.both(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.page(" + jsString(ast.String()) + ", " + left + ", " + right + ")", nil
+	case NodeWhere:
+		left, fn, err := g.each(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.where(" + left + ", " + fn + ", " + strconv.FormatBool(g.strict) + ")", nil
+	case NodeSumBy, NodeMinBy, NodeMaxBy:
+		left, fn, err := g.each(ast, value)
+		if err != nil {
+			return "", err
+		}
+		return "$.aggregate(" + jsString(ast.String()) + ", " + left + ", " + fn + ", " + strconv.FormatBool(g.strict) + ")", nil
+	case NodeExists:
+		strict := g.strict
+		g.strict = true
+		right, err := g.gen(ast.Right, value, false)
+		g.strict = strict
+		if err != nil {
+			return "", err
+		}
+		return "$.exists(() => " + right + ")", nil
+	}
+
+	return "", jsUnsupported(ast)
+}
+
+// each generates JavaScript for the left side of a node like `where`, and a
+// function which runs the right side for each of its items.
+func (g *jsGenerator) each(ast *Node, value string) (string, string, Error) {
+	left, err := g.gen(ast.Left, value, false)
+	if err != nil {
+		return "", "", err
+	}
+	item, key := g.newVar(), g.newVar()
+	g.scopes = append(g.scopes, jsScope{parent: value, key: key, value: item})
+	right, err := g.gen(ast.Right, item, false)
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	if err != nil {
+		return "", "", err
+	}
+	return left, "(" + item + ", " + key + ") => " + right, nil
+}
+
+// both generates JavaScript for the left and right side of a node.
+func (g *jsGenerator) both(ast *Node, value string) (string, string, Error) {
+	left, err := g.gen(ast.Left, value, false)
+	if err != nil {
+		return "", "", err
+	}
+	right, err := g.gen(ast.Right, value, false)
+	if err != nil {
+		return "", "", err
+	}
+	return left, right, nil
+}
+
+// call generates a call to a runtime helper with the left and right side of
+// the node as arguments.
+func (g *jsGenerator) call(ast *Node, value, helper string) (string, Error) {
+	left, right, err := g.both(ast, value)
+	if err != nil {
+		return "", err
+	}
+	return helper + "(" + left + ", " + right + ")", nil
+}
+
+// jsString quotes a string as a JavaScript string literal.
+func jsString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r < 0x20 || r == 0x2028 || r == 0x2029 || r == utf8.RuneError:
+			sb.WriteString(`\u`)
+			hex := strconv.FormatInt(int64(r), 16)
+			sb.WriteString(strings.Repeat("0", 4-len(hex)) + hex)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// jsNumber formats a number as a JavaScript number literal.
+func jsNumber(n float64) string {
+	var s string
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		s = "-Infinity"
+	default:
+		s = strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	if strings.HasPrefix(s, "-") {
+		return "(" + s + ")"
+	}
+	return s
+}
@@ -0,0 +1,159 @@
+package mexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJavaScript(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+
+	type test struct {
+		expr  string
+		input string
+	}
+	cases := []test{
+		{expr: `a + 2 * b`, input: `{"a": 1, "b": 3}`},
+		{expr: `(a + 2) * b ^ 2 / 4`, input: `{"a": 1, "b": 3}`},
+		{expr: `a % 3 - -b + c % 2`, input: `{"a": 7, "b": 1, "c": -5.5}`},
+		{expr: `a / 0`, input: `{"a": 1}`},
+		{expr: `"id" + 1`},
+		{expr: `"id" + missing`},
+		{expr: `a + b`, input: `{"a": [1], "b": [2, 3]}`},
+		{expr: `a - 1`, input: `{"a": "x"}`},
+		{expr: `foo.bar.baz`, input: `{"foo": {"bar": {"baz": "hi"}}}`},
+		{expr: `foo.missing.baz`, input: `{"foo": {}}`},
+		{expr: `items.id`, input: `{"items": [{"id": 1}, {"name": "x"}, {"id": 3}]}`},
+		{expr: `items.length + name.length`, input: `{"items": [1, 2], "name": "héllo"}`},
+		{expr: `name[1] + name[-1] + name[1:2]`, input: `{"name": "日本語です"}`},
+		{expr: `items[1:] + items[:0]`, input: `{"items": [1, 2, 3]}`},
+		{expr: `items[5]`, input: `{"items": [1, 2, 3]}`},
+		{expr: `a == b`, input: `{"a": {"x": [1, 2]}, "b": {"x": [1, 2]}}`},
+		{expr: `a != b`, input: `{"a": [1, 2], "b": [2, 1]}`},
+		{expr: `a < b and b >= 3 or not c`, input: `{"a": 1, "b": 3, "c": ""}`},
+		{expr: `a <= b and b > a and b <= 3`, input: `{"a": 1, "b": 3}`},
+		{expr: `"2020-01-02" > "2020-01-01T12:00:00Z"`},
+		{expr: `a > "b"`, input: `{"a": 1}`},
+		{expr: `"1" < "2"`},
+		{expr: `"March 7" < "2020-01-01"`},
+		{expr: `"2020-01-01T12:00:00" < "2020-01-01T13:00:00+02:00"`},
+		{expr: `2^2000 > 1 and -(2^2000) < 0`},
+		{expr: `"a" + 100000000000000000000`},
+		{expr: `"a" + n + " " + m + " " + f`, input: `{"n": 1234567, "m": 999999, "f": 0.00001}`},
+		{expr: `"a" + k`, input: `{"k": {"k": 1, "b": [1, "x", null, {}]}}`},
+		{expr: `-5 and 1`},
+		{expr: `"f" in name and name contains "oo" and name startsWith "fo" and name endsWith "o"`, input: `{"name": "foo"}`},
+		{expr: `2 in items and "a" in obj and not ("b" in obj)`, input: `{"items": [1, 2], "obj": {"a": 1, "b": null}}`},
+		{expr: `x in 1..10 and 2.5 in 1..10`, input: `{"x": 5}`},
+		{expr: `1..3 + [4, "five"]`},
+		{expr: `items where id > 1`, input: `{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}`},
+		{expr: `items where price > $root.min and $parent == $root`, input: `{"min": 5, "items": [{"price": 4}, {"price": 6}]}`},
+		{expr: `items where $key > 0 and $value.id < 3`, input: `{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}`},
+		{expr: `items where tags[0] == "a"`, input: `{"items": [{"tags": []}, {"tags": ["a"]}]}`},
+		{expr: `(groups where (items where @ > 2).length > 0).name`, input: `{"groups": [{"name": "a", "items": [1]}, {"name": "b", "items": [3]}]}`},
+		{expr: `items where active limit 1 offset 1`, input: `{"items": [{"active": true}, {"active": false}, {"active": true}, {"active": true}]}`},
+		{expr: `missing ?? a ?? 1`, input: `{"a": "x"}`},
+		{expr: `exists a and exists c.d and not exists b and not exists c.e`, input: `{"a": null, "c": {"d": 1}}`},
+		{expr: `exists items[5]`, input: `{"items": [1]}`},
+		{expr: `exists (items where x.y > 1)`, input: `{"items": [{"x": {}}]}`},
+		{expr: `items sumBy price`, input: `{"items": [{"price": 1.5}, {"name": "x"}, {"price": 2}]}`},
+		{expr: `items sumBy price`, input: `{"items": []}`},
+		{expr: `(items minBy price).id + (items maxBy price).id`, input: `{"items": [{"id": 1, "price": 3}, {"id": 2, "price": 1}, {"id": 4, "price": 3}, {"id": 8, "price": 1}]}`},
+		{expr: `items sumBy name`, input: `{"items": [{"name": "x"}]}`},
+		{expr: `obj maxBy price`, input: `{"obj": {"a": {"price": 1}}}`},
+		{expr: `name.camel + " " + name.snake + " " + name.kebab + " " + name.title`, input: `{"name": "HTTPServer fooBar_baz2Go"}`},
+		{expr: `name.lower + name.upper`, input: `{"name": "MiXed"}`},
+		{expr: `text.lines.length + text.words.length`, input: `{"text": "one two\r\nthree\n"}`},
+		{expr: `a.isEmpty and b.isEmpty and not c.isEmpty and d.isBlank`, input: `{"a": "", "b": null, "c": [1], "d": "  "}`},
+	}
+
+	var script strings.Builder
+	script.WriteString("const results = [];\n")
+	inputs := []any{}
+	for _, tc := range cases {
+		ast, err := Parse(tc.expr, nil)
+		if err != nil {
+			t.Fatal(err.Pretty(tc.expr))
+		}
+		source, err := ToJavaScript(ast)
+		if err != nil {
+			t.Fatal(err.Pretty(tc.expr))
+		}
+		var input any
+		if tc.input != "" {
+			if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+				t.Fatal(err)
+			}
+		}
+		inputs = append(inputs, input)
+		encoded, _ := json.Marshal(input)
+		script.WriteString("try { results.push({value: " + source + "(" + string(encoded) + ")}); } catch (e) { results.push({error: e.message}); }\n")
+	}
+	script.WriteString("console.log(JSON.stringify(results));\n")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(node, "-")
+	cmd.Stdin = strings.NewReader(script.String())
+	cmd.Stderr = &stderr
+	out, runErr := cmd.Output()
+	if runErr != nil {
+		t.Fatalf("%v: %s", runErr, stderr.String())
+	}
+	var results []struct {
+		Value any    `json:"value"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(out, &results); err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			expected, err := Eval(tc.expr, inputs[idx])
+			if err != nil {
+				if results[idx].Error != err.Error() {
+					t.Fatalf("expected error %q but found %q", err.Error(), results[idx].Error)
+				}
+				return
+			}
+			if results[idx].Error != "" {
+				t.Fatalf("unexpected error %s", results[idx].Error)
+			}
+			// Normalize numbers and other types by round-tripping through JSON.
+			var want any
+			b, _ := json.Marshal(expected)
+			json.Unmarshal(b, &want)
+			if !reflect.DeepEqual(want, results[idx].Value) {
+				t.Fatalf("expected %v but found %v", want, results[idx].Value)
+			}
+		})
+	}
+}
+
+func TestJavaScriptUnsupported(t *testing.T) {
+	for _, expr := range []string{
+		`a.default(1)`,
+		`round(a)`,
+		`created before now`,
+		`created after now`,
+		`created sameDay now`,
+		`name like "a*"`,
+		`ip inCidr "10.0.0.0/8"`,
+		`created format "2006"`,
+	} {
+		ast, err := Parse(expr, nil)
+		if err != nil {
+			t.Fatal(err.Pretty(expr))
+		}
+		if _, err := ToJavaScript(ast); err == nil || !strings.Contains(err.Error(), "is not supported in JavaScript") {
+			t.Fatalf("expected unsupported error for %s but found %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,542 @@
+//go:build !mexpr_lite
+
+package mexpr
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// jmesToken is a lexical token of a JMESPath expression.
+type jmesToken struct {
+	// Type is the operator or punctuation, or one of `ident`, `number`,
+	// `string`, `literal`, or `eof`.
+	Type   string
+	Value  string
+	Offset uint16
+	Length uint8
+}
+
+func (t jmesToken) String() string {
+	if t.Type == "eof" {
+		return "end of expression"
+	}
+	return t.Value
+}
+
+// jmesOperators are matched longest first.
+var jmesOperators = []string{"[?", "[*]", "[]", "||", "&&", "==", "!=", "<=", ">=", ".*", "[", "]", "(", ")", ".", ",", "|", "!", "<", ">", "@", ":", "*"}
+
+// jmesLex splits a JMESPath expression into tokens.
+func jmesLex(expression string) ([]jmesToken, Error) {
+	tokens := []jmesToken{}
+	pos := 0
+	for pos < len(expression) {
+		c := expression[pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			pos++
+			continue
+		}
+		start := pos
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			// Quoted identifiers, raw strings, and JSON literals.
+			pos++
+			var sb strings.Builder
+			for pos < len(expression) && expression[pos] != c {
+				if expression[pos] == '\\' && pos+1 < len(expression) && expression[pos+1] == c {
+					pos++
+				}
+				sb.WriteByte(expression[pos])
+				pos++
+			}
+			if pos >= len(expression) {
+				return nil, newError(KindSyntax, uint16(start), uint8(pos-start), "unterminated %c", c)
+			}
+			pos++
+			typ := map[byte]string{'"': "ident", '\'': "string", '`': "literal"}[c]
+			value := sb.String()
+			if c == '"' {
+				// Quoted identifiers are JSON strings.
+				var s string
+				if err := json.Unmarshal([]byte(expression[start:pos]), &s); err != nil {
+					return nil, newError(KindSyntax, uint16(start), uint8(pos-start), "invalid quoted identifier")
+				}
+				value = s
+			}
+			tokens = append(tokens, jmesToken{Type: typ, Value: value, Offset: uint16(start), Length: uint8(pos - start)})
+			continue
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			for pos < len(expression) && (expression[pos] == '_' || (expression[pos] >= 'a' && expression[pos] <= 'z') || (expression[pos] >= 'A' && expression[pos] <= 'Z') || (expression[pos] >= '0' && expression[pos] <= '9')) {
+				pos++
+			}
+			tokens = append(tokens, jmesToken{Type: "ident", Value: expression[start:pos], Offset: uint16(start), Length: uint8(pos - start)})
+			continue
+		case c == '-' || (c >= '0' && c <= '9'):
+			pos++
+			for pos < len(expression) && expression[pos] >= '0' && expression[pos] <= '9' {
+				pos++
+			}
+			tokens = append(tokens, jmesToken{Type: "number", Value: expression[start:pos], Offset: uint16(start), Length: uint8(pos - start)})
+			continue
+		}
+		matched := false
+		for _, op := range jmesOperators {
+			if strings.HasPrefix(expression[pos:], op) {
+				tokens = append(tokens, jmesToken{Type: op, Value: op, Offset: uint16(pos), Length: uint8(len(op))})
+				pos += len(op)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, newError(KindSyntax, uint16(pos), 1, "unexpected character %q", c)
+		}
+	}
+	tokens = append(tokens, jmesToken{Type: "eof", Offset: uint16(len(expression))})
+	return tokens, nil
+}
+
+// jmesParser converts JMESPath tokens into a mexpr abstract syntax tree.
+type jmesParser struct {
+	tokens []jmesToken
+	pos    int
+
+	// base is the left side of a pipe, which expressions on the right side are
+	// evaluated against, e.g. `[0]` in `items[*].id | [0]`.
+	base *Node
+}
+
+// ParseJMESPath parses a useful subset of JMESPath into a mexpr abstract
+// syntax tree which can be type checked and run like any other, easing
+// migration for filters already written in JMESPath. Supported are
+// identifiers, sub-expressions, indexes, slices, projections, filters,
+// pipes, comparisons, `&&`, `||`, `!`, literals, and the `length`,
+// `contains`, `starts_with`, and `ends_with` functions.
+//
+// Results follow mexpr semantics, e.g. selecting a field from an array
+// projects it rather than returning `null`. Constructs which would silently
+// give different results are syntax errors instead: flattening with `[]`, and
+// `&&` or `||` between values which aren't conditions, as JMESPath returns
+// one of the operands rather than a boolean. Filters and `!` use JMESPath
+// truthiness, so `0` is true.
+//
+// Run the result with `LenientIndexes`, which gives JMESPath semantics for
+// indexes and slices: out-of-range indexes like `items[5]` are `null` and
+// slices like `items[0:10]` are clamped to the available items. It is always
+// used for type checking.
+func ParseJMESPath(expression string, types any, options ...InterpreterOption) (*Node, Error) {
+	tokens, err := jmesLex(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &jmesParser{tokens: tokens}
+	ast, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.token(); t.Type != "eof" {
+		return nil, newError(KindSyntax, t.Offset, t.Length, "unexpected %s", t)
+	}
+	if err := jmesCheckLogic(ast); err != nil {
+		return nil, err
+	}
+	spans(ast)
+	if types != nil {
+		if err := TypeCheck(ast, types, append(options[:len(options):len(options)], LenientIndexes)...); err != nil {
+			return ast, err
+		}
+	}
+	return ast, nil
+}
+
+func (p *jmesParser) token() jmesToken {
+	return p.tokens[p.pos]
+}
+
+func (p *jmesParser) next() jmesToken {
+	t := p.tokens[p.pos]
+	if t.Type != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// expect consumes a token of the given type or returns an error.
+func (p *jmesParser) expect(typ string) (jmesToken, Error) {
+	t := p.next()
+	if t.Type != typ {
+		return t, newError(KindSyntax, t.Offset, t.Length, "expected %s but found %s", typ, t)
+	}
+	return t, nil
+}
+
+func (p *jmesParser) parsePipe() (*Node, Error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.token().Type == "|" {
+		p.next()
+		base := p.base
+		p.base = left
+		left, err = p.parseOr()
+		p.base = base
+		if err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *jmesParser) parseOr() (*Node, Error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.token().Type == "||" {
+		t := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Node{Type: NodeOr, Offset: t.Offset, Length: t.Length, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *jmesParser) parseAnd() (*Node, Error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.token().Type == "&&" {
+		t := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Node{Type: NodeAnd, Offset: t.Offset, Length: t.Length, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *jmesParser) parseNot() (*Node, Error) {
+	if p.token().Type == "!" {
+		t := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Type: NodeNot, Offset: t.Offset, Length: t.Length, Right: jmesTruthy(right)}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *jmesParser) parseComparison() (*Node, Error) {
+	left, err := p.parseChain()
+	if err != nil {
+		return nil, err
+	}
+	var nodeType NodeType
+	switch p.token().Type {
+	case "==":
+		nodeType = NodeEqual
+	case "!=":
+		nodeType = NodeNotEqual
+	case "<":
+		nodeType = NodeLessThan
+	case "<=":
+		nodeType = NodeLessThanEqual
+	case ">":
+		nodeType = NodeGreaterThan
+	case ">=":
+		nodeType = NodeGreaterThanEqual
+	default:
+		return left, nil
+	}
+	t := p.next()
+	right, err := p.parseChain()
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Type: nodeType, Offset: t.Offset, Length: t.Length, Left: left, Right: right}, nil
+}
+
+// parseChain parses a primary expression followed by any number of field
+// selections, indexes, and projections.
+func (p *jmesParser) parseChain() (*Node, Error) {
+	t := p.token()
+	switch t.Type {
+	case "string":
+		p.next()
+		return &Node{Type: NodeLiteral, Offset: t.Offset, Length: t.Length, Value: t.Value}, nil
+	case "literal":
+		p.next()
+		var value any
+		if err := json.Unmarshal([]byte(t.Value), &value); err != nil {
+			return nil, newError(KindSyntax, t.Offset, t.Length, "invalid JSON literal %s", t.Value)
+		}
+		return &Node{Type: NodeLiteral, Offset: t.Offset, Length: t.Length, Value: value}, nil
+	case "(":
+		p.next()
+		result, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return p.parsePostfix(result)
+	case "ident":
+		if p.tokens[p.pos+1].Type == "(" {
+			result, err := p.parseFunction()
+			if err != nil {
+				return nil, err
+			}
+			return p.parsePostfix(result)
+		}
+	case "@":
+		p.next()
+		return p.parsePostfix(p.current(p.base, t))
+	case "[", "[*]", "[]", "[?":
+		return p.parseSteps(p.base, false)
+	}
+	if t.Type != "ident" {
+		return nil, newError(KindSyntax, t.Offset, t.Length, "unexpected %s", t)
+	}
+	return p.parseSteps(p.base, true)
+}
+
+// parseFunction parses a supported function call like `length(items)`.
+func (p *jmesParser) parseFunction() (*Node, Error) {
+	name := p.next()
+	p.next()
+	args := []*Node{}
+	for p.token().Type != ")" {
+		if len(args) > 0 {
+			if _, err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	arity := 2
+	var nodeType NodeType
+	switch name.Value {
+	case "length":
+		arity = 1
+	case "contains":
+		nodeType = NodeContains
+	case "starts_with":
+		nodeType = NodeStartsWith
+	case "ends_with":
+		nodeType = NodeEndsWith
+	default:
+		return nil, newError(KindSyntax, name.Offset, name.Length, "unsupported function %s", name.Value)
+	}
+	if len(args) != arity {
+		return nil, newError(KindSyntax, name.Offset, name.Length, "%s expects %d arguments but found %d", name.Value, arity, len(args))
+	}
+	if name.Value == "length" {
+		return &Node{Type: NodeFieldSelect, Offset: name.Offset, Length: name.Length, Left: args[0], Right: &Node{Type: NodeIdentifier, Offset: name.Offset, Length: name.Length, Value: "length"}}, nil
+	}
+	return &Node{Type: nodeType, Offset: name.Offset, Length: name.Length, Left: args[0], Right: args[1]}, nil
+}
+
+// parsePostfix parses any field selections, indexes, and projections after
+// the current node.
+func (p *jmesParser) parsePostfix(current *Node) (*Node, Error) {
+	return p.parseSteps(current, false)
+}
+
+// parseSteps parses field selections, indexes, and projections applied to
+// `current`, which is the current value if `nil`. When `first` is set an
+// identifier may start the chain without a leading `.`.
+func (p *jmesParser) parseSteps(current *Node, first bool) (*Node, Error) {
+	for ; ; first = false {
+		t := p.token()
+		switch {
+		case t.Type == "." || (t.Type == "ident" && first):
+			if t.Type == "." {
+				p.next()
+			}
+			name, err := p.expect("ident")
+			if err != nil {
+				return nil, err
+			}
+			field := &Node{Type: NodeIdentifier, Offset: name.Offset, Length: name.Length, Value: name.Value}
+			if current == nil {
+				current = field
+			} else {
+				current = &Node{Type: NodeFieldSelect, Offset: t.Offset, Length: t.Length, Left: current, Right: field}
+			}
+		case t.Type == "[":
+			p.next()
+			index, projection, err := p.parseIndex(t)
+			if err != nil {
+				return nil, err
+			}
+			current = &Node{Type: NodeArrayIndex, Offset: t.Offset, Length: t.Length, Left: p.current(current, t), Right: index}
+			if projection {
+				return p.project(current)
+			}
+		case t.Type == "[]":
+			return nil, newError(KindSyntax, t.Offset, t.Length, "flattening with [] is not supported")
+		case t.Type == "[*]":
+			p.next()
+			return p.project(p.current(current, t))
+		case t.Type == "[?":
+			p.next()
+			base := p.base
+			p.base = nil
+			condition, err := p.parsePipe()
+			p.base = base
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return p.project(&Node{Type: NodeWhere, Offset: t.Offset, Length: t.Length, Left: p.current(current, t), Right: jmesTruthy(condition)})
+		case t.Type == ".*" || t.Type == "*":
+			return nil, newError(KindSyntax, t.Offset, t.Length, "object projections are not supported")
+		default:
+			return current, nil
+		}
+	}
+}
+
+// jmesTruthy converts a node into a condition using JMESPath truthiness, where
+// only `false`, `null`, and empty strings, arrays, and objects are false. This
+// differs from mexpr, where numbers like `0` are also false. The operands of
+// `&&` and `||` are converted too, as only their truthiness matters.
+func jmesTruthy(n *Node) *Node {
+	switch {
+	case n.Type == NodeAnd || n.Type == NodeOr:
+		n.Left, n.Right = jmesTruthy(n.Left), jmesTruthy(n.Right)
+		return n
+	case isBoolean(n):
+		return n
+	}
+	// The equivalent of `not n.isEmpty and n != false`.
+	empty := &Node{Type: NodeFieldSelect, Offset: n.Offset, Length: n.Length, Left: n, Right: &Node{Type: NodeIdentifier, Offset: n.Offset, Length: n.Length, Value: "isEmpty"}}
+	notFalse := &Node{Type: NodeNotEqual, Offset: n.Offset, Length: n.Length, Left: n, Right: &Node{Type: NodeLiteral, Offset: n.Offset, Length: n.Length, Value: false}}
+	return &Node{Type: NodeAnd, Offset: n.Offset, Length: n.Length, Left: &Node{Type: NodeNot, Offset: n.Offset, Length: n.Length, Right: empty}, Right: notFalse}
+}
+
+// jmesCheckLogic returns an error for `&&` and `||` with operands which may
+// not be booleans, outside of filters and `!` where only their truthiness
+// matters. In JMESPath these return one of the operands, e.g. `a || b` is the
+// first truthy value, while in mexpr they always return a boolean.
+func jmesCheckLogic(n *Node) Error {
+	if n == nil {
+		return nil
+	}
+	if n.Type == NodeAnd || n.Type == NodeOr {
+		for _, operand := range []*Node{n.Left, n.Right} {
+			if operand.Type != NodeAnd && operand.Type != NodeOr && !isBoolean(operand) {
+				op := "&&"
+				if n.Type == NodeOr {
+					op = "||"
+				}
+				return newError(KindSyntax, n.Offset, n.Length, "%s is only supported between conditions like comparisons", op)
+			}
+		}
+	}
+	for _, child := range append([]*Node{n.Left, n.Right}, n.Args...) {
+		if err := jmesCheckLogic(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// current returns the node, or a reference to the current value if `nil`.
+func (p *jmesParser) current(n *Node, t jmesToken) *Node {
+	if n == nil {
+		return &Node{Type: NodeIdentifier, Offset: t.Offset, Length: t.Length, Value: "@"}
+	}
+	return n
+}
+
+// parseIndex parses an index like `[0]` or a slice like `[1:3]` after the
+// opening bracket. JMESPath slices exclude the end while mexpr slices include
+// it, so the end is adjusted. Slices are projections.
+func (p *jmesParser) parseIndex(open jmesToken) (*Node, bool, Error) {
+	var parts []*int
+	var current *int
+	for {
+		t := p.next()
+		switch t.Type {
+		case "number":
+			n, err := strconv.Atoi(t.Value)
+			if err != nil || current != nil {
+				return nil, false, newError(KindSyntax, t.Offset, t.Length, "invalid index %s", t.Value)
+			}
+			current = &n
+			continue
+		case ":":
+			parts = append(parts, current)
+			current = nil
+			continue
+		case "]":
+			parts = append(parts, current)
+		default:
+			return nil, false, newError(KindSyntax, t.Offset, t.Length, "expected index but found %s", t)
+		}
+		break
+	}
+
+	if len(parts) == 1 {
+		if parts[0] == nil {
+			return nil, false, newError(KindSyntax, open.Offset, open.Length, "missing index")
+		}
+		return &Node{Type: NodeLiteral, Offset: open.Offset, Length: open.Length, Value: float64(*parts[0])}, false, nil
+	}
+	if len(parts) > 3 || (len(parts) == 3 && parts[2] != nil && *parts[2] != 1) {
+		return nil, false, newError(KindSyntax, open.Offset, open.Length, "slice steps are not supported")
+	}
+	start, end := 0, -1
+	if parts[0] != nil {
+		start = *parts[0]
+	}
+	if parts[1] != nil {
+		end = *parts[1] - 1
+		if *parts[1] == 0 {
+			// An end of `-1` is the last item in mexpr, so instead use a start
+			// after the end, which is always empty with `LenientIndexes`.
+			start, end = 1, 0
+		}
+	}
+	return &Node{
+		Type:   NodeSlice,
+		Offset: open.Offset,
+		Length: open.Length,
+		Left:   &Node{Type: NodeLiteral, Offset: open.Offset, Value: float64(start)},
+		Right:  &Node{Type: NodeLiteral, Offset: open.Offset, Value: float64(end)},
+	}, true, nil
+}
+
+// project parses the rest of a projection like `[*].name`, which is applied
+// to each item of `items`.
+func (p *jmesParser) project(items *Node) (*Node, Error) {
+	base := p.base
+	p.base = nil
+	rest, err := p.parseSteps(nil, false)
+	p.base = base
+	if err != nil {
+		return nil, err
+	}
+	if rest == nil {
+		return items, nil
+	}
+	return &Node{Type: NodeFieldSelect, Offset: items.Offset, Length: items.Length, Left: items, Right: rest}, nil
+}
@@ -0,0 +1,182 @@
+//go:build !mexpr_lite
+
+package mexpr
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJMESPath(t *testing.T) {
+	type test struct {
+		expr   string
+		output string
+		err    string
+	}
+	input := `{
+		"items": [
+			{"id": 1, "name": "a", "tags": ["x"]},
+			{"id": 5, "name": "b", "tags": ["y", "z"]}
+		],
+		"people": {"alice": {"age": 30}},
+		"members": [{"name": "x", "age": 0}, {"name": "y"}],
+		"name": "foo"
+	}`
+	cases := []test{
+		{expr: `people.alice.age`, output: `30`},
+		{expr: `"name"`, output: `"foo"`},
+		{expr: `@.name`, output: `"foo"`},
+		{expr: `items[0].name`, output: `"a"`},
+		{expr: `items[-1].tags[0]`, output: `"y"`},
+		{expr: `items[*].id`, output: `[1, 5]`},
+		{expr: `items[*].tags[0]`, output: `["x", "y"]`},
+		{expr: `items[1:].id`, output: `[5]`},
+		{expr: `items[:1].id`, output: `[1]`},
+		{expr: `items[:-1].name`, output: `["a"]`},
+		{expr: `items[5]`, output: `null`},
+		{expr: `items[5].name`, output: `null`},
+		{expr: `items[0:10].id`, output: `[1, 5]`},
+		{expr: `items[0:0]`, output: `[]`},
+		{expr: `members[2:1]`, output: `[]`},
+		{expr: `members[1:5].name`, output: `["y"]`},
+		{expr: "items[?id > `3`].name", output: `["b"]`},
+		{expr: "items[?name == 'a' || id == `5`].id", output: `[1, 5]`},
+		{expr: "items[?!(id == `1`) && contains(tags, 'z')].id", output: `[5]`},
+		{expr: "items[?id > `3`] | [0].name", output: `"b"`},
+		{expr: `items[*].id | [1]`, output: `5`},
+		{expr: `name | length(@)`, output: `3`},
+		{expr: `length(items) == ` + "`2`", output: `true`},
+		{expr: `starts_with(name, 'fo') && !ends_with(name, 'x')`, output: `true`},
+		{expr: "`[1, 2]`", output: `[1, 2]`},
+		{expr: `members[?age].name`, output: `["x"]`},
+		{expr: `members[?!age].name`, output: `["y"]`},
+		{expr: `!members[0].age`, output: `false`},
+		{expr: `members[?age || name == 'y'].name`, output: `["x", "y"]`},
+		{expr: `members[?(age || name == 'y') && name == 'x'].name`, output: `["x"]`},
+		{expr: `items[].name`, err: "flattening with [] is not supported"},
+		{expr: `reservations[].instances[].id`, err: "flattening with [] is not supported"},
+		{expr: `people || name`, err: "|| is only supported between conditions"},
+		{expr: "name && id == `1`", err: "&& is only supported between conditions"},
+		{expr: `items.*`, err: "object projections are not supported"},
+		{expr: `items[::2]`, err: "slice steps are not supported"},
+		{expr: `items[`, err: "expected index but found end of expression"},
+		{expr: `foo bar`, err: "unexpected bar"},
+		{expr: `sort(items)`, err: "unsupported function sort"},
+		{expr: "`{oops`", err: "invalid JSON literal"},
+		{expr: `'unterminated`, err: "unterminated '"},
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(input), &value); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := ParseJMESPath(tc.expr, value)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q but found %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			result, err := Run(ast, value, LenientIndexes)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			var expected, actual any
+			json.Unmarshal([]byte(tc.output), &expected)
+			b, _ := json.Marshal(result)
+			json.Unmarshal(b, &actual)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("expected %s but found %s", tc.output, b)
+			}
+		})
+	}
+}
+
+// TestJMESPathCompliance runs index and slice cases from the JMESPath
+// compliance tests, see https://github.com/jmespath/jmespath.test.
+func TestJMESPathCompliance(t *testing.T) {
+	type test struct {
+		expr   string
+		output string
+	}
+	suites := []struct {
+		input string
+		cases []test
+	}{
+		{
+			input: `{"foo": {"bar": ["zero", "one", "two"]}}`,
+			cases: []test{
+				{expr: `foo.bar[0]`, output: `"zero"`},
+				{expr: `foo.bar[1]`, output: `"one"`},
+				{expr: `foo.bar[2]`, output: `"two"`},
+				{expr: `foo.bar[3]`, output: `null`},
+				{expr: `foo.bar[-1]`, output: `"two"`},
+				{expr: `foo.bar[-2]`, output: `"one"`},
+				{expr: `foo.bar[-3]`, output: `"zero"`},
+				{expr: `foo.bar[-4]`, output: `null`},
+			},
+		},
+		{
+			input: `{"foo": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9], "empty": []}`,
+			cases: []test{
+				{expr: `foo[0:10:1]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[0:10]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[0:10:]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[0::1]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[0::]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[0:]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[:10:1]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[::1]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[:10:]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[::]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[:]`, output: `[0, 1, 2, 3, 4, 5, 6, 7, 8, 9]`},
+				{expr: `foo[1:9]`, output: `[1, 2, 3, 4, 5, 6, 7, 8]`},
+				{expr: `foo[-3:]`, output: `[7, 8, 9]`},
+				{expr: `foo[:-3]`, output: `[0, 1, 2, 3, 4, 5, 6]`},
+				{expr: `foo[-5:-2]`, output: `[5, 6, 7]`},
+				{expr: `foo[8:20]`, output: `[8, 9]`},
+				{expr: `foo[-20:2]`, output: `[0, 1]`},
+				{expr: `foo[10:]`, output: `[]`},
+				{expr: `foo[:-20]`, output: `[]`},
+				{expr: `foo[5:2]`, output: `[]`},
+				{expr: `foo[:0]`, output: `[]`},
+				{expr: `empty[0:1]`, output: `[]`},
+				{expr: `empty[0]`, output: `null`},
+			},
+		},
+	}
+
+	for _, suite := range suites {
+		var input any
+		if err := json.Unmarshal([]byte(suite.input), &input); err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range suite.cases {
+			t.Run(tc.expr, func(t *testing.T) {
+				ast, err := ParseJMESPath(tc.expr, input)
+				if err != nil {
+					t.Fatal(err.Pretty(tc.expr))
+				}
+				result, err := Run(ast, input, LenientIndexes)
+				if err != nil {
+					t.Fatal(err.Pretty(tc.expr))
+				}
+				var expected, actual any
+				json.Unmarshal([]byte(tc.output), &expected)
+				b, _ := json.Marshal(result)
+				json.Unmarshal(b, &actual)
+				if !reflect.DeepEqual(expected, actual) {
+					t.Fatalf("expected %s but found %s", tc.output, b)
+				}
+			})
+		}
+	}
+}
@@ -3,6 +3,7 @@ package mexpr
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -31,6 +32,14 @@ const (
 	TokenStringCompare
 	TokenWhere
 	TokenEOF
+	TokenComma
+	TokenExists
+	TokenTransform
+	TokenPaging
+	TokenAggregate
+	TokenRange
+	TokenSemicolon
+	TokenCoalesce
 )
 
 func (t TokenType) String() string {
@@ -73,6 +82,22 @@ func (t TokenType) String() string {
 		return "where"
 	case TokenEOF:
 		return "eof"
+	case TokenComma:
+		return "comma"
+	case TokenExists:
+		return "exists"
+	case TokenTransform:
+		return "transform"
+	case TokenPaging:
+		return "paging"
+	case TokenAggregate:
+		return "aggregate"
+	case TokenRange:
+		return "range"
+	case TokenSemicolon:
+		return "semicolon"
+	case TokenCoalesce:
+		return "coalesce"
 	}
 	return "unknown"
 }
@@ -97,6 +122,10 @@ func basic(input rune) TokenType {
 		return TokenMulDiv
 	case '^':
 		return TokenPower
+	case ',':
+		return TokenComma
+	case ';':
+		return TokenSemicolon
 	}
 
 	return TokenUnknown
@@ -108,37 +137,172 @@ type Token struct {
 	Length uint8
 	Offset uint16
 	Value  string
+
+	// Trivia is the whitespace before the token, only set when lexing with
+	// `PreserveTrivia`. The final `TokenEOF` holds any trailing whitespace, so
+	// the original expression can be reproduced from the trivia and the text of
+	// each token.
+	Trivia string
 }
 
 func (t *Token) String() string {
 	return fmt.Sprintf("%d (%s) %s", t.Offset, t.Type, t.Value)
 }
 
-// Lexer returns tokens from an input expression.
-type Lexer interface {
+// TokenSource provides tokens to a parser, for example a `Lexer` or a slice
+// of preprocessed tokens using `NewSliceLexer`.
+type TokenSource interface {
 	// Next returns the next token from the expression. The returned token may
 	// be changed in-place on subsequent calls and should not be stored.
 	Next() (*Token, Error)
 }
 
-// NewLexer creates a new lexer for the given expression.
-func NewLexer(expression string) Lexer {
+// Lexer returns tokens from an input expression.
+type Lexer interface {
+	TokenSource
+
+	// Peek returns the token after the current one without moving forward. The
+	// returned token may be changed in-place on subsequent calls.
+	Peek() (*Token, Error)
+
+	// Checkpoint saves the position of the lexer, including the current token,
+	// so it can be restored with `Restore` to try a different parse.
+	Checkpoint() LexerState
+
+	// Restore moves the lexer back to a previously saved position and restores
+	// the current token.
+	Restore(state LexerState)
+}
+
+// LexerState is a saved lexer position, see `Lexer.Checkpoint`.
+type LexerState struct {
+	pos       uint16
+	lastWidth uint16
+	token     Token
+}
+
+// NewLexer creates a new lexer for the given expression. Options like
+// `StrictSyntax` change which input is accepted.
+func NewLexer(expression string, options ...InterpreterOption) Lexer {
+	c := newConfig(options)
 	return &lexer{
 		expression: expression,
 		pos:        0,
 		lastWidth:  0,
 		token:      &Token{},
+		peeked:     &Token{},
+		strict:     c.strictSyntax,
+		trivia:     c.preserveTrivia,
 	}
 }
 
+// Tokenize returns all the tokens of an expression, not including the final
+// `TokenEOF`. Unlike `Lexer.Next` the returned tokens are copies which are
+// safe to store. If the expression can't be tokenized, the tokens found so far
+// are returned with the error.
+func Tokenize(expression string, options ...InterpreterOption) ([]Token, Error) {
+	l := NewLexer(expression, options...)
+	tokens := []Token{}
+	for {
+		t, err := l.Next()
+		if err != nil {
+			return tokens, err
+		}
+		if t.Type == TokenEOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, *t)
+	}
+}
+
+// NewSliceLexer creates a lexer which returns the given tokens followed by a
+// `TokenEOF`, for example to parse a token stream which was modified after
+// calling `Tokenize` to expand macros. The token offsets are used for errors.
+func NewSliceLexer(tokens []Token) Lexer {
+	return &sliceLexer{tokens: tokens}
+}
+
+type sliceLexer struct {
+	tokens []Token
+	pos    int
+
+	// token is a copy of the current token, so the slice isn't modified.
+	token  Token
+	peeked Token
+}
+
+func (l *sliceLexer) Next() (*Token, Error) {
+	if l.pos < len(l.tokens) {
+		l.token = l.tokens[l.pos]
+		l.pos++
+		return &l.token, nil
+	}
+	end := uint16(0)
+	if len(l.tokens) > 0 {
+		last := l.tokens[len(l.tokens)-1]
+		end = last.Offset + uint16(last.Length)
+	}
+	l.token = Token{Type: TokenEOF, Offset: end, Length: 1}
+	return &l.token, nil
+}
+
+func (l *sliceLexer) Peek() (*Token, Error) {
+	state := l.Checkpoint()
+	t, _ := l.Next()
+	l.peeked = *t
+	l.Restore(state)
+	return &l.peeked, nil
+}
+
+func (l *sliceLexer) Checkpoint() LexerState {
+	return LexerState{pos: uint16(l.pos), token: l.token}
+}
+
+func (l *sliceLexer) Restore(state LexerState) {
+	l.pos = int(state.pos)
+	l.token = state.token
+}
+
 type lexer struct {
 	expression string
 	pos        uint16
 	lastWidth  uint16
 
+	// strict reports malformed input as errors, see `StrictSyntax`.
+	strict bool
+
+	// trivia records whitespace before each token, see `PreserveTrivia`.
+	trivia bool
+
 	// token is a cached token to prevent new tokens from being allocated.
 	// It is re-used on each call to `Next()`.
 	token *Token
+
+	// peeked is a cached token returned by `Peek()`.
+	peeked *Token
+}
+
+func (l *lexer) Checkpoint() LexerState {
+	return LexerState{pos: l.pos, lastWidth: l.lastWidth, token: *l.token}
+}
+
+func (l *lexer) Restore(state LexerState) {
+	l.pos = state.pos
+	l.lastWidth = state.lastWidth
+	*l.token = state.token
+}
+
+func (l *lexer) Peek() (*Token, Error) {
+	state := l.Checkpoint()
+	t, err := l.Next()
+	if err == nil {
+		*l.peeked = *t
+	}
+	l.Restore(state)
+	if err != nil {
+		return nil, err
+	}
+	return l.peeked, nil
 }
 
 // next returns the next rune in the expression at the current position.
@@ -173,25 +337,41 @@ func (l *lexer) newToken(typ TokenType, value string) *Token {
 	if l.token.Length == 0 {
 		l.token.Length = 1
 	}
-	if typ == TokenString {
-		// Account for quotes
-		l.token.Offset--
-	}
 	return l.token
 }
 
 // consumeNumber reads runes from the expression until a non-number or
 // non-decimal is encountered.
-func (l *lexer) consumeNumber() *Token {
+func (l *lexer) consumeNumber() (*Token, Error) {
 	start := l.pos - l.lastWidth
+	dot := l.expression[start] == '.'
 	for {
 		r := l.next()
+		if r == '.' && l.peek() == '.' {
+			// Stop before a range like `1..10`.
+			l.back()
+			break
+		}
 		if r != '.' && r != '_' && (r < '0' || r > '9') {
 			l.back()
 			break
 		}
+		if l.strict {
+			switch r {
+			case '.':
+				if dot {
+					return nil, newError(KindSyntax, l.pos-1, 1, "unexpected second decimal point in number")
+				}
+				dot = true
+			case '_':
+				// Underscores may only separate digits, like `1_000`.
+				if !isDigit(rune(l.expression[l.pos-2])) || !isDigit(l.peek()) {
+					return nil, newError(KindSyntax, l.pos-1, 1, "underscores in numbers must be between digits")
+				}
+			}
+		}
 	}
-	return l.newToken(TokenNumber, l.expression[start:l.pos])
+	return l.newToken(TokenNumber, l.expression[start:l.pos]), nil
 }
 
 // consumeIdentifier reads runes from the expression until a non-identifier
@@ -201,6 +381,14 @@ func (l *lexer) consumeIdentifier() *Token {
 	start := l.pos - l.lastWidth
 	for {
 		r := l.next()
+		if r == '&' || r == '|' || r == '?' {
+			// Only `&&`, `||`, and `??` end an identifier, so `a&b` is one.
+			if l.peek() == r {
+				l.pos--
+				break
+			}
+			continue
+		}
 		if r == -1 || basic(r) != TokenUnknown || r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == '<' || r == '>' || r == '=' || r == '!' || r == '.' || r == '[' || r == '(' {
 			l.back()
 			break
@@ -218,18 +406,53 @@ func (l *lexer) consumeIdentifier() *Token {
 			return l.newToken(TokenOr, value)
 		case "not":
 			return l.newToken(TokenNot, value)
-		case "in", "contains", "startsWith", "endsWith", "before", "after":
+		case "in", "contains", "startsWith", "endsWith", "before", "after", "sameDay", "like", "inCidr":
 			return l.newToken(TokenStringCompare, value)
 		case "where":
 			return l.newToken(TokenWhere, value)
+		case "exists":
+			return l.newToken(TokenExists, value)
+		case "format":
+			return l.newToken(TokenTransform, value)
+		case "limit", "offset":
+			return l.newToken(TokenPaging, value)
+		case "sumBy", "minBy", "maxBy":
+			return l.newToken(TokenAggregate, value)
 		}
 	}
 	return l.newToken(TokenIdentifier, value)
 }
 
+// consumeQuotedIdentifier reads an identifier in backticks like `a.b`, which
+// may contain any characters except a backtick and is never a keyword.
+func (l *lexer) consumeQuotedIdentifier() (*Token, Error) {
+	start := l.pos - l.lastWidth
+	for {
+		r := l.next()
+		if r == -1 {
+			if l.strict {
+				return nil, newError(KindSyntax, start, uint8(l.pos-start), "unterminated quoted identifier")
+			}
+			break
+		}
+		if r == '`' {
+			break
+		}
+	}
+	value := l.expression[start+1 : l.pos]
+	if strings.HasSuffix(value, "`") {
+		value = value[:len(value)-1]
+	}
+	t := l.newToken(TokenIdentifier, value)
+	t.Offset = start
+	t.Length = uint8(l.pos - start)
+	return t, nil
+}
+
 // consumeString reads runes from the expression until a non-escaped double
 // quote is encountered. Only double-quoted strings are supported.
-func (l *lexer) consumeString() *Token {
+func (l *lexer) consumeString() (*Token, Error) {
+	start := l.pos - l.lastWidth
 	buf := bytes.NewBuffer(make([]byte, 0, 8))
 	for {
 		r := l.next()
@@ -238,19 +461,37 @@ func (l *lexer) consumeString() *Token {
 			buf.WriteRune('"')
 			continue
 		}
-		if r == -1 || r == '"' {
+		if r == -1 {
+			if l.strict {
+				return nil, newError(KindSyntax, start, uint8(l.pos-start), "unterminated string")
+			}
+			break
+		}
+		if r == '"' {
 			break
 		}
 		buf.WriteRune(r)
 	}
-	return l.newToken(TokenString, buf.String())
+	t := l.newToken(TokenString, buf.String())
+	// Locate the raw string including its quotes and escapes.
+	t.Offset = start
+	t.Length = uint8(l.pos - start)
+	return t, nil
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
 }
 
 func (l *lexer) Next() (*Token, Error) {
+	start := l.pos
 	r := l.next()
 	for r == ' ' || r == '\t' || r == '\r' || r == '\n' {
 		r = l.next()
 	}
+	if l.trivia {
+		l.token.Trivia = l.expression[start : l.pos-l.lastWidth]
+	}
 	if r == -1 {
 		return l.newToken(TokenEOF, ""), nil
 	}
@@ -259,18 +500,25 @@ func (l *lexer) Next() (*Token, Error) {
 	if b != TokenUnknown {
 		if r == '.' {
 			n := l.peek()
+			if n == '.' {
+				l.next()
+				return l.newToken(TokenRange, ".."), nil
+			}
 			if n >= '0' && n <= '9' {
-				return l.consumeNumber(), nil
+				return l.consumeNumber()
 			}
 		}
 		if l.pos-l.lastWidth > uint16(len(l.expression)-1) {
+			if l.strict && r == '.' {
+				return nil, newError(KindSyntax, l.pos-1, 1, "expected property name after .")
+			}
 			return l.newToken(TokenEOF, ""), nil
 		}
 		return l.newToken(b, l.expression[l.pos-l.lastWidth:l.pos]), nil
 	}
 
 	if r >= '0' && r <= '9' {
-		return l.consumeNumber(), nil
+		return l.consumeNumber()
 	}
 
 	if r == '<' || r == '>' || r == '!' {
@@ -279,19 +527,50 @@ func (l *lexer) Next() (*Token, Error) {
 			return l.newToken(TokenComparison, string([]rune{r, eq})), nil
 		}
 		l.back()
+		if r == '!' {
+			// C-style alias for `not`.
+			return l.newToken(TokenNot, "!"), nil
+		}
 		return l.newToken(TokenComparison, string(r)), nil
 	}
 
+	if r == '&' || r == '|' {
+		// C-style aliases for `and` and `or`.
+		if l.peek() != r {
+			return nil, newError(KindSyntax, l.pos-1, 1, "%c should be %c%c", r, r, r)
+		}
+		l.next()
+		if r == '&' {
+			return l.newToken(TokenAnd, "&&"), nil
+		}
+		return l.newToken(TokenOr, "||"), nil
+	}
+
+	if r == '?' {
+		if l.next() == '?' {
+			return l.newToken(TokenCoalesce, "??"), nil
+		}
+		// Restore the width of the `?` for `consumeIdentifier` below.
+		l.back()
+		l.lastWidth = 1
+	}
+
 	if r == '=' {
 		if l.peek() == '=' {
 			l.next()
 			return l.newToken(TokenComparison, "=="), nil
 		}
-		return nil, NewError(l.pos, 1, "= should be ==")
+		// A single `=` is only allowed with `LenientEquals`, which the parser
+		// checks.
+		return l.newToken(TokenComparison, "="), nil
 	}
 
 	if r == '"' {
-		return l.consumeString(), nil
+		return l.consumeString()
+	}
+
+	if r == '`' {
+		return l.consumeQuotedIdentifier()
 	}
 
 	return l.consumeIdentifier(), nil
@@ -0,0 +1,125 @@
+package mexpr
+
+import "testing"
+
+func TestLexerPeek(t *testing.T) {
+	l := NewLexer(`a.in not in b`)
+	expected := []TokenType{TokenIdentifier, TokenDot, TokenIdentifier, TokenNot, TokenStringCompare, TokenIdentifier, TokenEOF}
+	for idx, typ := range expected {
+		peeked, err := l.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if peeked.Type != typ {
+			t.Fatalf("token %d: expected peek %s but found %s", idx, typ, peeked.Type)
+		}
+		tok, err := l.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Type != typ || tok.Offset != peeked.Offset {
+			t.Fatalf("token %d: expected %s but found %s", idx, peeked, tok)
+		}
+	}
+}
+
+func TestLexerCheckpoint(t *testing.T) {
+	l := NewLexer(`a.where and b`)
+	l.Next()
+	dot, _ := l.Next()
+	state := l.Checkpoint()
+
+	// Keywords after a dot are identifiers, which depends on the restored token.
+	for i := 0; i < 2; i++ {
+		tok, _ := l.Next()
+		if tok.Type != TokenIdentifier || tok.Value != "where" {
+			t.Fatalf("expected where identifier but found %s", tok)
+		}
+		tok, _ = l.Next()
+		if tok.Type != TokenAnd {
+			t.Fatalf("expected and but found %s", tok)
+		}
+		l.Restore(state)
+		if dot.Type != TokenDot || dot.Offset != 1 {
+			t.Fatalf("expected current token to be restored but found %s", dot)
+		}
+	}
+
+	if _, err := NewLexer(`"a`, StrictSyntax).Peek(); err == nil {
+		t.Fatal("expected peek error")
+	}
+}
+
+func TestParseTokenSlice(t *testing.T) {
+	tokens, err := Tokenize(`total > LIMIT`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expand the `LIMIT` macro into `(max * 2)`.
+	expanded := []Token{}
+	for _, tok := range tokens {
+		if tok.Type == TokenIdentifier && tok.Value == "LIMIT" {
+			macro, _ := Tokenize(`(max * 2)`)
+			for _, m := range macro {
+				// Errors within the macro point at its use.
+				m.Offset, m.Length = tok.Offset, tok.Length
+				expanded = append(expanded, m)
+			}
+			continue
+		}
+		expanded = append(expanded, tok)
+	}
+
+	ast, err := NewParser(NewSliceLexer(expanded)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Run(ast, map[string]any{"total": 15, "max": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != true {
+		t.Fatalf("expected true but found %v", result)
+	}
+	if expanded[2].Value != "(" {
+		t.Fatal("parsing should not modify the token slice")
+	}
+
+	_, err = NewParser(NewSliceLexer(tokens[:2])).Parse()
+	if err == nil || err.Offset() != 7 {
+		t.Fatalf("expected error at the end of the tokens but found %v", err)
+	}
+}
+
+func TestLexerQuestionMark(t *testing.T) {
+	cases := map[string][]Token{
+		"?é":     {{Type: TokenIdentifier, Offset: 0, Value: "?é"}},
+		"*?日":    {{Type: TokenMulDiv, Offset: 0, Value: "*"}, {Type: TokenIdentifier, Offset: 1, Value: "?日"}},
+		"a ?? é": {{Type: TokenIdentifier, Offset: 0, Value: "a"}, {Type: TokenCoalesce, Offset: 2, Value: "??"}, {Type: TokenIdentifier, Offset: 5, Value: "é"}},
+		"a?":     {{Type: TokenIdentifier, Offset: 0, Value: "a?"}},
+		"a??b":   {{Type: TokenIdentifier, Offset: 0, Value: "a"}, {Type: TokenCoalesce, Offset: 1, Value: "??"}, {Type: TokenIdentifier, Offset: 3, Value: "b"}},
+		"a&b":    {{Type: TokenIdentifier, Offset: 0, Value: "a&b"}},
+		"a|b":    {{Type: TokenIdentifier, Offset: 0, Value: "a|b"}},
+		"a&&b":   {{Type: TokenIdentifier, Offset: 0, Value: "a"}, {Type: TokenAnd, Offset: 1, Value: "&&"}, {Type: TokenIdentifier, Offset: 3, Value: "b"}},
+	}
+	for expr, expected := range cases {
+		tokens, err := Tokenize(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if len(tokens) != len(expected) {
+			t.Fatalf("%s: expected %v but found %v", expr, expected, tokens)
+		}
+		for idx, tok := range tokens {
+			if tok.Type != expected[idx].Type || tok.Offset != expected[idx].Offset || tok.Value != expected[idx].Value {
+				t.Fatalf("%s: expected %v but found %v", expr, expected[idx], tok)
+			}
+		}
+
+		// These must not panic.
+		Parse(expr, nil)
+		Highlight(expr)
+		Suggest(expr, len(expr), nil)
+	}
+}
@@ -0,0 +1,271 @@
+package mexpr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Lint rules, see `Finding`.
+const (
+	// LintRedundantParens reports parentheses which don't change the result,
+	// like `(a > 1) and b`.
+	LintRedundantParens = "redundant-parens"
+
+	// LintConstantCondition reports conditions which are always or never true,
+	// like `x > 5 and x < 3`.
+	LintConstantCondition = "constant-condition"
+
+	// LintCoercion reports values which will be converted to strings, like
+	// `"id" + 1`. Requires types.
+	LintCoercion = "coercion"
+
+	// LintLenientEquals reports `=` used in place of `==` when using
+	// `LenientEquals`. Requires types.
+	LintLenientEquals = "lenient-equals"
+
+	// LintEnum reports comparisons with values which are not allowed for a
+	// property, see `LintConfig.Enums`.
+	LintEnum = "enum"
+
+	// LintDeprecated reports use of deprecated properties, see
+	// `LintConfig.Deprecated`.
+	LintDeprecated = "deprecated"
+)
+
+// Finding is an issue found by `Lint`.
+type Finding struct {
+	// Rule identifies the kind of issue, e.g. `LintRedundantParens`.
+	Rule string
+
+	// Err describes the issue and its location in the expression.
+	Err Error
+}
+
+func (f Finding) String() string {
+	return f.Rule + ": " + f.Err.Error()
+}
+
+// LintConfig describes the input for `Lint`.
+type LintConfig struct {
+	// Enums maps property paths like `user.status` to the values they may
+	// have. Comparisons with other values using `==` or `!=` are reported.
+	// Properties of array items use the path of the array, e.g. `items.status`
+	// for `items where status == "a"`. Use `Schema.Enums` to read them from
+	// the same schema used for type checking.
+	Enums map[string][]any
+
+	// Deprecated is called for each property path used by the expression, like
+	// `user` and `user.name` for `user.name`, and returns a message if the
+	// property is deprecated or an empty string otherwise.
+	Deprecated func(path string) string
+}
+
+// Lint parses an expression and returns issues which are not errors but
+// likely mistakes or style problems, sorted by their location. If `types` is
+// passed then the expression is type checked and type warnings like string
+// coercions are included. Pass the same options used to run the expression.
+// An error is returned only if the expression can't be parsed or fails to
+// type check.
+func Lint(expression string, types any, config LintConfig, options ...InterpreterOption) ([]Finding, Error) {
+	ast, err := Parse(expression, nil, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{config: config, options: options}
+	l.parens(expression, ast)
+	l.conditions(ast)
+	l.properties(ast, nil)
+
+	if types != nil && ast != nil {
+		t := newTypeChecker(ast, options...)
+		if err := t.Run(types); err != nil {
+			return nil, err
+		}
+		for idx, warning := range t.Warnings() {
+			l.report(t.rules[idx], warning)
+		}
+	}
+
+	sort.SliceStable(l.findings, func(a, b int) bool {
+		return l.findings[a].Err.Offset() < l.findings[b].Err.Offset()
+	})
+	return l.findings, nil
+}
+
+type linter struct {
+	config   LintConfig
+	options  []InterpreterOption
+	findings []Finding
+}
+
+// report adds a finding unless the same rule was already reported at the
+// same location, e.g. a constant condition found by both the analysis and the
+// type checker.
+func (l *linter) report(rule string, err Error) {
+	for _, f := range l.findings {
+		if f.Rule == rule && f.Err.Offset() == err.Offset() {
+			return
+		}
+	}
+	l.findings = append(l.findings, Finding{Rule: rule, Err: err})
+}
+
+// parens reports each pair of parentheses which can be removed without
+// changing the parsed expression.
+func (l *linter) parens(expression string, ast *Node) {
+	lexer := NewLexer(expression, l.options...)
+	open := []int{}
+	for {
+		t, err := lexer.Next()
+		if err != nil || t.Type == TokenEOF {
+			return
+		}
+		switch t.Type {
+		case TokenLeftParen:
+			open = append(open, int(t.Offset))
+		case TokenRightParen:
+			if len(open) == 0 {
+				return
+			}
+			start, end := open[len(open)-1], int(t.Offset)
+			open = open[:len(open)-1]
+
+			// Function calls like `lower()` parse differently without their
+			// parentheses, so they are never reported.
+			without := expression[:start] + " " + expression[start+1:end] + " " + expression[end+1:]
+			other, err := Parse(without, nil, l.options...)
+			if err == nil && sameNode(ast, other) {
+				l.report(LintRedundantParens, newSpanError(KindSyntax, uint16(start), uint16(end+1), "redundant parentheses"))
+			}
+		}
+	}
+}
+
+// sameNode returns whether two nodes have the same structure and values,
+// ignoring their locations.
+func sameNode(a, b *Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type != b.Type || !reflect.DeepEqual(a.Value, b.Value) || len(a.Args) != len(b.Args) {
+		return false
+	}
+	for idx := range a.Args {
+		if !sameNode(a.Args[idx], b.Args[idx]) {
+			return false
+		}
+	}
+	return sameNode(a.Left, b.Left) && sameNode(a.Right, b.Right)
+}
+
+// conditions reports the outermost conditions which are always or never
+// true, see `Truthiness`.
+func (l *linter) conditions(ast *Node) {
+	if ast == nil {
+		return
+	}
+	if isCondition(ast) {
+		if truth := Truthiness(ast, l.options...); truth != TruthDepends {
+			l.report(LintConstantCondition, newNodeError(KindTypeMismatch, ast, "condition is %s true", truth))
+			return
+		}
+	}
+	l.conditions(ast.Left)
+	l.conditions(ast.Right)
+	for _, arg := range ast.Args {
+		l.conditions(arg)
+	}
+}
+
+// isCondition returns whether a node results in a boolean.
+func isCondition(ast *Node) bool {
+	switch ast.Type {
+	case NodeEqual, NodeNotEqual, NodeLessThan, NodeLessThanEqual, NodeGreaterThan, NodeGreaterThanEqual,
+		NodeAnd, NodeOr, NodeNot, NodeIn, NodeContains, NodeStartsWith, NodeEndsWith, NodeBefore, NodeAfter,
+		NodeExists, NodeSameDay, NodeLike, NodeInCidr:
+		return true
+	}
+	return false
+}
+
+// properties walks the property paths used by the expression to report enum
+// and deprecation issues. The base is the path of the current item, e.g.
+// `items` within `items where ...`.
+func (l *linter) properties(ast *Node, base []string) {
+	if ast == nil {
+		return
+	}
+	switch ast.Type {
+	case NodeIdentifier:
+		if path := pathOf(ast, base); path != nil && len(path) > len(base) && l.config.Deprecated != nil {
+			name := strings.Join(path, ".")
+			if message := l.config.Deprecated(name); message != "" {
+				l.report(LintDeprecated, newNodeError(KindUnknownProperty, ast, "%s is deprecated: %s", name, message))
+			}
+		}
+		return
+	case NodeFieldSelect:
+		l.properties(ast.Left, base)
+		if path := pathOf(ast.Left, base); path != nil {
+			l.properties(ast.Right, path)
+		}
+		return
+	case NodeWhere:
+		l.properties(ast.Left, base)
+		if path := pathOf(ast.Left, base); path != nil {
+			l.properties(ast.Right, path)
+		}
+		return
+	case NodeEqual, NodeNotEqual:
+		l.enum(ast.Left, ast.Right, base)
+		l.enum(ast.Right, ast.Left, base)
+	}
+	l.properties(ast.Left, base)
+	l.properties(ast.Right, base)
+	for _, arg := range ast.Args {
+		l.properties(arg, base)
+	}
+}
+
+// enum reports a comparison of a property with a literal that is not one of
+// the property's allowed values.
+func (l *linter) enum(property, literal *Node, base []string) {
+	if literal.Type != NodeLiteral || l.config.Enums == nil {
+		return
+	}
+	path := pathOf(property, base)
+	if path == nil {
+		return
+	}
+	name := strings.Join(path, ".")
+	allowed, ok := l.config.Enums[name]
+	if !ok {
+		return
+	}
+	for _, value := range allowed {
+		if deepEqual(value, literal.Value) {
+			return
+		}
+	}
+	l.report(LintEnum, newNodeError(KindTypeMismatch, literal, "%s is not one of the allowed values for %s: %s", formatLiteral(literal.Value), name, formatValues(allowed)))
+}
+
+// formatLiteral quotes strings for messages.
+func formatLiteral(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return toString(v)
+}
+
+// formatValues formats a list of allowed values for messages.
+func formatValues(values []any) string {
+	parts := make([]string, len(values))
+	for idx, v := range values {
+		parts[idx] = formatLiteral(v)
+	}
+	return strings.Join(parts, ", ")
+}
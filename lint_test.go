@@ -0,0 +1,115 @@
+package mexpr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	config := LintConfig{
+		Enums: map[string][]any{
+			"status":       {"active", "closed"},
+			"items.status": {"new", "done"},
+			"priority":     {1, 2, 3},
+		},
+		Deprecated: func(path string) string {
+			if path == "user.name" {
+				return "use user.displayName"
+			}
+			return ""
+		},
+	}
+	types := map[string]any{
+		"id":       1,
+		"status":   "",
+		"priority": 1,
+		"user":     map[string]any{"name": "", "displayName": ""},
+		"items":    []any{map[string]any{"status": ""}},
+		"x":        1,
+	}
+
+	cases := []struct {
+		expr     string
+		types    any
+		opts     []InterpreterOption
+		expected []string
+	}{
+		{expr: `(a > 1) and b`, expected: []string{"redundant-parens: redundant parentheses"}},
+		{expr: `(a + 1) * 2`},
+		{expr: `((a))`, expected: []string{"redundant-parens: redundant parentheses", "redundant-parens: redundant parentheses"}},
+		{expr: `not (a or b)`},
+		{expr: `a.default(1) == 1`},
+		{expr: `x > 5 and x < 3`, expected: []string{"constant-condition: condition is never true"}},
+		{expr: `a and 1 == 1`, expected: []string{"constant-condition: condition is always true"}},
+		{expr: `1 + 2`},
+		{expr: `(items where (x > 5 and x < 3)).length`, expected: []string{"constant-condition: condition is never true"}},
+		{expr: `"id" + id`, types: types, expected: []string{"coercion: number will be converted to a string"}},
+		{expr: `id = 1`, types: types, opts: []InterpreterOption{LenientEquals}, expected: []string{"lenient-equals: = should be =="}},
+		{expr: `status == "open"`, expected: []string{`enum: "open" is not one of the allowed values for status: "active", "closed"`}},
+		{expr: `status != "closed" and "x" == status`, expected: []string{`enum: "x" is not one of the allowed values for status: "active", "closed"`}},
+		{expr: `priority == 2 or priority == 4`, expected: []string{`enum: 4 is not one of the allowed values for priority: 1, 2, 3`}},
+		{expr: `items where status == "open"`, expected: []string{`enum: "open" is not one of the allowed values for items.status: "new", "done"`}},
+		{expr: `kind == "c"`, types: Object(map[string]Schema{"kind": Enum("a", "b")}), expected: []string{`enum: "c" is not one of the allowed values for kind: "a", "b"`}},
+		{expr: `user.name + user.displayName`, expected: []string{"deprecated: user.name is deprecated: use user.displayName"}},
+		{expr: `(user.name)`, types: types, expected: []string{"redundant-parens: redundant parentheses", "deprecated: user.name is deprecated: use user.displayName"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			findings, err := Lint(tc.expr, tc.types, config, tc.opts...)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			var found []string
+			for _, f := range findings {
+				found = append(found, f.String())
+			}
+			if !reflect.DeepEqual(tc.expected, found) {
+				t.Fatalf("expected %v but found %v", tc.expected, found)
+			}
+		})
+	}
+}
+
+func TestLintLocation(t *testing.T) {
+	findings, err := Lint(`a or (b and c)`, nil, LintConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Err.Offset() != 5 || findings[0].Err.Length() != 9 {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+}
+
+func TestLintLongParens(t *testing.T) {
+	expression := `a or (` + strings.Repeat("b and ", 60) + `c)`
+	findings, err := Lint(expression, nil, LintConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+	start, end := findings[0].Err.Span()
+	if findings[0].Err.Offset() != 5 || findings[0].Err.Length() != 255 || start != 5 || int(end) != len(expression) {
+		t.Fatalf("unexpected location %d %d %d %d", findings[0].Err.Offset(), findings[0].Err.Length(), start, end)
+	}
+}
+
+func TestLintError(t *testing.T) {
+	if _, err := Lint(`a +`, nil, LintConfig{}); err == nil {
+		t.Fatal("expected syntax error")
+	}
+	if _, err := Lint(`id.foo`, map[string]any{"id": 1}, LintConfig{}); err == nil {
+		t.Fatal("expected type error")
+	}
+}
+
+func TestLintEmpty(t *testing.T) {
+	// Some tokens on their own parse to an empty AST, which isn't type checked.
+	findings, err := Lint(`<`, map[string]any{"id": 1}, LintConfig{})
+	if err != nil || len(findings) != 0 {
+		t.Fatalf("unexpected result %v %v", findings, err)
+	}
+}
@@ -0,0 +1,46 @@
+package mexpr
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLiteDependencies(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+
+	deps := func(tags ...string) map[string]bool {
+		args := []string{"list", "-deps"}
+		if len(tags) > 0 {
+			args = append(args, "-tags", strings.Join(tags, ","))
+		}
+		out, err := exec.Command(goTool, append(args, ".")...).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]bool{}
+		for _, pkg := range strings.Fields(string(out)) {
+			found[pkg] = true
+		}
+		return found
+	}
+
+	full := deps()
+	lite := deps("mexpr_lite")
+	for _, pkg := range []string{"crypto/md5", "crypto/sha256"} {
+		if !full[pkg] {
+			t.Errorf("expected %s in full build", pkg)
+		}
+		if lite[pkg] {
+			t.Errorf("expected %s to be left out of lite build", pkg)
+		}
+	}
+	for pkg := range lite {
+		if strings.HasPrefix(pkg, "crypto") {
+			t.Errorf("expected %s to be left out of lite build", pkg)
+		}
+	}
+}
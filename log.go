@@ -0,0 +1,85 @@
+package mexpr
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Lifecycle events passed to a `Logger`.
+const (
+	// LogParse is logged after parsing, with the `expression` when known and
+	// its `hash` if successful.
+	LogParse = "parse"
+
+	// LogTypeCheck is logged after type checking.
+	LogTypeCheck = "typecheck"
+
+	// LogRun is logged after each run, with the `hash` of the expression and
+	// its `result` if successful. The hash matches the one logged when parsing,
+	// which includes the expression's source.
+	LogRun = "run"
+)
+
+// Logger receives evaluation lifecycle events like `LogRun` along with
+// structured fields as alternating keys and values, e.g.
+// `"duration", 15 * time.Microsecond`. Every event includes its `duration`,
+// and failures include the `error` and its `kind`. The fields are compatible
+// with structured loggers like `log/slog`, for example:
+//
+//	mexpr.WithLogger(mexpr.LoggerFunc(func(event string, fields ...any) {
+//		slog.Info(event, fields...)
+//	}))
+type Logger interface {
+	Log(event string, fields ...any)
+}
+
+// LoggerFunc is a function which implements `Logger`.
+type LoggerFunc func(event string, fields ...any)
+
+// Log calls the function.
+func (f LoggerFunc) Log(event string, fields ...any) {
+	f(event, fields...)
+}
+
+// logEvent logs an event which started at `start` with the given fields.
+func logEvent(logger Logger, event string, start time.Time, err Error, fields ...any) {
+	fields = append(fields, "duration", time.Since(start))
+	if err != nil {
+		fields = append(fields, "error", err, "kind", err.Kind().String())
+	}
+	logger.Log(event, fields...)
+}
+
+// hashAST returns a stable hash of the AST to identify an expression, e.g. to
+// group log events. It ignores locations, so the same expression with
+// different whitespace has the same hash.
+func hashAST(ast *Node) string {
+	h := fnv.New64a()
+	writeAST(h, ast)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// writeAST writes the node types and values of the AST to `w`.
+func writeAST(w io.Writer, ast *Node) {
+	if ast == nil {
+		io.WriteString(w, "_")
+		return
+	}
+	switch v := ast.Value.(type) {
+	case string:
+		fmt.Fprintf(w, "(%d %q ", ast.Type, v)
+	case error:
+		fmt.Fprintf(w, "(%d %q ", ast.Type, v.Error())
+	default:
+		fmt.Fprintf(w, "(%d %T %v ", ast.Type, v, v)
+	}
+	writeAST(w, ast.Left)
+	writeAST(w, ast.Right)
+	for _, arg := range ast.Args {
+		writeAST(w, arg)
+	}
+	io.WriteString(w, ")")
+}
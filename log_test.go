@@ -0,0 +1,70 @@
+package mexpr
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	events := []string{}
+	logger := WithLogger(LoggerFunc(func(event string, fields ...any) {
+		if len(fields)%2 != 0 {
+			t.Fatalf("expected key/value pairs but found %v", fields)
+		}
+		line := event
+		for idx := 0; idx < len(fields); idx += 2 {
+			if fields[idx] == "duration" {
+				if _, ok := fields[idx+1].(time.Duration); !ok {
+					t.Fatalf("expected duration but found %v", fields[idx+1])
+				}
+				continue
+			}
+			line += fmt.Sprintf(" %s=%v", fields[idx], fields[idx+1])
+		}
+		events = append(events, line)
+	}))
+
+	ast, err := Parse(`a > 1`, map[string]any{"a": 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter(ast, logger)
+	interpreter.Run(map[string]any{"a": 2})
+	interpreter.Run(map[string]any{"a": "x"})
+	Parse(`a +`, nil, logger)
+
+	hash := hashAST(ast)
+	expected := []string{
+		"parse expression=a > 1 hash=" + hash,
+		"typecheck",
+		"run hash=" + hash + " result=true",
+		"run hash=" + hash + " error=unable to convert to number: x kind=type-mismatch",
+		"parse expression=a + error=incomplete expression, EOF found kind=syntax",
+	}
+	if !reflect.DeepEqual(expected, events) {
+		t.Fatalf("expected %q but found %q", expected, events)
+	}
+}
+
+func TestHashAST(t *testing.T) {
+	hashes := map[string]string{}
+	for _, expr := range []string{`a > 1`, `a>1`, `(a > 1)`, `a > 2`, `a >= 1`, `"a" > 1`, `b > 1`} {
+		ast, err := Parse(expr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[expr] = hashAST(ast)
+	}
+	if hashes[`a > 1`] != hashes[`a>1`] || hashes[`a > 1`] != hashes[`(a > 1)`] {
+		t.Fatalf("expected the same hash regardless of formatting: %v", hashes)
+	}
+	seen := map[string]bool{}
+	for _, expr := range []string{`a > 1`, `a > 2`, `a >= 1`, `"a" > 1`, `b > 1`} {
+		if seen[hashes[expr]] {
+			t.Fatalf("unexpected duplicate hash for %s: %v", expr, hashes)
+		}
+		seen[hashes[expr]] = true
+	}
+}
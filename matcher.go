@@ -0,0 +1,319 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Matcher finds which of many stored expressions match an input, e.g. for
+// alerting or subscriptions where thousands of filters are checked against
+// each event. Expressions which require a property to equal a literal or
+// start with a literal prefix, like `type == "order" and total > 100`, are
+// indexed by that property so only the candidates which could match are
+// run. Other expressions are run for every input. It is safe for concurrent
+// use.
+type Matcher struct {
+	mu        sync.RWMutex
+	types     any
+	options   []InterpreterOption
+	config    config
+	entries   map[string]*matcherEntry
+	paths     map[string]*matcherPath
+	unindexed map[string]*matcherEntry
+}
+
+// matcherEntry is a stored expression along with the predicate it is
+// indexed by, if any.
+type matcherEntry struct {
+	id         string
+	expression string
+	ast        *Node
+	pool       sync.Pool
+
+	// path is the property the entry is indexed by, with either the value it
+	// must equal or the prefix it must start with.
+	path   []string
+	equals bool
+	key    any
+	prefix string
+}
+
+// matcherPath indexes the entries which check a single property. The keys of
+// `prefixes` are also kept in `sorted` so the prefixes of a value can be found
+// with a binary search, see `matchPrefixes`.
+type matcherPath struct {
+	path     []string
+	equals   map[any]map[string]*matcherEntry
+	prefixes map[string]map[string]*matcherEntry
+	sorted   []string
+}
+
+// NewMatcher creates an empty matcher. If `types` is passed, expressions are
+// type checked against it when added like with `Parse`.
+func NewMatcher(types any, options ...InterpreterOption) *Matcher {
+	return &Matcher{
+		types:     types,
+		options:   options,
+		config:    newConfig(options),
+		entries:   map[string]*matcherEntry{},
+		paths:     map[string]*matcherPath{},
+		unindexed: map[string]*matcherEntry{},
+	}
+}
+
+// Add parses and stores an expression, replacing any existing expression with
+// the same ID.
+func (m *Matcher) Add(id, expression string) Error {
+	ast, err := Parse(expression, m.types, m.options...)
+	if err != nil {
+		return err
+	}
+	e := &matcherEntry{id: id, expression: expression, ast: ast}
+	m.predicate(e, ast)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	m.entries[id] = e
+	if e.path == nil {
+		m.unindexed[id] = e
+		return nil
+	}
+	name := strings.Join(e.path, ".")
+	p := m.paths[name]
+	if p == nil {
+		p = &matcherPath{path: e.path, equals: map[any]map[string]*matcherEntry{}, prefixes: map[string]map[string]*matcherEntry{}}
+		m.paths[name] = p
+	}
+	if e.equals {
+		if p.equals[e.key] == nil {
+			p.equals[e.key] = map[string]*matcherEntry{}
+		}
+		p.equals[e.key][id] = e
+	} else {
+		if p.prefixes[e.prefix] == nil {
+			p.prefixes[e.prefix] = map[string]*matcherEntry{}
+			idx := sort.SearchStrings(p.sorted, e.prefix)
+			p.sorted = append(p.sorted, "")
+			copy(p.sorted[idx+1:], p.sorted[idx:])
+			p.sorted[idx] = e.prefix
+		}
+		p.prefixes[e.prefix][id] = e
+	}
+	return nil
+}
+
+// Remove deletes a stored expression.
+func (m *Matcher) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+}
+
+func (m *Matcher) remove(id string) {
+	e := m.entries[id]
+	if e == nil {
+		return
+	}
+	delete(m.entries, id)
+	if e.path == nil {
+		delete(m.unindexed, id)
+		return
+	}
+	name := strings.Join(e.path, ".")
+	p := m.paths[name]
+	if e.equals {
+		delete(p.equals[e.key], id)
+		if len(p.equals[e.key]) == 0 {
+			delete(p.equals, e.key)
+		}
+	} else {
+		delete(p.prefixes[e.prefix], id)
+		if len(p.prefixes[e.prefix]) == 0 {
+			delete(p.prefixes, e.prefix)
+			idx := sort.SearchStrings(p.sorted, e.prefix)
+			p.sorted = append(p.sorted[:idx], p.sorted[idx+1:]...)
+		}
+	}
+	if len(p.equals) == 0 && len(p.prefixes) == 0 {
+		delete(m.paths, name)
+	}
+}
+
+// predicate finds a check which must pass for the expression to match, like
+// `type == "order"` in `type == "order" and total > 100`, and sets it on the
+// entry. Only the conditions joined by `and` at the top of the expression are
+// required.
+func (m *Matcher) predicate(e *matcherEntry, ast *Node) bool {
+	if ast == nil {
+		return false
+	}
+	switch ast.Type {
+	case NodeAnd:
+		return m.predicate(e, ast.Left) || m.predicate(e, ast.Right)
+	case NodeEqual:
+		for _, sides := range [2][2]*Node{{ast.Left, ast.Right}, {ast.Right, ast.Left}} {
+			if path := propertyPath(sides[0]); path != nil && sides[1].Type == NodeLiteral {
+				if key, ok := m.key(sides[1].Value); ok {
+					e.path, e.equals, e.key = path, true, key
+					return true
+				}
+			}
+		}
+	case NodeStartsWith:
+		if path := propertyPath(ast.Left); path != nil && ast.Right.Type == NodeLiteral {
+			if prefix, ok := ast.Right.Value.(string); ok {
+				e.path, e.prefix = path, m.fold(prefix)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the index key for a value, or false if the value can't be
+// indexed. Numbers are converted to floats, so e.g. `5` and `5.0` match.
+func (m *Matcher) key(v any) (any, bool) {
+	switch n := v.(type) {
+	case string:
+		return m.fold(n), true
+	case bool:
+		return n, true
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f, true
+		}
+		return nil, false
+	}
+	if isNumber(v) {
+		f, _ := toNumber(nil, v)
+		return f, true
+	}
+	return nil, false
+}
+
+func (m *Matcher) fold(s string) string {
+	if m.config.foldStrings {
+		return foldString(s)
+	}
+	return s
+}
+
+// candidates returns the entries which could match the input, sorted by ID.
+func (m *Matcher) candidates(input any) []*matcherEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	results := []*matcherEntry{}
+	for _, e := range m.unindexed {
+		results = append(results, e)
+	}
+	for _, p := range m.paths {
+		value, found, missing := m.resolve(p.path, input)
+		if missing {
+			// A missing property can't equal a literal or start with a prefix.
+			continue
+		}
+		if key, indexable := m.key(value); found && indexable {
+			for _, e := range p.equals[key] {
+				results = append(results, e)
+			}
+		} else {
+			// If the value couldn't be found in nested maps or can't be a map
+			// key then every entry needs to be checked.
+			for _, entries := range p.equals {
+				for _, e := range entries {
+					results = append(results, e)
+				}
+			}
+		}
+		if s, isStr := value.(string); found && isStr {
+			p.matchPrefixes(m.fold(s), func(prefix string) {
+				for _, e := range p.prefixes[prefix] {
+					results = append(results, e)
+				}
+			})
+		} else {
+			for _, entries := range p.prefixes {
+				for _, e := range entries {
+					results = append(results, e)
+				}
+			}
+		}
+	}
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].id < results[b].id
+	})
+	return results
+}
+
+// matchPrefixes calls `yield` with each indexed prefix of `s`. The largest
+// prefix at or before `s` in sorted order is the longest candidate. If it is a
+// prefix of `s` then any others are shorter, otherwise they must also be
+// prefixes of the part it has in common with `s`, so the search repeats with
+// a shorter string each time.
+func (p *matcherPath) matchPrefixes(s string, yield func(prefix string)) {
+	for {
+		idx := sort.Search(len(p.sorted), func(i int) bool { return p.sorted[i] > s }) - 1
+		if idx < 0 {
+			return
+		}
+		candidate := p.sorted[idx]
+		if strings.HasPrefix(s, candidate) {
+			yield(candidate)
+			if candidate == "" {
+				return
+			}
+			s = candidate[:len(candidate)-1]
+			continue
+		}
+		common := 0
+		for common < len(s) && common < len(candidate) && s[common] == candidate[common] {
+			common++
+		}
+		s = s[:common]
+	}
+}
+
+// resolve gets a property path from nested maps. It returns whether the value
+// was found, or whether it is definitely missing. If neither, e.g. the input
+// isn't a map, the value can only be known by running the expression.
+func (m *Matcher) resolve(path []string, input any) (any, bool, bool) {
+	value := input
+	for _, name := range path {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, false, false
+		}
+		if value, ok = obj[name]; !ok {
+			// Missing properties may be globals or unquoted strings, and are
+			// errors in strict mode.
+			known := !m.config.strict && !m.config.unquoted && m.config.globals == nil
+			return nil, false, known
+		}
+	}
+	return value, true, false
+}
+
+// Match runs the candidate expressions against the input and returns the IDs
+// of those which return a truthy value, sorted by ID. If an expression fails
+// then a `*ProgramError` with its ID as the name is returned.
+func (m *Matcher) Match(input any) ([]string, Error) {
+	matched := []string{}
+	for _, e := range m.candidates(input) {
+		i, ok := e.pool.Get().(Interpreter)
+		if !ok {
+			i = NewInterpreter(e.ast, m.options...)
+		}
+		result, err := i.Run(input)
+		e.pool.Put(i)
+		if err != nil {
+			return nil, &ProgramError{Name: e.id, Expression: e.expression, Err: err}
+		}
+		if toBool(result) {
+			matched = append(matched, e.id)
+		}
+	}
+	return matched, nil
+}
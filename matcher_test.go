@@ -0,0 +1,104 @@
+package mexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	m := NewMatcher(nil, FoldStrings)
+	for id, expr := range map[string]string{
+		"orders":       `type == "order"`,
+		"big-orders":   `type == "ORDER" and total > 100`,
+		"refunds":      `"refund" == type and total > 0`,
+		"eu":           `region startsWith "eu-"`,
+		"deep":         `user.plan == "pro" and total > 1`,
+		"numbers":      `count == 5`,
+		"unindexed":    `total > 1000 or type == "order"`,
+		"will-replace": `type == "x"`,
+	} {
+		if err := m.Add(id, expr); err != nil {
+			t.Fatal(err.Pretty(expr))
+		}
+	}
+	if err := m.Add("will-replace", `type == "refund"`); err != nil {
+		t.Fatal(err)
+	}
+	m.Add("removed", `type == "order"`)
+	m.Remove("removed")
+
+	cases := []struct {
+		input      map[string]any
+		candidates []string
+		matched    []string
+	}{
+		{
+			input:      map[string]any{"type": "order", "total": 150, "region": "us-east", "count": 5},
+			candidates: []string{"big-orders", "numbers", "orders", "unindexed"},
+			matched:    []string{"big-orders", "numbers", "orders", "unindexed"},
+		},
+		{
+			input:      map[string]any{"type": "Refund", "total": 5.0, "region": "EU-west", "count": 4.0, "user": map[string]any{"plan": "pro"}},
+			candidates: []string{"deep", "eu", "refunds", "unindexed", "will-replace"},
+			matched:    []string{"deep", "eu", "refunds", "will-replace"},
+		},
+		{
+			// Values which can't be indexed check every expression using them.
+			input:      map[string]any{"type": []any{"order"}, "total": 1},
+			candidates: []string{"big-orders", "orders", "refunds", "unindexed", "will-replace"},
+			matched:    []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		candidates := []string{}
+		for _, e := range m.candidates(tc.input) {
+			candidates = append(candidates, e.id)
+		}
+		if !reflect.DeepEqual(candidates, tc.candidates) {
+			t.Fatalf("expected candidates %v but found %v", tc.candidates, candidates)
+		}
+		matched, err := m.Match(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(matched, tc.matched) {
+			t.Fatalf("expected matches %v but found %v", tc.matched, matched)
+		}
+	}
+
+	// Properties from globals can't be indexed, so all entries are checked.
+	m = NewMatcher(nil, WithGlobals(map[string]any{"env": "prod"}))
+	m.Add("prod", `env == "prod"`)
+	if matched, err := m.Match(map[string]any{}); err != nil || !reflect.DeepEqual(matched, []string{"prod"}) {
+		t.Fatalf("expected global to match but found %v (%v)", matched, err)
+	}
+}
+
+func TestMatcherPrefixes(t *testing.T) {
+	m := NewMatcher(nil)
+	for _, prefix := range []string{"", "a", "ab", "abc", "abd", "abcd-x", "b", "ba"} {
+		if err := m.Add(prefix, `name startsWith "`+prefix+`"`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Remove("ba")
+
+	cases := map[string][]string{
+		"abcd": {"", "a", "ab", "abc"},
+		"abd":  {"", "a", "ab", "abd"},
+		"b":    {"", "b"},
+		"baz":  {"", "b"},
+		"c":    {""},
+		"":     {""},
+	}
+	for name, expected := range cases {
+		candidates := []string{}
+		for _, e := range m.candidates(map[string]any{"name": name}) {
+			candidates = append(candidates, e.id)
+		}
+		if !reflect.DeepEqual(candidates, expected) {
+			t.Fatalf("%s: expected candidates %v but found %v", name, expected, candidates)
+		}
+	}
+}
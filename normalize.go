@@ -0,0 +1,155 @@
+package mexpr
+
+import (
+	"strings"
+	"unicode"
+)
+
+// compositions lists pairs of base letters and their precomposed forms for
+// each combining mark, covering the accented Latin letters.
+var compositions = map[rune]string{
+	'\u0300': "AÀEÈIÌOÒUÙaàeèiìoòuùÜǛüǜNǸnǹĒḔēḕŌṐōṑWẀwẁÂẦâầĂẰăằÊỀêềÔỒôồƠỜơờƯỪưừYỲyỳ",
+	'\u0301': "AÁEÉIÍOÓUÚYÝaáeéiíoóuúyýCĆcćLĹlĺNŃnńRŔrŕSŚsśZŹzźÜǗüǘGǴgǵÅǺåǻÆǼæǽØǾøǿÇḈçḉĒḖēḗÏḮïḯKḰkḱMḾmḿÕṌõṍŌṒōṓPṔpṕŨṸũṹWẂwẃÂẤâấĂẮăắÊẾêếÔỐôốƠỚơớƯỨưứ",
+	'\u0302': "AÂEÊIÎOÔUÛaâeêiîoôuûCĈcĉGĜgĝHĤhĥJĴjĵSŜsŝWŴwŵYŶyŷZẐzẑẠẬạậẸỆẹệỌỘọộ",
+	'\u0303': "AÃNÑOÕaãnñoõIĨiĩUŨuũVṼvṽÂẪâẫĂẴăẵEẼeẽÊỄêễÔỖôỗƠỠơỡƯỮưữYỸyỹ",
+	'\u0304': "AĀaāEĒeēIĪiīOŌoōUŪuūÜǕüǖÄǞäǟȦǠȧǡÆǢæǣǪǬǫǭÖȪöȫÕȬõȭȮȰȯȱYȲyȳGḠgḡḶḸḷḹṚṜṛṝ",
+	'\u0306': "AĂaăEĔeĕGĞgğIĬiĭOŎoŏUŬuŭȨḜȩḝẠẶạặ",
+	'\u0307': "CĊcċEĖeėGĠgġIİZŻzżAȦaȧOȮoȯBḂbḃDḊdḋFḞfḟHḢhḣMṀmṁNṄnṅPṖpṗRṘrṙSṠsṡŚṤśṥŠṦšṧṢṨṣṩTṪtṫWẆwẇXẊxẋYẎyẏſẛ",
+	'\u0308': "AÄEËIÏOÖUÜaäeëiïoöuüyÿYŸHḦhḧÕṎõṏŪṺūṻWẄwẅXẌxẍtẗ",
+	'\u0309': "AẢaảÂẨâẩĂẲăẳEẺeẻÊỂêểIỈiỉOỎoỏÔỔôổƠỞơởUỦuủƯỬưửYỶyỷ",
+	'\u030a': "AÅaåUŮuůwẘyẙ",
+	'\u030b': "OŐoőUŰuű",
+	'\u030c': "CČcčDĎdďEĚeěLĽlľNŇnňRŘrřSŠsšTŤtťZŽzžAǍaǎIǏiǐOǑoǒUǓuǔÜǙüǚGǦgǧKǨkǩƷǮʒǯjǰHȞhȟ",
+	'\u030f': "AȀaȁEȄeȅIȈiȉOȌoȍRȐrȑUȔuȕ",
+	'\u0311': "AȂaȃEȆeȇIȊiȋOȎoȏRȒrȓUȖuȗ",
+	'\u031b': "OƠoơUƯuư",
+	'\u0323': "BḄbḅDḌdḍHḤhḥKḲkḳLḶlḷMṂmṃNṆnṇRṚrṛSṢsṣTṬtṭVṾvṿWẈwẉZẒzẓAẠaạEẸeẹIỊiịOỌoọƠỢơợUỤuụƯỰưựYỴyỵ",
+	'\u0324': "UṲuṳ",
+	'\u0325': "AḀaḁ",
+	'\u0326': "SȘsșTȚtț",
+	'\u0327': "CÇcçGĢgģKĶkķLĻlļNŅnņRŖrŗSŞsşTŢtţEȨeȩDḐdḑHḨhḩ",
+	'\u0328': "AĄaąEĘeęIĮiįUŲuųOǪoǫ",
+	'\u032d': "DḒdḓEḘeḙLḼlḽNṊnṋTṰtṱUṶuṷ",
+	'\u032e': "HḪhḫ",
+	'\u0330': "EḚeḛIḬiḭUṴuṵ",
+	'\u0331': "BḆbḇDḎdḏKḴkḵLḺlḻNṈnṉRṞrṟTṮtṯZẔzẕhẖ",
+}
+
+// composed maps a base letter and a combining mark to its precomposed form.
+var composed = func() map[[2]rune]rune {
+	m := map[[2]rune]rune{}
+	for mark, letters := range compositions {
+		runes := []rune(letters)
+		for idx := 0; idx+1 < len(runes); idx += 2 {
+			m[[2]rune{runes[idx], mark}] = runes[idx+1]
+		}
+	}
+	return m
+}()
+
+// combiningClass returns the Unicode canonical combining class of a mark in
+// the combining diacritical marks block, which orders marks below before
+// marks above, or 0 for other runes.
+func combiningClass(r rune) uint8 {
+	switch {
+	case r < 0x0300 || r > 0x036f || r == 0x034f:
+		return 0
+	case r >= 0x0334 && r <= 0x0338:
+		return 1
+	case r == 0x0321 || r == 0x0322 || r == 0x0327 || r == 0x0328:
+		return 202
+	case r == 0x031b:
+		return 216
+	case r >= 0x0316 && r <= 0x0319, r >= 0x031c && r <= 0x0320,
+		r >= 0x0323 && r <= 0x0326, r >= 0x0329 && r <= 0x0333,
+		r >= 0x0339 && r <= 0x033c, r >= 0x0347 && r <= 0x0349,
+		r == 0x034d || r == 0x034e, r >= 0x0353 && r <= 0x0356,
+		r == 0x0359 || r == 0x035a:
+		return 220
+	case r == 0x0315 || r == 0x031a || r == 0x0358:
+		return 232
+	case r == 0x035c || r == 0x035f || r == 0x0362:
+		return 233
+	case r == 0x035d || r == 0x035e || r == 0x0360 || r == 0x0361:
+		return 234
+	case r == 0x0345:
+		return 240
+	}
+	return 230
+}
+
+// normalizeString composes letters followed by combining marks, like `e`
+// followed by U+0301, into their precomposed forms like `é`. Marks are put in
+// canonical order first, so e.g. a dot below and a circumflex compose to `ệ`
+// in either order. This is the subset of Unicode NFC normalization needed for
+// accented Latin letters.
+func normalizeString(s string) string {
+	combining := false
+	for _, r := range s {
+		if r >= 0x0300 && r <= 0x036f {
+			combining = true
+			break
+		}
+	}
+	if !combining {
+		return s
+	}
+	runes := []rune(s)
+
+	// Sort each run of marks by combining class, keeping the order of marks
+	// with the same class.
+	for idx := 1; idx < len(runes); idx++ {
+		c := combiningClass(runes[idx])
+		if c == 0 {
+			continue
+		}
+		for prev := idx; prev > 0; prev-- {
+			p := combiningClass(runes[prev-1])
+			if p == 0 || p <= c {
+				break
+			}
+			runes[prev-1], runes[prev] = runes[prev], runes[prev-1]
+		}
+	}
+
+	// Compose each mark with the last letter unless a mark of the same class
+	// which didn't compose is in between.
+	result := runes[:0]
+	starter := -1
+	last := uint8(0)
+	for _, r := range runes {
+		c := combiningClass(r)
+		if c == 0 {
+			starter, last = len(result), 0
+			result = append(result, r)
+			continue
+		}
+		if starter != -1 && last < c {
+			if composedRune, ok := composed[[2]rune{result[starter], r}]; ok {
+				result[starter] = composedRune
+				continue
+			}
+		}
+		last = c
+		result = append(result, r)
+	}
+	return string(result)
+}
+
+// foldString normalizes and case folds a string so that e.g. `Café` and
+// `CAFE\u0301` compare as equal.
+func foldString(s string) string {
+	return strings.Map(foldRune, normalizeString(s))
+}
+
+// foldRune returns the smallest rune which is equivalent under Unicode simple
+// case folding, so `K`, `k`, and the Kelvin sign all fold to `K`.
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < folded {
+			folded = f
+		}
+	}
+	return folded
+}
@@ -0,0 +1,299 @@
+package mexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpenAPISchema converts an OpenAPI 3 schema object, as decoded from JSON or
+// YAML, into a `Schema` for type checking, so expressions like `?filter=`
+// query parameters can be validated against a published API description.
+// References like `#/components/schemas/User` are resolved using
+// `components`, which is the decoded `components.schemas` object of the
+// document and may be nil if there are no references. Recursive references
+// accept any type at the point where they repeat.
+//
+// Strings with the `date` or `date-time` format are dates, which can be
+// ordered like `created < "2022-01-01"` or used with operators like `before`.
+// Objects without properties accept any property, as do schemas without a
+// type. Properties which are not `required` are `Optional`, and other
+// properties are only allowed if `additionalProperties` is `true` or a
+// schema. Schemas with an `enum` only allow its values, see `Enum`.
+func OpenAPISchema(schema any, components map[string]any) (Schema, error) {
+	c := &openAPIConverter{components: components, visiting: map[string]bool{}}
+	s, err := c.convert(schema)
+	if err != nil {
+		return Schema{}, err
+	}
+	if s == nil {
+		return Schema{}, fmt.Errorf("OpenAPI schema allows no value")
+	}
+	return Schema{s}, nil
+}
+
+type openAPIConverter struct {
+	components map[string]any
+
+	// visiting tracks the references being converted to break cycles.
+	visiting map[string]bool
+}
+
+// openAPIObject returns a decoded JSON or YAML object as a map with string
+// keys.
+func openAPIObject(v any) (map[string]any, bool) {
+	switch m := v.(type) {
+	case map[string]any:
+		return m, true
+	case map[any]any:
+		result := make(map[string]any, len(m))
+		for k, v := range m {
+			result[toString(k)] = v
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// convert converts a schema, returning nil if it allows no value at all like
+// the JSON Schema `false`.
+func (c *openAPIConverter) convert(v any) (*schema, error) {
+	if b, ok := v.(bool); ok {
+		// JSON Schema allows `true` for any value and `false` for none.
+		if b {
+			return schemaAny, nil
+		}
+		return nil, nil
+	}
+	obj, ok := openAPIObject(v)
+	if !ok {
+		return nil, fmt.Errorf("expected OpenAPI schema object but found %v", v)
+	}
+
+	if ref, ok := obj["$ref"].(string); ok {
+		return c.ref(ref)
+	}
+
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if options, ok := obj[key].([]any); ok {
+			schemas, err := c.convertAll(options)
+			if err != nil {
+				return nil, err
+			}
+			// Options which allow no value can't match.
+			allowed := []*schema{}
+			for _, s := range schemas {
+				if s != nil {
+					allowed = append(allowed, s)
+				}
+			}
+			if len(allowed) == 0 {
+				return nil, nil
+			}
+			return c.nullable(obj, newUnion(allowed...)), nil
+		}
+	}
+
+	if all, ok := obj["allOf"].([]any); ok {
+		schemas, err := c.convertAll(all)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range schemas {
+			if s == nil {
+				return nil, nil
+			}
+		}
+		return c.nullable(obj, intersect(schemas)), nil
+	}
+
+	var types []string
+	switch t := obj["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		// OpenAPI 3.1 allows a list of types, like `["string", "null"]`.
+		for _, item := range t {
+			types = append(types, toString(item))
+		}
+	case nil:
+		if _, ok := obj["properties"]; ok {
+			types = []string{"object"}
+		} else if _, ok := obj["items"]; ok {
+			types = []string{"array"}
+		}
+	}
+	values, isEnum := obj["enum"].([]any)
+	if len(types) == 0 {
+		if isEnum {
+			return c.nullable(obj, newEnum(values)), nil
+		}
+		return schemaAny, nil
+	}
+
+	schemas := make([]*schema, len(types))
+	for idx, typ := range types {
+		s, err := c.convertType(typ, obj)
+		if err != nil {
+			return nil, err
+		}
+		schemas[idx] = s
+	}
+	s := newUnion(schemas...)
+	if isEnum {
+		s = restrictEnum(s, values)
+	}
+	return c.nullable(obj, s), nil
+}
+
+// restrictEnum limits a schema to the given values, see `Enum`. Members of a
+// union only allow the values of their own type.
+func restrictEnum(s *schema, values []any) *schema {
+	if s.typeName != typeUnion {
+		return withEnum(s, values)
+	}
+	tmp := *s
+	tmp.oneOf = make([]*schema, len(s.oneOf))
+	for idx, o := range s.oneOf {
+		allowed := []any{}
+		for _, v := range values {
+			if t := getSchema(v).typeName; t == o.typeName || (t == typeString && o.typeName == typeDate) {
+				allowed = append(allowed, v)
+			}
+		}
+		tmp.oneOf[idx] = withEnum(o, allowed)
+	}
+	return &tmp
+}
+
+func (c *openAPIConverter) convertAll(values []any) ([]*schema, error) {
+	schemas := make([]*schema, len(values))
+	for idx, v := range values {
+		s, err := c.convert(v)
+		if err != nil {
+			return nil, err
+		}
+		schemas[idx] = s
+	}
+	return schemas, nil
+}
+
+// convertType converts a schema with a single type like `string`.
+func (c *openAPIConverter) convertType(typ string, obj map[string]any) (*schema, error) {
+	switch typ {
+	case "null":
+		return schemaNull, nil
+	case "boolean":
+		return schemaBool, nil
+	case "integer":
+		return schemaInt, nil
+	case "number":
+		if format, _ := obj["format"].(string); format == "float" || format == "double" {
+			return schemaFloat, nil
+		}
+		return schemaNumber, nil
+	case "string":
+		if format, _ := obj["format"].(string); format == "date" || format == "date-time" {
+			return schemaDate, nil
+		}
+		return schemaString, nil
+	case "array":
+		s := newSchema(typeArray)
+		if items, ok := obj["items"]; ok {
+			var err error
+			if s.items, err = c.convert(items); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case "object":
+		props, _ := openAPIObject(obj["properties"])
+		additional, hasAdditional := obj["additionalProperties"]
+		if len(props) == 0 && !hasAdditional {
+			// Free-form objects like maps may have any properties.
+			return schemaAny, nil
+		}
+		s := newSchema(typeObject)
+		s.properties = make(map[string]*schema, len(props))
+		if hasAdditional {
+			var err error
+			if s.additional, err = c.convert(additional); err != nil {
+				return nil, fmt.Errorf("additionalProperties: %w", err)
+			}
+		}
+		required := map[string]bool{}
+		if names, ok := obj["required"].([]any); ok {
+			for _, name := range names {
+				required[toString(name)] = true
+			}
+		}
+		for name, prop := range props {
+			p, err := c.convert(prop)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			if p == nil {
+				// The property can never be present.
+				continue
+			}
+			if !required[name] {
+				p = newUnion(p, schemaNull)
+			}
+			s.properties[name] = p
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported OpenAPI type %s", typ)
+}
+
+// ref converts a reference like `#/components/schemas/User`.
+func (c *openAPIConverter) ref(ref string) (*schema, error) {
+	name := strings.TrimPrefix(ref, "#/components/schemas/")
+	target, ok := c.components[name]
+	if !ok || name == ref {
+		return nil, fmt.Errorf("cannot resolve OpenAPI reference %s", ref)
+	}
+	if c.visiting[name] {
+		return schemaAny, nil
+	}
+	c.visiting[name] = true
+	defer delete(c.visiting, name)
+	s, err := c.convert(target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+// nullable adds `null` to the schema for OpenAPI 3.0 `nullable: true`.
+func (c *openAPIConverter) nullable(obj map[string]any, s *schema) *schema {
+	if n, _ := obj["nullable"].(bool); n {
+		return newUnion(s, schemaNull)
+	}
+	return s
+}
+
+// intersect combines `allOf` schemas, where objects have the properties of
+// all of them. If any of them isn't an object, the first schema which is not
+// `any` is used.
+func intersect(schemas []*schema) *schema {
+	merged := newSchema(typeObject)
+	merged.properties = map[string]*schema{}
+	for _, s := range schemas {
+		if s.isAny() {
+			continue
+		}
+		if s.typeName != typeObject {
+			return s
+		}
+		for k, v := range s.properties {
+			merged.properties[k] = v
+		}
+		if merged.additional == nil {
+			merged.additional = s.additional
+		}
+	}
+	if len(merged.properties) == 0 && merged.additional == nil {
+		return schemaAny
+	}
+	return merged
+}
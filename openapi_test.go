@@ -0,0 +1,189 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const openAPIComponents = `{
+	"User": {
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer"},
+			"name": {"type": "string", "nullable": true},
+			"email": {"type": ["string", "null"], "format": "email"},
+			"created": {"type": "string", "format": "date-time"},
+			"score": {"type": "number", "format": "double"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"meta": {"type": "object", "additionalProperties": true},
+			"manager": {"$ref": "#/components/schemas/User"}
+		}
+	},
+	"Order": {
+		"allOf": [
+			{"type": "object", "properties": {"id": {"type": "integer"}}},
+			{"properties": {"status": {"type": "string", "enum": ["new", "done"]}}}
+		]
+	},
+	"Owner": {
+		"oneOf": [
+			{"$ref": "#/components/schemas/User"},
+			{"type": "object", "properties": {"team": {"type": "string"}}}
+		]
+	}
+}`
+
+func TestOpenAPISchema(t *testing.T) {
+	var components map[string]any
+	if err := json.Unmarshal([]byte(openAPIComponents), &components); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ref  string
+		expr string
+		err  string
+	}{
+		{ref: "User", expr: `id > 1 and name startsWith "a" and email endsWith ".com"`},
+		{ref: "User", expr: `created after "2022-01-01" and score > 0.5`},
+		{ref: "User", expr: `created < "2022-01-01" and created >= manager.created`},
+		{ref: "User", expr: `tags contains "admin" and meta.anything == 1`},
+		{ref: "User", expr: `manager.manager.id == id`},
+		{ref: "Order", expr: `id > 1 and status == "new"`},
+		{ref: "Owner", expr: `team == "a" or name == "b"`},
+		{ref: "User", expr: `age > 1`, err: "no property age"},
+		{ref: "User", expr: `name > 1`, err: "cannot compare"},
+		{ref: "Order", expr: `total > 1`, err: "no property total"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			types, err := OpenAPISchema(map[string]any{"$ref": "#/components/schemas/" + tc.ref}, components)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, perr := Parse(tc.expr, types)
+			if tc.err != "" {
+				if perr == nil || !strings.Contains(perr.Error(), tc.err) {
+					t.Fatalf("expected %s but found %v", tc.err, perr)
+				}
+				return
+			}
+			if perr != nil {
+				t.Fatal(perr.Pretty(tc.expr))
+			}
+		})
+	}
+}
+
+func TestOpenAPISchemaError(t *testing.T) {
+	if _, err := OpenAPISchema(map[string]any{"$ref": "#/components/schemas/Missing"}, nil); err == nil {
+		t.Fatal("expected unresolved reference error")
+	}
+	_, err := OpenAPISchema(map[string]any{"type": "object", "properties": map[string]any{"a": map[string]any{"type": "file"}}}, nil)
+	if err == nil || err.Error() != "property a: unsupported OpenAPI type file" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestOpenAPISchemaEnum(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"status": {"type": "string", "enum": ["new", "done"]},
+			"level": {"type": ["integer", "string"], "enum": [1, 2, "max"]},
+			"kind": {"enum": ["a", "b", null]}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+	types, err := OpenAPISchema(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ast, perr := Parse(`status == "open" or level == 3 or level == "max" or kind == "c"`, nil)
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	checker := NewTypeChecker(ast)
+	if err := checker.Run(types); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, w := range checker.Warnings() {
+		warnings = append(warnings, w.Error())
+	}
+	expected := []string{
+		`"open" is not one of the allowed values for status: "new", "done"`,
+		`3 is not one of the allowed values for level: 1, 2, "max"`,
+		`"c" is not one of the allowed values for kind: "a", "b"`,
+	}
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected %v but found %v", expected, warnings)
+	}
+	for idx, w := range warnings {
+		if !strings.Contains(w, expected[idx]) {
+			t.Fatalf("expected %s but found %s", expected[idx], w)
+		}
+	}
+}
+
+func TestOpenAPISchemaProperties(t *testing.T) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["id", "labels"],
+		"properties": {
+			"id": {"type": "integer"},
+			"nickname": {"type": "string"},
+			"removed": false,
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"extra": {"type": "object", "properties": {"a": {"type": "integer"}}, "additionalProperties": true},
+			"closed": {"type": "object", "properties": {"a": {"type": "integer"}}, "additionalProperties": false}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+	types, err := OpenAPISchema(schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: `id + 1 > 2 and (nickname ?? "x") startsWith "a"`},
+		{expr: `exists nickname and nickname.length > 2`},
+		{expr: `labels.team startsWith "a" and (labels where @ == "b").length > 0`},
+		{expr: `labels.team > 1`, err: "cannot compare"},
+		{expr: `extra.a > 1 and extra.b == "c"`},
+		{expr: `closed.b == 1`, err: "no property b"},
+		{expr: `removed == 1`, err: "no property removed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, perr := Parse(tc.expr, types)
+			if tc.err != "" {
+				if perr == nil || !strings.Contains(perr.Error(), tc.err) {
+					t.Fatalf("expected %s but found %v", tc.err, perr)
+				}
+				return
+			}
+			if perr != nil {
+				t.Fatal(perr.Pretty(tc.expr))
+			}
+		})
+	}
+
+	if _, err := OpenAPISchema(false, nil); err == nil || err.Error() != "OpenAPI schema allows no value" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := OpenAPISchema(map[string]any{"oneOf": []any{false, map[string]any{"type": "string"}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
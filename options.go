@@ -0,0 +1,343 @@
+package mexpr
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InterpreterOption passes configuration settings when creating a new
+// interpreter instance. Options are also used by the parser and type checker.
+// Options are either a `Flag` like `StrictMode` which enables a feature, or
+// created by a function like `WithClock` for options which take parameters.
+type InterpreterOption interface {
+	apply(c *config)
+}
+
+// Flag is an option which enables a feature, like `StrictMode`.
+type Flag int
+
+const (
+	// StrictMode does extra checks like making sure identifiers exist.
+	StrictMode Flag = iota
+
+	// UnqoutedStrings enables the use of unquoted string values rather than
+	// returning nil or a missing identifier error. Identifiers get priority
+	// over unquoted strings.
+	UnquotedStrings
+
+	// StrictNumbers tracks integers and floats separately. Comparing an integer
+	// with a float for equality is an error, while math on integers (including
+	// the result of `.length`) stays an integer, e.g. `5 / 2` is `2`, except for
+	// negative powers and results which overflow, which are floats. Integral
+	// number literals like `5` can be used as either an integer or a float.
+	StrictNumbers
+
+	// DecimalNumbers does math using exact decimal arithmetic instead of
+	// floats, so `0.1 + 0.2 == 0.3` is true. Number results are returned as
+	// `*big.Rat` values. Division that does not terminate, like `1 / 3`, is
+	// still exact as a fraction. Non-integer powers fall back to floats.
+	DecimalNumbers
+
+	// StrictTypes disables implicit conversions between types. Adding a
+	// string to a non-string, using string operators like `endsWith` on
+	// non-strings, and using non-booleans with `and`, `or`, or `not` are all
+	// errors rather than silently converting the values.
+	StrictTypes
+
+	// LenientIndexes returns `nil` for out-of-range indexes and for indexing
+	// into `nil` rather than an error, so filters over ragged data like
+	// `items where tags[0] == "foo"` skip items without enough values.
+	// Out-of-range slices are clamped to the available items.
+	LenientIndexes
+
+	// KeepMapKeys makes `where` clauses on maps return a map of the matching
+	// keys and values rather than a slice of values.
+	KeepMapKeys
+
+	// UndefinedValues returns `Undefined` rather than `nil` for missing
+	// properties outside of strict mode, so they can be told apart from
+	// explicit `null` values. The `undefined` identifier can be used to check
+	// for it, e.g. `foo == undefined`.
+	UndefinedValues
+
+	// ThreeValuedLogic uses SQL-style `null` handling, where comparing `nil`
+	// with anything results in `nil` (unknown) rather than `true` or `false`.
+	// Unknown values propagate through `and`, `or`, and `not`, e.g.
+	// `nil and false` is `false` while `nil and true` is `nil`.
+	ThreeValuedLogic
+
+	// FoldStrings ignores case and how accented letters are encoded when
+	// comparing strings with `==`, `!=`, `in`, `contains`, `startsWith`, and
+	// `endsWith`, so `"café" == "CAFE\u0301"` is true. Strings are case folded
+	// and accented Latin letters are composed like Unicode NFC normalization.
+	FoldStrings
+
+	// LenientEquals accepts a single `=` as `==`, e.g. `status = "active"`,
+	// which end users writing filters in URLs often type. The type checker
+	// warns about each use.
+	LenientEquals
+
+	// StrictSyntax makes the lexer report unterminated strings and quoted
+	// identifiers, malformed numbers like `1.2.3` or `1__0`, and a trailing
+	// `.` as syntax errors at the exact location of the problem rather than
+	// accepting them.
+	StrictSyntax
+
+	// PreserveTrivia makes the lexer record the whitespace before each token
+	// in `Token.Trivia`, so formatters can reproduce or normalize the original
+	// layout of an expression.
+	PreserveTrivia
+)
+
+func (f Flag) apply(c *config) {
+	switch f {
+	case StrictMode:
+		c.strict = true
+	case UnquotedStrings:
+		c.unquoted = true
+	case StrictNumbers:
+		c.strictNumbers = true
+	case DecimalNumbers:
+		c.decimal = true
+	case StrictTypes:
+		c.strictTypes = true
+	case LenientIndexes:
+		c.lenient = true
+	case KeepMapKeys:
+		c.keepMapKeys = true
+	case UndefinedValues:
+		c.undefined = true
+	case ThreeValuedLogic:
+		c.threeValued = true
+	case FoldStrings:
+		c.foldStrings = true
+	case LenientEquals:
+		c.lenientEquals = true
+	case StrictSyntax:
+		c.strictSyntax = true
+	case PreserveTrivia:
+		c.preserveTrivia = true
+	}
+}
+
+// optionFunc is an option which modifies the config, used for options which
+// take parameters.
+type optionFunc func(c *config)
+
+func (f optionFunc) apply(c *config) {
+	f(c)
+}
+
+// LayoutUnix is a special date layout for `WithDateLayouts` which parses
+// numbers (or numeric strings) as seconds since the Unix epoch.
+const LayoutUnix = "unix"
+
+// WithDateLayouts adds extra layouts used when converting strings into dates
+// and times, e.g. for `before` and `after`. Layouts use the Go time format,
+// like `time.RFC1123`, and are tried in order after the built-in RFC 3339
+// layouts. Use `LayoutUnix` to support epoch seconds.
+func WithDateLayouts(layouts ...string) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.dateLayouts = append(c.dateLayouts, layouts...)
+	})
+}
+
+// WithLocation sets the location used to parse dates and times which don't
+// include a time zone, like `2022-01-01T12:00:00`. The default is UTC.
+func WithLocation(loc *time.Location) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.location = loc
+	})
+}
+
+// WithClock sets the function used to get the current time for the `now`
+// identifier, which defaults to `time.Now`. This is useful for tests or
+// replaying past events.
+func WithClock(clock func() time.Time) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.clock = clock
+	})
+}
+
+// WithGlobals adds extra identifiers which are available to every run, like
+// the current user or feature flags, without modifying the input. Input
+// properties with the same name take priority over globals. Globals can be
+// accessed anywhere, including inside `where` clauses.
+func WithGlobals(globals map[string]any) InterpreterOption {
+	return optionFunc(func(c *config) {
+		if c.globals == nil {
+			c.globals = map[string]any{}
+		}
+		for k, v := range globals {
+			c.globals[k] = v
+		}
+	})
+}
+
+// WithTrace logs each node to `w` as it is evaluated along with its result,
+// which is useful to debug why an expression returned an unexpected value.
+// Each node is logged after the nodes it depends on, which are indented, e.g.
+// for `price > 20`:
+//
+//	  price => 12
+//	  20 => 20
+//	> => false
+func WithTrace(w io.Writer) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.trace = w
+	})
+}
+
+// WithAccessHook calls `hook` with the path of every property accessed from
+// the input while running, like `user.email`, so access can be audited or
+// denied. Array indexes are not part of the path, so `items[0].id` and
+// `items where id > 3` both access `items.id`. If the hook returns an error
+// then running fails with a `KindAccessDenied` error.
+func WithAccessHook(hook func(path string) error) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.access = hook
+	})
+}
+
+// WithStats records statistics about each run into `stats`, like the number
+// of nodes evaluated and the time taken, so expensive expressions can be
+// monitored. The stats are reset at the start of every run. Counting
+// allocations briefly stops the world, which adds some overhead to each run.
+// Interpreters are not safe for concurrent use, so use one `Stats` per
+// interpreter.
+func WithStats(stats *Stats) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.stats = stats
+	})
+}
+
+// WithLogger sends lifecycle events like parsing, type checking, and each run
+// to `logger` with structured fields like the duration and any error, e.g.
+// for audit trails of which filters ran. See `Logger`.
+func WithLogger(logger Logger) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.logger = logger
+	})
+}
+
+// WithParallel splits `where` clauses over arrays with at least `threshold`
+// items across `workers` goroutines, which defaults to `runtime.GOMAXPROCS`
+// when zero. Results are kept in the same order as the input. This only helps
+// for large arrays or expensive conditions, as starting goroutines has a
+// cost. It is ignored when using `WithTrace`, `WithStats`, `WithAccessHook`,
+// or `Explain`, which need to see each item in order.
+func WithParallel(threshold, workers int) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.parallelThreshold = threshold
+		c.parallelWorkers = workers
+	})
+}
+
+// WithMaxWhereResults limits the number of items each `where` clause may
+// return to `max`, protecting servers from expressions like `items where true`
+// which return entire huge datasets. Exceeding the limit is a
+// `KindLimitExceeded` error, unless `truncate` is set, in which case only the
+// first `max` matching items are returned. Maps have no order, so which of
+// their matching items are returned when truncated is arbitrary.
+func WithMaxWhereResults(max int, truncate bool) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.maxWhereResults = max
+		c.truncateWhere = truncate
+	})
+}
+
+// WithEnumStrings enables `UnquotedStrings` but only for the given values, so
+// `status == active` works while a typo like `status == actve` is still an
+// unknown property rather than silently becoming a string. Type checking or
+// `StrictMode` reports such typos along with the closest allowed values. Use
+// `Schema.EnumStrings` to allow the string values of a schema's `Enum`s.
+func WithEnumStrings(values ...string) InterpreterOption {
+	return optionFunc(func(c *config) {
+		c.unquoted = true
+		if c.enumStrings == nil {
+			c.enumStrings = map[string]bool{}
+		}
+		for _, v := range values {
+			c.enumStrings[v] = true
+		}
+	})
+}
+
+// unquotedString returns whether an unknown identifier should be treated as
+// a string, see `UnquotedStrings` and `WithEnumStrings`.
+func (c *config) unquotedString(name string) bool {
+	return c.unquoted && (c.enumStrings == nil || c.enumStrings[name])
+}
+
+// closestEnums returns the enum values closest to an unknown identifier, see
+// `WithEnumStrings`.
+func (c *config) closestEnums(name string) []string {
+	if c.enumStrings == nil {
+		return nil
+	}
+	best := len(name)/2 + 1
+	matches := []string{}
+	for v := range c.enumStrings {
+		d := editDistance(strings.ToLower(name), strings.ToLower(v))
+		if d < best {
+			best = d
+			matches = matches[:0]
+		}
+		if d == best {
+			matches = append(matches, v)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// config holds the settings from all passed options.
+type config struct {
+	strict         bool
+	unquoted       bool
+	strictNumbers  bool
+	decimal        bool
+	strictTypes    bool
+	lenient        bool
+	keepMapKeys    bool
+	undefined      bool
+	threeValued    bool
+	foldStrings    bool
+	lenientEquals  bool
+	strictSyntax   bool
+	preserveTrivia bool
+	dateLayouts    []string
+	location       *time.Location
+	clock          func() time.Time
+	globals        map[string]any
+	enumStrings    map[string]bool
+	trace          io.Writer
+	access         func(path string) error
+	stats          *Stats
+	logger         Logger
+
+	parallelThreshold int
+	parallelWorkers   int
+
+	maxWhereResults int
+	truncateWhere   bool
+}
+
+// newConfig creates a config from a list of options.
+func newConfig(options []InterpreterOption) config {
+	c := config{}
+	for _, opt := range options {
+		if opt != nil {
+			opt.apply(&c)
+		}
+	}
+	return c
+}
+
+// toTime converts a value into a time using the configured date layouts,
+// returning the zero time on failure.
+func (c *config) toTime(v any) time.Time {
+	return toTime(v, c.dateLayouts, c.location)
+}
@@ -0,0 +1,93 @@
+package mexpr
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// parallel returns whether a `where` clause over the items should be split
+// across goroutines, see `WithParallel`.
+func (i *interpreter) parallel(items []any) bool {
+	if i.parallelThreshold <= 0 || len(items) < i.parallelThreshold {
+		return false
+	}
+	// These need to see every node in order, so can't run in parallel.
+	return i.trace == nil && i.stats == nil && i.access == nil && i.explanations == nil
+}
+
+// fork creates an interpreter with a copy of the current run's state, so it
+// can evaluate items in another goroutine.
+func (i *interpreter) fork() *interpreter {
+	f := &interpreter{
+		config:  i.config,
+		ast:     i.ast,
+		root:    i.root,
+		scopes:  append([]scope(nil), i.scopes...),
+		now:     i.now,
+		buffers: buffered(i.ast, nil),
+		paths:   i.paths,
+	}
+	// Nested `where` clauses run in the worker's goroutine.
+	f.parallelThreshold = 0
+	return f
+}
+
+// filterParallel runs a `where` clause condition for each item, splitting the
+// items into one chunk per worker. It returns whether each item matched. If
+// more than one item fails in strict mode, the error for the first is
+// returned, the same as when running in order.
+func (i *interpreter) filterParallel(ast *Node, value any, items []any) ([]bool, Error) {
+	workers := i.parallelWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if i.now.IsZero() {
+		// Set the time now so `now` is consistent across workers.
+		clock := i.clock
+		if clock == nil {
+			clock = time.Now
+		}
+		i.now = clock()
+	}
+	matched := make([]bool, len(items))
+	errs := make([]Error, workers)
+	spent := make([]int, workers)
+	size := (len(items) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w*size < len(items); w++ {
+		start, end := w*size, (w+1)*size
+		if end > len(items) {
+			end = len(items)
+		}
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			// Split the remaining range items and iterations between workers.
+			worker := i.fork()
+			worker.items = maxRunItems - (maxRunItems-i.items)/workers
+			used := worker.items
+			defer func() { spent[w] = worker.items - used }()
+			for idx := start; idx < end; idx++ {
+				ok, err := worker.filter(ast, value, idx, items[idx])
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				matched[idx] = ok
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range spent {
+		if err := i.spend(ast, n); err != nil {
+			return nil, err
+		}
+	}
+	return matched, nil
+}
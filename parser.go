@@ -3,6 +3,8 @@ package mexpr
 import (
 	"math"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // NodeType defines the type of the abstract syntax tree node.
@@ -39,16 +41,54 @@ const (
 	NodeBefore
 	NodeAfter
 	NodeWhere
+	NodeCall
+	NodeExists
+	NodeFormat
+	NodeLimit
+	NodeOffset
+	NodeSumBy
+	NodeMinBy
+	NodeMaxBy
+	NodeArray
+	NodeRange
+	NodeSameDay
+	NodeLike
+	NodeInCidr
+
+	// NodeError replaces an invalid part of the expression when parsing with
+	// `ParsePartial`. Its value is the syntax error.
+	NodeError
+
+	// NodeSequence holds several expressions separated by `;` in its args. Its
+	// result is the result of the last one.
+	NodeSequence
+
+	// NodeCoalesce returns its right side if the left side is missing or
+	// `null`, like `a ?? 1`.
+	NodeCoalesce
 )
 
 // Node is a unit of the binary tree that makes up the abstract syntax tree.
 type Node struct {
-	Type   NodeType
+	Type NodeType
+
+	// Length and Offset locate the node's own token in the expression, e.g. the
+	// operator of `a + b`, which is used for error messages.
 	Length uint8
 	Offset uint16
-	Left   *Node
-	Right  *Node
-	Value  interface{}
+
+	// Start and End are the offsets of the whole sub-expression, e.g. all of
+	// `a + b`, including any parentheses around it. The end is exclusive.
+	Start uint16
+	End   uint16
+
+	Left  *Node
+	Right *Node
+	Value interface{}
+
+	// Args are the arguments for function calls or the items of array
+	// literals.
+	Args []*Node
 }
 
 // String converts the node to a string representation (basically the node name
@@ -107,6 +147,38 @@ func (n Node) String() string {
 		return "after"
 	case NodeWhere:
 		return "where"
+	case NodeCall:
+		return toString(n.Value) + "()"
+	case NodeExists:
+		return "exists"
+	case NodeFormat:
+		return "format"
+	case NodeLimit:
+		return "limit"
+	case NodeOffset:
+		return "offset"
+	case NodeSumBy:
+		return "sumBy"
+	case NodeMinBy:
+		return "minBy"
+	case NodeMaxBy:
+		return "maxBy"
+	case NodeArray:
+		return "[...]"
+	case NodeRange:
+		return ".."
+	case NodeSameDay:
+		return "sameDay"
+	case NodeLike:
+		return "like"
+	case NodeInCidr:
+		return "inCidr"
+	case NodeError:
+		return "error"
+	case NodeSequence:
+		return ";"
+	case NodeCoalesce:
+		return "??"
 	}
 
 	return ""
@@ -125,6 +197,11 @@ func (n Node) Dot(prefix string) string {
 		value += "\"" + prefix + n.String() + "\" -- \"" + prefix + "r" + n.Right.String() + "\"\n"
 		value += n.Right.Dot(prefix+"r") + "\n"
 	}
+	for i, arg := range n.Args {
+		argPrefix := prefix + "a" + strconv.Itoa(i)
+		value += "\"" + prefix + n.String() + "\" -- \"" + argPrefix + arg.String() + "\"\n"
+		value += arg.Dot(argPrefix) + "\n"
+	}
 	return value
 }
 
@@ -134,9 +211,14 @@ var bindingPowers = map[TokenType]int{
 	TokenOr:            1,
 	TokenAnd:           2,
 	TokenWhere:         3,
+	TokenPaging:        3,
+	TokenAggregate:     3,
 	TokenStringCompare: 4,
 	TokenComparison:    5,
 	TokenSlice:         5,
+	TokenCoalesce:      7,
+	TokenTransform:     8,
+	TokenRange:         8,
 	TokenAddSub:        10,
 	TokenMulDiv:        15,
 	TokenNot:           40,
@@ -150,6 +232,13 @@ var bindingPowers = map[TokenType]int{
 // generates a single literal node for the resutl. This prevents the interpreter
 // from needing to re-compute the value each time.
 func precomputeLiterals(offset uint16, nodeType NodeType, left, right *Node) (*Node, Error) {
+	if leftValue, ok := left.Value.(int64); ok {
+		if rightValue, ok := right.Value.(int64); ok {
+			if result, ok := checkedIntegerMath(nodeType, leftValue, rightValue); ok {
+				return &Node{Type: NodeLiteral, Offset: offset, Length: left.Length + right.Length, Value: result}, nil
+			}
+		}
+	}
 	leftValue, err := toNumber(left, left.Value)
 	if err != nil {
 		return nil, err
@@ -168,42 +257,66 @@ func precomputeLiterals(offset uint16, nodeType NodeType, left, right *Node) (*N
 		return &Node{Type: NodeLiteral, Offset: offset, Length: l, Value: leftValue * rightValue}, nil
 	case NodeDivide:
 		if rightValue == 0 {
-			return nil, NewError(offset, 1, "cannot divide by zero")
+			return nil, wrapError(newError(KindRuntime, offset, 1, "cannot divide by zero"), ErrDivideByZero)
 		}
 		return &Node{Type: NodeLiteral, Offset: offset, Length: l, Value: leftValue / rightValue}, nil
 	case NodeModulus:
-		if int(rightValue) == 0 {
-			return nil, NewError(offset, 1, "cannot divide by zero")
+		if rightValue == 0 {
+			return nil, wrapError(newError(KindRuntime, offset, 1, "cannot divide by zero"), ErrDivideByZero)
 		}
-		return &Node{Type: NodeLiteral, Offset: offset, Length: l, Value: float64(int(leftValue) % int(rightValue))}, nil
+		return &Node{Type: NodeLiteral, Offset: offset, Length: l, Value: math.Mod(leftValue, rightValue)}, nil
 	case NodePower:
 		return &Node{Type: NodeLiteral, Offset: offset, Length: l, Value: math.Pow(leftValue, rightValue)}, nil
 	}
-	return nil, NewError(offset, 1, "cannot precompute unknown operator")
+	return nil, newError(KindSyntax, offset, 1, "cannot precompute unknown operator")
 }
 
-// Parser takes a lexer and parses its tokens into an abstract syntax tree.
+// Parser takes a token source like a lexer and parses its tokens into an
+// abstract syntax tree.
 type Parser interface {
 	// Parse the expression and return the root node.
 	Parse() (*Node, Error)
 }
 
-// NewParser creates a new parser that uses the given lexer to get and process
-// tokens into an abstract syntax tree.
-func NewParser(lexer Lexer) Parser {
+// NewParser creates a new parser that uses the given lexer or other token
+// source to get and process tokens into an abstract syntax tree. Options which change how math works,
+// like `DecimalNumbers`, should be passed to both the parser and interpreter.
+func NewParser(lexer TokenSource, options ...InterpreterOption) Parser {
+	c := newConfig(options)
 	return &parser{
 		lexer: lexer,
+		// Literal math must be exact for decimals and use integer math for
+		// strict numbers, so leave it to the interpreter.
+		precompute:    !c.decimal && !c.strictNumbers,
+		lenientEquals: c.lenientEquals,
+		logger:        c.logger,
 	}
 }
 
 // parser is an implementation of a Pratt or top-down operator precedence parser
 type parser struct {
-	lexer Lexer
-	token *Token
+	lexer         TokenSource
+	token         *Token
+	precompute    bool
+	lenientEquals bool
+	logger        Logger
+
+	// recover enables error recovery for `ParsePartial`, which collects syntax
+	// errors and replaces invalid parts of the expression with error nodes.
+	recover bool
+	errors  []Error
 }
 
 func (p *parser) advance() Error {
 	t, err := p.lexer.Next()
+	for err != nil && p.recover {
+		// Skip invalid input as long as the lexer makes progress.
+		if len(p.errors) > 0 && err.Offset() <= p.errors[len(p.errors)-1].Offset() {
+			break
+		}
+		p.errors = append(p.errors, err)
+		t, err = p.lexer.Next()
+	}
 	if err != nil {
 		return err
 	}
@@ -211,8 +324,46 @@ func (p *parser) advance() Error {
 	return nil
 }
 
+// skip returns the error, or when recovering records it and returns nil so
+// parsing continues as if the input were valid, e.g. treating `=` as `==`.
+func (p *parser) skip(err Error) Error {
+	if !p.recover {
+		return err
+	}
+	p.record(err)
+	return nil
+}
+
+// record adds a recovered error, ignoring follow-on errors at the same
+// location like a missing `)` where the expression ends.
+func (p *parser) record(err Error) {
+	if len(p.errors) > 0 && p.errors[len(p.errors)-1].Offset() == err.Offset() {
+		return
+	}
+	p.errors = append(p.errors, err)
+}
+
+// fail returns the error, or when recovering records it and returns an error
+// node in place of the invalid part of the expression. The left node, if
+// any, is the valid part before the error.
+func (p *parser) fail(err Error, left *Node) (*Node, Error) {
+	if !p.recover {
+		return nil, err
+	}
+	p.record(err)
+	return &Node{Type: NodeError, Offset: err.Offset(), Length: err.Length(), Left: left, Value: err}, nil
+}
+
 func (p *parser) parse(bindingPower int) (*Node, Error) {
 	leftToken := *p.token
+	if p.recover {
+		switch leftToken.Type {
+		case TokenRightParen, TokenRightBracket, TokenComma, TokenEOF:
+			// Missing operand like `(a + )`, so leave the closing token for the
+			// enclosing expression.
+			return p.nud(&leftToken)
+		}
+	}
 	if err := p.advance(); err != nil {
 		return nil, err
 	}
@@ -250,19 +401,23 @@ func (p *parser) ensure(result *Node, err Error, typ TokenType) (*Node, Error) {
 		return result, nil
 	}
 
-	extra := ""
+	err = newError(KindSyntax, p.token.Offset, p.token.Length, "expected %s but found %s", typ, p.token.Type)
 	if typ == TokenEOF && p.token.Type == TokenIdentifier {
 		switch p.token.Value {
 		case "startswith", "beginswith", "beginsWith", "hasprefix", "hasPrefix":
-			extra = " (did you mean `startsWith`?)"
+			err = withSuggestions(err, "startsWith")
 		case "endswith", "hassuffix", "hasSuffix":
-			extra = " (did you mean `endsWith`?)"
+			err = withSuggestions(err, "endsWith")
 		case "contains":
-			extra = " (did you mean `in`?)"
+			err = withSuggestions(err, "in")
 		}
 	}
 
-	return nil, NewError(p.token.Offset, p.token.Length, "expected %s but found %s%s", typ, p.token.Type, extra)
+	// When recovering, keep the result as if the expected token was present.
+	if err := p.skip(err); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // nud: null denotation. These nodes have no left context and only
@@ -270,18 +425,30 @@ func (p *parser) ensure(result *Node, err Error, typ TokenType) (*Node, Error) {
 // minus.
 func (p *parser) nud(t *Token) (*Node, Error) {
 	switch t.Type {
-	case TokenIdentifier:
-		return &Node{Type: NodeIdentifier, Value: t.Value, Offset: t.Offset, Length: t.Length}, nil
+	case TokenIdentifier, TokenStringCompare, TokenTransform, TokenPaging, TokenAggregate:
+		// Infix keywords like `format` or `like` at the start of an expression
+		// are treated as normal identifiers, e.g. `format == "json"`.
+		return &Node{Type: NodeIdentifier, Value: t.Value, Offset: t.Offset, Length: t.Length, Start: t.Offset, End: t.Offset + uint16(t.Length)}, nil
 	case TokenNumber:
 		f, err := strconv.ParseFloat(t.Value, 64)
 		if err != nil {
-			return nil, NewError(p.token.Offset, p.token.Length, err.Error())
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "invalid number %s", t.Value), nil)
 		}
-		return &Node{Type: NodeLiteral, Value: f, Offset: t.Offset, Length: t.Length}, nil
+		if math.Abs(f) >= 1<<53 {
+			// Floats can't represent every integer this large, so keep large
+			// integer literals like IDs exact.
+			if n, err := strconv.ParseInt(strings.ReplaceAll(t.Value, "_", ""), 10, 64); err == nil {
+				return &Node{Type: NodeLiteral, Value: n, Offset: t.Offset, Length: t.Length, Start: t.Offset, End: t.Offset + uint16(t.Length)}, nil
+			}
+		}
+		return &Node{Type: NodeLiteral, Value: f, Offset: t.Offset, Length: t.Length, Start: t.Offset, End: t.Offset + uint16(t.Length)}, nil
 	case TokenString:
-		return &Node{Type: NodeLiteral, Value: t.Value, Offset: t.Offset, Length: t.Length}, nil
+		return &Node{Type: NodeLiteral, Value: t.Value, Offset: t.Offset, Length: t.Length, Start: t.Offset, End: t.Offset + uint16(t.Length)}, nil
 	case TokenLeftParen:
 		result, err := p.parse(0)
+		if err == nil && result != nil && p.token.Type == TokenRightParen {
+			result.Start, result.End = t.Offset, p.token.Offset+uint16(p.token.Length)
+		}
 		return p.ensure(result, err, TokenRightParen)
 	case TokenNot:
 		offset := t.Offset
@@ -289,7 +456,26 @@ func (p *parser) nud(t *Token) (*Node, Error) {
 		if err != nil {
 			return nil, err
 		}
+		if result == nil {
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "missing right operand"), nil)
+		}
 		return &Node{Type: NodeNot, Offset: offset, Length: uint8(t.Offset + uint16(t.Length) - offset), Right: result}, nil
+	case TokenExists:
+		switch p.token.Type {
+		case TokenIdentifier, TokenNumber, TokenString, TokenLeftParen, TokenLeftBracket, TokenNot, TokenExists, TokenAddSub, TokenSlice:
+		default:
+			// Without an operand it's a normal identifier, e.g. `exists == 1`.
+			return &Node{Type: NodeIdentifier, Value: t.Value, Offset: t.Offset, Length: t.Length, Start: t.Offset, End: t.Offset + uint16(t.Length)}, nil
+		}
+		offset := t.Offset
+		result, err := p.parse(bindingPowers[TokenNot])
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "missing right operand"), nil)
+		}
+		return &Node{Type: NodeExists, Offset: offset, Length: uint8(t.Offset + uint16(t.Length) - offset), Right: result}, nil
 	case TokenAddSub:
 		value := t.Value
 		offset := t.Offset
@@ -297,6 +483,9 @@ func (p *parser) nud(t *Token) (*Node, Error) {
 		if err != nil {
 			return nil, err
 		}
+		if result == nil {
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "missing right operand"), nil)
+		}
 		return &Node{Type: NodeSign, Value: value, Offset: offset, Length: uint8(t.Offset + uint16(t.Length) - offset), Right: result}, nil
 	case TokenSlice:
 		offset := t.Offset
@@ -304,16 +493,31 @@ func (p *parser) nud(t *Token) (*Node, Error) {
 		if err != nil {
 			return nil, err
 		}
-		// Create a dummy left node with value 0, the start of the slice. This also
-		// sets the parent node's value to a pre-allocated list of [0, 0] which is
-		// used later by the interpreter. It prevents additional allocations.
-		return &Node{Type: NodeSlice, Offset: offset, Length: uint8(t.Offset + uint16(t.Length) - offset), Left: &Node{Type: NodeLiteral, Value: 0.0, Offset: offset}, Right: result, Value: []interface{}{0.0, 0.0}}, nil
+		if result == nil {
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "missing right operand"), nil)
+		}
+		// Create a dummy left node with value 0, the start of the slice.
+		return &Node{Type: NodeSlice, Offset: offset, Length: uint8(t.Offset + uint16(t.Length) - offset), Left: &Node{Type: NodeLiteral, Value: 0.0, Offset: offset}, Right: result}, nil
+	case TokenLeftBracket:
+		items, err := p.parseList(TokenRightBracket)
+		if err != nil {
+			return nil, err
+		}
+		array := &Node{Type: NodeArray, Offset: t.Offset, Length: uint8(p.token.Offset + uint16(p.token.Length) - t.Offset), Start: t.Offset, End: p.token.Offset + uint16(p.token.Length), Args: items}
+		return p.ensure(array, nil, TokenRightBracket)
 	case TokenRightParen:
-		return nil, NewError(t.Offset, t.Length, "unexpected right-paren")
+		return p.fail(newError(KindSyntax, t.Offset, t.Length, "unexpected right-paren"), nil)
 	case TokenRightBracket:
-		return nil, NewError(t.Offset, t.Length, "unexpected right-bracket")
+		return p.fail(newError(KindSyntax, t.Offset, t.Length, "unexpected right-bracket"), nil)
 	case TokenEOF:
-		return nil, NewError(t.Offset, t.Length, "incomplete expression, EOF found")
+		return p.fail(newError(KindSyntax, t.Offset, t.Length, "incomplete expression, EOF found"), nil)
+	case TokenComparison:
+		if t.Value == "=" {
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "= should be =="), nil)
+		}
+	}
+	if p.recover {
+		return p.fail(newError(KindSyntax, t.Offset, t.Length, "unexpected %s", t.Type), nil)
 	}
 	return nil, nil
 }
@@ -327,9 +531,11 @@ func (p *parser) newNodeParseRight(left *Node, t *Token, typ NodeType, bindingPo
 		return nil, err
 	}
 	if right == nil {
-		return nil, NewError(t.Offset, t.Length, "missing right operand")
+		if right, err = p.fail(newError(KindSyntax, t.Offset, t.Length, "missing right operand"), nil); err != nil {
+			return nil, err
+		}
 	}
-	return &Node{Type: typ, Offset: offset, Length: uint8(p.token.Offset + uint16(p.token.Length) - offset), Left: left, Right: right}, nil
+	return &Node{Type: typ, Offset: offset, Length: t.Length, Left: left, Right: right}, nil
 }
 
 // led: left denotation. These tokens produce nodes that operate on two operands
@@ -364,11 +570,15 @@ func (p *parser) led(t *Token, n *Node) (*Node, Error) {
 			return nil, err
 		}
 		if right == nil {
-			return nil, NewError(t.Offset, t.Length, "missing right operand")
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "missing right operand"), n)
 		}
-		if n.Type == NodeLiteral && right.Type == NodeLiteral {
+		if p.precompute && n.Type == NodeLiteral && right.Type == NodeLiteral {
 			if !(isString(n.Value) || isString(right.Value)) {
-				return precomputeLiterals(offset, nodeType, n, right)
+				literal, err := precomputeLiterals(offset, nodeType, n, right)
+				if literal != nil {
+					literal.Start, literal.End = n.Start, right.End
+				}
+				return literal, err
 			}
 		}
 		return &Node{Type: nodeType, Offset: offset, Length: uint8(t.Offset + uint16(t.Length) - offset), Left: n, Right: right, Value: 0.0}, nil
@@ -387,12 +597,27 @@ func (p *parser) led(t *Token, n *Node) (*Node, Error) {
 			nodeType = NodeGreaterThan
 		case ">=":
 			nodeType = NodeGreaterThanEqual
+		case "=":
+			if !p.lenientEquals {
+				if err := p.skip(newError(KindSyntax, t.Offset, t.Length, "= should be ==")); err != nil {
+					return nil, err
+				}
+			}
+			node, err := p.newNodeParseRight(n, t, NodeEqual, bindingPowers[t.Type])
+			if err != nil {
+				return nil, err
+			}
+			// Mark the node so the type checker can warn about it.
+			node.Value = "="
+			return node, nil
 		}
 		return p.newNodeParseRight(n, t, nodeType, bindingPowers[t.Type])
 	case TokenAnd:
 		return p.newNodeParseRight(n, t, NodeAnd, bindingPowers[t.Type])
 	case TokenOr:
 		return p.newNodeParseRight(n, t, NodeOr, bindingPowers[t.Type])
+	case TokenCoalesce:
+		return p.newNodeParseRight(n, t, NodeCoalesce, bindingPowers[t.Type])
 	case TokenStringCompare:
 		var nodeType NodeType
 		switch t.Value {
@@ -408,36 +633,215 @@ func (p *parser) led(t *Token, n *Node) (*Node, Error) {
 			nodeType = NodeBefore
 		case "after":
 			nodeType = NodeAfter
+		case "sameDay":
+			nodeType = NodeSameDay
+		case "like":
+			nodeType = NodeLike
+		case "inCidr":
+			nodeType = NodeInCidr
 		}
 		return p.newNodeParseRight(n, t, nodeType, bindingPowers[t.Type])
 	case TokenWhere:
 		return p.newNodeParseRight(n, t, NodeWhere, bindingPowers[t.Type])
+	case TokenTransform:
+		return p.newNodeParseRight(n, t, NodeFormat, bindingPowers[t.Type])
+	case TokenPaging:
+		if t.Value == "limit" {
+			return p.newNodeParseRight(n, t, NodeLimit, bindingPowers[t.Type])
+		}
+		offset, err := p.newNodeParseRight(n, t, NodeOffset, bindingPowers[t.Type])
+		if err != nil {
+			return nil, err
+		}
+		if n.Type == NodeLimit && n.End == 0 {
+			// Rewrite `items limit 10 offset 20` so the offset is applied first,
+			// matching `items offset 20 limit 10`. Parentheses set the span, so
+			// `(items limit 10) offset 20` still applies the limit first.
+			offset.Left = n.Left
+			n.Left = offset
+			return n, nil
+		}
+		return offset, nil
+	case TokenAggregate:
+		nodeType := NodeSumBy
+		switch t.Value {
+		case "minBy":
+			nodeType = NodeMinBy
+		case "maxBy":
+			nodeType = NodeMaxBy
+		}
+		// Stop before comparisons so `items sumBy price > 10` compares the sum.
+		return p.newNodeParseRight(n, t, nodeType, bindingPowers[TokenComparison])
+	case TokenRange:
+		return p.newNodeParseRight(n, t, NodeRange, bindingPowers[t.Type])
 	case TokenDot:
+		if p.token.Type == TokenString {
+			// Quoted property names like `foo."a b"`.
+			p.token.Type = TokenIdentifier
+		}
 		return p.newNodeParseRight(n, t, NodeFieldSelect, bindingPowers[t.Type])
 	case TokenLeftBracket:
 		n, err := p.newNodeParseRight(n, t, NodeArrayIndex, 0)
+		if err == nil && p.token.Type == TokenRightBracket {
+			spans(n.Left)
+			n.Start, n.End = n.Left.Start, p.token.Offset+uint16(p.token.Length)
+		}
 		return p.ensure(n, err, TokenRightBracket)
+	case TokenLeftParen:
+		if n.Type != NodeIdentifier {
+			return p.fail(newError(KindSyntax, t.Offset, t.Length, "unexpected left-paren"), n)
+		}
+		if functions[n.Value.(string)] == nil {
+			if err := p.skip(newNodeError(KindSyntax, n, "unknown function %s", n.Value)); err != nil {
+				return nil, err
+			}
+		}
+		args, err := p.parseList(TokenRightParen)
+		if err != nil {
+			return nil, err
+		}
+		call := &Node{Type: NodeCall, Offset: n.Offset, Length: uint8(p.token.Offset + uint16(p.token.Length) - n.Offset), Start: n.Start, End: p.token.Offset + uint16(p.token.Length), Value: n.Value, Args: args}
+		return p.ensure(call, nil, TokenRightParen)
 	case TokenSlice:
 		if p.token.Type == TokenRightBracket {
-			// This sets the parent node's value to a pre-allocated list of [0, 0]
-			// which is used later by the interpreter. It prevents additional
-			// allocations.
-			return &Node{Type: NodeSlice, Offset: t.Offset, Length: t.Length, Left: n, Right: &Node{Type: NodeLiteral, Offset: t.Offset, Value: -1.0}, Value: []interface{}{0.0, 0.0}}, nil
+			// An open-ended slice like `items[1:]` ends at the last item.
+			return &Node{Type: NodeSlice, Offset: t.Offset, Length: t.Length, Left: n, Right: &Node{Type: NodeLiteral, Offset: t.Offset, Value: -1.0}}, nil
 		}
-		nn, err := p.newNodeParseRight(n, t, NodeSlice, bindingPowers[t.Type])
+		return p.newNodeParseRight(n, t, NodeSlice, bindingPowers[t.Type])
+	}
+	return p.fail(newError(KindSyntax, t.Offset, t.Length, "unexpected token %s", t.Type), n)
+}
+
+// parseList parses comma-separated expressions up to the `end` token, which
+// is left for the caller to consume. A trailing comma is allowed.
+func (p *parser) parseList(end TokenType) ([]*Node, Error) {
+	var items []*Node
+	for p.token.Type != end {
+		start := *p.token
+		item, err := p.parse(0)
 		if err != nil {
 			return nil, err
 		}
-		nn.Value = []interface{}{0.0, 0.0}
-		return nn, nil
+		if item == nil {
+			return nil, newError(KindSyntax, start.Offset, start.Length, "unexpected %s", start.Type)
+		}
+		items = append(items, item)
+		if p.token.Type != TokenComma {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
 	}
-	return nil, NewError(t.Offset, t.Length, "unexpected token %s", t.Type)
+	return items, nil
 }
 
 func (p *parser) Parse() (*Node, Error) {
+	if p.logger == nil {
+		return p.parseAll()
+	}
+	start := time.Now()
+	n, err := p.parseAll()
+	fields := []any{}
+	if l, ok := p.lexer.(*lexer); ok {
+		fields = append(fields, "expression", l.expression)
+	}
+	if err == nil {
+		fields = append(fields, "hash", hashAST(n))
+	}
+	logEvent(p.logger, LogParse, start, err, fields...)
+	return n, err
+}
+
+// parseAll parses the whole expression up to the end of the input.
+func (p *parser) parseAll() (*Node, Error) {
 	if err := p.advance(); err != nil {
 		return nil, err
 	}
 	n, err := p.parse(0)
-	return p.ensure(n, err, TokenEOF)
+	if err == nil && n != nil && p.token.Type == TokenSemicolon {
+		n, err = p.parseSequence(n)
+	}
+	n, err = p.ensure(n, err, TokenEOF)
+	if n != nil {
+		spans(n)
+	}
+	return n, err
+}
+
+// parseSequence parses the rest of a list of expressions separated by `;`,
+// e.g. `a; b; c`. A trailing `;` is allowed.
+func (p *parser) parseSequence(first *Node) (*Node, Error) {
+	sequence := &Node{Type: NodeSequence, Offset: p.token.Offset, Length: p.token.Length, Args: []*Node{first}}
+	for p.token.Type == TokenSemicolon {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.token.Type == TokenEOF || p.token.Type == TokenSemicolon {
+			continue
+		}
+		start := *p.token
+		n, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			if n, err = p.fail(newError(KindSyntax, start.Offset, start.Length, "incomplete expression, %s found", start.Type), nil); err != nil {
+				return nil, err
+			}
+		}
+		sequence.Args = append(sequence.Args, n)
+	}
+	if len(sequence.Args) == 1 {
+		return first, nil
+	}
+	return sequence, nil
+}
+
+// ParsePartial parses an expression like `Parse` but recovers from syntax
+// errors, returning a best-effort AST along with all syntax errors found.
+// Invalid parts of the expression are replaced by `NodeError` nodes, which
+// fail when run or type checked, so live-editing UIs can keep analyzing and
+// completing the rest of the expression while the user types.
+func ParsePartial(expression string, options ...InterpreterOption) (*Node, []Error) {
+	p := NewParser(NewLexer(expression, options...), options...).(*parser)
+	p.recover = true
+	n, err := p.Parse()
+	if err != nil {
+		// The error could not be recovered from, e.g. a lexer error which
+		// doesn't make progress.
+		p.errors = append(p.errors, err)
+		n = &Node{Type: NodeError, Offset: err.Offset(), Length: err.Length(), Value: err}
+		spans(n)
+	}
+	return n, p.errors
+}
+
+// spans sets the start and end of nodes which span their children, e.g.
+// from `a` to `b` for `a + b`. Nodes with a known span, like those in
+// parentheses, are left as-is.
+func spans(n *Node) {
+	if n == nil {
+		return
+	}
+	spans(n.Left)
+	spans(n.Right)
+	for _, arg := range n.Args {
+		spans(arg)
+	}
+	if n.End != 0 {
+		return
+	}
+	n.Start, n.End = n.Offset, n.Offset+uint16(n.Length)
+	for _, child := range append([]*Node{n.Left, n.Right}, n.Args...) {
+		if child == nil || child.End == 0 {
+			continue
+		}
+		if child.Start < n.Start {
+			n.Start = child.Start
+		}
+		if child.End > n.End {
+			n.End = child.End
+		}
+	}
 }
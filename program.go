@@ -0,0 +1,146 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// Program is a set of named expressions which are parsed and type checked
+// together and then run against each input in one pass, e.g. to compute
+// several derived fields or filters for each record. It is safe for
+// concurrent use.
+type Program struct {
+	names       []string
+	expressions map[string]string
+	asts        []*Node
+	options     []InterpreterOption
+
+	// pool holds slices of interpreters, one per expression, so they can be
+	// reused between runs.
+	pool sync.Pool
+}
+
+// ProgramError is an error from one of the expressions in a program, or from
+// one of the named expressions given to e.g. `FilterFromQuery`. Use
+// `Expression` with the pretty print methods to show where the error is.
+type ProgramError struct {
+	// Name of the expression which failed.
+	Name string
+
+	// Expression is the source of the expression which failed.
+	Expression string
+
+	// Err is the underlying error.
+	Err Error
+}
+
+func (e *ProgramError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, so `errors.Is` and `errors.As` work
+// with program errors.
+func (e *ProgramError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON encodes the underlying error as JSON along with the name of the
+// expression which failed.
+func (e *ProgramError) MarshalJSON() ([]byte, error) {
+	var result errorJSON
+	if err, ok := e.Err.(*exprErr); ok {
+		result = err.toJSON()
+	} else {
+		start, end := e.Err.Span()
+		result = errorJSON{Message: e.Err.Error(), Kind: e.Err.Kind().String(), Offset: e.Err.Offset(), Length: e.Err.Length(), Start: start, End: end}
+	}
+	result.Name = e.Name
+	return json.Marshal(result)
+}
+
+func (e *ProgramError) Offset() uint16 {
+	return e.Err.Offset()
+}
+
+func (e *ProgramError) Length() uint8 {
+	return e.Err.Length()
+}
+
+func (e *ProgramError) End() uint16 {
+	return e.Err.End()
+}
+
+func (e *ProgramError) Span() (uint16, uint16) {
+	return e.Err.Span()
+}
+
+func (e *ProgramError) Kind() ErrorKind {
+	return e.Err.Kind()
+}
+
+func (e *ProgramError) Pretty(source string) string {
+	return e.Name + ": " + e.Err.Pretty(source)
+}
+
+func (e *ProgramError) PrettyColor(source string) string {
+	return e.Name + ": " + e.Err.PrettyColor(source)
+}
+
+func (e *ProgramError) PrettyContext(source string, context int) string {
+	return e.Name + ": " + e.Err.PrettyContext(source, context)
+}
+
+// Compile parses a set of named expressions into a program. If `types` is
+// passed, every expression is type checked against it like with `Parse`. If
+// any expression fails then a `*ProgramError` is returned for the first one
+// by name.
+func Compile(expressions map[string]string, types any, options ...InterpreterOption) (*Program, Error) {
+	p := &Program{
+		names:       make([]string, 0, len(expressions)),
+		expressions: make(map[string]string, len(expressions)),
+		options:     options,
+	}
+	for name, expression := range expressions {
+		p.names = append(p.names, name)
+		p.expressions[name] = expression
+	}
+	sort.Strings(p.names)
+	for _, name := range p.names {
+		ast, err := Parse(expressions[name], types, options...)
+		if err != nil {
+			return nil, &ProgramError{Name: name, Expression: expressions[name], Err: err}
+		}
+		p.asts = append(p.asts, ast)
+	}
+	return p, nil
+}
+
+// Names returns the names of the program's expressions in sorted order.
+func (p *Program) Names() []string {
+	return append([]string(nil), p.names...)
+}
+
+// Run evaluates every expression against the input and returns the results
+// by name. If any expression fails then a `*ProgramError` is returned.
+func (p *Program) Run(input any) (map[string]any, Error) {
+	interpreters, ok := p.pool.Get().(*[]Interpreter)
+	if !ok {
+		created := make([]Interpreter, len(p.asts))
+		for idx, ast := range p.asts {
+			created[idx] = NewInterpreter(ast, p.options...)
+		}
+		interpreters = &created
+	}
+	defer p.pool.Put(interpreters)
+
+	results := make(map[string]any, len(p.names))
+	for idx, name := range p.names {
+		result, err := (*interpreters)[idx].Run(input)
+		if err != nil {
+			return nil, &ProgramError{Name: name, Expression: p.expressions[name], Err: err}
+		}
+		results[name] = result
+	}
+	return results, nil
+}
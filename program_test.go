@@ -0,0 +1,59 @@
+package mexpr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	types := map[string]any{"price": 1.0, "quantity": 1, "tags": []any{"a"}}
+	program, err := Compile(map[string]string{
+		"total":    `price * quantity`,
+		"discount": `"sale" in tags and price > 10`,
+		"label":    `"x" + quantity`,
+	}, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := program.Names(); !reflect.DeepEqual(names, []string{"discount", "label", "total"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	for _, tc := range []struct {
+		input    map[string]any
+		expected map[string]any
+	}{
+		{
+			input:    map[string]any{"price": 20.0, "quantity": 2, "tags": []any{"sale"}},
+			expected: map[string]any{"total": 40.0, "discount": true, "label": "x2"},
+		},
+		{
+			input:    map[string]any{"price": 5.0, "quantity": 3, "tags": []any{}},
+			expected: map[string]any{"total": 15.0, "discount": false, "label": "x3"},
+		},
+	} {
+		results, err := program.Run(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(results, tc.expected) {
+			t.Fatalf("expected %v but found %v", tc.expected, results)
+		}
+	}
+
+	// Errors include the name of the failing expression.
+	_, err = Compile(map[string]string{"ok": `price > 1`, "bad": `missing > 1`}, types)
+	if err == nil || !strings.HasPrefix(err.Error(), "bad: ") || err.(*ProgramError).Expression != `missing > 1` {
+		t.Fatalf("expected error for bad expression but found %v", err)
+	}
+
+	program, err = Compile(map[string]string{"ratio": `price / quantity`}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = program.Run(map[string]any{"price": 1.0, "quantity": 0.0})
+	if err == nil || err.Kind() != KindRuntime || err.Error() != "ratio: cannot divide by zero" {
+		t.Fatalf("expected divide by zero error but found %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+// Package rules is a small rules engine built on mexpr. Each rule has a
+// boolean condition, a priority, and labels or an action to apply when the
+// condition matches an input.
+//
+//	engine, err := rules.New([]rules.Rule{
+//		{Name: "vip", Priority: 10, Condition: `total > 1000`, Labels: []string{"priority"}},
+//		{Name: "sale", Condition: `"sale" in tags`, Labels: []string{"discount"}},
+//	}, nil)
+//	matched, err := engine.Evaluate(order, rules.AllMatches)
+//	fmt.Println(rules.Labels(matched))
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/danielgtaylor/mexpr"
+)
+
+// Mode describes which matching rules are returned by `Evaluate`.
+type Mode int
+
+const (
+	// FirstMatch returns only the highest priority matching rule.
+	FirstMatch Mode = iota
+
+	// AllMatches returns every matching rule.
+	AllMatches
+)
+
+// Rule is a named condition along with what to do when it matches.
+type Rule struct {
+	// Name identifies the rule in errors.
+	Name string
+
+	// Priority orders the rules, with higher priorities evaluated first. Rules
+	// with the same priority are evaluated in the order they were added.
+	Priority int
+
+	// Condition is an mexpr expression which must return a boolean. A `nil`
+	// result, e.g. for a missing property, does not match.
+	Condition string
+
+	// Labels are applied to the input when the rule matches, see `Labels`.
+	Labels []string
+
+	// Action is called with the input when the rule matches, if set. An error
+	// stops evaluating any further rules.
+	Action func(input any) error
+}
+
+// Engine evaluates a set of rules against inputs. It is safe for concurrent
+// use.
+type Engine struct {
+	rules   []*Rule
+	asts    []*mexpr.Node
+	options []mexpr.InterpreterOption
+
+	// pool holds slices of interpreters, one per rule, so they can be reused
+	// between evaluations.
+	pool sync.Pool
+}
+
+// New creates an engine from a set of rules, parsing each condition. If
+// `types` is passed, conditions are type checked against it like with
+// `mexpr.Parse`. The options are used to parse and run every condition.
+func New(rules []Rule, types any, options ...mexpr.InterpreterOption) (*Engine, error) {
+	e := &Engine{options: options}
+	for idx := range rules {
+		rule := rules[idx]
+		e.rules = append(e.rules, &rule)
+	}
+	sort.SliceStable(e.rules, func(a, b int) bool {
+		return e.rules[a].Priority > e.rules[b].Priority
+	})
+	for _, rule := range e.rules {
+		ast, err := mexpr.Parse(rule.Condition, types, options...)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		e.asts = append(e.asts, ast)
+	}
+	return e, nil
+}
+
+// Rules returns the engine's rules in the order they are evaluated.
+func (e *Engine) Rules() []*Rule {
+	return append([]*Rule(nil), e.rules...)
+}
+
+// Evaluate runs the rules against the input in priority order, calling the
+// action of each matching rule, and returns the matching rules. With
+// `FirstMatch` evaluation stops at the first match.
+func (e *Engine) Evaluate(input any, mode Mode) ([]*Rule, error) {
+	interpreters, ok := e.pool.Get().(*[]mexpr.Interpreter)
+	if !ok {
+		created := make([]mexpr.Interpreter, len(e.asts))
+		for idx, ast := range e.asts {
+			created[idx] = mexpr.NewInterpreter(ast, e.options...)
+		}
+		interpreters = &created
+	}
+	defer e.pool.Put(interpreters)
+
+	var matched []*Rule
+	for idx, rule := range e.rules {
+		result, err := (*interpreters)[idx].Run(input)
+		if err != nil {
+			return matched, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if result == nil || result == mexpr.Undefined {
+			continue
+		}
+		ok, isBool := result.(bool)
+		if !isBool {
+			return matched, fmt.Errorf("rule %s: condition must return a boolean but found %v", rule.Name, result)
+		}
+		if !ok {
+			continue
+		}
+		matched = append(matched, rule)
+		if rule.Action != nil {
+			if err := rule.Action(input); err != nil {
+				return matched, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+		if mode == FirstMatch {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// Labels returns the unique labels of the rules in order.
+func Labels(rules []*Rule) []string {
+	labels := []string{}
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		for _, label := range rule.Labels {
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
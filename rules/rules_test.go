@@ -0,0 +1,99 @@
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danielgtaylor/mexpr"
+)
+
+func names(rules []*Rule) []string {
+	result := []string{}
+	for _, rule := range rules {
+		result = append(result, rule.Name)
+	}
+	return result
+}
+
+func TestEvaluate(t *testing.T) {
+	var actions []string
+	action := func(name string) func(any) error {
+		return func(input any) error {
+			actions = append(actions, name)
+			return nil
+		}
+	}
+	engine, err := New([]Rule{
+		{Name: "sale", Condition: `"sale" in tags`, Labels: []string{"discount"}, Action: action("sale")},
+		{Name: "vip", Priority: 10, Condition: `total > 1000`, Labels: []string{"priority", "discount"}, Action: action("vip")},
+		{Name: "large", Priority: 5, Condition: `items.length > 3`, Labels: []string{"review"}},
+		{Name: "missing", Condition: `coupon.code == "X"`},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := names(engine.Rules()); !reflect.DeepEqual(order, []string{"vip", "large", "sale", "missing"}) {
+		t.Fatalf("unexpected rule order %v", order)
+	}
+
+	input := map[string]any{"total": 1500.0, "tags": []any{"sale"}, "items": []any{1, 2}}
+
+	matched, err := engine.Evaluate(input, AllMatches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names(matched), []string{"vip", "sale"}) {
+		t.Fatalf("unexpected matches %v", names(matched))
+	}
+	if labels := Labels(matched); !reflect.DeepEqual(labels, []string{"priority", "discount"}) {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	if !reflect.DeepEqual(actions, []string{"vip", "sale"}) {
+		t.Fatalf("unexpected actions %v", actions)
+	}
+
+	actions = nil
+	matched, err = engine.Evaluate(input, FirstMatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names(matched), []string{"vip"}) || !reflect.DeepEqual(actions, []string{"vip"}) {
+		t.Fatalf("unexpected first match %v with actions %v", names(matched), actions)
+	}
+
+	matched, err = engine.Evaluate(map[string]any{"total": 1.0, "tags": []any{}, "items": []any{}}, AllMatches)
+	if err != nil || len(matched) != 0 {
+		t.Fatalf("expected no matches but found %v (%v)", names(matched), err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New([]Rule{{Name: "bad", Condition: `total >`}}, nil)
+	var exprErr mexpr.Error
+	if err == nil || !strings.HasPrefix(err.Error(), "rule bad: ") || !errors.As(err, &exprErr) || exprErr.Kind() != mexpr.KindSyntax {
+		t.Fatalf("expected syntax error but found %v", err)
+	}
+
+	engine, err := New([]Rule{{Name: "number", Condition: `total + 1`}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Evaluate(map[string]any{"total": 1}, AllMatches); err == nil || !strings.Contains(err.Error(), "must return a boolean") {
+		t.Fatalf("expected boolean error but found %v", err)
+	}
+
+	failed := errors.New("failed")
+	engine, err = New([]Rule{
+		{Name: "first", Condition: `1 == 1`, Action: func(any) error { return failed }},
+		{Name: "second", Condition: `1 == 1`},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, err := engine.Evaluate(nil, AllMatches)
+	if !errors.Is(err, failed) || len(matched) != 1 {
+		t.Fatalf("expected action error after one match but found %v (%v)", names(matched), err)
+	}
+}
@@ -0,0 +1,266 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema describes the type of a value for type checking. It can be used in
+// place of an example value anywhere type examples are accepted, like
+// `TypeCheck`, `Parse`, or within `OneOf`, to describe types precisely
+// without fabricating fake example values, for example:
+//
+//	mexpr.TypeCheck(ast, mexpr.Object(map[string]mexpr.Schema{
+//		"id":   mexpr.TypeInteger,
+//		"tags": mexpr.ArrayOf(mexpr.TypeString),
+//	}))
+//
+// The zero value accepts any type.
+type Schema struct {
+	s *schema
+}
+
+func (s Schema) String() string {
+	if s.s == nil {
+		return string(typeAny)
+	}
+	return s.s.String()
+}
+
+// Basic schemas for `Object` properties and `ArrayOf` items.
+var (
+	TypeAny     = Schema{schemaAny}
+	TypeNull    = Schema{schemaNull}
+	TypeBoolean = Schema{schemaBool}
+	TypeNumber  = Schema{schemaNumber}
+	TypeInteger = Schema{schemaInt}
+	TypeFloat   = Schema{schemaFloat}
+	TypeString  = Schema{schemaString}
+)
+
+// SchemaOf returns the schema of a type example, e.g. `map[string]any{"id": 1}`
+// is an object with a number property `id`.
+func SchemaOf(example any) Schema {
+	return Schema{getSchema(example)}
+}
+
+// Object returns the schema of an object with the given properties.
+func Object(properties map[string]Schema) Schema {
+	s := newSchema(typeObject)
+	s.properties = make(map[string]*schema, len(properties))
+	for k, v := range properties {
+		s.properties[k] = getSchema(v)
+	}
+	return Schema{s}
+}
+
+// Optional returns the schema of a property which may be missing from the
+// input, like sparse JSON, given its schema or an example value when it is
+// present. Optional properties may be `null` and can be checked with `exists`
+// or given a fallback with `??`, e.g. `nickname ?? name`.
+func Optional(example any) Schema {
+	return Schema{newUnion(getSchema(example), schemaNull)}
+}
+
+// Enum returns the schema of a value which may only be one of the given
+// values. Comparing it with other values using `==` or `!=` is reported as a
+// type checking warning, and `WithEnumStrings` or `LintConfig.Enums` can be
+// configured from the same schema using `EnumStrings` and `Enums`, e.g.:
+//
+//	types := mexpr.Object(map[string]mexpr.Schema{
+//		"status": mexpr.Enum("active", "closed"),
+//	})
+//	mexpr.Parse(expression, types, mexpr.WithEnumStrings(types.EnumStrings()...))
+func Enum(values ...any) Schema {
+	return Schema{newEnum(values)}
+}
+
+// Enums returns the allowed values of each property path in the schema, see
+// `Enum`, for use as `LintConfig.Enums`. Properties of array items use the
+// path of the array, e.g. `items.status`.
+func (s Schema) Enums() map[string][]any {
+	enums := map[string][]any{}
+	walkEnums(s.s, "", func(path string, values []any) {
+		if path != "" {
+			enums[path] = values
+		}
+	})
+	return enums
+}
+
+// EnumStrings returns the sorted string values allowed anywhere in the
+// schema, see `Enum`, for use with `WithEnumStrings`.
+func (s Schema) EnumStrings() []string {
+	seen := map[string]bool{}
+	walkEnums(s.s, "", func(path string, values []any) {
+		for _, v := range values {
+			if str, ok := v.(string); ok {
+				seen[str] = true
+			}
+		}
+	})
+	strs := make([]string, 0, len(seen))
+	for str := range seen {
+		strs = append(strs, str)
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+// walkEnums calls `fn` with the path and allowed values of each schema which
+// has them.
+func walkEnums(s *schema, path string, fn func(path string, values []any)) {
+	if s == nil {
+		return
+	}
+	if values := s.enumValues(); values != nil {
+		fn(path, values)
+		return
+	}
+	switch s.typeName {
+	case typeUnion:
+		// Other members allow any value, so only look inside structures.
+		for _, o := range s.oneOf {
+			if o.typeName == typeArray || o.typeName == typeObject {
+				walkEnums(o, path, fn)
+			}
+		}
+	case typeArray:
+		walkEnums(s.items, path, fn)
+	case typeObject:
+		for k, v := range s.properties {
+			if path != "" {
+				k = path + "." + k
+			}
+			walkEnums(v, k, fn)
+		}
+	}
+}
+
+// ArrayOf returns the schema of an array whose items are like the given
+// schema or example value. This is also useful for arrays which may be empty,
+// since there is no item to use as an example, for example:
+//
+//	mexpr.TypeCheck(ast, map[string]any{
+//		"tags": mexpr.ArrayOf(""),
+//	})
+func ArrayOf(items any) Schema {
+	s := newSchema(typeArray)
+	s.items = getSchema(items)
+	return Schema{s}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	numberType    = reflect.TypeOf(json.Number(""))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// SchemaFor returns the schema of the Go type `T` as it would be encoded to
+// JSON, for type checking expressions against the input of strongly typed
+// services, for example:
+//
+//	type User struct {
+//		ID    int      `json:"id"`
+//		Email *string  `json:"email"`
+//		Tags  []string `json:"tags,omitempty"`
+//	}
+//
+//	err := mexpr.TypeCheck(ast, mexpr.SchemaFor[User]())
+//
+// Struct fields use their `json` tag names and embedded structs are
+// flattened. Pointers may be `null`, `time.Time` is a date, and maps,
+// interfaces, and types with custom JSON marshaling accept any value.
+func SchemaFor[T any]() Schema {
+	return Schema{schemaForType(reflect.TypeOf((*T)(nil)).Elem(), map[reflect.Type]bool{})}
+}
+
+// schemaForType returns the schema of a Go type. Visiting tracks the structs
+// being converted, so recursive types accept any value where they repeat.
+func schemaForType(t reflect.Type, visiting map[reflect.Type]bool) *schema {
+	switch t {
+	case timeType:
+		return schemaDate
+	case numberType:
+		return schemaNumber
+	}
+	if t.Kind() != reflect.Pointer && t.Implements(marshalerType) {
+		return schemaAny
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return schemaBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return schemaInt
+	case reflect.Float32, reflect.Float64:
+		return schemaFloat
+	case reflect.String:
+		return schemaString
+	case reflect.Pointer:
+		return newUnion(schemaForType(t.Elem(), visiting), schemaNull)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Bytes are encoded as base64 strings.
+			return schemaString
+		}
+		s := newSchema(typeArray)
+		s.items = schemaForType(t.Elem(), visiting)
+		return s
+	case reflect.Struct:
+		if visiting[t] {
+			return schemaAny
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		s := newSchema(typeObject)
+		s.properties = map[string]*schema{}
+		addFields(s, t, visiting, 0, map[string]int{})
+		return s
+	}
+	return schemaAny
+}
+
+// addFields adds the properties of a struct's fields to an object schema,
+// following the `encoding/json` naming rules. Depths tracks how deeply each
+// property is embedded, as fields of outer structs take priority over those
+// of embedded structs regardless of their order.
+func addFields(s *schema, t reflect.Type, visiting map[reflect.Type]bool, depth int, depths map[string]int) {
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addFields(s, embedded, visiting, depth+1, depths)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if d, ok := depths[name]; ok && d <= depth {
+			continue
+		}
+		depths[name] = depth
+		if strings.Contains(","+opts+",", ",string,") {
+			s.properties[name] = schemaString
+			continue
+		}
+		s.properties[name] = schemaForType(f.Type, visiting)
+	}
+}
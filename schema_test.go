@@ -0,0 +1,246 @@
+package mexpr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchema(t *testing.T) {
+	types := Object(map[string]Schema{
+		"id":      TypeInteger,
+		"name":    TypeString,
+		"tags":    ArrayOf(TypeString),
+		"parent":  SchemaOf(OneOf(map[string]any{"id": 1}, nil)),
+		"extra":   TypeAny,
+		"missing": {},
+		"items": ArrayOf(Object(map[string]Schema{
+			"price": TypeFloat,
+			"sold":  TypeBoolean,
+		})),
+	})
+
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: `id > 1 and name startsWith "a"`},
+		{expr: `tags where @ startsWith "a"`},
+		{expr: `parent.id + 1`},
+		{expr: `extra.foo.bar > missing`},
+		{expr: `(items where sold).price sumBy @ > 10`},
+		{expr: `name > 1`, err: "cannot compare string with number"},
+		{expr: `items where color`, err: "no property color"},
+		{expr: `tags[0] > 1`, err: "cannot compare"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr, types)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %s but found %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+		})
+	}
+
+	if s := ArrayOf(OneOf(TypeString, TypeNull)).String(); s != "array[string|null]" {
+		t.Fatalf("unexpected schema %s", s)
+	}
+	if s := (Schema{}).String(); s != "any" {
+		t.Fatalf("unexpected schema %s", s)
+	}
+}
+
+type schemaBase struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type schemaUser struct {
+	schemaBase
+	Name    string         `json:"name"`
+	Email   *string        `json:"email,omitempty"`
+	Score   float64        `json:"score,string"`
+	Tags    []string       `json:"tags"`
+	Avatar  []byte         `json:"avatar"`
+	Meta    map[string]any `json:"meta"`
+	Manager *schemaUser    `json:"manager"`
+	Friends []schemaUser   `json:"friends"`
+	Secret  string         `json:"-"`
+	Plain   bool
+	private int
+	Labels  map[string]string `json:"labels"`
+}
+
+type schemaAccount struct {
+	ID int `json:"id"`
+	schemaIDString
+}
+
+type schemaIDString struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	types := SchemaFor[schemaUser]()
+
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: `id > 1 and created before "2022-01-01" and name startsWith "a"`},
+		{expr: `email endsWith ".com" and score startsWith "1"`},
+		{expr: `tags contains "a" and avatar.length > 0 and meta.foo.bar == 1`},
+		{expr: `manager.manager.id == id and (friends where id > 1).length > 0`},
+		{expr: `Plain and labels.a == "b"`},
+		{expr: `ID > 1`, err: "no property ID"},
+		{expr: `Secret == "a"`, err: "no property Secret"},
+		{expr: `private == 1`, err: "no property private"},
+		{expr: `name > 1`, err: "cannot compare"},
+		{expr: `created < "2022-01-01" and created after manager.created`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr, types)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %s but found %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+		})
+	}
+
+	if s := SchemaFor[[]*int]().String(); s != "array[number|null]" {
+		t.Fatalf("unexpected schema %s", s)
+	}
+
+	// Outer fields take priority over embedded ones, like in `encoding/json`.
+	if _, err := Parse(`id + 1 > 5 and kind == "a"`, SchemaFor[schemaAccount]()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	types := map[string]any{
+		"name":     "",
+		"nickname": Optional(""),
+		"age":      Optional(TypeInteger),
+	}
+
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: `exists nickname and nickname startsWith "a"`},
+		{expr: `(nickname ?? name).length > 3`},
+		{expr: `age ?? 0 > 17`},
+		{expr: `missing ?? name`},
+		{expr: `(nickname ?? name) > 1`, err: "cannot compare string with number"},
+		{expr: `(name ?? 1) + 1`},
+		{expr: `missing > 1`, err: "no property missing"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr, types)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %s but found %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+		})
+	}
+
+	ast, err := Parse(`(age ?? 18) >= 18`, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := Run(ast, map[string]any{"name": "a"}, StrictMode); err != nil || result != true {
+		t.Fatalf("expected true but found %v %v", result, err)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	types := Object(map[string]Schema{
+		"status":   Enum("active", "closed"),
+		"priority": Enum(1, 2, 3),
+		"label":    SchemaOf(OneOf(Enum("a", "b"), TypeInteger)),
+		"items": ArrayOf(Object(map[string]Schema{
+			"status": Enum("new", "done", nil),
+		})),
+	})
+
+	cases := []struct {
+		expr     string
+		warnings []string
+	}{
+		{expr: `status == "active" or "closed" != status`},
+		{expr: `status == "open"`, warnings: []string{`"open" is not one of the allowed values for status: "active", "closed"`}},
+		{expr: `priority == 2 or priority != 4`, warnings: []string{`4 is not one of the allowed values for priority: 1, 2, 3`}},
+		{expr: `label == "c" or label == 5`},
+		{expr: `items where status == "open"`, warnings: []string{`"open" is not one of the allowed values for status: "new", "done"`}},
+		{expr: `status startsWith "x"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			checker := NewTypeChecker(ast)
+			if err := checker.Run(types); err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			var warnings []string
+			for _, w := range checker.Warnings() {
+				warnings = append(warnings, w.Error())
+			}
+			if len(warnings) != len(tc.warnings) {
+				t.Fatalf("expected %v but found %v", tc.warnings, warnings)
+			}
+			for idx, w := range warnings {
+				if !strings.Contains(w, tc.warnings[idx]) {
+					t.Fatalf("expected %s but found %s", tc.warnings[idx], w)
+				}
+			}
+		})
+	}
+
+	enums := types.Enums()
+	expected := map[string][]any{
+		"status":       {"active", "closed"},
+		"priority":     {1, 2, 3},
+		"items.status": {"new", "done"},
+	}
+	if !reflect.DeepEqual(enums, expected) {
+		t.Fatalf("expected %v but found %v", expected, enums)
+	}
+	if strs := types.EnumStrings(); !reflect.DeepEqual(strs, []string{"active", "closed", "done", "new"}) {
+		t.Fatalf("unexpected enum strings %v", strs)
+	}
+
+	if _, err := Parse(`status == active and (items where status == done)`, types, WithEnumStrings(types.EnumStrings()...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(`status == actve`, types, WithEnumStrings(types.EnumStrings()...)); err == nil {
+		t.Fatal("expected unknown property error")
+	}
+}
@@ -0,0 +1,160 @@
+package mexpr
+
+// Simplify returns a smaller equivalent of an expression's conditions, e.g.
+// for stored filters which are run many times. It removes double negations
+// like `not not a`, absorbs conditions without properties like
+// `a > 1 and 1 == 1` to `a > 1` or `a or 2 > 1` to a `true` literal, and
+// applies De Morgan's laws to combine negations, e.g. `not a and not b` to
+// `not (a or b)`. Rules which would change the type of a result, like
+// `name and 1 == 1` to `name`, are only applied to conditions which already
+// result in a boolean. Pass the same options used to run the expression. The
+// passed AST is not modified.
+//
+// Removed parts of the expression are no longer run, so the simplified
+// expression won't return any errors they would have caused, e.g. for
+// `items[5] > 1 or 1 == 1` with fewer items.
+func Simplify(ast *Node, options ...InterpreterOption) *Node {
+	s := &simplifier{options: options}
+	return s.simplify(ast)
+}
+
+// negatedComparisons maps comparison operators to their opposites.
+var negatedComparisons = map[NodeType]NodeType{
+	NodeEqual:            NodeNotEqual,
+	NodeNotEqual:         NodeEqual,
+	NodeLessThan:         NodeGreaterThanEqual,
+	NodeGreaterThanEqual: NodeLessThan,
+	NodeGreaterThan:      NodeLessThanEqual,
+	NodeLessThanEqual:    NodeGreaterThan,
+}
+
+// Negate returns the logical negation of a condition in simplified form, e.g.
+// for finding the records excluded by a filter. Comparisons are flipped, like
+// `a > 1` to `a <= 1`, and negations are moved inside `and` and `or` using De
+// Morgan's laws before calling `Simplify`, so `a == 1 and not (b > 1)`
+// becomes `a != 1 or b > 1`. Other conditions are wrapped in `not`, so `not b`
+// becomes `not not b` unless `b` is a boolean condition. Pass the same options
+// used to run the expression. The passed AST is not modified.
+//
+// Comparisons which fail, e.g. with a missing property, fail the same way
+// when flipped. The exception is `NaN`, which is neither less than, equal to,
+// nor greater than any number.
+func Negate(ast *Node, options ...InterpreterOption) *Node {
+	return Simplify(negate(ast), options...)
+}
+
+// negate returns the negation of a node without simplifying it.
+func negate(ast *Node) *Node {
+	if ast == nil {
+		return nil
+	}
+	n := *ast
+	if typ, ok := negatedComparisons[ast.Type]; ok {
+		n.Type = typ
+		return &n
+	}
+	switch ast.Type {
+	case NodeAnd, NodeOr:
+		n.Type = NodeOr
+		if ast.Type == NodeOr {
+			n.Type = NodeAnd
+		}
+		n.Left, n.Right = negate(ast.Left), negate(ast.Right)
+		return &n
+	case NodeNot:
+		if ast.Right != nil && isBoolean(ast.Right) {
+			return ast.Right
+		}
+	case NodeLiteral:
+		if b, ok := ast.Value.(bool); ok {
+			return literalBool(ast, !b)
+		}
+	}
+	return &Node{Type: NodeNot, Offset: ast.Offset, Length: ast.Length, Start: ast.Start, End: ast.End, Right: ast}
+}
+
+type simplifier struct {
+	options []InterpreterOption
+}
+
+func (s *simplifier) simplify(ast *Node) *Node {
+	if ast == nil {
+		return nil
+	}
+	n := *ast
+	n.Left = s.simplify(ast.Left)
+	n.Right = s.simplify(ast.Right)
+	if ast.Args != nil {
+		n.Args = make([]*Node, len(ast.Args))
+		for idx, arg := range ast.Args {
+			n.Args[idx] = s.simplify(arg)
+		}
+	}
+
+	switch n.Type {
+	case NodeNot:
+		if b, ok := s.constant(n.Right); ok {
+			return literalBool(&n, !b)
+		}
+		if n.Right != nil && n.Right.Type == NodeNot && n.Right.Right != nil && isBoolean(n.Right.Right) {
+			// Double negation, e.g. `not not a` is `a`.
+			return n.Right.Right
+		}
+	case NodeAnd, NodeOr:
+		// The result of `and` when one side is `true` or `or` when one side is
+		// `false` is the other side, while the other constant absorbs both.
+		identity := n.Type == NodeAnd
+		for _, sides := range [2][2]*Node{{n.Left, n.Right}, {n.Right, n.Left}} {
+			b, ok := s.constant(sides[0])
+			if !ok {
+				continue
+			}
+			if b != identity {
+				return literalBool(&n, b)
+			}
+			if sides[1] != nil && isBoolean(sides[1]) {
+				return sides[1]
+			}
+		}
+		if n.Left != nil && n.Right != nil && n.Left.Type == NodeNot && n.Right.Type == NodeNot {
+			// De Morgan's laws, e.g. `not a and not b` is `not (a or b)`.
+			inner := n
+			inner.Type = NodeOr
+			if n.Type == NodeOr {
+				inner.Type = NodeAnd
+			}
+			inner.Left, inner.Right = n.Left.Right, n.Right.Right
+			return &Node{Type: NodeNot, Offset: n.Offset, Length: n.Length, Start: n.Start, End: n.End, Right: &inner}
+		}
+	}
+	return &n
+}
+
+// constant returns the boolean result of a node if it doesn't depend on the
+// input, like `true` or `1 < 2`.
+func (s *simplifier) constant(ast *Node) (bool, bool) {
+	if ast == nil || !static(ast) {
+		return false, false
+	}
+	result, err := Run(ast, nil, s.options...)
+	if err != nil {
+		return false, false
+	}
+	b, ok := result.(bool)
+	return b, ok
+}
+
+// isBoolean returns whether a node always results in a boolean, or `nil` for
+// unknown values when using `ThreeValuedLogic`.
+func isBoolean(ast *Node) bool {
+	if ast.Type == NodeLiteral {
+		_, ok := ast.Value.(bool)
+		return ok
+	}
+	return isCondition(ast)
+}
+
+// literalBool replaces a node with a boolean literal at the same location.
+func literalBool(ast *Node, value bool) *Node {
+	return &Node{Type: NodeLiteral, Value: value, Offset: ast.Offset, Length: ast.Length, Start: ast.Start, End: ast.End}
+}
@@ -0,0 +1,142 @@
+package mexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	input := map[string]any{"a": 5.0, "b": 0.0, "name": "x", "items": []any{1.0, 2.0}}
+
+	cases := []struct {
+		expr     string
+		expected string
+	}{
+		{expr: "not not (a > 1)", expected: "a > 1"},
+		{expr: "!!(a > 1)", expected: "a > 1"},
+		// Double negation of a non-boolean converts it, so it is kept.
+		{expr: "not not name", expected: "not not name"},
+		{expr: "a > 1 and 1 == 1", expected: "a > 1"},
+		{expr: "1 == 1 and a > 1", expected: "a > 1"},
+		{expr: "name and 1 == 1", expected: "name and 1 == 1"},
+		{expr: "a > 1 or 1 == 2", expected: "a > 1"},
+		{expr: "not a and not b", expected: "not (a or b)"},
+		{expr: "not a or not (b > 1)", expected: "not (a and b > 1)"},
+		{expr: "items where (not not (@ > 1) and 2 > 1)", expected: "items where @ > 1"},
+		{expr: "a + 1", expected: "a + 1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := Parse(tc.expected, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			simplified := Simplify(ast)
+			if !sameNode(expected, simplified) {
+				t.Fatalf("expected %s but found %s", expected.Dot(""), simplified.Dot(""))
+			}
+
+			before, err := Run(ast, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := Run(simplified, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(before, after) {
+				t.Fatalf("expected %v but found %v", before, after)
+			}
+		})
+	}
+
+	// Constants absorb the other side into a literal.
+	for expr, expected := range map[string]bool{
+		"a > 1 and 1 == 2": false,
+		"a > 1 or 2 > 1":   true,
+		"not (1 == 2)":     true,
+	} {
+		ast, err := Parse(expr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		simplified := Simplify(ast)
+		if simplified.Type != NodeLiteral || simplified.Value != expected {
+			t.Fatalf("expected %v literal for %s but found %s", expected, expr, simplified.Dot(""))
+		}
+	}
+}
+
+func TestSimplifyUnchanged(t *testing.T) {
+	ast, err := Parse("not not (a > 1)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Simplify(ast)
+	if ast.Type != NodeNot || ast.Right.Type != NodeNot {
+		t.Fatal("expected AST to be unchanged")
+	}
+}
+
+func TestNegate(t *testing.T) {
+	inputs := []map[string]any{
+		{"a": 5.0, "b": 0.0, "name": "x"},
+		{"a": 1.0, "b": 2.0, "name": ""},
+	}
+
+	cases := []struct {
+		expr     string
+		expected string
+	}{
+		{expr: "a > 1", expected: "a <= 1"},
+		{expr: "a <= 1", expected: "a > 1"},
+		{expr: "a < 1", expected: "a >= 1"},
+		{expr: "a >= 1", expected: "a < 1"},
+		{expr: "a == 1", expected: "a != 1"},
+		{expr: "a != 1", expected: "a == 1"},
+		{expr: "a == 1 and not (b > 1)", expected: "a != 1 or b > 1"},
+		{expr: "a == 1 and not b", expected: "a != 1 or not not b"},
+		{expr: "a > 1 or b < 1", expected: "a <= 1 and b >= 1"},
+		{expr: "not (a > 1)", expected: "a > 1"},
+		{expr: "not name", expected: "not not name"},
+		{expr: `name startsWith "x"`, expected: `not (name startsWith "x")`},
+		{expr: "name and b", expected: "not (name and b)"},
+		{expr: "a > 1 and 1 == 1", expected: "a <= 1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := Parse(tc.expected, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			negated := Negate(ast)
+			if !sameNode(expected, negated) {
+				t.Fatalf("expected %s but found %s", expected.Dot(""), negated.Dot(""))
+			}
+
+			for _, input := range inputs {
+				before, err := Run(ast, input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				after, err := Run(negated, input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if toBool(before) == toBool(after) {
+					t.Fatalf("expected negated result for %v but found %v", input, after)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package mexpr
+
+import (
+	"runtime"
+	"time"
+)
+
+// Stats describes the work done by a single run, used to monitor and limit
+// expensive expressions. See `WithStats`.
+type Stats struct {
+	// Nodes is the number of nodes evaluated. Nodes inside a `where` clause or
+	// a field select on an array are counted once per item.
+	Nodes int
+
+	// Items is the number of array or map items iterated by `where` clauses,
+	// field selects on arrays like `items.id`, `sumBy`, `minBy`, and `maxBy`.
+	Items int
+
+	// Allocations is the number of heap allocations made while running. It is
+	// measured for the whole process, so it is approximate when other
+	// goroutines are running.
+	Allocations uint64
+
+	// Duration is the wall time taken to run.
+	Duration time.Duration
+}
+
+// measure calls `run`, recording statistics for `WithStats`.
+func (i *interpreter) measure(run func() (any, Error)) (any, Error) {
+	*i.stats = Stats{}
+	allocs := heapAllocs()
+	start := time.Now()
+	result, err := run()
+	i.stats.Duration = time.Since(start)
+	i.stats.Allocations = heapAllocs() - allocs
+	return result, err
+}
+
+// heapAllocs returns the total number of heap allocations made by the
+// process so far. This briefly stops the world, which is why stats are
+// opt-in.
+func heapAllocs() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Mallocs
+}
@@ -0,0 +1,77 @@
+package mexpr
+
+import (
+	"strings"
+	"unicode"
+)
+
+// identifierWords splits an identifier like `fooBar`, `foo_bar`, or
+// `HTTPServer` into its words, which are split on any non-alphanumeric
+// character and on changes in case.
+func identifierWords(s string) []string {
+	words := []string{}
+	runes := []rune(s)
+	start := -1
+	for idx, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:idx]))
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && unicode.IsUpper(r) {
+			prev := runes[idx-1]
+			nextLower := idx+1 < len(runes) && unicode.IsLower(runes[idx+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				// Split `fooBar` before the `B` and `HTTPServer` before the `S`.
+				words = append(words, string(runes[start:idx]))
+				start = idx
+			}
+		}
+		if start < 0 {
+			start = idx
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// capitalize uppercases the first letter of a word and lowercases the rest.
+func capitalize(word string) string {
+	runes := []rune(strings.ToLower(word))
+	if len(runes) > 0 {
+		runes[0] = unicode.ToUpper(runes[0])
+	}
+	return string(runes)
+}
+
+// toCase converts an identifier to `camel`, `snake`, `kebab`, or `title` case.
+func toCase(style, s string) string {
+	words := identifierWords(s)
+	for idx, word := range words {
+		switch style {
+		case "camel":
+			if idx == 0 {
+				words[idx] = strings.ToLower(word)
+			} else {
+				words[idx] = capitalize(word)
+			}
+		case "title":
+			words[idx] = capitalize(word)
+		default:
+			words[idx] = strings.ToLower(word)
+		}
+	}
+	switch style {
+	case "camel":
+		return strings.Join(words, "")
+	case "snake":
+		return strings.Join(words, "_")
+	case "kebab":
+		return strings.Join(words, "-")
+	}
+	return strings.Join(words, " ")
+}
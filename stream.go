@@ -0,0 +1,57 @@
+package mexpr
+
+// Stream runs a condition like `level == "error"` against each item read from
+// `next`, calling `yield` with each item for which it is true. Items are read
+// one at a time, so the whole input never needs to be in memory, which is
+// useful for log or event pipelines. Each item is run like the condition of a
+// `where` clause, so `@` and `$root` are the item while `$key` is its
+// position in the stream.
+//
+// Reading stops when `next` returns false or when `yield` returns false, e.g.
+// to stop at the first match when checking if any item matches. Errors for an
+// item are ignored unless using `StrictMode`, in which case streaming stops
+// and the error is returned.
+func Stream(ast *Node, next func() (any, bool), yield func(item any) bool, options ...InterpreterOption) Error {
+	if ast == nil {
+		return nil
+	}
+	i := NewInterpreter(ast, options...).(*interpreter)
+	i.reset(nil)
+	if i.buffers != nil {
+		defer i.release()
+	}
+	stream := func() (any, Error) {
+		for idx := 0; ; idx++ {
+			item, ok := next()
+			if !ok {
+				return nil, nil
+			}
+			// Each item has its own limit on range items and iterations.
+			i.root = item
+			i.items = 0
+			matched, err := i.filter(ast, nil, idx, item)
+			if err != nil {
+				return nil, err
+			}
+			if matched && !yield(item) {
+				return nil, nil
+			}
+		}
+	}
+	var err Error
+	if i.stats != nil {
+		_, err = i.measure(stream)
+	} else {
+		_, err = stream()
+	}
+	return err
+}
+
+// FromChannel returns a function which reads items from a channel until it is
+// closed, for use with `Stream`.
+func FromChannel(ch <-chan any) func() (any, bool) {
+	return func() (any, bool) {
+		item, ok := <-ch
+		return item, ok
+	}
+}
@@ -0,0 +1,65 @@
+package mexpr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	events := []any{
+		map[string]any{"level": "info", "msg": "starting"},
+		map[string]any{"level": "error", "msg": "failed"},
+		map[string]any{"level": "warn"},
+		map[string]any{"level": "error", "msg": "failed again"},
+	}
+
+	cases := []struct {
+		expr     string
+		opts     []InterpreterOption
+		limit    int
+		expected []any
+		err      string
+	}{
+		{expr: `level == "error"`, expected: []any{events[1], events[3]}},
+		{expr: `$key > 1 and $root.level != "info"`, expected: []any{events[2], events[3]}},
+		{expr: `msg startsWith "failed"`, limit: 1, expected: []any{events[1]}},
+		{expr: `msg.length > 0`, expected: []any{events[0], events[1], events[3]}},
+		{expr: `msg.length > 0`, opts: []InterpreterOption{StrictMode}, expected: []any{events[0], events[1]}, err: "cannot get msg"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			ch := make(chan any)
+			go func() {
+				defer close(ch)
+				for _, event := range events {
+					ch <- event
+				}
+			}()
+			next := FromChannel(ch)
+			var matched []any
+			err = Stream(ast, next, func(item any) bool {
+				matched = append(matched, item)
+				return tc.limit == 0 || len(matched) < tc.limit
+			}, tc.opts...)
+			// Drain the channel so the sender can finish.
+			for _, ok := next(); ok; _, ok = next() {
+			}
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q but found %v", tc.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			if !reflect.DeepEqual(matched, tc.expected) {
+				t.Fatalf("expected %v but found %v", tc.expected, matched)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package mexpr
+
+import (
+	"sort"
+	"strings"
+)
+
+// SuggestionKind describes what a `Suggestion` completes.
+type SuggestionKind uint8
+
+// Suggestion kinds
+const (
+	SuggestProperty SuggestionKind = iota
+	SuggestFunction
+	SuggestKeyword
+	SuggestOperator
+)
+
+func (k SuggestionKind) String() string {
+	switch k {
+	case SuggestProperty:
+		return "property"
+	case SuggestFunction:
+		return "function"
+	case SuggestKeyword:
+		return "keyword"
+	}
+	return "operator"
+}
+
+// Suggestion is a possible completion returned by `Suggest`.
+type Suggestion struct {
+	// Text to insert, e.g. a property name, function name, or operator.
+	Text string
+
+	// Kind of value being completed.
+	Kind SuggestionKind
+
+	// Offset is where the inserted text starts. It is before the cursor when
+	// completing a partially typed word, which should be replaced.
+	Offset int
+}
+
+// Keywords and operators suggested depending on the position in the
+// expression. Operands can be followed by any operator.
+var (
+	operandKeywords   = []string{"not", "now"}
+	operatorKeywords  = []string{"and", "or", "in", "contains", "startsWith", "endsWith", "before", "after", "sameDay", "like", "inCidr", "where", "exists", "format", "limit", "offset", "sumBy", "minBy", "maxBy"}
+	operatorSymbols   = []string{"==", "!=", "<", "<=", ">", ">=", "+", "-", "*", "/", "%", "^", "??"}
+	stringProperties  = []string{"length", "isEmpty", "isBlank", "lower", "upper", "lines", "words", "camel", "snake", "kebab", "title"}
+	arrayProperties   = []string{"length", "isEmpty"}
+	operandTokenTypes = map[TokenType]bool{
+		TokenLeftParen: true, TokenLeftBracket: true, TokenComma: true, TokenSlice: true,
+		TokenAddSub: true, TokenMulDiv: true, TokenPower: true, TokenComparison: true,
+		TokenAnd: true, TokenOr: true, TokenNot: true, TokenStringCompare: true,
+		TokenWhere: true, TokenPaging: true, TokenAggregate: true, TokenRange: true,
+		TokenTransform: true, TokenSemicolon: true, TokenCoalesce: true,
+	}
+)
+
+// Suggest returns possible completions for an expression at the cursor
+// position, given as a byte offset, for editors and API consoles to offer
+// autocomplete. Depending on the position these are property names, function
+// names, keywords, or operators, filtered by any partially typed word before
+// the cursor. If `types` is passed, it should be a set of representative
+// example values for the input like for `Parse`, and is used to suggest the
+// properties available at the current path, e.g. `name` after `user.` or
+// within `users where ...`. Nothing is suggested within strings or after
+// invalid input.
+func Suggest(expression string, cursor int, types any, options ...InterpreterOption) []Suggestion {
+	if cursor < 0 || cursor > len(expression) {
+		cursor = len(expression)
+	}
+	prefix := expression[:cursor]
+
+	if inString(prefix) {
+		return nil
+	}
+	tokens, err := Tokenize(prefix)
+	if err != nil {
+		return nil
+	}
+	if strings.HasSuffix(prefix, ".") && (len(tokens) == 0 || int(tokens[len(tokens)-1].Offset)+int(tokens[len(tokens)-1].Length) < cursor) {
+		// The lexer ends at a trailing dot, which is usually being typed.
+		tokens = append(tokens, Token{Type: TokenDot, Offset: uint16(cursor - 1), Length: 1, Value: "."})
+	}
+
+	// A word directly before the cursor is being typed and gets replaced.
+	partial, offset := "", cursor
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		if int(last.Offset)+int(last.Length) == cursor && isWord(last.Value) {
+			partial, offset = last.Value, int(last.Offset)
+			tokens = tokens[:len(tokens)-1]
+		}
+	}
+
+	s := &suggester{
+		root:    getSchema(types),
+		typed:   types != nil,
+		globals: newConfig(options).globals,
+		partial: partial,
+		offset:  offset,
+	}
+
+	if len(tokens) == 0 || operandTokenTypes[tokens[len(tokens)-1].Type] {
+		s.operand(tokens)
+	} else if tokens[len(tokens)-1].Type == TokenDot {
+		s.property(tokens)
+	} else if partial != "" {
+		// Only keywords can be partially typed after an operand.
+		s.add(SuggestKeyword, operatorKeywords...)
+	} else {
+		s.add(SuggestOperator, operatorSymbols...)
+		s.add(SuggestKeyword, operatorKeywords...)
+	}
+	return s.suggestions
+}
+
+// inString returns whether the end of the expression is within an
+// unterminated string.
+func inString(expression string) bool {
+	quoted := false
+	for idx := 0; idx < len(expression); idx++ {
+		switch expression[idx] {
+		case '\\':
+			if quoted {
+				idx++
+			}
+		case '"':
+			quoted = !quoted
+		}
+	}
+	return quoted
+}
+
+// isWord returns whether a token value is a partially typed identifier or
+// keyword, as opposed to symbols like `&&` or `!`.
+func isWord(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if !(r == '_' || r == '$' || r == '@' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r > 127) {
+			return false
+		}
+	}
+	return value[0] < '0' || value[0] > '9'
+}
+
+type suggester struct {
+	root        *schema
+	typed       bool
+	globals     map[string]any
+	partial     string
+	offset      int
+	suggestions []Suggestion
+}
+
+// add suggests each value which starts with the partially typed word,
+// ignoring case.
+func (s *suggester) add(kind SuggestionKind, values ...string) {
+	partial := strings.ToLower(s.partial)
+	for _, v := range values {
+		if strings.HasPrefix(strings.ToLower(v), partial) {
+			s.suggestions = append(s.suggestions, Suggestion{Text: v, Kind: kind, Offset: s.offset})
+		}
+	}
+}
+
+// operand suggests the start of a value: properties of the current item or
+// input, functions, and keywords like `not`.
+func (s *suggester) operand(tokens []Token) {
+	scope := s.scope(tokens)
+	names := scope.propertyNames()
+	if scope == s.root {
+		names = append(names, mapKeys(s.globals)...)
+	}
+	s.add(SuggestProperty, unique(names)...)
+	s.add(SuggestFunction, unique(mapKeys(functions))...)
+	s.add(SuggestKeyword, operandKeywords...)
+}
+
+// property suggests the properties of the path before a trailing dot,
+// including pseudo-properties like `length`.
+func (s *suggester) property(tokens []Token) {
+	if !s.typed {
+		return
+	}
+	end := len(tokens) - 1
+	start := chainStart(tokens, end)
+	value := s.resolve(s.scope(tokens[:start]), tokens[start:end])
+	if value == nil || value.isAny() {
+		return
+	}
+	names := value.propertyNames()
+	if items := value.member(typeArray); items != nil {
+		names = append(names, items.items.propertyNames()...)
+	}
+	s.add(SuggestProperty, unique(names)...)
+	pseudo := []string{}
+	if value.isString() {
+		pseudo = append(pseudo, stringProperties...)
+	} else if value.isArray() {
+		pseudo = append(pseudo, arrayProperties...)
+	}
+	s.add(SuggestProperty, pseudo...)
+}
+
+// scope returns the schema of the value which bare identifiers refer to
+// after the tokens, which is the input or the items of an array within
+// `where` and aggregate clauses like `items where ...`.
+func (s *suggester) scope(tokens []Token) *schema {
+	if !s.typed {
+		return nil
+	}
+
+	// Each group of parentheses or brackets can open a new item scope.
+	type level struct {
+		depth int
+		value *schema
+	}
+	levels := []level{}
+	depth := 0
+	current := func() *schema {
+		if len(levels) > 0 {
+			return levels[len(levels)-1].value
+		}
+		return s.root
+	}
+	for idx, t := range tokens {
+		switch t.Type {
+		case TokenLeftParen, TokenLeftBracket:
+			depth++
+		case TokenRightParen, TokenRightBracket:
+			depth--
+			for len(levels) > 0 && levels[len(levels)-1].depth > depth {
+				levels = levels[:len(levels)-1]
+			}
+		case TokenWhere, TokenAggregate:
+			if len(levels) > 0 && levels[len(levels)-1].depth == depth {
+				// Chained like `items where a where b`, which has the same items.
+				continue
+			}
+			parent := current()
+			array := s.resolve(parent, tokens[chainStart(tokens, idx):idx])
+			var items *schema
+			if a := array.member(typeArray); a != nil {
+				items = a.items
+			}
+			levels = append(levels, level{depth: depth, value: items})
+		case TokenAnd, TokenOr, TokenPaging, TokenSemicolon:
+			// These end a `where` clause, e.g. `(items where a) and b`.
+			if len(levels) > 0 && levels[len(levels)-1].depth == depth {
+				levels = levels[:len(levels)-1]
+			}
+		}
+	}
+	return current()
+}
+
+// chainStart returns the index of the first token of a property path like
+// `a.b[0].c` ending before the token at `end`.
+func chainStart(tokens []Token, end int) int {
+	start := end
+	for start > 0 {
+		t := tokens[start-1]
+		switch {
+		case t.Type == TokenIdentifier || t.Type == TokenDot:
+			start--
+		case t.Type == TokenRightBracket:
+			depth := 0
+			idx := start - 1
+			for ; idx >= 0; idx-- {
+				if tokens[idx].Type == TokenRightBracket {
+					depth++
+				} else if tokens[idx].Type == TokenLeftBracket {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if idx <= 0 {
+				return start
+			}
+			start = idx
+		default:
+			return start
+		}
+	}
+	return start
+}
+
+// resolve returns the schema of a property path like `a.b[0].c` relative to
+// the given scope. Returns nil if unknown.
+func (s *suggester) resolve(scope *schema, path []Token) *schema {
+	if len(path) == 0 {
+		return nil
+	}
+	value := scope
+	for idx := 0; idx < len(path); idx++ {
+		t := path[idx]
+		switch t.Type {
+		case TokenIdentifier:
+			if idx == 0 {
+				switch t.Value {
+				case "@":
+					continue
+				case "$root":
+					value = s.root
+					continue
+				}
+			}
+			if a := value.member(typeArray); a != nil && !value.isObject() {
+				// Properties of arrays select from each item.
+				value = a.items
+			}
+			next, ok := value.property(t.Value)
+			if !ok && idx == 0 && value == s.root {
+				if g, found := s.globals[t.Value]; found {
+					next, ok = getSchema(g), true
+				}
+			}
+			if !ok {
+				return nil
+			}
+			value = next
+		case TokenLeftBracket:
+			for depth := 0; idx < len(path); idx++ {
+				if path[idx].Type == TokenLeftBracket {
+					depth++
+				} else if path[idx].Type == TokenRightBracket {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if a := value.member(typeArray); a != nil {
+				value = a.items
+			}
+		}
+	}
+	return value
+}
+
+// unique returns the sorted values without duplicates.
+func unique(values []string) []string {
+	sort.Strings(values)
+	result := values[:0]
+	for idx, v := range values {
+		if idx == 0 || v != values[idx-1] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+//go:build !mexpr_lite
+
+package mexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSuggestExtra covers suggestions for functions which are left out of
+// builds with the `mexpr_lite` build tag.
+func TestSuggestExtra(t *testing.T) {
+	types := map[string]any{
+		"status": "",
+		"items":  []any{map[string]any{"id": 1, "tags": []any{""}}},
+	}
+
+	cases := []struct {
+		expr     string
+		expected []string
+	}{
+		{expr: `items where id > 1 and s`, expected: []string{"status", "sha256", "similarity", "startOfDay", "startOfMonth", "startOfYear", "string"}},
+		{expr: `(items where t`, expected: []string{"tags", "take", "tojson"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			var found []string
+			for _, s := range Suggest(tc.expr, len(tc.expr), types) {
+				found = append(found, s.Text)
+			}
+			if !reflect.DeepEqual(tc.expected, found) {
+				t.Fatalf("expected %v but found %v", tc.expected, found)
+			}
+		})
+	}
+}
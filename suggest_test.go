@@ -0,0 +1,71 @@
+package mexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	types := map[string]any{
+		"status": "",
+		"user":   map[string]any{"name": "", "age": 1},
+		"items":  []any{map[string]any{"id": 1, "tags": []any{""}}},
+	}
+
+	cases := []struct {
+		expr     string
+		cursor   int
+		opts     []InterpreterOption
+		expected []string
+	}{
+		{expr: `us`, expected: []string{"user"}},
+		{expr: `user.`, expected: []string{"age", "name"}},
+		{expr: `user.n`, expected: []string{"name"}},
+		{expr: `user.name == "a" an`, expected: []string{"and"}},
+		{expr: `user.name st`, expected: []string{"startsWith"}},
+		{expr: `items where i`, expected: []string{"id", "int"}},
+		{expr: `(items where ta`, expected: []string{"tags", "take"}},
+		{expr: `items where tags.`, expected: []string{"length", "isEmpty"}},
+		{expr: `items.`, expected: []string{"id", "tags", "length", "isEmpty"}},
+		{expr: `items[0].`, expected: []string{"id", "tags"}},
+		{expr: `status.l`, expected: []string{"length", "lower", "lines"}},
+		{expr: `$root.u`, expected: []string{"user"}},
+		{expr: `u and a`, cursor: 1, expected: []string{"user", "urldecode", "urlencode"}},
+		{expr: `ab`, opts: []InterpreterOption{WithGlobals(map[string]any{"abc": 1})}, expected: []string{"abc"}},
+		{expr: `"us`},
+		{expr: `missing.`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			cursor := tc.cursor
+			if cursor == 0 {
+				cursor = len(tc.expr)
+			}
+			var found []string
+			for _, s := range Suggest(tc.expr, cursor, types, tc.opts...) {
+				found = append(found, s.Text)
+			}
+			if !reflect.DeepEqual(tc.expected, found) {
+				t.Fatalf("expected %v but found %v", tc.expected, found)
+			}
+		})
+	}
+}
+
+func TestSuggestPosition(t *testing.T) {
+	suggestions := Suggest(`user.name `, 10, nil)
+	if len(suggestions) == 0 || suggestions[0].Text != "==" || suggestions[0].Kind != SuggestOperator || suggestions[0].Offset != 10 {
+		t.Fatalf("unexpected suggestions %v", suggestions)
+	}
+
+	suggestions = Suggest(`a + ro`, 6, nil)
+	for _, s := range suggestions {
+		if s.Kind == SuggestProperty || s.Offset != 4 {
+			t.Fatalf("unexpected suggestion %v", s)
+		}
+	}
+	if len(suggestions) == 0 {
+		t.Fatal("expected function suggestions")
+	}
+}
@@ -1,20 +1,28 @@
 package mexpr
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"sort"
 	"strings"
+	"time"
 )
 
 type valueType string
 
 const (
 	typeUnknown valueType = "unknown"
+	typeAny     valueType = "any"
+	typeNull    valueType = "null"
 	typeBool    valueType = "boolean"
 	typeNumber  valueType = "number"
 	typeString  valueType = "string"
+	typeDate    valueType = "date"
 	typeArray   valueType = "array"
 	typeObject  valueType = "object"
+	typeUnion   valueType = "union"
 )
 
 // mapKeys returns the keys of the map m.
@@ -27,60 +35,404 @@ func mapKeys[M ~map[K]V, K comparable, V any](m M) []K {
 	return r
 }
 
+// numberKind tracks whether a number is an integer or float, which is used
+// when strict number typing is enabled.
+type numberKind uint8
+
+const (
+	// numberAny can be used as either an integer or a float, e.g. the literal
+	// value `5`.
+	numberAny numberKind = iota
+	numberInteger
+	numberFloat
+)
+
 type schema struct {
 	typeName   valueType
 	items      *schema
 	properties map[string]*schema
+
+	// additional is the schema of any object properties which are not listed
+	// in `properties`, or nil if there may not be any others.
+	additional *schema
+
+	// nullable marks that the value may also be `null`.
+	nullable bool
+
+	// oneOf lists the possible types of a union, e.g. a string or a number.
+	oneOf []*schema
+
+	// number describes whether a number is an integer or float.
+	number numberKind
+
+	// enum lists the allowed values, if limited, see `Enum`.
+	enum []any
 }
 
 func (s *schema) String() string {
-	if s.isArray() {
-		return fmt.Sprintf("%s[%s]", s.typeName, s.items)
+	str := string(s.typeName)
+	switch s.typeName {
+	case typeArray:
+		str = fmt.Sprintf("%s[%s]", s.typeName, s.items)
+	case typeObject:
+		str = fmt.Sprintf("%s{%v}", s.typeName, mapKeys(s.properties))
+	case typeUnion:
+		types := make([]string, len(s.oneOf))
+		for i, o := range s.oneOf {
+			types[i] = o.String()
+		}
+		str = strings.Join(types, "|")
+	}
+	if s.nullable {
+		str += "|null"
+	}
+	return str
+}
+
+// is returns whether the schema is or may be (in the case of a union) the
+// given type.
+func (s *schema) is(t valueType) bool {
+	if s == nil {
+		return false
+	}
+	if s.typeName == t {
+		return true
+	}
+	for _, o := range s.oneOf {
+		if o.is(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// enumValues returns the allowed values of the schema, or nil if any value of
+// its type is allowed. A union only has allowed values if all of its members
+// do.
+func (s *schema) enumValues() []any {
+	if s == nil {
+		return nil
+	}
+	if s.typeName != typeUnion {
+		return s.enum
+	}
+	values := []any{}
+	for _, o := range s.oneOf {
+		if o.enum == nil {
+			return nil
+		}
+		values = append(values, o.enum...)
+	}
+	return values
+}
+
+// withEnum returns a copy of the schema which only allows the given values.
+func withEnum(s *schema, values []any) *schema {
+	tmp := *s
+	tmp.enum = values
+	return &tmp
+}
+
+// newEnum returns the schema of a value which may only be one of the given
+// values, with the type of each value.
+func newEnum(values []any) *schema {
+	schemas := make([]*schema, len(values))
+	for idx, v := range values {
+		schemas[idx] = withEnum(getSchema(v), []any{v})
+	}
+	return newUnion(schemas...)
+}
+
+// member returns the schema for type `t` which is either the schema itself or
+// one of the schemas in a union. Returns nil if not found.
+func (s *schema) member(t valueType) *schema {
+	if s == nil {
+		return nil
+	}
+	if s.typeName == t {
+		return s
+	}
+	for _, o := range s.oneOf {
+		if o.typeName == t {
+			return o
+		}
 	}
-	if s.isObject() {
-		return fmt.Sprintf("%s{%v}", s.typeName, mapKeys(s.properties))
+	return nil
+}
+
+// property returns the schema of the named property, if present in the
+// object or any object in a union.
+func (s *schema) property(name string) (*schema, bool) {
+	if s == nil {
+		return nil, false
+	}
+	if s.typeName != typeUnion {
+		v, ok := s.properties[name]
+		if !ok && s.additional != nil {
+			// Other properties may be missing.
+			return newUnion(s.additional, schemaNull), true
+		}
+		return v, ok
 	}
-	return string(s.typeName)
+	found := []*schema{}
+	for _, o := range s.oneOf {
+		if v, ok := o.property(name); ok {
+			found = append(found, v)
+		}
+	}
+	if len(found) == 0 {
+		return nil, false
+	}
+	return newUnion(found...), true
+}
+
+// propertyNames returns the names of all known properties of an object or
+// union of objects.
+func (s *schema) propertyNames() []string {
+	if s == nil {
+		return nil
+	}
+	names := mapKeys(s.properties)
+	for _, o := range s.oneOf {
+		names = append(names, o.propertyNames()...)
+	}
+	return names
+}
+
+// isAny returns whether the schema accepts any type. This is used to continue
+// checking after an error without generating follow-on errors.
+func (s *schema) isAny() bool {
+	return s != nil && s.typeName == typeAny
+}
+
+// mayBeNull returns whether a value of the schema may be `null`.
+func (s *schema) mayBeNull() bool {
+	return s != nil && (s.nullable || s.typeName == typeNull || s.typeName == typeAny)
 }
 
 func (s *schema) isNumber() bool {
-	return s != nil && s.typeName == typeNumber
+	return s.is(typeNumber)
 }
 
 func (s *schema) isString() bool {
-	return s != nil && s.typeName == typeString
+	return s.is(typeString)
+}
+
+// isDateLike returns whether the schema is a date or a string which may be
+// converted into a date.
+func isDateLike(s *schema) bool {
+	return s.is(typeDate) || s.isString()
 }
 
 func (s *schema) isArray() bool {
-	return s != nil && s.typeName == typeArray
+	return s.is(typeArray)
 }
 
 func (s *schema) isObject() bool {
-	return s != nil && s.typeName == typeObject
+	return s.is(typeObject)
 }
 
 var (
+	schemaNull   = newSchema(typeNull)
 	schemaBool   = newSchema(typeBool)
 	schemaNumber = newSchema(typeNumber)
+	schemaInt    = &schema{typeName: typeNumber, number: numberInteger}
+	schemaFloat  = &schema{typeName: typeNumber, number: numberFloat}
 	schemaString = newSchema(typeString)
+	schemaDate   = newSchema(typeDate)
+	schemaAny    = newSchema(typeAny)
 )
 
 func newSchema(t valueType) *schema {
 	return &schema{typeName: t}
 }
 
+// newUnion creates a schema which may be any of the given schemas. Nested
+// unions are flattened, duplicate simple types are removed, and `null` makes
+// the result nullable. If only one type remains it is returned directly.
+func newUnion(schemas ...*schema) *schema {
+	nullable := false
+	oneOf := []*schema{}
+	seen := map[valueType]int{}
+	var add func(s *schema)
+	add = func(s *schema) {
+		if s == nil {
+			return
+		}
+		if s.nullable {
+			nullable = true
+		}
+		switch s.typeName {
+		case typeNull:
+			nullable = true
+			return
+		case typeUnion:
+			for _, o := range s.oneOf {
+				add(o)
+			}
+			return
+		case typeArray, typeObject:
+			// These are structural, so keep each one.
+		default:
+			if idx, ok := seen[s.typeName]; ok {
+				// Only keep allowed values if both schemas have them.
+				if prev := oneOf[idx]; prev.enum != nil {
+					if s.enum == nil {
+						oneOf[idx] = withEnum(prev, nil)
+					} else {
+						merged := withEnum(prev, append(append([]any{}, prev.enum...), s.enum...))
+						if merged.number != s.number {
+							merged.number = numberAny
+						}
+						oneOf[idx] = merged
+					}
+				}
+				return
+			}
+			seen[s.typeName] = len(oneOf)
+		}
+		oneOf = append(oneOf, s)
+	}
+	for _, s := range schemas {
+		add(s)
+	}
+
+	var result *schema
+	switch len(oneOf) {
+	case 0:
+		return schemaNull
+	case 1:
+		if !nullable || oneOf[0].nullable {
+			return oneOf[0]
+		}
+		// Copy so shared schemas like `schemaString` aren't modified.
+		tmp := *oneOf[0]
+		result = &tmp
+	default:
+		result = &schema{typeName: typeUnion, oneOf: oneOf}
+	}
+	result.nullable = nullable
+	return result
+}
+
+// oneOf is a set of example values, any of which may be used for a value.
+type oneOf []any
+
+// OneOf returns a type example where the value may be any one of the given
+// example values. This can be used for nullable fields or union types when
+// type checking, for example:
+//
+//	mexpr.TypeCheck(ast, map[string]any{
+//		"id": mexpr.OneOf("abc123", 123),
+//		"name": mexpr.OneOf("Alice", nil),
+//	})
+func OneOf(examples ...any) any {
+	return oneOf(examples)
+}
+
+// Nullable returns a type example where the value may be the given example
+// value or `null`. It is shorthand for `OneOf(example, nil)`.
+func Nullable(example any) any {
+	return OneOf(example, nil)
+}
+
+// mergeSchemas combines the schemas of example values which are used in the
+// same place, like the items of an array. Objects are merged into a single
+// object with the properties of all of them, where properties missing from
+// some objects are nullable. Arrays are merged into a single array the same
+// way, and any other types become a union.
+func mergeSchemas(schemas []*schema) *schema {
+	others := []*schema{}
+	objects := []*schema{}
+	items := []*schema{}
+	arrays := false
+	for _, s := range schemas {
+		switch s.typeName {
+		case typeObject:
+			objects = append(objects, s)
+		case typeArray:
+			arrays = true
+			if s.items != nil {
+				items = append(items, s.items)
+			}
+		default:
+			others = append(others, s)
+		}
+	}
+	if len(objects) > 0 {
+		properties := map[string][]*schema{}
+		additional := []*schema{}
+		for _, o := range objects {
+			for k, v := range o.properties {
+				properties[k] = append(properties[k], v)
+			}
+			if o.additional != nil {
+				additional = append(additional, o.additional)
+			}
+		}
+		merged := newSchema(typeObject)
+		if len(additional) > 0 {
+			merged.additional = mergeSchemas(additional)
+		}
+		merged.properties = make(map[string]*schema, len(properties))
+		for k, v := range properties {
+			merged.properties[k] = mergeSchemas(v)
+			if len(v) < len(objects) {
+				merged.properties[k] = newUnion(merged.properties[k], schemaNull)
+			}
+		}
+		others = append(others, merged)
+	}
+	if arrays {
+		merged := newSchema(typeArray)
+		if len(items) > 0 {
+			merged.items = mergeSchemas(items)
+		}
+		others = append(others, merged)
+	}
+	return newUnion(others...)
+}
+
 func getSchema(v any) *schema {
 	switch i := v.(type) {
+	case nil:
+		return schemaNull
+	case *schema:
+		return i
+	case oneOf:
+		schemas := make([]*schema, len(i))
+		for j, example := range i {
+			schemas[j] = getSchema(example)
+		}
+		return newUnion(schemas...)
 	case bool:
 		return schemaBool
-	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return schemaInt
+	case float32, float64, *big.Float, *big.Rat:
+		return schemaFloat
+	case *big.Int:
+		return schemaInt
+	case json.Number:
 		return schemaNumber
 	case string, []byte:
 		return schemaString
+	case time.Time:
+		return schemaDate
+	case Schema:
+		if i.s == nil {
+			return schemaAny
+		}
+		return i.s
 	case []any:
 		s := newSchema(typeArray)
 		if len(i) > 0 {
-			s.items = getSchema(i[0])
+			// Use every item as an example, since they may differ.
+			items := make([]*schema, len(i))
+			for j, item := range i {
+				items[j] = getSchema(item)
+			}
+			s.items = mergeSchemas(items)
 		}
 		return s
 	case map[string]any:
@@ -104,36 +456,216 @@ func getSchema(v any) *schema {
 // TypeChecker checks to ensure types used for operations will work.
 type TypeChecker interface {
 	Run(value any) Error
+
+	// Warnings returns non-fatal issues found during the last run, such as
+	// implicit type conversions or comparisons which always have the same
+	// result. These are useful to show as hints without rejecting the
+	// expression.
+	Warnings() []Error
 }
 
 // NewTypeChecker returns a type checker for the given AST.
 func NewTypeChecker(ast *Node, options ...InterpreterOption) TypeChecker {
-	unquoted := false
-
-	for _, opt := range options {
-		switch opt {
-		case UnquotedStrings:
-			unquoted = true
-		}
-	}
+	return newTypeChecker(ast, options...)
+}
 
+func newTypeChecker(ast *Node, options ...InterpreterOption) *typeChecker {
 	return &typeChecker{
-		ast:      ast,
-		unquoted: unquoted,
+		ast:    ast,
+		config: newConfig(options),
 	}
 }
 
 type typeChecker struct {
+	config
 	ast             *Node
 	prevFieldSelect bool
-	unquoted        bool
+
+	// root is the input type, while scopes holds the types of nested `where`
+	// clauses for `$root`, `$parent`, `$key`, and `$value`.
+	root   any
+	scopes []scope
+
+	// prevProperty is set when the identifier is the property name on the
+	// right side of a `.`, which means it can't be a global.
+	prevProperty bool
+
+	// collect enables gathering all errors into `errors` rather than stopping
+	// at the first one.
+	collect bool
+	errors  []Error
+
+	warnings []Error
+
+	// rules identifies the kind of each warning, used by `Lint`.
+	rules []string
 }
 
 func (i *typeChecker) Run(value any) Error {
+	i.warnings = nil
+	i.rules = nil
+	if s, ok := value.(Schema); ok {
+		value = getSchema(s)
+	}
+	i.root = value
+	i.scopes = i.scopes[:0]
+	if i.logger == nil {
+		_, err := i.run(i.ast, value)
+		return err
+	}
+	start := time.Now()
 	_, err := i.run(i.ast, value)
+	logEvent(i.logger, LogTypeCheck, start, err)
 	return err
 }
 
+func (i *typeChecker) Warnings() []Error {
+	return i.warnings
+}
+
+// warn records a non-fatal issue at the location of the given node. The rule
+// identifies the kind of issue for `Lint`.
+func (i *typeChecker) warn(ast *Node, rule string, format string, a ...any) {
+	i.warnings = append(i.warnings, newNodeError(KindTypeMismatch, ast, format, a...))
+	i.rules = append(i.rules, rule)
+}
+
+// numberKind returns the kind of number for the schema, which may be a union.
+func (s *schema) numberKind() numberKind {
+	if n := s.member(typeNumber); n != nil {
+		return n.number
+	}
+	return numberAny
+}
+
+// numberResult returns the schema of the result of a math operation on two
+// numbers when using strict number typing. Integer math results in an
+// integer, while any float operand results in a float.
+func numberResult(left, right *schema) *schema {
+	l, r := left.numberKind(), right.numberKind()
+	if l == numberFloat || r == numberFloat {
+		return schemaFloat
+	}
+	if l == numberInteger || r == numberInteger {
+		return schemaInt
+	}
+	return schemaNumber
+}
+
+// mixesNumbers returns whether one schema is an integer while the other is a
+// float.
+func mixesNumbers(left, right *schema) bool {
+	l, r := left.numberKind(), right.numberKind()
+	return (l == numberInteger && r == numberFloat) || (l == numberFloat && r == numberInteger)
+}
+
+// isScalar returns whether the schema is a known simple type like a number.
+func (s *schema) isScalar() bool {
+	return s != nil && (s.typeName == typeBool || s.typeName == typeNumber || s.typeName == typeString)
+}
+
+// checkCoercion warns if a string operation will implicitly convert a
+// non-string operand into a string.
+func (i *typeChecker) checkCoercion(ast *Node, leftType, rightType *schema) {
+	if leftType.isString() && rightType.isScalar() && !rightType.isString() {
+		i.warn(ast, LintCoercion, "%s will be converted to a string", rightType)
+	} else if rightType.isString() && leftType.isScalar() && !leftType.isString() {
+		i.warn(ast, LintCoercion, "%s will be converted to a string", leftType)
+	}
+}
+
+// checkPaging checks the types for `limit` and `offset`, which take an array
+// and a number and return the array.
+func (i *typeChecker) checkPaging(ast *Node, leftType, rightType *schema) (*schema, Error) {
+	if !leftType.isAny() && !leftType.isArray() && leftType.typeName != typeNull {
+		return i.fail(newNodeError(KindTypeMismatch, ast, "%s requires an array but found %s", ast, leftType))
+	}
+	if !rightType.isAny() && !rightType.isNumber() {
+		return i.fail(newNodeError(KindTypeMismatch, ast, "%s requires a number but found %s", ast, rightType))
+	}
+	return leftType, nil
+}
+
+// checkBoolean fails if a value used as a boolean is not one when using
+// strict typing.
+func (i *typeChecker) checkBoolean(ast *Node, t *schema) Error {
+	if i.threeValued && t.typeName == typeNull {
+		// Unknown values are allowed with `ThreeValuedLogic`.
+		return nil
+	}
+	if i.strictTypes && !t.isAny() && !t.is(typeBool) {
+		_, err := i.fail(newNodeError(KindTypeMismatch, ast, "expected boolean but found %s", t))
+		return err
+	}
+	return nil
+}
+
+// comparison returns the type of comparing values of the given types, which
+// is a boolean unless using `ThreeValuedLogic`, where comparisons with `null`
+// are `null` (unknown) like in the interpreter.
+func (i *typeChecker) comparison(leftType, rightType *schema) *schema {
+	if !i.threeValued {
+		return schemaBool
+	}
+	if leftType.typeName == typeNull || rightType.typeName == typeNull {
+		return schemaNull
+	}
+	if leftType.mayBeNull() || rightType.mayBeNull() {
+		return newUnion(schemaBool, schemaNull)
+	}
+	return schemaBool
+}
+
+// checkEquality warns about equality checks that always give the same result,
+// like comparing two constants or values of incompatible types.
+func (i *typeChecker) checkEquality(ast *Node, leftType, rightType *schema) {
+	result := ast.Type == NodeEqual
+	if ast.Left.Type == NodeLiteral && ast.Right.Type == NodeLiteral {
+		if !deepEqual(ast.Left.Value, ast.Right.Value) {
+			result = !result
+		}
+		i.warn(ast, LintConstantCondition, "comparison is always %t", result)
+		return
+	}
+	if leftType.isScalar() && rightType.isScalar() && leftType.typeName != rightType.typeName {
+		i.warn(ast, LintConstantCondition, "comparing %s with %s is always %t", leftType, rightType, !result)
+	}
+}
+
+// checkEnum warns about comparing a value which only allows certain values,
+// see `Enum`, with a literal which isn't one of them.
+func (i *typeChecker) checkEnum(property, literal *Node, t *schema) {
+	if literal.Type != NodeLiteral || literal.Value == nil {
+		// Nullability is checked separately.
+		return
+	}
+	allowed := t.enumValues()
+	if allowed == nil {
+		return
+	}
+	for _, v := range allowed {
+		if deepEqual(v, literal.Value) {
+			return
+		}
+	}
+	if path := propertyPath(property); path != nil {
+		i.warn(literal, LintEnum, "%s is not one of the allowed values for %s: %s", formatLiteral(literal.Value), strings.Join(path, "."), formatValues(allowed))
+		return
+	}
+	i.warn(literal, LintEnum, "%s is not one of the allowed values: %s", formatLiteral(literal.Value), formatValues(allowed))
+}
+
+// fail handles a type error. Normally the error is returned as-is, but when
+// collecting errors it is saved and an `any` schema is returned instead so
+// that checking can continue without reporting follow-on errors.
+func (i *typeChecker) fail(err Error) (*schema, Error) {
+	if i.collect {
+		i.errors = append(i.errors, err)
+		return schemaAny, nil
+	}
+	return nil, err
+}
+
 func (i *typeChecker) runBoth(ast *Node, value any) (*schema, *schema, Error) {
 	leftType, err := i.run(ast.Left, value)
 	if err != nil {
@@ -149,8 +681,12 @@ func (i *typeChecker) runBoth(ast *Node, value any) (*schema, *schema, Error) {
 func (i *typeChecker) run(ast *Node, value any) (*schema, Error) {
 	fromSelect := i.prevFieldSelect
 	i.prevFieldSelect = false
+	fromProperty := i.prevProperty
+	i.prevProperty = false
 
 	switch ast.Type {
+	case NodeError:
+		return i.fail(ast.Value.(Error))
 	case NodeIdentifier:
 		switch ast.Value.(string) {
 		case "@":
@@ -158,20 +694,63 @@ func (i *typeChecker) run(ast *Node, value any) (*schema, Error) {
 				return s, nil
 			}
 			return getSchema(value), nil
+		case "$root", "$parent", "$key", "$value":
+			if !fromProperty {
+				var result any
+				if ast.Value.(string) == "$root" {
+					result = i.root
+				} else if len(i.scopes) > 0 {
+					current := i.scopes[len(i.scopes)-1]
+					switch ast.Value.(string) {
+					case "$parent":
+						result = current.parent
+					case "$key":
+						result = current.key
+					case "$value":
+						result = current.value
+					}
+				}
+				if s, ok := result.(*schema); ok {
+					return s, nil
+				}
+				return getSchema(result), nil
+			}
 		case "length":
-			return schemaNumber, nil
+			return schemaInt, nil
+		case "isEmpty":
+			s, ok := value.(*schema)
+			if !ok {
+				s = getSchema(value)
+			}
+			if _, ok := s.property("isEmpty"); !ok {
+				return schemaBool, nil
+			}
+		case "isBlank":
+			if s, ok := value.(*schema); !ok || s.isAny() || s.isString() || s.typeName == typeNull {
+				return schemaBool, nil
+			}
 		case "lower", "upper":
 			return schemaString, nil
+		case "camel", "snake", "kebab", "title":
+			if s, ok := value.(*schema); !ok || s.isAny() || s.isString() {
+				return schemaString, nil
+			}
+		case "lines", "words":
+			if s, ok := value.(*schema); !ok || s.isAny() || s.isString() {
+				arr := newSchema(typeArray)
+				arr.items = schemaString
+				return arr, nil
+			}
 		}
 		errValue := value
 		if s, ok := value.(*schema); ok {
-			if v, ok := s.properties[ast.Value.(string)]; ok {
-				return v, nil
+			if s.isAny() {
+				return schemaAny, nil
 			}
-			keys := []string{}
-			for k := range s.properties {
-				keys = append(keys, k)
+			if v, ok := s.property(ast.Value.(string)); ok {
+				return v, nil
 			}
+			keys := s.propertyNames()
 			errValue = "map with keys [" + strings.Join(keys, ", ") + "]"
 		}
 		if m, ok := value.(map[string]any); ok {
@@ -194,62 +773,182 @@ func (i *typeChecker) run(ast *Node, value any) (*schema, Error) {
 			}
 			errValue = "map with keys [" + strings.Join(keys, ", ") + "]"
 		}
-		if i.unquoted && !fromSelect {
-			// Identifiers not found in the map are treated as strings, but only if
-			// the previous item was not a `.` like `obj.field`.
-			return schemaString, nil
+		if !fromProperty && i.globals != nil {
+			if v, ok := i.globals[ast.Value.(string)]; ok {
+				return getSchema(v), nil
+			}
+		}
+		if !fromProperty && ast.Value.(string) == "now" {
+			return schemaDate, nil
+		}
+		if !fromProperty && i.undefined && ast.Value.(string) == "undefined" {
+			return schemaNull, nil
 		}
-		return nil, NewError(ast.Offset, ast.Length, "no property %v in %v", ast.Value, errValue)
+		err := newNodeError(KindUnknownProperty, ast, "no property %v in %v", ast.Value, errValue)
+		if !fromSelect {
+			if i.unquotedString(ast.Value.(string)) {
+				// Identifiers not found in the map are treated as strings, but only if
+				// the previous item was not a `.` like `obj.field`.
+				return schemaString, nil
+			}
+			err = withSuggestions(err, i.closestEnums(ast.Value.(string))...)
+		}
+		return i.fail(err)
 	case NodeFieldSelect:
 		i.prevFieldSelect = true
-		leftType, err := i.run(ast.Left, value)
+		var leftType *schema
+		var err Error
+		if allowsMissing(ast.Right) {
+			leftType, err = i.runAllowMissing(ast.Left, value)
+		} else {
+			leftType, err = i.run(ast.Left, value)
+		}
 		if err != nil {
 			return nil, err
 		}
+		if ast.Right.Type == NodeCall {
+			return i.call(ast.Right, []*schema{leftType}, value)
+		}
+		if leftType.typeName == typeArray && projects(ast.Right) {
+			result := newSchema(typeArray)
+			if leftType.items != nil {
+				i.prevFieldSelect = true
+				i.prevProperty = true
+				items, err := i.run(ast.Right, leftType.items)
+				if err != nil {
+					return nil, err
+				}
+				result.items = items
+			}
+			return result, nil
+		}
 		i.prevFieldSelect = true
+		i.prevProperty = true
 		return i.run(ast.Right, leftType)
+	case NodeCall:
+		return i.call(ast, nil, value)
+	case NodeRange:
+		leftType, rightType, err := i.runBoth(ast, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range []*schema{leftType, rightType} {
+			if !t.isAny() && !t.isNumber() {
+				return i.fail(newNodeError(KindTypeMismatch, ast, "range requires numbers but found %s", t))
+			}
+		}
+		arr := newSchema(typeArray)
+		arr.items = schemaNumber
+		return arr, nil
+	case NodeArray:
+		arr := newSchema(typeArray)
+		items := make([]*schema, 0, len(ast.Args))
+		for _, item := range ast.Args {
+			itemType, err := i.run(item, value)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, itemType)
+		}
+		if len(items) > 0 {
+			// Items may have different types, like `["a", 1]`.
+			arr.items = mergeSchemas(items)
+		}
+		return arr, nil
+	case NodeSequence:
+		var result *schema
+		for _, expr := range ast.Args {
+			var err Error
+			if result, err = i.run(expr, value); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case NodeCoalesce:
+		leftType, err := i.runAllowMissing(ast.Left, value)
+		if err != nil {
+			return nil, err
+		}
+		rightType, err := i.run(ast.Right, value)
+		if err != nil {
+			return nil, err
+		}
+		if leftType.isAny() {
+			return schemaAny, nil
+		}
+		if leftType.typeName == typeNull {
+			return rightType, nil
+		}
+		if leftType.nullable {
+			present := *leftType
+			present.nullable = false
+			return newUnion(&present, rightType), nil
+		}
+		return leftType, nil
+	case NodeExists:
+		if _, err := i.runAllowMissing(ast.Right, value); err != nil {
+			return nil, err
+		}
+		return schemaBool, nil
 	case NodeArrayIndex:
 		leftType, rightType, err := i.runBoth(ast, value)
 		if err != nil {
 			return nil, err
 		}
+		if leftType.isAny() || rightType.isAny() {
+			return schemaAny, nil
+		}
 		if !(leftType.isString() || leftType.isArray()) {
-			return nil, NewError(ast.Offset, ast.Length, "can only index strings or arrays but got %v", leftType)
+			return i.fail(newNodeError(KindTypeMismatch, ast, "can only index strings or arrays but got %v", leftType))
 		}
-		if rightType.isArray() {
+		if ast.Right.Type == NodeSlice || (rightType.isArray() && ast.Right.Type != NodeArray) {
 			// This is a slice!
 			return leftType, nil
 		}
 		if rightType.isNumber() {
-			if leftType.isString() {
-				return leftType, nil
+			if i.strictNumbers && rightType.numberKind() == numberFloat {
+				return i.fail(newNodeError(KindTypeMismatch, ast, "array index must be an integer but found %v", rightType))
+			}
+			if arr := leftType.member(typeArray); arr != nil {
+				if arr.items == nil {
+					// The example was empty, so the item type is unknown.
+					return schemaAny, nil
+				}
+				if leftType.isString() {
+					return newUnion(arr.items, schemaString), nil
+				}
+				return arr.items, nil
 			}
-			return leftType.items, nil
+			return leftType, nil
 		}
-		return nil, NewError(ast.Offset, ast.Length, "array index must be number or slice but found %v", rightType)
+		return i.fail(newNodeError(KindTypeMismatch, ast, "array index must be number or slice but found %v", rightType))
 	case NodeSlice:
 		leftType, rightType, err := i.runBoth(ast, value)
 		if err != nil {
 			return nil, err
 		}
-		if !leftType.isNumber() {
-			return nil, NewError(ast.Offset, ast.Length, "slice index must be a number but found %s", leftType)
+		if !leftType.isNumber() && !leftType.isAny() {
+			return i.fail(newNodeError(KindTypeMismatch, ast, "slice index must be a number but found %s", leftType))
 		}
-		if !rightType.isNumber() {
-			return nil, NewError(ast.Offset, ast.Length, "slice index must be a number but found %s", rightType)
+		if !rightType.isNumber() && !rightType.isAny() {
+			return i.fail(newNodeError(KindTypeMismatch, ast, "slice index must be a number but found %s", rightType))
 		}
 		s := newSchema(typeArray)
 		s.items = leftType
 		return s, nil
 	case NodeLiteral:
+		if f, ok := ast.Value.(float64); ok && f == math.Trunc(f) {
+			// Integral literals can be used as integers or floats.
+			return schemaNumber, nil
+		}
 		return getSchema(ast.Value), nil
 	case NodeSign:
 		rightType, err := i.run(ast.Right, value)
 		if err != nil {
 			return nil, err
 		}
-		if !rightType.isNumber() {
-			return nil, NewError(ast.Offset, ast.Length, "expected number but found %s", rightType)
+		if !rightType.isNumber() && !rightType.isAny() {
+			return i.fail(newNodeError(KindTypeMismatch, ast, "expected number but found %s", rightType))
 		}
 		return schemaNumber, nil
 	case NodeAdd, NodeSubtract, NodeMultiply, NodeDivide, NodeModulus, NodePower:
@@ -257,69 +956,224 @@ func (i *typeChecker) run(ast *Node, value any) (*schema, Error) {
 		if err != nil {
 			return nil, err
 		}
+		if leftType.isAny() || rightType.isAny() {
+			return schemaAny, nil
+		}
 		if ast.Type == NodeAdd {
 			if leftType.isString() || rightType.isString() {
+				if i.strictTypes && !(leftType.isString() && rightType.isString()) {
+					return i.fail(newNodeError(KindTypeMismatch, ast, "cannot add %s and %s without converting to a string", leftType, rightType))
+				}
+				i.checkCoercion(ast, leftType, rightType)
+				if leftType.isNumber() && rightType.isNumber() {
+					// Unions like `string|number` may also be added as numbers.
+					return newUnion(schemaString, leftType.member(typeNumber)), nil
+				}
 				return schemaString, nil
 			}
 			if leftType.isArray() && rightType.isArray() {
-				if leftType.items.typeName != rightType.items.typeName {
-					return nil, NewError(ast.Offset, ast.Length, "array item types don't match: %s vs %s", leftType.items, rightType.items)
+				leftItems := leftType.member(typeArray).items
+				rightItems := rightType.member(typeArray).items
+				if leftItems != nil && rightItems != nil && leftItems.typeName != rightItems.typeName {
+					return i.fail(newNodeError(KindTypeMismatch, ast, "array item types don't match: %s vs %s", leftItems, rightItems))
 				}
 				return leftType, nil
 			}
 		}
 		if leftType.isNumber() && rightType.isNumber() {
+			if i.strictNumbers {
+				if ast.Type == NodeModulus && (leftType.numberKind() == numberFloat || rightType.numberKind() == numberFloat) {
+					return i.fail(newNodeError(KindTypeMismatch, ast, "modulus requires integers but found %s and %s", leftType, rightType))
+				}
+				return numberResult(leftType, rightType), nil
+			}
 			return leftType, nil
 		}
-		return nil, NewError(ast.Offset, ast.Length, "cannot operate on incompatible types %v and %v", leftType.typeName, rightType.typeName)
+		return i.fail(newNodeError(KindTypeMismatch, ast, "cannot operate on incompatible types %v and %v", leftType.typeName, rightType.typeName))
 	case NodeLessThan, NodeLessThanEqual, NodeGreaterThan, NodeGreaterThanEqual:
 		leftType, rightType, err := i.runBoth(ast, value)
 		if err != nil {
 			return nil, err
 		}
+		if leftType.isAny() || rightType.isAny() {
+			return i.comparison(leftType, rightType), nil
+		}
+		if i.threeValued && (leftType.typeName == typeNull || rightType.typeName == typeNull) {
+			// Comparisons with `null` are unknown.
+			return schemaNull, nil
+		}
+		if (leftType.is(typeDate) || rightType.is(typeDate)) && isDateLike(leftType) && isDateLike(rightType) {
+			// Dates can be compared with dates or strings, which are converted
+			// to dates when running.
+			return i.comparison(leftType, rightType), nil
+		}
 		if !leftType.isNumber() || !rightType.isNumber() {
-			return nil, NewError(ast.Offset, ast.Length, "cannot compare %s with %s", leftType, rightType)
+			return i.fail(newNodeError(KindTypeMismatch, ast, "cannot compare %s with %s", leftType, rightType))
+		}
+		return i.comparison(leftType, rightType), nil
+	case NodeEqual, NodeNotEqual:
+		leftType, rightType, err := i.runBoth(ast, value)
+		if err != nil {
+			return nil, err
 		}
+		if ast.Value == "=" {
+			i.warn(ast, LintLenientEquals, "= should be ==")
+		}
+		if i.strictNumbers && mixesNumbers(leftType, rightType) {
+			return i.fail(newNodeError(KindTypeMismatch, ast, "cannot compare integer and float values"))
+		}
+		i.checkEquality(ast, leftType, rightType)
+		i.checkEnum(ast.Left, ast.Right, leftType)
+		i.checkEnum(ast.Right, ast.Left, rightType)
+		return i.comparison(leftType, rightType), nil
+	case NodeIn, NodeContains, NodeStartsWith, NodeEndsWith, NodeLike:
+		leftType, rightType, err := i.runBoth(ast, value)
+		if err != nil {
+			return nil, err
+		}
+		if i.strictTypes && !leftType.isAny() && !rightType.isAny() && !(leftType.isString() && rightType.isString()) {
+			container := rightType
+			if ast.Type == NodeContains {
+				container = leftType
+			}
+			isMembership := ast.Type == NodeIn || ast.Type == NodeContains
+			if !isMembership || !(container.isArray() || container.isObject()) {
+				return i.fail(newNodeError(KindTypeMismatch, ast, "expected strings but found %s and %s", leftType, rightType))
+			}
+		}
+		i.checkCoercion(ast, leftType, rightType)
 		return schemaBool, nil
-	case NodeEqual, NodeNotEqual, NodeAnd, NodeOr, NodeIn, NodeContains, NodeStartsWith, NodeEndsWith, NodeBefore, NodeAfter:
+	case NodeAnd, NodeOr:
+		leftType, rightType, err := i.runBoth(ast, value)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.checkBoolean(ast.Left, leftType); err != nil {
+			return nil, err
+		}
+		if err := i.checkBoolean(ast.Right, rightType); err != nil {
+			return nil, err
+		}
+		if i.threeValued && (leftType.mayBeNull() || rightType.mayBeNull()) {
+			// Unknown values may give an unknown result, but e.g. `null and
+			// false` is still `false`.
+			return newUnion(schemaBool, schemaNull), nil
+		}
+		return schemaBool, nil
+	case NodeBefore, NodeAfter, NodeSameDay, NodeInCidr:
 		_, _, err := i.runBoth(ast, value)
 		if err != nil {
 			return nil, err
 		}
 		return schemaBool, nil
+	case NodeSumBy, NodeMinBy, NodeMaxBy:
+		leftType, err := i.run(ast.Left, value)
+		if err != nil {
+			return nil, err
+		}
+		items := schemaAny
+		if !leftType.isAny() {
+			arr := leftType.member(typeArray)
+			if arr == nil {
+				return i.fail(newNodeError(KindTypeMismatch, ast, "%s requires an array but found %s", ast, leftType))
+			}
+			if arr.items != nil {
+				items = arr.items
+			}
+		}
+		i.prevFieldSelect = true
+		i.scopes = append(i.scopes, scope{parent: value, key: schemaInt, value: items})
+		rightType, err := i.run(ast.Right, items)
+		i.scopes = i.scopes[:len(i.scopes)-1]
+		if err != nil {
+			return nil, err
+		}
+		if !rightType.isAny() && !rightType.isNumber() && rightType.typeName != typeNull {
+			return i.fail(newNodeError(KindTypeMismatch, ast.Right, "%s requires numbers but found %s", ast, rightType))
+		}
+		if ast.Type == NodeSumBy {
+			return schemaNumber, nil
+		}
+		return items, nil
+	case NodeLimit, NodeOffset:
+		leftType, rightType, err := i.runBoth(ast, value)
+		if err != nil {
+			return nil, err
+		}
+		return i.checkPaging(ast, leftType, rightType)
+	case NodeFormat:
+		_, rightType, err := i.runBoth(ast, value)
+		if err != nil {
+			return nil, err
+		}
+		if !rightType.isAny() && !rightType.isString() {
+			return i.fail(newNodeError(KindTypeMismatch, ast, "format layout must be a string but found %s", rightType))
+		}
+		return schemaString, nil
 	case NodeWhere:
 		leftType, err := i.run(ast.Left, value)
 		if err != nil {
 			return nil, err
 		}
-		if leftType.isObject() {
-			keys := mapKeys(leftType.properties)
+		if leftType.isAny() {
+			i.prevFieldSelect = true
+			i.scopes = append(i.scopes, scope{parent: value, key: schemaAny, value: schemaAny})
+			_, err := i.run(ast.Right, schemaAny)
+			i.scopes = i.scopes[:len(i.scopes)-1]
+			if err != nil {
+				return nil, err
+			}
+			return schemaAny, nil
+		}
+		arr := leftType.member(typeArray)
+		key := schemaInt
+		obj := leftType.member(typeObject)
+		if arr == nil && obj != nil {
+			key = schemaString
+			keys := mapKeys(obj.properties)
 			sort.Strings(keys)
 			if len(keys) > 0 {
 				// Pick the first prop as the representative item type.
-				prop := leftType.properties[keys[0]]
-				leftType = newSchema(typeArray)
-				leftType.items = prop
+				arr = newSchema(typeArray)
+				arr.items = obj.properties[keys[0]]
+			} else if obj.additional != nil {
+				arr = newSchema(typeArray)
+				arr.items = obj.additional
 			}
 		}
-		if !leftType.isArray() || leftType.items == nil {
-			return nil, NewError(ast.Offset, ast.Length, "where clause requires a non-empty array or object, but found %s", leftType)
+		if arr == nil || arr.items == nil {
+			return i.fail(newNodeError(KindTypeMismatch, ast, "where clause requires a non-empty array or object, but found %s", leftType))
 		}
 		// In an unquoted string scenario it makes no sense for the first/only
 		// token after a `where` clause to be treated as a string. Instead we
 		// treat a `where` the same as a field select `.` in this scenario.
 		i.prevFieldSelect = true
-		_, err = i.run(ast.Right, leftType.items)
+		i.scopes = append(i.scopes, scope{parent: value, key: key, value: arr.items})
+		_, err = i.run(ast.Right, arr.items)
+		i.scopes = i.scopes[:len(i.scopes)-1]
 		if err != nil {
 			return nil, err
 		}
-		return leftType, nil
+		if i.keepMapKeys && key == schemaString {
+			return obj, nil
+		}
+		return arr, nil
 	case NodeNot:
-		_, err := i.run(ast.Right, value)
+		rightType, err := i.run(ast.Right, value)
 		if err != nil {
 			return nil, err
 		}
+		if err := i.checkBoolean(ast.Right, rightType); err != nil {
+			return nil, err
+		}
+		if i.threeValued && rightType.mayBeNull() {
+			// `not null` is unknown.
+			if rightType.typeName == typeNull {
+				return schemaNull, nil
+			}
+			return newUnion(schemaBool, schemaNull), nil
+		}
 		return schemaBool, nil
 	}
-	return nil, NewError(ast.Offset, ast.Length, "unexpected node %v", ast)
+	return i.fail(newNodeError(KindUnknown, ast, "unexpected node %v", ast))
 }
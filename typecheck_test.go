@@ -0,0 +1,216 @@
+package mexpr
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTypeCheckAll(t *testing.T) {
+	type test struct {
+		expr  string
+		input string
+		errs  []string
+	}
+	cases := []test{
+		{expr: `foo + 1`, input: `{"foo": 1}`},
+		{expr: `foo + bar`, input: `{}`, errs: []string{"no property foo", "no property bar"}},
+		{expr: `foo.bar > 1 and baz[0] == 1`, input: `{"foo": 1, "baz": 2}`, errs: []string{"no property bar", "can only index"}},
+		{expr: `(a + 1) > b`, input: `{"a": [1], "b": "x"}`, errs: []string{"cannot operate on incompatible types"}},
+		{expr: `items where id > 1 and missing`, input: `{"items": [{"id": 1}]}`, errs: []string{"no property missing"}},
+		{expr: `name < "bob"`, input: `{"name": "alice"}`, errs: []string{"cannot compare string with string"}},
+		{expr: `created >= startOfMonth(now) and now > created`, input: `{"created": "2022-01-01"}`},
+		{expr: `startOfDay(now) + 1`, input: `{}`, errs: []string{"incompatible types date and number"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			var input any
+			if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+				t.Fatal(err)
+			}
+			ast, err := Parse(tc.expr, nil)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			errs := TypeCheckAll(ast, input)
+			if len(errs) != len(tc.errs) {
+				t.Fatalf("expected %d errors but found %v", len(tc.errs), errs)
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tc.errs[i]) {
+					t.Fatalf("expected %s but found %s", tc.errs[i], err.Pretty(tc.expr))
+				}
+			}
+		})
+	}
+}
+
+func TestTypeCheckWarnings(t *testing.T) {
+	type test struct {
+		expr     string
+		input    string
+		warnings []string
+	}
+	cases := []test{
+		{expr: `foo + 1`, input: `{"foo": 1}`},
+		{expr: `foo == "bar"`, input: `{"foo": "baz"}`},
+		{expr: `1 == 1 or foo`, input: `{"foo": true}`, warnings: []string{"comparison is always true"}},
+		{expr: `"a" != "a"`, warnings: []string{"comparison is always false"}},
+		{expr: `foo == "1"`, input: `{"foo": 1}`, warnings: []string{"comparing number with string is always false"}},
+		{expr: `foo != "1"`, input: `{"foo": 1}`, warnings: []string{"comparing number with string is always true"}},
+		{expr: `"foo" + 1`, warnings: []string{"number will be converted to a string"}},
+		{expr: `"id1" endsWith 1`, warnings: []string{"number will be converted to a string"}},
+		{expr: `items where (id == "1" and name + 1)`, input: `{"items": [{"id": 1, "name": "a"}]}`, warnings: []string{"comparing number with string", "number will be converted"}},
+		{expr: `foo = "bar"`, input: `{"foo": "baz"}`, warnings: []string{"= should be =="}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			var input any = map[string]any{}
+			if tc.input != "" {
+				if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ast, err := Parse(tc.expr, nil, LenientEquals)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			tc2 := NewTypeChecker(ast)
+			if err := tc2.Run(input); err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			warnings := tc2.Warnings()
+			if len(warnings) != len(tc.warnings) {
+				t.Fatalf("expected %d warnings but found %v", len(tc.warnings), warnings)
+			}
+			for i, w := range warnings {
+				if !strings.Contains(w.Error(), tc.warnings[i]) {
+					t.Fatalf("expected %s but found %s", tc.warnings[i], w.Pretty(tc.expr))
+				}
+			}
+		})
+	}
+}
+
+func TestTypeCheckUnion(t *testing.T) {
+	type test struct {
+		expr  string
+		types map[string]any
+		err   string
+	}
+	cases := []test{
+		{expr: `name startsWith "a"`, types: map[string]any{"name": Nullable("")}},
+		{expr: `age > 18`, types: map[string]any{"age": Nullable(1)}},
+		{expr: `round(age) > 18`, types: map[string]any{"age": Nullable(1.5)}},
+		{expr: `id + 1`, types: map[string]any{"id": OneOf("abc", 123)}},
+		{expr: `id > 1`, types: map[string]any{"id": OneOf(true, 123)}},
+		{expr: `user.name.length > 0`, types: map[string]any{"user": Nullable(map[string]any{"name": ""})}},
+		{expr: `pet.barks or pet.meows`, types: map[string]any{"pet": OneOf(map[string]any{"barks": true}, map[string]any{"meows": true})}},
+		{expr: `tags[0].lower`, types: map[string]any{"tags": Nullable([]any{""})}},
+		{expr: `items where id > 1`, types: map[string]any{"items": Nullable([]any{map[string]any{"id": 1}})}},
+		{expr: `name > 1`, types: map[string]any{"name": Nullable("")}, err: "cannot compare string|null with number"},
+		{expr: `pet.purrs`, types: map[string]any{"pet": OneOf(map[string]any{"barks": true}, map[string]any{"meows": true})}, err: "no property purrs"},
+		{expr: `id > 1`, types: map[string]any{"id": OneOf(true, "a")}, err: "cannot compare boolean|string with number"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr, tc.types)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected error but found none")
+				}
+				if !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %s but found %s", tc.err, err.Pretty(tc.expr))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+		})
+	}
+}
+
+func TestTypeCheckThreeValued(t *testing.T) {
+	types := map[string]any{"x": 1, "y": true, "n": nil, "age": Nullable(1)}
+	cases := []struct {
+		expr   string
+		output string
+	}{
+		{expr: `x < 1`, output: "boolean"},
+		{expr: `x < n`, output: "null"},
+		{expr: `x == n`, output: "null"},
+		{expr: `x != n`, output: "null"},
+		{expr: `age > 18`, output: "boolean|null"},
+		{expr: `age == 18`, output: "boolean|null"},
+		{expr: `x < n and y`, output: "boolean|null"},
+		{expr: `age > 18 or y`, output: "boolean|null"},
+		{expr: `x > 1 and y`, output: "boolean"},
+		{expr: `not (x < n)`, output: "null"},
+		{expr: `not (age > 18)`, output: "boolean|null"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, err := Parse(tc.expr, types, ThreeValuedLogic, StrictTypes)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			i := newTypeChecker(ast, ThreeValuedLogic, StrictTypes)
+			i.root = types
+			result, err := i.run(ast, types)
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+			if result.String() != tc.output {
+				t.Fatalf("expected %s but found %s", tc.output, result)
+			}
+		})
+	}
+}
+
+func TestTypeCheckArrayItems(t *testing.T) {
+	type test struct {
+		expr  string
+		types map[string]any
+		err   string
+	}
+	mixed := []any{map[string]any{"id": 1}, map[string]any{"id": 2, "name": "b"}}
+	cases := []test{
+		{expr: `items where name startsWith "b"`, types: map[string]any{"items": mixed}},
+		{expr: `items[0].name.length > 0`, types: map[string]any{"items": mixed}},
+		{expr: `values where @ > 1`, types: map[string]any{"values": []any{"a", 1}}},
+		{expr: `nested[0][1] + 1`, types: map[string]any{"nested": []any{[]any{}, []any{1}}}},
+		{expr: `tags where @ startsWith "a"`, types: map[string]any{"tags": ArrayOf("")}},
+		{expr: `(users where age > 18).length`, types: map[string]any{"users": ArrayOf(map[string]any{"age": 1})}},
+		{expr: `items where missing`, types: map[string]any{"items": mixed}, err: "no property missing"},
+		{expr: `values > 1`, types: map[string]any{"values": []any{"a", 1}}, err: "cannot compare"},
+		{expr: `tags[0] + 1`, types: map[string]any{"tags": []any{}}},
+		{expr: `tags[0] > 1`, types: map[string]any{"tags": ArrayOf("")}, err: "cannot compare"},
+		{expr: `["a", 1][1] + 1 > 0`},
+		{expr: `[1, "a"][0] startsWith "a"`},
+		{expr: `[a, b][1].name.length > 0`, types: map[string]any{"a": map[string]any{"id": 1}, "b": map[string]any{"name": ""}}},
+		{expr: `[a, "b"][0] > 1`, types: map[string]any{"a": true}, err: "cannot compare boolean|string with number"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := Parse(tc.expr, tc.types)
+			if tc.err != "" {
+				if err == nil {
+					t.Fatal("expected error but found none")
+				}
+				if !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %s but found %s", tc.err, err.Pretty(tc.expr))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Pretty(tc.expr))
+			}
+		})
+	}
+}